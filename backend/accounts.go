@@ -0,0 +1,228 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// accountTypes are the kinds of account a user can create.
+var accountTypes = map[string]bool{
+	"checking":    true,
+	"savings":     true,
+	"credit_card": true,
+	"cash":        true,
+	"investment":  true,
+	"loan":        true,
+	"other":       true,
+}
+
+// ValidateAccount checks an account's fields, normalizes its currency code and
+// rounds its opening balance to that currency.
+func ValidateAccount(account *Account) error {
+	if account.AccountName == "" {
+		return fmt.Errorf("accountName is required")
+	}
+	if !accountTypes[account.AccountType] {
+		return fmt.Errorf("invalid accountType %q", account.AccountType)
+	}
+	account.Currency = strings.ToUpper(account.Currency)
+	if len(account.Currency) != 3 {
+		return fmt.Errorf("currency must be a three letter ISO 4217 code")
+	}
+	account.OpeningBalance = account.OpeningBalance.Round(account.Currency)
+	if account.OpeningDate == "" {
+		account.OpeningDate = time.Now().UTC().Format("2006-01-02")
+	}
+	if _, err := time.Parse("2006-01-02", account.OpeningDate); err != nil {
+		return fmt.Errorf("invalid openingDate, expected YYYY-MM-DD")
+	}
+	return nil
+}
+
+// requireAccount checks that an item booked against an account names one of
+// the workspace's accounts, and that an item with a currency is in the
+// account's currency, writing an error response if not. Items without an
+// accountId are not booked against any account and always pass.
+func requireAccount(w http.ResponseWriter, userId string, accountId string, currency string) bool {
+	if accountId == "" {
+		return true
+	}
+	account, err := GetAccount(userId, accountId)
+	if err != nil {
+		http.Error(w, "Failed to get account: "+err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	if account == nil {
+		http.Error(w, "Account not found: "+accountId, http.StatusNotFound)
+		return false
+	}
+	if currency != "" && currency != account.Currency {
+		http.Error(w, fmt.Sprintf("Currency %s does not match the %s of account %s", currency, account.Currency, account.AccountName), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// ValidateTransfer checks a transfer's fields and derives its month from its
+// date. ToAmount is only checked against the accounts' currencies by
+// ValidateTransferAccounts.
+func ValidateTransfer(transfer *Transfer) error {
+	if transfer.FromAccountId == "" || transfer.ToAccountId == "" {
+		return fmt.Errorf("fromAccountId and toAccountId are required")
+	}
+	if transfer.FromAccountId == transfer.ToAccountId {
+		return fmt.Errorf("cannot transfer to the same account")
+	}
+	if transfer.Amount <= 0 {
+		return fmt.Errorf("amount must be positive")
+	}
+	if transfer.ToAmount < 0 {
+		return fmt.Errorf("toAmount must be positive")
+	}
+	date, err := time.Parse("2006-01-02", transfer.Date)
+	if err != nil {
+		return fmt.Errorf("invalid date, expected YYYY-MM-DD")
+	}
+	transfer.Month = date.Format(monthLayout)
+	return nil
+}
+
+// ValidateTransferAccounts checks a transfer against the accounts it moves
+// money between. Amount is in the from account's currency. Between accounts
+// in different currencies, ToAmount is the amount that arrived in the to
+// account's currency and is required; between accounts in the same currency
+// it must be left out. Both amounts are rounded to their currencies.
+func ValidateTransferAccounts(transfer *Transfer, from Account, to Account) error {
+	transfer.Amount = transfer.Amount.Round(from.Currency)
+	if from.Currency == to.Currency {
+		if transfer.ToAmount != 0 && transfer.ToAmount.Round(to.Currency) != transfer.Amount {
+			return fmt.Errorf("toAmount is only used between accounts in different currencies")
+		}
+		transfer.ToAmount = 0
+		return nil
+	}
+	transfer.ToAmount = transfer.ToAmount.Round(to.Currency)
+	if transfer.ToAmount <= 0 {
+		return fmt.Errorf("toAmount in %s is required for a transfer from %s to %s", to.Currency, from.Currency, to.Currency)
+	}
+	return nil
+}
+
+// received is the amount a transfer added to its to account.
+func (transfer Transfer) received() Money {
+	if transfer.ToAmount != 0 {
+		return transfer.ToAmount
+	}
+	return transfer.Amount
+}
+
+// ComputeAccountBalances returns the running balance of an account for every
+// month from its opening month, or its earliest activity if that is earlier,
+// through toMonth. Income and transfers in raise the balance; expenses and
+// transfers out lower it, so a credit card carries a negative balance while
+// money is owed on it.
+func ComputeAccountBalances(account Account, income []IncomeItem, expenses []ExpenseItem, transfers []Transfer, toMonth string) ([]AccountBalance, error) {
+	byMonth := make(map[string]*AccountBalance)
+	entry := func(month string) *AccountBalance {
+		if byMonth[month] == nil {
+			byMonth[month] = &AccountBalance{Month: month}
+		}
+		return byMonth[month]
+	}
+
+	fromMonth := account.OpeningDate
+	if len(fromMonth) >= 7 {
+		fromMonth = fromMonth[:7]
+	}
+	earliest := func(month string) {
+		if month != "" && month < fromMonth {
+			fromMonth = month
+		}
+	}
+
+	for _, item := range income {
+		if item.AccountId == account.AccountId {
+			entry(item.Month).Income += item.IncomeItemValue
+			earliest(item.Month)
+		}
+	}
+	for _, item := range expenses {
+		if item.AccountId == account.AccountId {
+			entry(item.Month).Expenses += item.ExpenseValue
+			earliest(item.Month)
+		}
+	}
+	for _, transfer := range transfers {
+		if transfer.ToAccountId == account.AccountId {
+			entry(transfer.Month).TransfersIn += transfer.received()
+			earliest(transfer.Month)
+		}
+		if transfer.FromAccountId == account.AccountId {
+			entry(transfer.Month).TransfersOut += transfer.Amount
+			earliest(transfer.Month)
+		}
+	}
+
+	if toMonth < fromMonth {
+		toMonth = fromMonth
+	}
+	// An account's history is not capped like a requested range, since a
+	// balance needs every month since the account opened
+	months, err := monthRange(fromMonth, toMonth, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	balances := make([]AccountBalance, 0, len(months))
+	balance := account.OpeningBalance
+	for _, month := range months {
+		point := entry(month)
+		balance += point.Income + point.TransfersIn - point.Expenses - point.TransfersOut
+		point.Balance = balance
+		balances = append(balances, *point)
+	}
+	return balances, nil
+}
+
+// accountHasActivity reports whether any income, expense or transfer is
+// booked against an account. Such an account's currency cannot change, since
+// the amounts already booked are in the old one.
+func accountHasActivity(accountId string, income []IncomeItem, expenses []ExpenseItem, transfers []Transfer) bool {
+	for _, item := range income {
+		if item.AccountId == accountId {
+			return true
+		}
+	}
+	for _, item := range expenses {
+		if item.AccountId == accountId {
+			return true
+		}
+	}
+	for _, transfer := range transfers {
+		if transfer.FromAccountId == accountId || transfer.ToAccountId == accountId {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadAccountBalances reads everything booked against an account and computes
+// its running balance through toMonth. The user's items are read month by
+// month from their partitions.
+func LoadAccountBalances(account Account, toMonth string) ([]AccountBalance, error) {
+	income, err := GetAllUserIncome(account.UserId)
+	if err != nil {
+		return nil, err
+	}
+	expenses, err := GetAllUserExpenses(account.UserId)
+	if err != nil {
+		return nil, err
+	}
+	transfers, err := GetAllUserTransfers(account.UserId)
+	if err != nil {
+		return nil, err
+	}
+	return ComputeAccountBalances(account, income, expenses, transfers, toMonth)
+}
@@ -0,0 +1,99 @@
+package main
+
+import "testing"
+
+func TestValidateTransferAccounts(t *testing.T) {
+	usd := Account{AccountId: "usd", Currency: "USD"}
+	eur := Account{AccountId: "eur", Currency: "EUR"}
+	jpy := Account{AccountId: "jpy", Currency: "JPY"}
+
+	tests := []struct {
+		name     string
+		transfer Transfer
+		from, to Account
+		wantErr  bool
+		wantTo   Money
+	}{
+		{"same currency", Transfer{Amount: 100000}, usd, usd, false, 0},
+		{"same currency with matching toAmount", Transfer{Amount: 100000, ToAmount: 100000}, usd, usd, false, 0},
+		{"same currency with different toAmount", Transfer{Amount: 100000, ToAmount: 90000}, usd, usd, true, 0},
+		{"different currencies", Transfer{Amount: 100000, ToAmount: 92345}, usd, eur, false, 92300},
+		{"different currencies rounded to yen", Transfer{Amount: 100000, ToAmount: 1494567}, usd, jpy, false, 1490000},
+		{"different currencies without toAmount", Transfer{Amount: 100000}, usd, eur, true, 0},
+	}
+	for _, test := range tests {
+		transfer := test.transfer
+		err := ValidateTransferAccounts(&transfer, test.from, test.to)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: error %v, want error %v", test.name, err, test.wantErr)
+			continue
+		}
+		if err == nil && transfer.ToAmount != test.wantTo {
+			t.Errorf("%s: toAmount %s, want %s", test.name, transfer.ToAmount, test.wantTo)
+		}
+	}
+}
+
+func TestComputeAccountBalances(t *testing.T) {
+	checking := Account{AccountId: "checking", Currency: "USD", OpeningBalance: 1000000, OpeningDate: "2024-01-15"}
+	income := []IncomeItem{
+		{IncomeItemName: "salary", Month: "2024-01", IncomeItemValue: 5000000, AccountId: "checking"},
+		{IncomeItemName: "other", Month: "2024-01", IncomeItemValue: 9990000, AccountId: "savings"},
+	}
+	expenses := []ExpenseItem{
+		{ExpenseItemName: "rent", Month: "2024-02", ExpenseValue: 2000000, AccountId: "checking"},
+	}
+	transfers := []Transfer{
+		{Month: "2024-02", FromAccountId: "checking", ToAccountId: "travel", Amount: 1000000, ToAmount: 920000},
+		{Month: "2024-03", FromAccountId: "travel", ToAccountId: "checking", Amount: 460000, ToAmount: 500000},
+	}
+
+	balances, err := ComputeAccountBalances(checking, income, expenses, transfers, "2024-03")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Money{6000000, 3000000, 3500000}
+	if len(balances) != len(want) {
+		t.Fatalf("got %d months, want %d", len(balances), len(want))
+	}
+	for i, balance := range balances {
+		if balance.Balance != want[i] {
+			t.Errorf("%s: balance %s, want %s", balance.Month, balance.Balance, want[i])
+		}
+	}
+}
+
+func TestComputeAccountBalancesLongHistory(t *testing.T) {
+	account := Account{AccountId: "savings", Currency: "USD", OpeningBalance: 10000, OpeningDate: "1990-06-01"}
+	balances, err := ComputeAccountBalances(account, nil, nil, nil, "2024-06")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(balances) != 34*12+1 {
+		t.Errorf("got %d months, want %d", len(balances), 34*12+1)
+	}
+}
+
+func TestAccountHasActivity(t *testing.T) {
+	income := []IncomeItem{{IncomeItemName: "salary", Month: "2024-01", AccountId: "checking"}}
+	expenses := []ExpenseItem{{ExpenseItemName: "groceries", Month: "2024-01", AccountId: "card"}}
+	transfers := []Transfer{{TransferId: "t1", FromAccountId: "checking", ToAccountId: "savings"}}
+
+	tests := []struct {
+		accountId string
+		active    bool
+	}{
+		{"checking", true},
+		{"card", true},
+		{"savings", true},
+		{"brokerage", false},
+	}
+	for _, test := range tests {
+		if got := accountHasActivity(test.accountId, income, expenses, transfers); got != test.active {
+			t.Errorf("%s: got %v, want %v", test.accountId, got, test.active)
+		}
+	}
+	if accountHasActivity("checking", nil, nil, nil) {
+		t.Error("expected no activity without items")
+	}
+}
@@ -0,0 +1,411 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/google/uuid"
+)
+
+// Types of alert rule.
+const (
+	AlertBudgetPercent = "budget_percent"
+	AlertExpenseOver   = "expense_over"
+	AlertIncomeMissing = "income_missing"
+)
+
+// InboxChannel is the channel every notification goes to: the notifications
+// table, read through the inbox endpoints.
+const InboxChannel = "inbox"
+
+// NotificationChannel delivers notifications somewhere outside the inbox,
+// such as email. Channels are registered by name and rules list the names
+// of the channels they are sent to.
+type NotificationChannel interface {
+	Name() string
+	Send(notification Notification) error
+}
+
+var notificationChannels = make(map[string]NotificationChannel)
+
+// RegisterNotificationChannel makes a channel available to alert rules,
+// replacing any channel of the same name.
+func RegisterNotificationChannel(channel NotificationChannel) {
+	notificationChannels[channel.Name()] = channel
+}
+
+func init() {
+	RegisterNotificationChannel(logChannel{})
+	RegisterNotificationChannel(emailChannel{})
+}
+
+// logChannel writes notifications to the server log.
+type logChannel struct{}
+
+func (logChannel) Name() string { return "log" }
+
+func (logChannel) Send(notification Notification) error {
+	log.Printf("Notification for %s: %s: %s", notification.UserId, notification.Title, notification.Message)
+	return nil
+}
+
+// ValidateAlertRule checks a rule's fields for its type and the channels it
+// is sent to. Every rule goes to the inbox.
+func ValidateAlertRule(rule *AlertRule) error {
+	rule.RuleName = strings.TrimSpace(rule.RuleName)
+	switch rule.Type {
+	case AlertBudgetPercent:
+		rule.BudgetItemName = strings.TrimSpace(rule.BudgetItemName)
+		if rule.BudgetItemName == "" {
+			return fmt.Errorf("budgetItemName is required")
+		}
+		if rule.Percent <= 0 || rule.Percent > 1000 {
+			return fmt.Errorf("percent must be between 0 and 1000")
+		}
+		if rule.RuleName == "" {
+			rule.RuleName = fmt.Sprintf("%s at %g%%", rule.BudgetItemName, rule.Percent)
+		}
+	case AlertExpenseOver:
+		if rule.Amount <= 0 {
+			return fmt.Errorf("amount must be positive")
+		}
+		if rule.RuleName == "" {
+			rule.RuleName = "Expenses over " + rule.Amount.String()
+		}
+	case AlertIncomeMissing:
+		rule.IncomeItemName = strings.TrimSpace(rule.IncomeItemName)
+		if rule.IncomeItemName == "" {
+			return fmt.Errorf("incomeItemName is required")
+		}
+		if rule.Day < 1 || rule.Day > 31 {
+			return fmt.Errorf("day must be between 1 and 31")
+		}
+		if rule.RuleName == "" {
+			rule.RuleName = fmt.Sprintf("%s missing by day %d", rule.IncomeItemName, rule.Day)
+		}
+	default:
+		return fmt.Errorf("invalid type %q, expected budget_percent, expense_over or income_missing", rule.Type)
+	}
+
+	channels := []string{InboxChannel}
+	seen := map[string]bool{InboxChannel: true}
+	for _, name := range rule.Channels {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if seen[name] {
+			continue
+		}
+		if _, ok := notificationChannels[name]; !ok {
+			return fmt.Errorf("unknown channel %q", name)
+		}
+		seen[name] = true
+		channels = append(channels, name)
+	}
+	rule.Channels = channels
+	return nil
+}
+
+// CheckAlertRules returns a notification for every enabled rule whose
+// condition holds in a month. Expenses are compared in the base currency at
+// the rate on their date and are left out when there is no rate. Income is
+// only missing once the rule's day has passed, or the last day of a shorter
+// month.
+func CheckAlertRules(rules []AlertRule, month string, report CurrencyReport, income []IncomeItem, expenses []ExpenseItem, rates *RateTable, now time.Time) []Notification {
+	base := report.BaseCurrency
+	notifications := []Notification{}
+	notify := func(rule AlertRule, subject string, title string, message string) {
+		notifications = append(notifications, Notification{
+			UserId:   rule.UserId,
+			RuleId:   rule.RuleId,
+			Type:     rule.Type,
+			Month:    month,
+			Title:    title,
+			Message:  message,
+			DedupKey: rule.RuleId + "#" + month + "#" + subject,
+		})
+	}
+
+	for _, rule := range rules {
+		if rule.Disabled {
+			continue
+		}
+		switch rule.Type {
+		case AlertBudgetPercent:
+			for _, line := range report.Budgets {
+				if !strings.EqualFold(line.BudgetItemName, rule.BudgetItemName) || line.Budget <= 0 {
+					continue
+				}
+				percent := line.Spent.Float64() / line.Budget.Float64() * 100
+				if percent < rule.Percent {
+					continue
+				}
+				notify(rule, strings.ToLower(line.BudgetItemName),
+					fmt.Sprintf("%s budget at %.0f%%", line.BudgetItemName, percent),
+					fmt.Sprintf("%s %s spent of the %s %s budgeted for %s in %s",
+						line.Spent.Format(base), base, line.Budget.Format(base), base, line.BudgetItemName, month))
+			}
+
+		case AlertExpenseOver:
+			for _, item := range expenses {
+				currency := item.Currency
+				if currency == "" {
+					currency = base
+				}
+				value, ok := rates.Convert(item.ExpenseValue, currency, base, itemDate(item.Date, item.Month))
+				if !ok || value <= rule.Amount {
+					continue
+				}
+				notify(rule, item.ExpenseItemName,
+					fmt.Sprintf("%s is over %s %s", expenseDescription(item), rule.Amount.Format(base), base),
+					fmt.Sprintf("%s of %s %s was recorded in %s",
+						expenseDescription(item), item.ExpenseValue.Format(currency), currency, month))
+			}
+
+		case AlertIncomeMissing:
+			start, err := parseMonth(month)
+			if err != nil {
+				continue
+			}
+			day := rule.Day
+			if last := start.AddDate(0, 1, -1).Day(); day > last {
+				day = last
+			}
+			if now.Before(start.AddDate(0, 0, day)) {
+				continue
+			}
+			key := merchantKey(rule.IncomeItemName)
+			received := false
+			for _, item := range income {
+				if merchantKey(item.IncomeItemName) == key || (item.Payer != "" && merchantKey(item.Payer) == key) {
+					received = true
+					break
+				}
+			}
+			if received {
+				continue
+			}
+			notify(rule, key,
+				fmt.Sprintf("%s has not arrived", rule.IncomeItemName),
+				fmt.Sprintf("No income from %s was recorded in %s by day %d", rule.IncomeItemName, month, day))
+		}
+	}
+	return notifications
+}
+
+// EvaluateAlerts checks a workspace's alert rules against a month's data and
+// raises the notifications that have not been raised before. Each is stored
+// in the inbox and sent to the rule's other channels; a channel that fails is
+// logged and left out of the notification's delivered list.
+func EvaluateAlerts(userId string, month string, now time.Time) ([]Notification, error) {
+	rules, err := GetAllAlertRules(userId)
+	if err != nil {
+		return nil, err
+	}
+	if len(rules) == 0 {
+		return []Notification{}, nil
+	}
+
+	settings, err := GetUserSettings(userId)
+	if err != nil {
+		return nil, err
+	}
+	rates, err := GetAllExchangeRates(userId)
+	if err != nil {
+		return nil, err
+	}
+	rateTable := NewRateTable(rates)
+	income, err := GetAllIncome(userId, month)
+	if err != nil {
+		return nil, err
+	}
+	budget, err := GetAllBudget(userId, month)
+	if err != nil {
+		return nil, err
+	}
+	expenses, err := GetAllExpenses(userId, month)
+	if err != nil {
+		return nil, err
+	}
+	report := BuildCurrencyReport(month, settings.BaseCurrency, rateTable, income, budget, expenses)
+
+	existing, err := GetAllNotifications(userId)
+	if err != nil {
+		return nil, err
+	}
+	raised := make(map[string]bool)
+	for _, notification := range existing {
+		raised[notification.DedupKey] = true
+	}
+	channels := make(map[string][]string)
+	for _, rule := range rules {
+		channels[rule.RuleId] = rule.Channels
+	}
+
+	notifications := []Notification{}
+	for _, notification := range CheckAlertRules(rules, month, report, income, expenses, rateTable, now) {
+		if raised[notification.DedupKey] {
+			continue
+		}
+		raised[notification.DedupKey] = true
+		notification.NotificationId = uuid.New().String()
+		notification.CreatedAt = now.UTC().Format(time.RFC3339)
+		notification.Delivered = deliverNotification(notification, channels[notification.RuleId])
+		if err := AddNotification(notification); err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, notification)
+	}
+	sort.Slice(notifications, func(i, j int) bool { return notifications[i].DedupKey < notifications[j].DedupKey })
+	return notifications, nil
+}
+
+// deliverNotification sends a notification to each of the named channels and
+// returns the ones that took it, starting with the inbox.
+func deliverNotification(notification Notification, names []string) []string {
+	delivered := []string{InboxChannel}
+	for _, name := range names {
+		if name == InboxChannel {
+			continue
+		}
+		channel, ok := notificationChannels[name]
+		if !ok {
+			log.Printf("Notification %s: channel %q is not registered", notification.NotificationId, name)
+			continue
+		}
+		if err := channel.Send(notification); err != nil {
+			log.Printf("Notification %s: sending to %s failed: %v", notification.NotificationId, name, err)
+			continue
+		}
+		delivered = append(delivered, name)
+	}
+	return delivered
+}
+
+// alertQueueSize is how many workspace months can wait to be evaluated. Any
+// more are dropped and left to the evaluate-alerts command.
+const alertQueueSize = 256
+
+// alertChecks holds the workspace months waiting for their alert rules to be
+// evaluated. A single worker evaluates them in turn, so that requests do not
+// wait on the rules or on channels such as email, and two evaluations of a
+// workspace never race to raise the same notification.
+var (
+	alertChecks      = make(chan [2]string, alertQueueSize)
+	alertChecksMu    sync.Mutex
+	alertChecksQueue = make(map[[2]string]bool)
+	alertWorker      sync.Once
+)
+
+// NotifyAlerts queues the alert rules to be evaluated after a change to a
+// month's data. A month already waiting is not queued twice. The change has
+// already been saved, so failures are logged rather than returned.
+func NotifyAlerts(userId string, month string) {
+	alertWorker.Do(func() { go evaluateAlertChecks() })
+
+	check := [2]string{userId, month}
+	alertChecksMu.Lock()
+	defer alertChecksMu.Unlock()
+	if alertChecksQueue[check] {
+		return
+	}
+	select {
+	case alertChecks <- check:
+		alertChecksQueue[check] = true
+	default:
+		log.Printf("Evaluating alerts for %s in %s skipped: the queue is full", userId, month)
+	}
+}
+
+func evaluateAlertChecks() {
+	for check := range alertChecks {
+		alertChecksMu.Lock()
+		delete(alertChecksQueue, check)
+		alertChecksMu.Unlock()
+
+		userId, month := check[0], check[1]
+		if _, err := EvaluateAlerts(userId, month, time.Now().UTC()); err != nil {
+			log.Printf("Evaluating alerts for %s in %s failed: %v", userId, month, err)
+		}
+	}
+}
+
+// AlertRunResult reports what EvaluateAllAlerts raised.
+type AlertRunResult struct {
+	Month      string   `json:"month"`
+	Workspaces int      `json:"workspaces"`
+	Raised     int      `json:"raised"`
+	Failed     []string `json:"failed"`
+}
+
+// EvaluateAllAlerts evaluates the alert rules of every workspace that has
+// any against a month. It catches the rules no change sets off, such as
+// income that has not arrived by its day, and can be run again safely since
+// a notification is only raised once.
+func EvaluateAllAlerts(month string, now time.Time) (*AlertRunResult, error) {
+	if _, err := parseMonth(month); err != nil {
+		return nil, err
+	}
+	result := &AlertRunResult{Month: month, Failed: []string{}}
+
+	workspaces := make(map[string]bool)
+	var order []string
+	err := ScanAllItems("AlertRules", func(item map[string]*dynamodb.AttributeValue) error {
+		var rule AlertRule
+		if err := dynamodbattribute.UnmarshalMap(item, &rule); err != nil {
+			return fmt.Errorf("failed to unmarshal AlertRules item: %v", err)
+		}
+		if !workspaces[rule.UserId] {
+			workspaces[rule.UserId] = true
+			order = append(order, rule.UserId)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, userId := range order {
+		result.Workspaces++
+		notifications, err := EvaluateAlerts(userId, month, now)
+		if err != nil {
+			result.Failed = append(result.Failed, fmt.Sprintf("%s: %v", userId, err))
+			continue
+		}
+		result.Raised += len(notifications)
+	}
+	return result, nil
+}
+
+// EvaluateAlertsCommand implements the "evaluate-alerts" admin command,
+// meant to be run on a schedule:
+//
+//	backend evaluate-alerts [-month YYYY-MM]
+func EvaluateAlertsCommand(args []string) int {
+	now := time.Now().UTC()
+	flags := flag.NewFlagSet("evaluate-alerts", flag.ContinueOnError)
+	month := flags.String("month", now.Format(monthLayout), "month to evaluate the rules against")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	result, err := EvaluateAllAlerts(*month, now)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "evaluate-alerts: %v\n", err)
+		return 1
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(result)
+	if len(result.Failed) > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestCheckAlertRules(t *testing.T) {
+	month := "2024-03"
+	rates := NewRateTable([]ExchangeRate{{FromCurrency: "EUR", ToCurrency: "USD", Rate: 1.1, Date: "2024-03-01"}})
+	budget := []BudgetItem{
+		{BudgetItemName: "Groceries", BudgetItemValue: 4000000, Currency: "USD"},
+		{BudgetItemName: "Fun", BudgetItemValue: 1000000, Currency: "USD"},
+	}
+	expenses := []ExpenseItem{
+		// Unsplit, so it counts towards its first tag
+		{ExpenseItemName: "market", Month: month, Date: "2024-03-04", ExpenseValue: 3400000, Currency: "USD", ExpenseTags: []string{"groceries", "weekly"}},
+		{ExpenseItemName: "concert", Month: month, Date: "2024-03-09", ExpenseValue: 4000000, Currency: "EUR", ExpenseTags: []string{"fun"}},
+		{ExpenseItemName: "museum", Month: month, Date: "2024-03-10", ExpenseValue: 200000, Currency: "GBP", ExpenseTags: []string{"fun"}},
+	}
+	income := []IncomeItem{{IncomeItemName: "Salary", Month: month, IncomeItemValue: 50000000, Currency: "USD"}}
+	report := BuildCurrencyReport(month, "USD", rates, income, budget, expenses)
+
+	rules := []AlertRule{
+		{RuleId: "groceries", Type: AlertBudgetPercent, BudgetItemName: "groceries", Percent: 80},
+		{RuleId: "fun", Type: AlertBudgetPercent, BudgetItemName: "Fun", Percent: 150},
+		{RuleId: "large", Type: AlertExpenseOver, Amount: 3500000},
+		{RuleId: "salary", Type: AlertIncomeMissing, IncomeItemName: "salary", Day: 5},
+		{RuleId: "bonus", Type: AlertIncomeMissing, IncomeItemName: "Bonus", Day: 31},
+		{RuleId: "off", Type: AlertExpenseOver, Amount: 1, Disabled: true},
+	}
+
+	tests := []struct {
+		name string
+		now  time.Time
+		want []string
+	}{
+		{
+			"before the end of the month",
+			time.Date(2024, 3, 20, 0, 0, 0, 0, time.UTC),
+			[]string{"fun#2024-03#fun", "groceries#2024-03#groceries", "large#2024-03#concert"},
+		},
+		{
+			"after the last day",
+			time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC),
+			[]string{"bonus#2024-03#bonus", "fun#2024-03#fun", "groceries#2024-03#groceries", "large#2024-03#concert"},
+		},
+	}
+	for _, test := range tests {
+		var got []string
+		for _, notification := range CheckAlertRules(rules, month, report, income, expenses, rates, test.now) {
+			got = append(got, notification.DedupKey)
+		}
+		sort.Strings(got)
+		if len(got) != len(test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+				break
+			}
+		}
+	}
+}
+
+func TestValidateAlertRule(t *testing.T) {
+	rule := AlertRule{Type: AlertBudgetPercent, BudgetItemName: " Groceries ", Percent: 80, Channels: []string{"LOG", "log", "inbox"}}
+	if err := ValidateAlertRule(&rule); err != nil {
+		t.Fatal(err)
+	}
+	if rule.RuleName != "Groceries at 80%" || len(rule.Channels) != 2 || rule.Channels[0] != InboxChannel || rule.Channels[1] != "log" {
+		t.Errorf("rule not normalized: %+v", rule)
+	}
+
+	invalid := []AlertRule{
+		{Type: AlertBudgetPercent, BudgetItemName: "Groceries"},
+		{Type: AlertExpenseOver},
+		{Type: AlertIncomeMissing, IncomeItemName: "Salary", Day: 32},
+		{Type: AlertExpenseOver, Amount: 1, Channels: []string{"pager"}},
+		{Type: "weekly"},
+	}
+	for _, rule := range invalid {
+		if err := ValidateAlertRule(&rule); err == nil {
+			t.Errorf("%+v: expected an error", rule)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Ways of grouping spending in a trend report.
+const (
+	TrendByCategory = "category"
+	TrendByTag      = "tag"
+)
+
+// trendLookback returns how many months before the range a trend report
+// needs: a year for the year-over-year deltas, and enough for the first
+// rolling average to cover a full window.
+func trendLookback(window int) int {
+	if window-1 > 12 {
+		return window - 1
+	}
+	return 12
+}
+
+// BuildTrendReport builds spending series from monthly currency reports,
+// which must cover the range and the trendLookback months before it. Months
+// missing from reports count as no spending.
+func BuildTrendReport(from string, to string, groupBy string, window int, top int, base string, reports map[string]CurrencyReport) (*TrendReport, error) {
+	if groupBy != TrendByCategory && groupBy != TrendByTag {
+		return nil, fmt.Errorf("invalid groupBy %q, expected category or tag", groupBy)
+	}
+	if window < 1 {
+		return nil, fmt.Errorf("window must be at least 1")
+	}
+	months, err := monthsBetween(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &TrendReport{
+		From:         from,
+		To:           to,
+		GroupBy:      groupBy,
+		BaseCurrency: base,
+		Window:       window,
+		Series:       []TrendSeries{},
+		TopMovers:    []TrendMover{},
+		MissingRates: []string{},
+	}
+
+	amounts := func(month string) map[string]Money {
+		if groupBy == TrendByTag {
+			return reports[month].ExpensesByTag
+		}
+		return reports[month].ExpensesByCategory
+	}
+	keys := make(map[string]bool)
+	missing := make(map[string]bool)
+	for _, month := range months {
+		for key := range amounts(month) {
+			keys[key] = true
+		}
+		for _, rate := range reports[month].MissingRates {
+			if !missing[rate] {
+				missing[rate] = true
+				report.MissingRates = append(report.MissingRates, rate)
+			}
+		}
+	}
+
+	report.Totals = trendPoints(months, window, base, func(month string) Money {
+		return reports[month].Expenses
+	})
+	for key := range keys {
+		series := TrendSeries{Key: key}
+		series.Points = trendPoints(months, window, base, func(month string) Money {
+			return amounts(month)[key]
+		})
+		for _, point := range series.Points {
+			series.Total += point.Amount
+		}
+		report.Series = append(report.Series, series)
+	}
+	sort.Slice(report.Series, func(i, j int) bool {
+		if report.Series[i].Total != report.Series[j].Total {
+			return report.Series[i].Total > report.Series[j].Total
+		}
+		return report.Series[i].Key < report.Series[j].Key
+	})
+
+	// Top movers compare the last month of the range with the one before it
+	for _, series := range report.Series {
+		last := series.Points[len(series.Points)-1]
+		if last.MoM == 0 {
+			continue
+		}
+		report.TopMovers = append(report.TopMovers, TrendMover{
+			Key:           series.Key,
+			Current:       last.Amount,
+			Previous:      last.Amount - last.MoM,
+			Change:        last.MoM,
+			ChangePercent: last.MoMPercent,
+		})
+	}
+	sort.SliceStable(report.TopMovers, func(i, j int) bool {
+		a, b := report.TopMovers[i].Change, report.TopMovers[j].Change
+		if a < 0 {
+			a = -a
+		}
+		if b < 0 {
+			b = -b
+		}
+		return a > b
+	})
+	if top >= 0 && len(report.TopMovers) > top {
+		report.TopMovers = report.TopMovers[:top]
+	}
+	return report, nil
+}
+
+// trendPoints computes the points of one series over months, reading the
+// months before the range for the deltas and rolling averages.
+func trendPoints(months []string, window int, base string, amount func(month string) Money) []TrendPoint {
+	points := make([]TrendPoint, 0, len(months))
+	for _, month := range months {
+		point := TrendPoint{Month: month, Amount: amount(month)}
+
+		previousMonth, _ := addMonths(month, -1)
+		previous := amount(previousMonth)
+		point.MoM = point.Amount - previous
+		point.MoMPercent = percentChange(point.Amount, previous)
+
+		lastYear, _ := addMonths(month, -12)
+		yearAgo := amount(lastYear)
+		point.YoY = point.Amount - yearAgo
+		point.YoYPercent = percentChange(point.Amount, yearAgo)
+
+		var sum Money
+		for i := 0; i < window; i++ {
+			earlier, _ := addMonths(month, -i)
+			sum += amount(earlier)
+		}
+		point.RollingAverage = sum.Div(window, base)
+		points = append(points, point)
+	}
+	return points
+}
+
+// percentChange returns the change from one amount to another as a
+// percentage with one decimal, or nil if there is nothing to compare with.
+func percentChange(current Money, previous Money) *float64 {
+	if previous == 0 {
+		return nil
+	}
+	percent := math.Round((current-previous).Float64()/math.Abs(previous.Float64())*1000) / 10
+	return &percent
+}
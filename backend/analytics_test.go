@@ -0,0 +1,146 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestPercentChange(t *testing.T) {
+	tests := []struct {
+		current, previous Money
+		want              *float64
+	}{
+		{1500000, 1000000, floatPtr(50)},
+		{500000, 1000000, floatPtr(-50)},
+		{1000000, 1000000, floatPtr(0)},
+		{1000000, 0, nil},
+		{0, 0, nil},
+		// A refund month is compared by its size, so moving up from it is
+		// still an increase
+		{500000, -1000000, floatPtr(150)},
+		{-2000000, -1000000, floatPtr(-100)},
+		{1, 3, floatPtr(-66.7)},
+	}
+	for _, test := range tests {
+		got := percentChange(test.current, test.previous)
+		if (got == nil) != (test.want == nil) || (got != nil && *got != *test.want) {
+			t.Errorf("percentChange(%d, %d) = %v, want %v", test.current, test.previous, deref(got), deref(test.want))
+		}
+	}
+}
+
+func floatPtr(f float64) *float64 { return &f }
+
+func deref(f *float64) interface{} {
+	if f == nil {
+		return nil
+	}
+	return *f
+}
+
+func TestTrendPoints(t *testing.T) {
+	amounts := map[string]Money{
+		"2023-01": 800000,
+		"2023-10": 300000,
+		"2023-11": 600000,
+		"2023-12": 900000,
+		"2024-01": 1200000,
+		"2024-02": 1000000,
+		// 2024-03 has no spending
+	}
+	points := trendPoints([]string{"2024-01", "2024-02", "2024-03"}, 3, "USD", func(month string) Money {
+		return amounts[month]
+	})
+
+	tests := []struct {
+		month          string
+		amount         Money
+		mom            Money
+		momPercent     *float64
+		yoy            Money
+		yoyPercent     *float64
+		rollingAverage Money
+	}{
+		// The window reaches back into the lookback months
+		{"2024-01", 1200000, 300000, floatPtr(33.3), 400000, floatPtr(50), 900000},
+		{"2024-02", 1000000, -200000, floatPtr(-16.7), 1000000, nil, 1033300},
+		{"2024-03", 0, -1000000, floatPtr(-100), 0, nil, 733300},
+	}
+	if len(points) != len(tests) {
+		t.Fatalf("got %d points, want %d", len(points), len(tests))
+	}
+	for i, test := range tests {
+		point := points[i]
+		if point.Month != test.month || point.Amount != test.amount || point.MoM != test.mom || point.YoY != test.yoy || point.RollingAverage != test.rollingAverage {
+			t.Errorf("%s: got %+v", test.month, point)
+		}
+		if deref(point.MoMPercent) != deref(test.momPercent) || deref(point.YoYPercent) != deref(test.yoyPercent) {
+			t.Errorf("%s: got percentages %v and %v, want %v and %v", test.month,
+				deref(point.MoMPercent), deref(point.YoYPercent), deref(test.momPercent), deref(test.yoyPercent))
+		}
+	}
+
+	// A one-month window is the month itself
+	single := trendPoints([]string{"2024-02"}, 1, "USD", func(month string) Money { return amounts[month] })
+	if single[0].RollingAverage != 1000000 {
+		t.Errorf("one-month window: got %d", single[0].RollingAverage)
+	}
+}
+
+func TestBuildTrendReport(t *testing.T) {
+	report := func(expenses Money, byCategory map[string]Money, missing ...string) CurrencyReport {
+		return CurrencyReport{Expenses: expenses, ExpensesByCategory: byCategory, ExpensesByTag: map[string]Money{"all": expenses}, MissingRates: missing}
+	}
+	reports := map[string]CurrencyReport{
+		"2023-03": report(500000, map[string]Money{"groceries": 500000}),
+		"2024-02": report(1500000, map[string]Money{"groceries": 1000000, "dining": 500000}),
+		"2024-03": report(2300000, map[string]Money{"groceries": 800000, "dining": 1200000, "travel": 300000}, "GBP/USD@2024-03-31"),
+	}
+
+	trend, err := BuildTrendReport("2024-02", "2024-03", TrendByCategory, 2, 2, "USD", reports)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var keys []string
+	for _, series := range trend.Series {
+		keys = append(keys, series.Key)
+	}
+	if len(keys) != 3 || keys[0] != "groceries" || keys[1] != "dining" || keys[2] != "travel" {
+		t.Errorf("got series %v, want groceries, dining and travel by total", keys)
+	}
+
+	last := trend.Totals[len(trend.Totals)-1]
+	if last.Amount != 2300000 || last.MoM != 800000 || last.YoY != 1800000 || last.RollingAverage != 1900000 {
+		t.Errorf("got totals %+v", last)
+	}
+
+	// The biggest changes in the last month, whichever their direction
+	if len(trend.TopMovers) != 2 || trend.TopMovers[0].Key != "dining" || trend.TopMovers[1].Key != "travel" {
+		t.Fatalf("got top movers %+v", trend.TopMovers)
+	}
+	if mover := trend.TopMovers[0]; mover.Current != 1200000 || mover.Previous != 500000 || mover.Change != 700000 || deref(mover.ChangePercent) != 140.0 {
+		t.Errorf("got %+v", mover)
+	}
+	if trend.TopMovers[1].ChangePercent != nil {
+		t.Errorf("travel had no spending before, got %v", deref(trend.TopMovers[1].ChangePercent))
+	}
+
+	if len(trend.MissingRates) != 1 || trend.MissingRates[0] != "GBP/USD@2024-03-31" {
+		t.Errorf("got missing rates %v", trend.MissingRates)
+	}
+
+	byTag, err := BuildTrendReport("2024-02", "2024-03", TrendByTag, 1, -1, "USD", reports)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(byTag.Series) != 1 || byTag.Series[0].Key != "all" || byTag.Series[0].Total != 3800000 {
+		t.Errorf("got %+v", byTag.Series)
+	}
+
+	if _, err := BuildTrendReport("2024-02", "2024-03", "merchant", 1, 5, "USD", reports); err == nil {
+		t.Error("expected an error for an unknown groupBy")
+	}
+	if _, err := BuildTrendReport("2024-02", "2024-03", TrendByCategory, 0, 5, "USD", reports); err == nil {
+		t.Error("expected an error for a window of 0")
+	}
+}
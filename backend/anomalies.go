@@ -0,0 +1,348 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Kinds of anomaly.
+const (
+	AnomalyMerchantAmount = "merchant_amount"
+	AnomalyTagAmount      = "tag_amount"
+	AnomalyNewMerchant    = "new_merchant"
+	AnomalyCategorySpike  = "category_spike"
+)
+
+const (
+	// anomalyHistoryMonths is how many months before an expense's month its
+	// baselines are drawn from
+	anomalyHistoryMonths = 12
+	// anomalyThreshold is how many standard deviations above its baseline an
+	// amount must be to be flagged
+	anomalyThreshold = 3.0
+	// anomalyMinSamples is how many past amounts a baseline needs
+	anomalyMinSamples = 3
+	// newMerchantMinHistory is how many past expenses are needed before a
+	// charge from a merchant never seen before can be called large
+	newMerchantMinHistory = 10
+	// newMerchantFactor is how many times the typical expense a first charge
+	// from a merchant must be to be flagged
+	newMerchantFactor = 3.0
+)
+
+// anomalyBaseline summarizes past amounts.
+type anomalyBaseline struct {
+	count  int
+	mean   float64
+	stddev float64
+}
+
+func newAnomalyBaseline(amounts []float64) anomalyBaseline {
+	baseline := anomalyBaseline{count: len(amounts)}
+	if len(amounts) == 0 {
+		return baseline
+	}
+	for _, amount := range amounts {
+		baseline.mean += amount
+	}
+	baseline.mean /= float64(len(amounts))
+	for _, amount := range amounts {
+		baseline.stddev += (amount - baseline.mean) * (amount - baseline.mean)
+	}
+	baseline.stddev = math.Sqrt(baseline.stddev / float64(len(amounts)))
+	return baseline
+}
+
+// score returns how many standard deviations an amount is above the mean.
+// The deviation is taken as at least a tenth of the mean, so that a
+// baseline of identical amounts does not flag every small change.
+func (b anomalyBaseline) score(amount float64) float64 {
+	spread := math.Max(b.stddev, math.Max(b.mean/10, 0.01))
+	return math.Round((amount-b.mean)/spread*10) / 10
+}
+
+// merchantKey normalizes a merchant name so that the same merchant matches
+// however the bank spelled it.
+func merchantKey(merchant string) string {
+	return strings.Join(normalizeName(merchant), " ")
+}
+
+// expenseBefore reports whether expense a was made before expense b: by
+// date when both have one, and otherwise by month.
+func expenseBefore(a ExpenseItem, b ExpenseItem) bool {
+	if a.Date != "" && b.Date != "" {
+		return a.Date < b.Date
+	}
+	return a.Month < b.Month
+}
+
+// categoryAmounts totals an expense's lines by category, lower-cased. Lines
+// without a category are left out.
+func categoryAmounts(item ExpenseItem) map[string]Money {
+	amounts := make(map[string]Money)
+	for _, line := range expenseLines(item) {
+		category := strings.ToLower(strings.TrimSpace(line.Category))
+		if category != "" {
+			amounts[category] += line.Amount
+		}
+	}
+	return amounts
+}
+
+// ScoreExpense compares an expense with the baselines of its merchant and
+// categories in the expenses of the same currency made before it, and flags
+// a large first charge from a merchant never seen before. Categories are
+// those of the split lines, as in reports.
+func ScoreExpense(item ExpenseItem, history []ExpenseItem) []ExpenseAnomaly {
+	anomalies := []ExpenseAnomaly{}
+	if item.ExpenseValue <= 0 {
+		return anomalies
+	}
+	amount := item.ExpenseValue.Float64()
+	merchant := merchantKey(item.Merchant)
+
+	var all, merchantAmounts []float64
+	tagAmounts := make(map[string][]float64)
+	for _, past := range history {
+		if !expenseBefore(past, item) {
+			continue
+		}
+		if past.Currency != item.Currency || past.ExpenseValue <= 0 {
+			continue
+		}
+		value := past.ExpenseValue.Float64()
+		all = append(all, value)
+		if merchant != "" && merchantKey(past.Merchant) == merchant {
+			merchantAmounts = append(merchantAmounts, value)
+		}
+		for category, value := range categoryAmounts(past) {
+			if value > 0 {
+				tagAmounts[category] = append(tagAmounts[category], value.Float64())
+			}
+		}
+	}
+
+	anomaly := func(kind string, baseline float64, score float64, explanation string) ExpenseAnomaly {
+		return ExpenseAnomaly{
+			Kind:            kind,
+			Month:           item.Month,
+			ExpenseItemName: item.ExpenseItemName,
+			Merchant:        item.Merchant,
+			Amount:          item.ExpenseValue,
+			Baseline:        MoneyFromFloat(baseline).Round(item.Currency),
+			Currency:        item.Currency,
+			Score:           score,
+			Explanation:     explanation,
+		}
+	}
+
+	if merchant != "" {
+		baseline := newAnomalyBaseline(merchantAmounts)
+		switch {
+		case baseline.count >= anomalyMinSamples:
+			if score := baseline.score(amount); score >= anomalyThreshold {
+				a := anomaly(AnomalyMerchantAmount, baseline.mean, score, "")
+				a.Explanation = fmt.Sprintf("%s at %s is far above the usual %s (%d past charges)",
+					item.ExpenseValue.Format(item.Currency), item.Merchant, a.Baseline.Format(item.Currency), baseline.count)
+				anomalies = append(anomalies, a)
+			}
+		case baseline.count == 0 && len(all) >= newMerchantMinHistory:
+			typical := median(all)
+			if typical > 0 && amount >= newMerchantFactor*typical {
+				a := anomaly(AnomalyNewMerchant, typical, math.Round(amount/typical*10)/10, "")
+				a.Explanation = fmt.Sprintf("first charge from %s is %s, %.1f times a typical expense of %s",
+					item.Merchant, item.ExpenseValue.Format(item.Currency), a.Score, a.Baseline.Format(item.Currency))
+				anomalies = append(anomalies, a)
+			}
+		}
+	}
+
+	categories := categoryAmounts(item)
+	var names []string
+	for category := range categories {
+		names = append(names, category)
+	}
+	sort.Strings(names)
+	for _, category := range names {
+		baseline := newAnomalyBaseline(tagAmounts[category])
+		if baseline.count < anomalyMinSamples {
+			continue
+		}
+		spent := categories[category]
+		if score := baseline.score(spent.Float64()); score >= anomalyThreshold {
+			a := anomaly(AnomalyTagAmount, baseline.mean, score, "")
+			a.Tag = category
+			a.Amount = spent
+			a.Explanation = fmt.Sprintf("%s on %s is far above the usual %s (%d past expenses)",
+				spent.Format(item.Currency), category, a.Baseline.Format(item.Currency), baseline.count)
+			anomalies = append(anomalies, a)
+		}
+	}
+	return anomalies
+}
+
+// CategorySpikes compares each category's spending in a month with its
+// monthly totals in the months before, counting months without spending as
+// zero once the category has been used. Split expenses count towards the
+// category of each line and expenses that are not split towards their first
+// tag, or "uncategorized" when they have none.
+func CategorySpikes(month string, expenses []ExpenseItem, history []ExpenseItem) []ExpenseAnomaly {
+	type key struct{ category, currency string }
+	totals := func(items []ExpenseItem) map[string]map[key]Money {
+		byMonth := make(map[string]map[key]Money)
+		for _, item := range items {
+			if byMonth[item.Month] == nil {
+				byMonth[item.Month] = make(map[key]Money)
+			}
+			for _, line := range expenseLines(item) {
+				category := strings.ToLower(line.Category)
+				if category == "" {
+					category = "uncategorized"
+				}
+				byMonth[item.Month][key{category, item.Currency}] += line.Amount
+			}
+		}
+		return byMonth
+	}
+	current := totals(expenses)[month]
+	past := totals(history)
+
+	var months []string
+	for m := range past {
+		if m < month {
+			months = append(months, m)
+		}
+	}
+	sort.Strings(months)
+
+	anomalies := []ExpenseAnomaly{}
+	for k, total := range current {
+		var amounts []float64
+		for _, m := range months {
+			value, ok := past[m][k]
+			if !ok && len(amounts) == 0 {
+				continue
+			}
+			amounts = append(amounts, value.Float64())
+		}
+		baseline := newAnomalyBaseline(amounts)
+		if baseline.count < anomalyMinSamples {
+			continue
+		}
+		score := baseline.score(total.Float64())
+		if score < anomalyThreshold {
+			continue
+		}
+		average := MoneyFromFloat(baseline.mean).Round(k.currency)
+		anomalies = append(anomalies, ExpenseAnomaly{
+			Kind:     AnomalyCategorySpike,
+			Month:    month,
+			Category: k.category,
+			Amount:   total,
+			Baseline: average,
+			Currency: k.currency,
+			Score:    score,
+			Explanation: fmt.Sprintf("%s spending of %s is far above its monthly average of %s over %d months",
+				k.category, total.Format(k.currency), average.Format(k.currency), baseline.count),
+		})
+	}
+	sort.Slice(anomalies, func(i, j int) bool { return anomalies[i].Category < anomalies[j].Category })
+	return anomalies
+}
+
+// loadAnomalyHistory reads a user's expenses in the months before a month,
+// and that month itself, caching partitions already read.
+func loadAnomalyHistory(userId string, month string, cache map[string][]ExpenseItem) ([]ExpenseItem, error) {
+	first, err := addMonths(month, -anomalyHistoryMonths)
+	if err != nil {
+		return nil, err
+	}
+	months, err := monthsBetween(first, month)
+	if err != nil {
+		return nil, err
+	}
+
+	var history []ExpenseItem
+	for _, m := range months {
+		partition := userId + "#" + m
+		items, ok := cache[partition]
+		if !ok {
+			items, err = GetAllExpenses(userId, m)
+			if err != nil {
+				return nil, err
+			}
+			cache[partition] = items
+		}
+		history = append(history, items...)
+	}
+	return history, nil
+}
+
+// FlagAnomalousExpenses scores new expense items against the user's past
+// expenses. Unusual items get their AnomalyScore and Anomalies explanations
+// set, and the anomalies are returned. Like duplicates, unusual items are
+// still saved.
+func FlagAnomalousExpenses(items []ExpenseItem) ([]ExpenseAnomaly, error) {
+	cache := make(map[string][]ExpenseItem)
+	anomalies := []ExpenseAnomaly{}
+	for i := range items {
+		item := &items[i]
+		history, err := loadAnomalyHistory(item.UserId, item.Month, cache)
+		if err != nil {
+			return nil, err
+		}
+
+		item.AnomalyScore = 0
+		item.Anomalies = nil
+		for _, anomaly := range ScoreExpense(*item, history) {
+			item.AnomalyScore = math.Max(item.AnomalyScore, anomaly.Score)
+			item.Anomalies = append(item.Anomalies, anomaly.Explanation)
+			anomalies = append(anomalies, anomaly)
+		}
+	}
+	return anomalies, nil
+}
+
+// FindMonthAnomalies lists the unusual expenses of a month, each scored
+// against the expenses made before it, and the categories whose spending
+// spiked, most unusual first.
+func FindMonthAnomalies(userId string, month string) ([]ExpenseAnomaly, error) {
+	history, err := loadAnomalyHistory(userId, month, make(map[string][]ExpenseItem))
+	if err != nil {
+		return nil, err
+	}
+	var expenses, earlier []ExpenseItem
+	for _, item := range history {
+		if item.Month == month {
+			expenses = append(expenses, item)
+		} else {
+			earlier = append(earlier, item)
+		}
+	}
+
+	anomalies := []ExpenseAnomaly{}
+	for _, item := range expenses {
+		anomalies = append(anomalies, ScoreExpense(item, history)...)
+	}
+	anomalies = append(anomalies, CategorySpikes(month, expenses, earlier)...)
+	sort.SliceStable(anomalies, func(i, j int) bool {
+		return anomalies[i].Score > anomalies[j].Score
+	})
+	return anomalies, nil
+}
+
+// median returns the middle value of amounts.
+func median(amounts []float64) float64 {
+	sorted := append([]float64(nil), amounts...)
+	sort.Float64s(sorted)
+	n := len(sorted)
+	if n == 0 {
+		return 0
+	}
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
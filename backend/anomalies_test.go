@@ -0,0 +1,199 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+// pastExpense is an expense in EUR made on a day of February 2024.
+func pastExpense(day int, merchant string, value Money, tags ...string) ExpenseItem {
+	return ExpenseItem{
+		ExpenseItemName: fmt.Sprintf("%s-%d", merchant, day),
+		Month:           "2024-02",
+		Date:            fmt.Sprintf("2024-02-%02d", day),
+		Merchant:        merchant,
+		ExpenseValue:    value,
+		ExpenseTags:     tags,
+		Currency:        "EUR",
+	}
+}
+
+func TestScoreExpense(t *testing.T) {
+	streaming := []ExpenseItem{
+		pastExpense(1, "Netflix", 100000),
+		pastExpense(2, "Netflix", 100000),
+		pastExpense(3, "Netflix", 100000),
+		pastExpense(4, "Netflix", 100000),
+	}
+
+	// Ten everyday expenses, so that a first charge can be called large
+	var everyday []ExpenseItem
+	for day := 1; day <= 10; day++ {
+		everyday = append(everyday, pastExpense(day, fmt.Sprintf("shop %d", day), 200000))
+	}
+
+	groceries := []ExpenseItem{
+		pastExpense(1, "", 500000, "Groceries"),
+		pastExpense(2, "", 500000, "groceries"),
+		pastExpense(3, "", 500000, "GROCERIES", "weekly"),
+	}
+
+	tests := []struct {
+		name    string
+		item    ExpenseItem
+		history []ExpenseItem
+		kinds   []string
+		tag     string
+		amount  Money
+	}{
+		{
+			"usual amount at a merchant",
+			pastExpense(20, "Netflix", 105000),
+			streaming,
+			nil, "", 0,
+		},
+		{
+			"far above the merchant's usual amount",
+			pastExpense(20, "NETFLIX", 500000),
+			streaming,
+			[]string{AnomalyMerchantAmount}, "", 500000,
+		},
+		{
+			"merchant charges in another currency are not compared",
+			func() ExpenseItem { item := pastExpense(20, "Netflix", 500000); item.Currency = "USD"; return item }(),
+			streaming,
+			nil, "", 0,
+		},
+		{
+			"large first charge from a new merchant",
+			pastExpense(15, "Jeweller", 1000000),
+			everyday,
+			[]string{AnomalyNewMerchant}, "", 1000000,
+		},
+		{
+			"still the first charge when a later one is recorded",
+			pastExpense(15, "Jeweller", 1000000),
+			append(append([]ExpenseItem{}, everyday...), pastExpense(25, "Jeweller", 1000000)),
+			[]string{AnomalyNewMerchant}, "", 1000000,
+		},
+		{
+			"later expenses do not count towards the baseline",
+			pastExpense(1, "Netflix", 500000),
+			streaming[1:],
+			nil, "", 0,
+		},
+		{
+			"categories match whatever the case",
+			pastExpense(20, "", 2000000, "Groceries"),
+			groceries,
+			[]string{AnomalyTagAmount}, "groceries", 2000000,
+		},
+		{
+			"a split line is scored against its category",
+			func() ExpenseItem {
+				item := pastExpense(20, "", 2100000, "shopping")
+				item.Splits = []ExpenseSplit{
+					{Category: "Groceries", Amount: 2000000},
+					{Category: "household", Amount: 100000},
+				}
+				return item
+			}(),
+			groceries,
+			[]string{AnomalyTagAmount}, "groceries", 2000000,
+		},
+		{
+			"tags other than the category are not compared",
+			pastExpense(20, "", 2000000, "shopping", "weekly"),
+			groceries,
+			nil, "", 0,
+		},
+		{
+			"refunds are not scored",
+			pastExpense(20, "Netflix", -500000),
+			streaming,
+			nil, "", 0,
+		},
+	}
+	for _, test := range tests {
+		anomalies := ScoreExpense(test.item, test.history)
+		if len(anomalies) != len(test.kinds) {
+			t.Errorf("%s: got %+v, want kinds %v", test.name, anomalies, test.kinds)
+			continue
+		}
+		for i, anomaly := range anomalies {
+			if anomaly.Kind != test.kinds[i] || anomaly.Tag != test.tag || anomaly.Amount != test.amount {
+				t.Errorf("%s: got %s %q %d, want %s %q %d", test.name,
+					anomaly.Kind, anomaly.Tag, anomaly.Amount, test.kinds[i], test.tag, test.amount)
+			}
+			if anomaly.Score < anomalyThreshold && anomaly.Kind != AnomalyNewMerchant {
+				t.Errorf("%s: score %v is below the threshold", test.name, anomaly.Score)
+			}
+		}
+	}
+}
+
+func TestCategorySpikes(t *testing.T) {
+	expense := func(month string, value Money, tags ...string) ExpenseItem {
+		return ExpenseItem{ExpenseItemName: month + "-" + fmt.Sprint(tags), Month: month, ExpenseValue: value, ExpenseTags: tags, Currency: "EUR"}
+	}
+	history := []ExpenseItem{
+		expense("2024-01", 1000000, "Groceries"),
+		expense("2024-02", 1000000, "groceries"),
+		expense("2024-03", 1000000, "groceries"),
+		expense("2024-01", 500000, "dining"),
+		expense("2024-02", 500000, "dining"),
+		expense("2024-03", 500000, "dining"),
+		expense("2024-03", 200000, "travel"),
+		expense("2024-01", 300000, "gifts"),
+		expense("2024-04", 9000000, "gifts"),
+	}
+
+	tests := []struct {
+		name       string
+		expenses   []ExpenseItem
+		categories []string
+	}{
+		{
+			"spending like before",
+			[]ExpenseItem{expense("2024-04", 1000000, "groceries"), expense("2024-04", 550000, "dining")},
+			nil,
+		},
+		{
+			"a category far above its average",
+			[]ExpenseItem{expense("2024-04", 4000000, "Groceries"), expense("2024-04", 500000, "dining")},
+			[]string{"groceries"},
+		},
+		{
+			"split lines count towards their own category",
+			[]ExpenseItem{{
+				ExpenseItemName: "receipt", Month: "2024-04", ExpenseValue: 4500000, Currency: "EUR",
+				ExpenseTags: []string{"groceries"},
+				Splits:      []ExpenseSplit{{Category: "groceries", Amount: 1000000}, {Category: "dining", Amount: 3500000}},
+			}},
+			[]string{"dining"},
+		},
+		{
+			"too few months to compare",
+			[]ExpenseItem{expense("2024-04", 5000000, "travel")},
+			nil,
+		},
+		{
+			"months without spending count as zero once a category is used",
+			[]ExpenseItem{expense("2024-04", 2000000, "gifts")},
+			[]string{"gifts"},
+		},
+	}
+	for _, test := range tests {
+		anomalies := CategorySpikes("2024-04", test.expenses, history)
+		var categories []string
+		for _, anomaly := range anomalies {
+			if anomaly.Kind != AnomalyCategorySpike {
+				t.Errorf("%s: got kind %s", test.name, anomaly.Kind)
+			}
+			categories = append(categories, anomaly.Category)
+		}
+		if fmt.Sprint(categories) != fmt.Sprint(test.categories) {
+			t.Errorf("%s: got %v, want %v", test.name, categories, test.categories)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+type camtDocument struct {
+	Statements []camtStatement `xml:"BkToCstmrStmt>Stmt"`
+}
+
+type camtStatement struct {
+	IBAN    string      `xml:"Acct>Id>IBAN"`
+	Other   string      `xml:"Acct>Id>Othr>Id"`
+	Entries []camtEntry `xml:"Ntry"`
+}
+
+type camtEntry struct {
+	Reference   string          `xml:"NtryRef"`
+	ServicerRef string          `xml:"AcctSvcrRef"`
+	Amount      string          `xml:"Amt"`
+	Indicator   string          `xml:"CdtDbtInd"`
+	Reversal    bool            `xml:"RvslInd"`
+	BookingDate camtDate        `xml:"BookgDt"`
+	ValueDate   camtDate        `xml:"ValDt"`
+	Details     []camtTxDetails `xml:"NtryDtls>TxDtls"`
+	Info        string          `xml:"AddtlNtryInf"`
+}
+
+type camtDate struct {
+	Date     string `xml:"Dt"`
+	DateTime string `xml:"DtTm"`
+}
+
+type camtTxDetails struct {
+	ServicerRef string   `xml:"Refs>AcctSvcrRef"`
+	EndToEndId  string   `xml:"Refs>EndToEndId"`
+	Creditor    string   `xml:"RltdPties>Cdtr>Nm"`
+	CreditorPty string   `xml:"RltdPties>Cdtr>Pty>Nm"`
+	Debtor      string   `xml:"RltdPties>Dbtr>Nm"`
+	DebtorPty   string   `xml:"RltdPties>Dbtr>Pty>Nm"`
+	Remittance  []string `xml:"RmtInf>Ustrd"`
+}
+
+// ParseCAMT053 reads an ISO 20022 camt.053 bank-to-customer statement. Each
+// booked entry becomes one transaction; debit entries are returned with a
+// negative amount.
+func ParseCAMT053(r io.Reader) ([]StatementTransaction, error) {
+	var document camtDocument
+	if err := xml.NewDecoder(r).Decode(&document); err != nil {
+		return nil, fmt.Errorf("failed to decode camt.053 statement: %v", err)
+	}
+	if len(document.Statements) == 0 {
+		return nil, fmt.Errorf("not a camt.053 statement: missing BkToCstmrStmt/Stmt")
+	}
+
+	var transactions []StatementTransaction
+	for _, statement := range document.Statements {
+		accountId := statement.IBAN
+		if accountId == "" {
+			accountId = statement.Other
+		}
+
+		for _, entry := range statement.Entries {
+			t, err := camtTransaction(accountId, entry)
+			if err != nil {
+				return nil, err
+			}
+			transactions = append(transactions, t)
+		}
+	}
+
+	assignSyntheticIds("camt", transactions)
+	return transactions, nil
+}
+
+func camtTransaction(accountId string, entry camtEntry) (StatementTransaction, error) {
+	t := StatementTransaction{AccountId: accountId, Memo: entry.Info}
+
+	amount, err := parseStatementAmount(entry.Amount)
+	if err != nil {
+		return t, fmt.Errorf("invalid camt.053 entry amount: %v", err)
+	}
+	debit := entry.Indicator == "DBIT"
+	if entry.Reversal {
+		debit = !debit
+	}
+	if debit {
+		amount = -amount
+	}
+	t.Amount = amount
+
+	date, err := entry.BookingDate.parse()
+	if err != nil {
+		date, err = entry.ValueDate.parse()
+	}
+	if err != nil {
+		return t, fmt.Errorf("camt.053 entry %s has no usable booking or value date", entry.ServicerRef)
+	}
+	t.Date = date
+
+	t.TransactionId = entry.ServicerRef
+	if t.TransactionId == "" {
+		t.TransactionId = entry.Reference
+	}
+
+	// Batched entries carry several details; the first one describes the
+	// counterparty well enough for a single normalized transaction
+	if len(entry.Details) > 0 {
+		details := entry.Details[0]
+		if t.TransactionId == "" {
+			t.TransactionId = details.ServicerRef
+		}
+		if t.TransactionId == "" && details.EndToEndId != "NOTPROVIDED" {
+			t.TransactionId = details.EndToEndId
+		}
+		if debit {
+			t.Payee = firstNonEmpty(details.Creditor, details.CreditorPty)
+		} else {
+			t.Payee = firstNonEmpty(details.Debtor, details.DebtorPty)
+		}
+		if remittance := strings.Join(details.Remittance, " "); remittance != "" {
+			t.Memo = remittance
+		}
+	}
+
+	return t, nil
+}
+
+func (d camtDate) parse() (time.Time, error) {
+	if d.Date != "" {
+		return time.Parse("2006-01-02", strings.TrimSpace(d.Date))
+	}
+	if d.DateTime != "" {
+		// Keep the calendar date as written, ignoring any offset
+		value := strings.TrimSpace(d.DateTime)
+		if len(value) >= 10 {
+			return time.Parse("2006-01-02", value[:10])
+		}
+	}
+	return time.Time{}, fmt.Errorf("missing date")
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
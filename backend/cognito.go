@@ -76,16 +76,29 @@ func AuthenticateUser(loginData LoginData) (*AuthResult, error) {
 	return authResult, nil
 }
 
-func ValidateToken(token string) (bool, error) {
-	// Validate the token using Cognito
+// GetTokenUser validates an access token with Cognito and returns the
+// username and email of the user it belongs to, and whether Cognito has
+// verified that the user owns the email address
+func GetTokenUser(token string) (string, string, bool, error) {
 	input := &cognitoidentityprovider.GetUserInput{
 		AccessToken: aws.String(token),
 	}
 
-	_, err := cognitoSvc.GetUser(input)
+	result, err := cognitoSvc.GetUser(input)
 	if err != nil {
-		return false, err
+		return "", "", false, err
 	}
 
-	return true, nil
+	email := ""
+	emailVerified := false
+	for _, attribute := range result.UserAttributes {
+		switch aws.StringValue(attribute.Name) {
+		case "email":
+			email = aws.StringValue(attribute.Value)
+		case "email_verified":
+			emailVerified = aws.StringValue(attribute.Value) == "true"
+		}
+	}
+
+	return aws.StringValue(result.Username), email, emailVerified, nil
 }
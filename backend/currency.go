@@ -0,0 +1,295 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// defaultBaseCurrency is used for users who have not chosen a base currency.
+const defaultBaseCurrency = "USD"
+
+// normalizeCurrency upper-cases a currency code and checks it looks like an
+// ISO 4217 code.
+func normalizeCurrency(code string) (string, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if len(code) != 3 {
+		return "", fmt.Errorf("invalid currency code %q", code)
+	}
+	for _, r := range code {
+		if r < 'A' || r > 'Z' {
+			return "", fmt.Errorf("invalid currency code %q", code)
+		}
+	}
+	return code, nil
+}
+
+// hasCurrency reports whether a model has a currency attribute, which is
+// empty for amounts in the base currency.
+func hasCurrency(t reflect.Type) bool {
+	_, names := csvFields(t)
+	for _, name := range names {
+		if name == "currency" {
+			return true
+		}
+	}
+	return false
+}
+
+// StampCurrency records a currency on every item of a workspace that has
+// none, which are the items in the base currency. It is run with the old
+// base currency before the base currency changes, so existing amounts keep
+// their meaning instead of being read in the new one. Items given a currency
+// in the meantime are left alone. It returns how many items were stamped.
+func StampCurrency(userId string, currency string) (int, error) {
+	stamped := 0
+	for _, section := range exportSections {
+		if !hasCurrency(reflect.TypeOf(section.Item)) {
+			continue
+		}
+
+		var keys []map[string]*dynamodb.AttributeValue
+		collect := func(item map[string]*dynamodb.AttributeValue) error {
+			if value, ok := item["currency"]; ok && aws.StringValue(value.S) != "" {
+				return nil
+			}
+			key := map[string]*dynamodb.AttributeValue{section.PartitionKey: item[section.PartitionKey]}
+			if section.SortKey != "" {
+				key[section.SortKey] = item[section.SortKey]
+			}
+			keys = append(keys, key)
+			return nil
+		}
+		var err error
+		if section.monthly() {
+			err = QueryUserMonthItems(section.Table, userId, collect)
+		} else {
+			err = QueryUserItems(section.Table, userId, collect)
+		}
+		if err != nil {
+			return stamped, err
+		}
+
+		for _, key := range keys {
+			updated, err := SetMissingCurrency(section.Table, key, currency)
+			if err != nil {
+				return stamped, err
+			}
+			if updated {
+				stamped++
+			}
+		}
+	}
+	return stamped, nil
+}
+
+// ValidateExchangeRate checks a rate and fills in its RateId, which makes a
+// second upload of the same pair and date replace the first.
+func ValidateExchangeRate(rate *ExchangeRate) error {
+	from, err := normalizeCurrency(rate.FromCurrency)
+	if err != nil {
+		return err
+	}
+	to, err := normalizeCurrency(rate.ToCurrency)
+	if err != nil {
+		return err
+	}
+	if from == to {
+		return fmt.Errorf("exchange rate from %s to itself", from)
+	}
+	if _, err := time.Parse("2006-01-02", rate.Date); err != nil {
+		return fmt.Errorf("invalid exchange rate date %q, expected YYYY-MM-DD", rate.Date)
+	}
+	if math.IsNaN(rate.Rate) || math.IsInf(rate.Rate, 0) || rate.Rate <= 0 {
+		return fmt.Errorf("exchange rate must be a positive number")
+	}
+	rate.FromCurrency = from
+	rate.ToCurrency = to
+	rate.RateId = fmt.Sprintf("%s#%s#%s", from, to, rate.Date)
+	return nil
+}
+
+// ParseExchangeRatesCSV reads rates from a CSV file with a header row naming
+// the date, from, to and rate columns, in any order.
+func ParseExchangeRatesCSV(r io.Reader) ([]ExchangeRate, error) {
+	rows, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read exchange rates: %v", err)
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("exchange rate file is empty")
+	}
+
+	columns := make(map[string]int)
+	for i, name := range rows[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"date", "from", "to", "rate"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("exchange rate file is missing the %s column", name)
+		}
+	}
+
+	var rates []ExchangeRate
+	for line, row := range rows[1:] {
+		if len(row) < len(rows[0]) {
+			return nil, fmt.Errorf("row %d: expected %d columns", line+2, len(rows[0]))
+		}
+		value, err := strconv.ParseFloat(strings.TrimSpace(row[columns["rate"]]), 64)
+		if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+			return nil, fmt.Errorf("row %d: invalid rate %q", line+2, row[columns["rate"]])
+		}
+		rates = append(rates, ExchangeRate{
+			FromCurrency: row[columns["from"]],
+			ToCurrency:   row[columns["to"]],
+			Date:         strings.TrimSpace(row[columns["date"]]),
+			Rate:         value,
+		})
+	}
+	return rates, nil
+}
+
+// RateTable answers conversion queries from a user's stored exchange rates.
+type RateTable struct {
+	pairs map[string][]ExchangeRate
+}
+
+func NewRateTable(rates []ExchangeRate) *RateTable {
+	table := &RateTable{pairs: make(map[string][]ExchangeRate)}
+	for _, rate := range rates {
+		key := rate.FromCurrency + "/" + rate.ToCurrency
+		table.pairs[key] = append(table.pairs[key], rate)
+	}
+	for _, rates := range table.pairs {
+		sort.Slice(rates, func(i, j int) bool { return rates[i].Date < rates[j].Date })
+	}
+	return table
+}
+
+// Rate returns the rate from one currency to another in effect on a date:
+// the latest stored rate on or before it, taken directly or inverted from
+// the opposite pair, whichever is more recent.
+func (t *RateTable) Rate(from string, to string, date time.Time) (float64, bool) {
+	if from == to {
+		return 1, true
+	}
+	day := date.Format("2006-01-02")
+
+	direct, directOk := latestRate(t.pairs[from+"/"+to], day)
+	inverse, inverseOk := latestRate(t.pairs[to+"/"+from], day)
+	switch {
+	case directOk && (!inverseOk || direct.Date >= inverse.Date):
+		return direct.Rate, true
+	case inverseOk:
+		return 1 / inverse.Rate, true
+	}
+	return 0, false
+}
+
+// Convert converts an amount into another currency at the rate in effect on
+// the given date, rounded to the minor unit of the target currency.
+func (t *RateTable) Convert(amount Money, from string, to string, date time.Time) (Money, bool) {
+	rate, ok := t.Rate(from, to, date)
+	if !ok {
+		return 0, false
+	}
+	return amount.Mul(rate).Round(to), true
+}
+
+func latestRate(rates []ExchangeRate, day string) (ExchangeRate, bool) {
+	i := sort.Search(len(rates), func(i int) bool { return rates[i].Date > day })
+	if i == 0 {
+		return ExchangeRate{}, false
+	}
+	return rates[i-1], true
+}
+
+// BuildCurrencyReport totals a month's income, budget and expenses in the
+// base currency. Amounts without a currency are already in the base currency.
+// Each amount is rounded to the base currency's minor unit before summing, so
+// the totals are exactly the sum of the lines.
+// Amounts that cannot be converted are left out of the totals and the missing
+// pair and date are listed instead. Split expenses count towards the tags and
+// category of each split line rather than those of the whole expense, and
+// other expenses towards their first tag as the category; see expenseLines.
+func BuildCurrencyReport(month string, base string, rates *RateTable, income []IncomeItem, budget []BudgetItem, expenses []ExpenseItem) CurrencyReport {
+	report := CurrencyReport{
+		Month:              month,
+		BaseCurrency:       base,
+		ExpensesByTag:      make(map[string]Money),
+		ExpensesByCategory: make(map[string]Money),
+		Budgets:            []BudgetLine{},
+		MissingRates:       []string{},
+	}
+	missing := make(map[string]bool)
+
+	convert := func(amount Money, currency string, date time.Time) (Money, bool) {
+		if currency == "" {
+			currency = base
+		}
+		converted, ok := rates.Convert(amount, currency, base, date)
+		if !ok {
+			key := fmt.Sprintf("%s/%s@%s", currency, base, date.Format("2006-01-02"))
+			if !missing[key] {
+				missing[key] = true
+				report.MissingRates = append(report.MissingRates, key)
+			}
+		}
+		return converted, ok
+	}
+
+	for _, item := range income {
+		if value, ok := convert(item.IncomeItemValue, item.Currency, itemDate(item.Date, item.Month)); ok {
+			report.Income += value
+		}
+	}
+	for _, item := range expenses {
+		date := itemDate(item.Date, item.Month)
+		for _, line := range expenseLines(item) {
+			value, ok := convert(line.Amount, item.Currency, date)
+			if !ok {
+				continue
+			}
+			report.Expenses += value
+
+			category := strings.ToLower(line.Category)
+			if category == "" {
+				category = "uncategorized"
+			}
+			report.ExpensesByCategory[category] += value
+
+			if len(line.Tags) == 0 {
+				report.ExpensesByTag["untagged"] += value
+			}
+			for _, tag := range line.Tags {
+				report.ExpensesByTag[tag] += value
+			}
+		}
+	}
+	for _, item := range budget {
+		value, ok := convert(item.BudgetItemValue, item.Currency, itemDate("", item.Month))
+		if !ok {
+			continue
+		}
+		report.Budget += value
+		spent := report.ExpensesByCategory[strings.ToLower(item.BudgetItemName)]
+		report.Budgets = append(report.Budgets, BudgetLine{
+			BudgetItemName: item.BudgetItemName,
+			Budget:         value,
+			Spent:          spent,
+			Remaining:      value - spent,
+		})
+	}
+
+	report.Net = report.Income - report.Expenses
+	return report
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseExchangeRatesCSV(t *testing.T) {
+	rates, err := ParseExchangeRatesCSV(strings.NewReader("Rate,Date,From,To\n0.92,2024-01-02,USD,EUR\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rates) != 1 || rates[0].Rate != 0.92 || rates[0].FromCurrency != "USD" || rates[0].Date != "2024-01-02" {
+		t.Errorf("got %+v", rates)
+	}
+
+	for _, value := range []string{"NaN", "nan", "Inf", "+Inf", "-Inf", "infinity", "abc"} {
+		_, err := ParseExchangeRatesCSV(strings.NewReader("date,from,to,rate\n2024-01-02,USD,EUR," + value + "\n"))
+		if err == nil {
+			t.Errorf("rate %q was accepted", value)
+		}
+	}
+}
+
+func TestValidateExchangeRate(t *testing.T) {
+	tests := []struct {
+		rate    ExchangeRate
+		wantErr bool
+	}{
+		{ExchangeRate{FromCurrency: "usd", ToCurrency: "eur", Date: "2024-01-02", Rate: 0.92}, false},
+		{ExchangeRate{FromCurrency: "USD", ToCurrency: "USD", Date: "2024-01-02", Rate: 1}, true},
+		{ExchangeRate{FromCurrency: "USD", ToCurrency: "EUR", Date: "02/01/2024", Rate: 0.92}, true},
+		{ExchangeRate{FromCurrency: "USD", ToCurrency: "EUR", Date: "2024-01-02", Rate: 0}, true},
+		{ExchangeRate{FromCurrency: "USD", ToCurrency: "EUR", Date: "2024-01-02", Rate: math.NaN()}, true},
+		{ExchangeRate{FromCurrency: "USD", ToCurrency: "EUR", Date: "2024-01-02", Rate: math.Inf(1)}, true},
+	}
+	for _, test := range tests {
+		rate := test.rate
+		err := ValidateExchangeRate(&rate)
+		if (err != nil) != test.wantErr {
+			t.Errorf("ValidateExchangeRate(%+v) error %v, want error %v", test.rate, err, test.wantErr)
+		}
+		if err == nil && rate.RateId != "USD#EUR#2024-01-02" {
+			t.Errorf("RateId = %s", rate.RateId)
+		}
+	}
+}
+
+func TestHasCurrency(t *testing.T) {
+	if !hasCurrency(reflect.TypeOf(ExpenseItem{})) {
+		t.Error("expense items have a currency")
+	}
+	if hasCurrency(reflect.TypeOf(UserSettings{})) {
+		t.Error("settings have no currency")
+	}
+}
@@ -3,8 +3,10 @@ package main
 import (
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
@@ -136,448 +138,2641 @@ func CreateTables() error {
 				},
 			},
 		},
+		{
+			Name: "Accounts",
+			Attributes: []*dynamodb.AttributeDefinition{
+				{
+					AttributeName: aws.String("userId"),
+					AttributeType: aws.String("S"),
+				},
+				{
+					AttributeName: aws.String("accountId"),
+					AttributeType: aws.String("S"),
+				},
+			},
+			KeySchema: []*dynamodb.KeySchemaElement{
+				{
+					AttributeName: aws.String("userId"),
+					KeyType:       aws.String("HASH"),
+				},
+				{
+					AttributeName: aws.String("accountId"),
+					KeyType:       aws.String("RANGE"),
+				},
+			},
+		},
+		{
+			Name: "Transfers",
+			Attributes: []*dynamodb.AttributeDefinition{
+				{
+					AttributeName: aws.String("userId#month"),
+					AttributeType: aws.String("S"),
+				},
+				{
+					AttributeName: aws.String("transferId"),
+					AttributeType: aws.String("S"),
+				},
+			},
+			KeySchema: []*dynamodb.KeySchemaElement{
+				{
+					AttributeName: aws.String("userId#month"),
+					KeyType:       aws.String("HASH"),
+				},
+				{
+					AttributeName: aws.String("transferId"),
+					KeyType:       aws.String("RANGE"),
+				},
+			},
+		},
+		{
+			Name: "UserSettings",
+			Attributes: []*dynamodb.AttributeDefinition{
+				{
+					AttributeName: aws.String("userId"),
+					AttributeType: aws.String("S"),
+				},
+			},
+			KeySchema: []*dynamodb.KeySchemaElement{
+				{
+					AttributeName: aws.String("userId"),
+					KeyType:       aws.String("HASH"),
+				},
+			},
+		},
+		{
+			Name: "ExchangeRates",
+			Attributes: []*dynamodb.AttributeDefinition{
+				{
+					AttributeName: aws.String("userId"),
+					AttributeType: aws.String("S"),
+				},
+				{
+					AttributeName: aws.String("rateId"),
+					AttributeType: aws.String("S"),
+				},
+			},
+			KeySchema: []*dynamodb.KeySchemaElement{
+				{
+					AttributeName: aws.String("userId"),
+					KeyType:       aws.String("HASH"),
+				},
+				{
+					AttributeName: aws.String("rateId"),
+					KeyType:       aws.String("RANGE"),
+				},
+			},
+		},
+		{
+			Name: "Households",
+			Attributes: []*dynamodb.AttributeDefinition{
+				{
+					AttributeName: aws.String("householdId"),
+					AttributeType: aws.String("S"),
+				},
+			},
+			KeySchema: []*dynamodb.KeySchemaElement{
+				{
+					AttributeName: aws.String("householdId"),
+					KeyType:       aws.String("HASH"),
+				},
+			},
+		},
+		{
+			Name: "HouseholdMembers",
+			Attributes: []*dynamodb.AttributeDefinition{
+				{
+					AttributeName: aws.String("householdId"),
+					AttributeType: aws.String("S"),
+				},
+				{
+					AttributeName: aws.String("userId"),
+					AttributeType: aws.String("S"),
+				},
+			},
+			KeySchema: []*dynamodb.KeySchemaElement{
+				{
+					AttributeName: aws.String("householdId"),
+					KeyType:       aws.String("HASH"),
+				},
+				{
+					AttributeName: aws.String("userId"),
+					KeyType:       aws.String("RANGE"),
+				},
+			},
+		},
+		{
+			Name: "HouseholdInvitations",
+			Attributes: []*dynamodb.AttributeDefinition{
+				{
+					AttributeName: aws.String("householdId"),
+					AttributeType: aws.String("S"),
+				},
+				{
+					AttributeName: aws.String("invitationId"),
+					AttributeType: aws.String("S"),
+				},
+			},
+			KeySchema: []*dynamodb.KeySchemaElement{
+				{
+					AttributeName: aws.String("householdId"),
+					KeyType:       aws.String("HASH"),
+				},
+				{
+					AttributeName: aws.String("invitationId"),
+					KeyType:       aws.String("RANGE"),
+				},
+			},
+		},
+		{
+			Name: "Goals",
+			Attributes: []*dynamodb.AttributeDefinition{
+				{
+					AttributeName: aws.String("userId"),
+					AttributeType: aws.String("S"),
+				},
+				{
+					AttributeName: aws.String("goalId"),
+					AttributeType: aws.String("S"),
+				},
+			},
+			KeySchema: []*dynamodb.KeySchemaElement{
+				{
+					AttributeName: aws.String("userId"),
+					KeyType:       aws.String("HASH"),
+				},
+				{
+					AttributeName: aws.String("goalId"),
+					KeyType:       aws.String("RANGE"),
+				},
+			},
+		},
+		{
+			Name: "GoalContributions",
+			Attributes: []*dynamodb.AttributeDefinition{
+				{
+					AttributeName: aws.String("userId"),
+					AttributeType: aws.String("S"),
+				},
+				{
+					AttributeName: aws.String("contributionId"),
+					AttributeType: aws.String("S"),
+				},
+			},
+			KeySchema: []*dynamodb.KeySchemaElement{
+				{
+					AttributeName: aws.String("userId"),
+					KeyType:       aws.String("HASH"),
+				},
+				{
+					AttributeName: aws.String("contributionId"),
+					KeyType:       aws.String("RANGE"),
+				},
+			},
+		},
+		{
+			Name: "Debts",
+			Attributes: []*dynamodb.AttributeDefinition{
+				{
+					AttributeName: aws.String("userId"),
+					AttributeType: aws.String("S"),
+				},
+				{
+					AttributeName: aws.String("debtId"),
+					AttributeType: aws.String("S"),
+				},
+			},
+			KeySchema: []*dynamodb.KeySchemaElement{
+				{
+					AttributeName: aws.String("userId"),
+					KeyType:       aws.String("HASH"),
+				},
+				{
+					AttributeName: aws.String("debtId"),
+					KeyType:       aws.String("RANGE"),
+				},
+			},
+		},
+		{
+			Name: "DebtPayments",
+			Attributes: []*dynamodb.AttributeDefinition{
+				{
+					AttributeName: aws.String("userId"),
+					AttributeType: aws.String("S"),
+				},
+				{
+					AttributeName: aws.String("paymentId"),
+					AttributeType: aws.String("S"),
+				},
+			},
+			KeySchema: []*dynamodb.KeySchemaElement{
+				{
+					AttributeName: aws.String("userId"),
+					KeyType:       aws.String("HASH"),
+				},
+				{
+					AttributeName: aws.String("paymentId"),
+					KeyType:       aws.String("RANGE"),
+				},
+			},
+		},
+		{
+			Name: "Holdings",
+			Attributes: []*dynamodb.AttributeDefinition{
+				{
+					AttributeName: aws.String("userId"),
+					AttributeType: aws.String("S"),
+				},
+				{
+					AttributeName: aws.String("holdingId"),
+					AttributeType: aws.String("S"),
+				},
+			},
+			KeySchema: []*dynamodb.KeySchemaElement{
+				{
+					AttributeName: aws.String("userId"),
+					KeyType:       aws.String("HASH"),
+				},
+				{
+					AttributeName: aws.String("holdingId"),
+					KeyType:       aws.String("RANGE"),
+				},
+			},
+		},
+		{
+			Name: "HoldingValuations",
+			Attributes: []*dynamodb.AttributeDefinition{
+				{
+					AttributeName: aws.String("userId"),
+					AttributeType: aws.String("S"),
+				},
+				{
+					AttributeName: aws.String("valuationId"),
+					AttributeType: aws.String("S"),
+				},
+			},
+			KeySchema: []*dynamodb.KeySchemaElement{
+				{
+					AttributeName: aws.String("userId"),
+					KeyType:       aws.String("HASH"),
+				},
+				{
+					AttributeName: aws.String("valuationId"),
+					KeyType:       aws.String("RANGE"),
+				},
+			},
+		},
+		{
+			Name: "InvestmentTransactions",
+			Attributes: []*dynamodb.AttributeDefinition{
+				{
+					AttributeName: aws.String("userId"),
+					AttributeType: aws.String("S"),
+				},
+				{
+					AttributeName: aws.String("transactionId"),
+					AttributeType: aws.String("S"),
+				},
+			},
+			KeySchema: []*dynamodb.KeySchemaElement{
+				{
+					AttributeName: aws.String("userId"),
+					KeyType:       aws.String("HASH"),
+				},
+				{
+					AttributeName: aws.String("transactionId"),
+					KeyType:       aws.String("RANGE"),
+				},
+			},
+		},
+		{
+			Name: "SecurityPrices",
+			Attributes: []*dynamodb.AttributeDefinition{
+				{
+					AttributeName: aws.String("userId"),
+					AttributeType: aws.String("S"),
+				},
+				{
+					AttributeName: aws.String("priceId"),
+					AttributeType: aws.String("S"),
+				},
+			},
+			KeySchema: []*dynamodb.KeySchemaElement{
+				{
+					AttributeName: aws.String("userId"),
+					KeyType:       aws.String("HASH"),
+				},
+				{
+					AttributeName: aws.String("priceId"),
+					KeyType:       aws.String("RANGE"),
+				},
+			},
+		},
+		{
+			Name: "RecurringItems",
+			Attributes: []*dynamodb.AttributeDefinition{
+				{
+					AttributeName: aws.String("userId"),
+					AttributeType: aws.String("S"),
+				},
+				{
+					AttributeName: aws.String("recurringId"),
+					AttributeType: aws.String("S"),
+				},
+			},
+			KeySchema: []*dynamodb.KeySchemaElement{
+				{
+					AttributeName: aws.String("userId"),
+					KeyType:       aws.String("HASH"),
+				},
+				{
+					AttributeName: aws.String("recurringId"),
+					KeyType:       aws.String("RANGE"),
+				},
+			},
+		},
+		{
+			Name: "Scenarios",
+			Attributes: []*dynamodb.AttributeDefinition{
+				{
+					AttributeName: aws.String("userId"),
+					AttributeType: aws.String("S"),
+				},
+				{
+					AttributeName: aws.String("scenarioId"),
+					AttributeType: aws.String("S"),
+				},
+			},
+			KeySchema: []*dynamodb.KeySchemaElement{
+				{
+					AttributeName: aws.String("userId"),
+					KeyType:       aws.String("HASH"),
+				},
+				{
+					AttributeName: aws.String("scenarioId"),
+					KeyType:       aws.String("RANGE"),
+				},
+			},
+		},
+		{
+			Name: "AlertRules",
+			Attributes: []*dynamodb.AttributeDefinition{
+				{
+					AttributeName: aws.String("userId"),
+					AttributeType: aws.String("S"),
+				},
+				{
+					AttributeName: aws.String("ruleId"),
+					AttributeType: aws.String("S"),
+				},
+			},
+			KeySchema: []*dynamodb.KeySchemaElement{
+				{
+					AttributeName: aws.String("userId"),
+					KeyType:       aws.String("HASH"),
+				},
+				{
+					AttributeName: aws.String("ruleId"),
+					KeyType:       aws.String("RANGE"),
+				},
+			},
+		},
+		{
+			Name: "Notifications",
+			Attributes: []*dynamodb.AttributeDefinition{
+				{
+					AttributeName: aws.String("userId"),
+					AttributeType: aws.String("S"),
+				},
+				{
+					AttributeName: aws.String("notificationId"),
+					AttributeType: aws.String("S"),
+				},
+			},
+			KeySchema: []*dynamodb.KeySchemaElement{
+				{
+					AttributeName: aws.String("userId"),
+					KeyType:       aws.String("HASH"),
+				},
+				{
+					AttributeName: aws.String("notificationId"),
+					KeyType:       aws.String("RANGE"),
+				},
+			},
+		},
+		{
+			Name: "EmailSubscriptions",
+			Attributes: []*dynamodb.AttributeDefinition{
+				{
+					AttributeName: aws.String("userId"),
+					AttributeType: aws.String("S"),
+				},
+				{
+					AttributeName: aws.String("subscriberId"),
+					AttributeType: aws.String("S"),
+				},
+			},
+			KeySchema: []*dynamodb.KeySchemaElement{
+				{
+					AttributeName: aws.String("userId"),
+					KeyType:       aws.String("HASH"),
+				},
+				{
+					AttributeName: aws.String("subscriberId"),
+					KeyType:       aws.String("RANGE"),
+				},
+			},
+		},
+		{
+			Name: "Webhooks",
+			Attributes: []*dynamodb.AttributeDefinition{
+				{
+					AttributeName: aws.String("userId"),
+					AttributeType: aws.String("S"),
+				},
+				{
+					AttributeName: aws.String("webhookId"),
+					AttributeType: aws.String("S"),
+				},
+			},
+			KeySchema: []*dynamodb.KeySchemaElement{
+				{
+					AttributeName: aws.String("userId"),
+					KeyType:       aws.String("HASH"),
+				},
+				{
+					AttributeName: aws.String("webhookId"),
+					KeyType:       aws.String("RANGE"),
+				},
+			},
+		},
+		{
+			Name: "WebhookDeliveries",
+			Attributes: []*dynamodb.AttributeDefinition{
+				{
+					AttributeName: aws.String("userId"),
+					AttributeType: aws.String("S"),
+				},
+				{
+					AttributeName: aws.String("deliveryId"),
+					AttributeType: aws.String("S"),
+				},
+			},
+			KeySchema: []*dynamodb.KeySchemaElement{
+				{
+					AttributeName: aws.String("userId"),
+					KeyType:       aws.String("HASH"),
+				},
+				{
+					AttributeName: aws.String("deliveryId"),
+					KeyType:       aws.String("RANGE"),
+				},
+			},
+		},
+		{
+			Name: "Events",
+			Attributes: []*dynamodb.AttributeDefinition{
+				{
+					AttributeName: aws.String("userId"),
+					AttributeType: aws.String("S"),
+				},
+				{
+					AttributeName: aws.String("eventId"),
+					AttributeType: aws.String("S"),
+				},
+			},
+			KeySchema: []*dynamodb.KeySchemaElement{
+				{
+					AttributeName: aws.String("userId"),
+					KeyType:       aws.String("HASH"),
+				},
+				{
+					AttributeName: aws.String("eventId"),
+					KeyType:       aws.String("RANGE"),
+				},
+			},
+		},
+		{
+			Name: "UserMonths",
+			Attributes: []*dynamodb.AttributeDefinition{
+				{
+					AttributeName: aws.String("userId"),
+					AttributeType: aws.String("S"),
+				},
+				{
+					AttributeName: aws.String("month"),
+					AttributeType: aws.String("S"),
+				},
+			},
+			KeySchema: []*dynamodb.KeySchemaElement{
+				{
+					AttributeName: aws.String("userId"),
+					KeyType:       aws.String("HASH"),
+				},
+				{
+					AttributeName: aws.String("month"),
+					KeyType:       aws.String("RANGE"),
+				},
+			},
+		},
+	}
+
+	for _, table := range tables {
+
+		input := &dynamodb.CreateTableInput{
+			AttributeDefinitions: table.Attributes,
+			KeySchema:            table.KeySchema,
+			BillingMode:          aws.String("PAY_PER_REQUEST"), // This enables on-demand capacity
+			TableName:            aws.String(table.Name),
+		}
+
+		log.Printf("Creating table %v", input)
+		_, err := db.CreateTable(input)
+		if err != nil {
+			log.Printf("failed %v", err)
+			return fmt.Errorf("failed to create table %s: %v", table.Name, err)
+		}
+		fmt.Printf("Created table %s\n", table.Name)
+	}
+
+	return nil
+}
+
+// AddIncome adds a new income item to the Income table
+func AddIncome(item IncomeItem) error {
+	// Create the composite key
+	userIdMonth := fmt.Sprintf("%s#%s", item.UserId, item.Month)
+
+	av, err := dynamodbattribute.MarshalMap(item)
+	if err != nil {
+		return fmt.Errorf("failed to marshal Income item: %v", err)
+	}
+
+	// Add the composite key to the item
+	av["userId#month"] = &dynamodb.AttributeValue{S: aws.String(userIdMonth)}
+	log.Printf("Adding : %v", av)
+	input := &dynamodb.PutItemInput{
+		TableName: aws.String("Income"),
+		Item:      av,
+	}
+
+	_, err = db.PutItem(input)
+	if err != nil {
+		return fmt.Errorf("failed to add Income item: %v", err)
+	}
+
+	return AddUserMonths(item.UserId, item.Month)
+}
+
+func GetAllIncome(userId string, month string) ([]IncomeItem, error) {
+	// Create the composite key
+	userIdMonth := fmt.Sprintf("%s#%s", userId, month)
+
+	// Create the query input
+	keyCond := expression.Key("userId#month").Equal(expression.Value(userIdMonth))
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCond).Build()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build expression: %v", err)
+	}
+
+	input := &dynamodb.QueryInput{
+		TableName:                 aws.String("Income"),
+		KeyConditionExpression:    expr.KeyCondition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+	}
+
+	// Execute the query
+	result, err := db.Query(input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query Income items: %v", err)
+	}
+
+	// Unmarshal the results
+	var incomeItems []IncomeItem
+	err = dynamodbattribute.UnmarshalListOfMaps(result.Items, &incomeItems)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal Income items: %v", err)
+	}
+
+	return incomeItems, nil
+}
+
+func UpdateIncome(userId string, month string, incomeItemName string, newValue Money) error {
+	// Create the composite key
+	userIdMonth := fmt.Sprintf("%s#%s", userId, month)
+
+	// Create the update expression
+	update := expression.Set(expression.Name("incomeItemValue"), expression.Value(newValue))
+	expr, err := expression.NewBuilder().WithUpdate(update).Build()
+	if err != nil {
+		return fmt.Errorf("failed to build expression: %v", err)
+	}
+
+	// Create the update item input
+	input := &dynamodb.UpdateItemInput{
+		TableName: aws.String("Income"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"userId#month":   {S: aws.String(userIdMonth)},
+			"incomeItemName": {S: aws.String(incomeItemName)},
+		},
+		UpdateExpression:          expr.Update(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		ReturnValues:              aws.String("UPDATED_NEW"),
+	}
+
+	// Execute the update
+	_, err = db.UpdateItem(input)
+	if err != nil {
+		return fmt.Errorf("failed to update Income item: %v", err)
+	}
+
+	return nil
+}
+
+// DeleteIncome removes an income item from the Income table
+func DeleteIncome(userId string, month string, incomeItemName string) error {
+	// Create the composite key
+	userIdMonth := fmt.Sprintf("%s#%s", userId, month)
+
+	// Create the delete item input
+	input := &dynamodb.DeleteItemInput{
+		TableName: aws.String("Income"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"userId#month":   {S: aws.String(userIdMonth)},
+			"incomeItemName": {S: aws.String(incomeItemName)},
+		},
+	}
+
+	// Execute the delete operation
+	_, err := db.DeleteItem(input)
+	if err != nil {
+		return fmt.Errorf("failed to delete Income item: %v", err)
+	}
+
+	return nil
+}
+
+// AddBudget adds a new budget item to the Budget table
+func AddBudget(item BudgetItem) error {
+	// Create the composite key
+	userIdMonth := fmt.Sprintf("%s#%s", item.UserID, item.Month)
+
+	av, err := dynamodbattribute.MarshalMap(item)
+	if err != nil {
+		return fmt.Errorf("failed to marshal Budget item: %v", err)
+	}
+
+	// Add the composite key to the item
+	av["userId#month"] = &dynamodb.AttributeValue{S: aws.String(userIdMonth)}
+
+	input := &dynamodb.PutItemInput{
+		TableName: aws.String("Budget"),
+		Item:      av,
+	}
+
+	_, err = db.PutItem(input)
+	if err != nil {
+		return fmt.Errorf("failed to add Budget item: %v", err)
+	}
+
+	return AddUserMonths(item.UserID, item.Month)
+}
+
+func GetAllBudget(userId string, month string) ([]BudgetItem, error) {
+	// Create the composite key
+	userIdMonth := fmt.Sprintf("%s#%s", userId, month)
+
+	// Create the query input
+	keyCond := expression.Key("userId#month").Equal(expression.Value(userIdMonth))
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCond).Build()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build expression: %v", err)
+	}
+
+	input := &dynamodb.QueryInput{
+		TableName:                 aws.String("Budget"),
+		KeyConditionExpression:    expr.KeyCondition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+	}
+
+	// Execute the query
+	result, err := db.Query(input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query Budget items: %v", err)
+	}
+
+	// Unmarshal the results
+	var budgetItems []BudgetItem
+	err = dynamodbattribute.UnmarshalListOfMaps(result.Items, &budgetItems)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal Budget items: %v", err)
+	}
+
+	return budgetItems, nil
+}
+
+func UpdateBudget(userId string, month string, budgetItemName string, newValue Money) error {
+	// Create the composite key
+	userIdMonth := fmt.Sprintf("%s#%s", userId, month)
+
+	// Create the update expression
+	update := expression.Set(expression.Name("budgetItemValue"), expression.Value(newValue))
+	expr, err := expression.NewBuilder().WithUpdate(update).Build()
+	if err != nil {
+		return fmt.Errorf("failed to build expression: %v", err)
+	}
+
+	// Create the update item input
+	input := &dynamodb.UpdateItemInput{
+		TableName: aws.String("Budget"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"userId#month":   {S: aws.String(userIdMonth)},
+			"budgetItemName": {S: aws.String(budgetItemName)},
+		},
+		UpdateExpression:          expr.Update(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		ReturnValues:              aws.String("UPDATED_NEW"),
+	}
+
+	// Execute the update
+	_, err = db.UpdateItem(input)
+	if err != nil {
+		return fmt.Errorf("failed to update Budget item: %v", err)
+	}
+
+	return nil
+}
+
+func DeleteBudget(userId string, month string, budgetItemName string) error {
+	// Create the composite key
+	userIdMonth := fmt.Sprintf("%s#%s", userId, month)
+
+	// Create the delete item input
+	input := &dynamodb.DeleteItemInput{
+		TableName: aws.String("Budget"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"userId#month":   {S: aws.String(userIdMonth)},
+			"budgetItemName": {S: aws.String(budgetItemName)},
+		},
+	}
+
+	// Execute the delete operation
+	_, err := db.DeleteItem(input)
+	if err != nil {
+		return fmt.Errorf("failed to delete Budget item: %v", err)
+	}
+
+	return nil
+}
+
+func AddExpenses(items []ExpenseItem) error {
+	// Create a list to hold the write requests
+	var writeRequests []*dynamodb.WriteRequest
+
+	for _, item := range items {
+		// Create the composite key
+		userIdMonth := fmt.Sprintf("%s#%s", item.UserId, item.Month)
+
+		av, err := dynamodbattribute.MarshalMap(item)
+		if err != nil {
+			return fmt.Errorf("failed to marshal Expense item: %v", err)
+		}
+
+		// Add the composite key to the item
+		av["userId#month"] = &dynamodb.AttributeValue{S: aws.String(userIdMonth)}
+
+		// Create a PutRequest for each item
+		writeRequests = append(writeRequests, &dynamodb.WriteRequest{
+			PutRequest: &dynamodb.PutRequest{
+				Item: av,
+			},
+		})
+	}
+
+	err := batchWrite("Expenses", writeRequests)
+	if err != nil {
+		return fmt.Errorf("failed to add Expense items: %v", err)
+	}
+
+	// Record the months the items were added to
+	months := make(map[string][]string)
+	for _, item := range items {
+		months[item.UserId] = append(months[item.UserId], item.Month)
+	}
+	for userId, userMonths := range months {
+		if err := AddUserMonths(userId, userMonths...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// batchWrite sends write requests in batches of 25 (DynamoDB limit),
+// resending any items DynamoDB reports as unprocessed
+func batchWrite(tableName string, writeRequests []*dynamodb.WriteRequest) error {
+	for i := 0; i < len(writeRequests); i += 25 {
+		end := i + 25
+		if end > len(writeRequests) {
+			end = len(writeRequests)
+		}
+
+		pending := map[string][]*dynamodb.WriteRequest{
+			tableName: writeRequests[i:end],
+		}
+		for attempt := 0; len(pending[tableName]) > 0; attempt++ {
+			if attempt == 5 {
+				return fmt.Errorf("%d item(s) still unprocessed after %d attempts", len(pending[tableName]), attempt)
+			}
+			if attempt > 0 {
+				time.Sleep(time.Duration(50<<attempt) * time.Millisecond)
+			}
+
+			output, err := db.BatchWriteItem(&dynamodb.BatchWriteItemInput{RequestItems: pending})
+			if err != nil {
+				return err
+			}
+			pending = output.UnprocessedItems
+		}
+	}
+
+	return nil
+}
+
+// PutItems writes already marshalled items to a table in batches
+func PutItems(tableName string, items []map[string]*dynamodb.AttributeValue) error {
+	writeRequests := make([]*dynamodb.WriteRequest, 0, len(items))
+	for _, item := range items {
+		writeRequests = append(writeRequests, &dynamodb.WriteRequest{
+			PutRequest: &dynamodb.PutRequest{Item: item},
+		})
+	}
+
+	err := batchWrite(tableName, writeRequests)
+	if err != nil {
+		return fmt.Errorf("failed to write %s items: %v", tableName, err)
+	}
+
+	return nil
+}
+
+// GetItemNames returns the sort key values of the items in one partition,
+// such as a user's items for one month
+func GetItemNames(tableName string, partitionKey string, partition string, sortKey string) (map[string]bool, error) {
+	keyCond := expression.Key(partitionKey).Equal(expression.Value(partition))
+	projection := expression.NamesList(expression.Name(sortKey))
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCond).WithProjection(projection).Build()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build expression: %v", err)
+	}
+
+	input := &dynamodb.QueryInput{
+		TableName:                 aws.String(tableName),
+		KeyConditionExpression:    expr.KeyCondition(),
+		ProjectionExpression:      expr.Projection(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+	}
+
+	names := make(map[string]bool)
+	err = db.QueryPages(input, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			if name, ok := item[sortKey]; ok && name.S != nil {
+				names[*name.S] = true
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query %s items: %v", tableName, err)
+	}
+
+	return names, nil
+}
+
+func GetAllExpenses(userId string, month string) ([]ExpenseItem, error) {
+	// Create the composite key
+	userIdMonth := fmt.Sprintf("%s#%s", userId, month)
+
+	// Create the query input
+	keyCond := expression.Key("userId#month").Equal(expression.Value(userIdMonth))
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCond).Build()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build expression: %v", err)
+	}
+
+	input := &dynamodb.QueryInput{
+		TableName:                 aws.String("Expenses"),
+		KeyConditionExpression:    expr.KeyCondition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+	}
+
+	// Execute the query
+	result, err := db.Query(input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query Expense items: %v", err)
+	}
+
+	// Unmarshal the results
+	var expenseItems []ExpenseItem
+	err = dynamodbattribute.UnmarshalListOfMaps(result.Items, &expenseItems)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal Expense items: %v", err)
+	}
+
+	return expenseItems, nil
+}
+
+// GetItemCurrency returns the currency of a monthly item, or "" if the item
+// has none or does not exist.
+func GetItemCurrency(tableName string, userId string, month string, sortKey string, name string) (string, error) {
+	// Create the composite key
+	userIdMonth := fmt.Sprintf("%s#%s", userId, month)
+
+	input := &dynamodb.GetItemInput{
+		TableName: aws.String(tableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			"userId#month": {S: aws.String(userIdMonth)},
+			sortKey:        {S: aws.String(name)},
+		},
+		ProjectionExpression: aws.String("currency"),
+	}
+
+	result, err := db.GetItem(input)
+	if err != nil {
+		return "", fmt.Errorf("failed to get %s item: %v", tableName, err)
+	}
+
+	if value, ok := result.Item["currency"]; ok {
+		return aws.StringValue(value.S), nil
+	}
+	return "", nil
+}
+
+// GetExpense returns a single expense item, or nil if it does not exist
+func GetExpense(userId string, month string, expenseItemName string) (*ExpenseItem, error) {
+	// Create the composite key
+	userIdMonth := fmt.Sprintf("%s#%s", userId, month)
+
+	input := &dynamodb.GetItemInput{
+		TableName: aws.String("Expenses"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"userId#month":    {S: aws.String(userIdMonth)},
+			"expenseItemName": {S: aws.String(expenseItemName)},
+		},
+	}
+
+	result, err := db.GetItem(input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Expense item: %v", err)
+	}
+
+	if result.Item == nil {
+		return nil, nil
+	}
+
+	var expenseItem ExpenseItem
+	err = dynamodbattribute.UnmarshalMap(result.Item, &expenseItem)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal Expense item: %v", err)
+	}
+
+	return &expenseItem, nil
+}
+
+func UpdateExpense(userId string, month string, expenseItemName string, newValue Money, newTags []string, newSplits []ExpenseSplit, newSharing *ExpenseSharing) error {
+	// Create the composite key
+	userIdMonth := fmt.Sprintf("%s#%s", userId, month)
+
+	// Create the update expression
+	update := expression.
+		Set(expression.Name("expenseItemValue"), expression.Value(newValue)).
+		Set(expression.Name("expenseTags"), expression.Value(newTags))
+	if len(newSplits) > 0 {
+		update = update.Set(expression.Name("splits"), expression.Value(newSplits))
+	} else {
+		update = update.Remove(expression.Name("splits"))
+	}
+	if newSharing != nil {
+		update = update.Set(expression.Name("sharing"), expression.Value(newSharing))
+	} else {
+		update = update.Remove(expression.Name("sharing"))
+	}
+
+	expr, err := expression.NewBuilder().WithUpdate(update).Build()
+	if err != nil {
+		return fmt.Errorf("failed to build expression: %v", err)
+	}
+
+	// Create the update item input
+	input := &dynamodb.UpdateItemInput{
+		TableName: aws.String("Expenses"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"userId#month":    {S: aws.String(userIdMonth)},
+			"expenseItemName": {S: aws.String(expenseItemName)},
+		},
+		UpdateExpression:          expr.Update(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		ReturnValues:              aws.String("UPDATED_NEW"),
+	}
+
+	// Execute the update
+	_, err = db.UpdateItem(input)
+	if err != nil {
+		return fmt.Errorf("failed to update Expense item: %v", err)
+	}
+
+	return nil
+}
+
+// ClearExpenseDuplicate removes the duplicate flag from an expense item
+func ClearExpenseDuplicate(userId string, month string, expenseItemName string) error {
+	// Create the composite key
+	userIdMonth := fmt.Sprintf("%s#%s", userId, month)
+
+	update := expression.Remove(expression.Name("duplicateOf")).Remove(expression.Name("duplicateOfMonth"))
+	expr, err := expression.NewBuilder().WithUpdate(update).Build()
+	if err != nil {
+		return fmt.Errorf("failed to build expression: %v", err)
+	}
+
+	input := &dynamodb.UpdateItemInput{
+		TableName: aws.String("Expenses"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"userId#month":    {S: aws.String(userIdMonth)},
+			"expenseItemName": {S: aws.String(expenseItemName)},
+		},
+		UpdateExpression:         expr.Update(),
+		ExpressionAttributeNames: expr.Names(),
+	}
+
+	_, err = db.UpdateItem(input)
+	if err != nil {
+		return fmt.Errorf("failed to update Expense item: %v", err)
+	}
+
+	return nil
+}
+
+// RepointExpenseDuplicate flags an expense item as a duplicate of another
+// item in place of the one it was flagged against. It reports false, without
+// an error, when the flag has been dismissed or changed, or the item deleted,
+// since it was read.
+func RepointExpenseDuplicate(item ExpenseItem, previous string) (bool, error) {
+	// Create the composite key
+	userIdMonth := fmt.Sprintf("%s#%s", item.UserId, item.Month)
+
+	update := expression.Set(expression.Name("duplicateOf"), expression.Value(item.DuplicateOf))
+	if item.DuplicateOfMonth != "" {
+		update = update.Set(expression.Name("duplicateOfMonth"), expression.Value(item.DuplicateOfMonth))
+	} else {
+		update = update.Remove(expression.Name("duplicateOfMonth"))
+	}
+	condition := expression.Name("duplicateOf").Equal(expression.Value(previous))
+	expr, err := expression.NewBuilder().WithUpdate(update).WithCondition(condition).Build()
+	if err != nil {
+		return false, fmt.Errorf("failed to build expression: %v", err)
+	}
+
+	input := &dynamodb.UpdateItemInput{
+		TableName: aws.String("Expenses"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"userId#month":    {S: aws.String(userIdMonth)},
+			"expenseItemName": {S: aws.String(item.ExpenseItemName)},
+		},
+		UpdateExpression:          expr.Update(),
+		ConditionExpression:       expr.Condition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+	}
+
+	_, err = db.UpdateItem(input)
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to update Expense item: %v", err)
+	}
+
+	return true, nil
+}
+
+// DeleteExpense removes an expense item from the Expenses table
+func DeleteExpense(userId string, month string, expenseItemName string) error {
+	// Create the composite key
+	userIdMonth := fmt.Sprintf("%s#%s", userId, month)
+
+	// Create the delete item input
+	input := &dynamodb.DeleteItemInput{
+		TableName: aws.String("Expenses"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"userId#month":    {S: aws.String(userIdMonth)},
+			"expenseItemName": {S: aws.String(expenseItemName)},
+		},
+	}
+
+	// Execute the delete operation
+	_, err := db.DeleteItem(input)
+	if err != nil {
+		return fmt.Errorf("failed to delete Expense item: %v", err)
+	}
+
+	return nil
+}
+
+// AddAccount creates or replaces an account in the Accounts table
+func AddAccount(account Account) error {
+	av, err := dynamodbattribute.MarshalMap(account)
+	if err != nil {
+		return fmt.Errorf("failed to marshal Account: %v", err)
+	}
+
+	input := &dynamodb.PutItemInput{
+		TableName: aws.String("Accounts"),
+		Item:      av,
+	}
+
+	_, err = db.PutItem(input)
+	if err != nil {
+		return fmt.Errorf("failed to add Account: %v", err)
+	}
+
+	return nil
+}
+
+func GetAllAccounts(userId string) ([]Account, error) {
+	keyCond := expression.Key("userId").Equal(expression.Value(userId))
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCond).Build()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build expression: %v", err)
+	}
+
+	input := &dynamodb.QueryInput{
+		TableName:                 aws.String("Accounts"),
+		KeyConditionExpression:    expr.KeyCondition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+	}
+
+	// Execute the query
+	result, err := db.Query(input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query Accounts: %v", err)
+	}
+
+	// Unmarshal the results
+	accounts := []Account{}
+	err = dynamodbattribute.UnmarshalListOfMaps(result.Items, &accounts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal Accounts: %v", err)
+	}
+
+	return accounts, nil
+}
+
+// GetAccount returns a single account, or nil if it does not exist
+func GetAccount(userId string, accountId string) (*Account, error) {
+	input := &dynamodb.GetItemInput{
+		TableName: aws.String("Accounts"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"userId":    {S: aws.String(userId)},
+			"accountId": {S: aws.String(accountId)},
+		},
+	}
+
+	result, err := db.GetItem(input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Account: %v", err)
+	}
+
+	if result.Item == nil {
+		return nil, nil
+	}
+
+	var account Account
+	err = dynamodbattribute.UnmarshalMap(result.Item, &account)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal Account: %v", err)
+	}
+
+	return &account, nil
+}
+
+// DeleteAccount removes an account from the Accounts table
+func DeleteAccount(userId string, accountId string) error {
+	input := &dynamodb.DeleteItemInput{
+		TableName: aws.String("Accounts"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"userId":    {S: aws.String(userId)},
+			"accountId": {S: aws.String(accountId)},
+		},
+	}
+
+	_, err := db.DeleteItem(input)
+	if err != nil {
+		return fmt.Errorf("failed to delete Account: %v", err)
+	}
+
+	return nil
+}
+
+// AddTransfer adds a new transfer to the Transfers table
+func AddTransfer(transfer Transfer) error {
+	// Create the composite key
+	userIdMonth := fmt.Sprintf("%s#%s", transfer.UserId, transfer.Month)
+
+	av, err := dynamodbattribute.MarshalMap(transfer)
+	if err != nil {
+		return fmt.Errorf("failed to marshal Transfer: %v", err)
+	}
+
+	// Add the composite key to the item
+	av["userId#month"] = &dynamodb.AttributeValue{S: aws.String(userIdMonth)}
+
+	input := &dynamodb.PutItemInput{
+		TableName: aws.String("Transfers"),
+		Item:      av,
+	}
+
+	_, err = db.PutItem(input)
+	if err != nil {
+		return fmt.Errorf("failed to add Transfer: %v", err)
+	}
+
+	return AddUserMonths(transfer.UserId, transfer.Month)
+}
+
+func GetAllTransfers(userId string, month string) ([]Transfer, error) {
+	// Create the composite key
+	userIdMonth := fmt.Sprintf("%s#%s", userId, month)
+
+	keyCond := expression.Key("userId#month").Equal(expression.Value(userIdMonth))
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCond).Build()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build expression: %v", err)
+	}
+
+	input := &dynamodb.QueryInput{
+		TableName:                 aws.String("Transfers"),
+		KeyConditionExpression:    expr.KeyCondition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+	}
+
+	// Execute the query
+	result, err := db.Query(input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query Transfers: %v", err)
+	}
+
+	// Unmarshal the results
+	transfers := []Transfer{}
+	err = dynamodbattribute.UnmarshalListOfMaps(result.Items, &transfers)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal Transfers: %v", err)
+	}
+
+	return transfers, nil
+}
+
+// DeleteTransfer removes a transfer from the Transfers table
+func DeleteTransfer(userId string, month string, transferId string) error {
+	// Create the composite key
+	userIdMonth := fmt.Sprintf("%s#%s", userId, month)
+
+	input := &dynamodb.DeleteItemInput{
+		TableName: aws.String("Transfers"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"userId#month": {S: aws.String(userIdMonth)},
+			"transferId":   {S: aws.String(transferId)},
+		},
+	}
+
+	_, err := db.DeleteItem(input)
+	if err != nil {
+		return fmt.Errorf("failed to delete Transfer: %v", err)
+	}
+
+	return nil
+}
+
+// AddUserMonths records that a user has items in the given months, so that
+// reads across all months can query each month's partition instead of
+// scanning whole tables. Recording a month again is harmless.
+func AddUserMonths(userId string, months ...string) error {
+	seen := make(map[string]bool)
+	var writeRequests []*dynamodb.WriteRequest
+	for _, month := range months {
+		if month == "" || seen[month] {
+			continue
+		}
+		seen[month] = true
+		writeRequests = append(writeRequests, &dynamodb.WriteRequest{
+			PutRequest: &dynamodb.PutRequest{
+				Item: map[string]*dynamodb.AttributeValue{
+					"userId": {S: aws.String(userId)},
+					"month":  {S: aws.String(month)},
+				},
+			},
+		})
+	}
+	if len(writeRequests) == 0 {
+		return nil
+	}
+
+	err := batchWrite("UserMonths", writeRequests)
+	if err != nil {
+		return fmt.Errorf("failed to add UserMonths items: %v", err)
+	}
+
+	return nil
+}
+
+// GetUserMonths returns the months a user has items in, oldest first
+func GetUserMonths(userId string) ([]string, error) {
+	months := []string{}
+	err := QueryUserItems("UserMonths", userId, func(item map[string]*dynamodb.AttributeValue) error {
+		if month, ok := item["month"]; ok && month.S != nil {
+			months = append(months, *month.S)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return months, nil
+}
+
+// QueryUserMonthItems calls fn for every item of a table partitioned by
+// userId#month that belongs to the user, across all the months recorded by
+// AddUserMonths. Items are passed page by page as they are read, so callers
+// can stream them without holding them all in memory.
+func QueryUserMonthItems(tableName string, userId string, fn func(item map[string]*dynamodb.AttributeValue) error) error {
+	months, err := GetUserMonths(userId)
+	if err != nil {
+		return err
+	}
+
+	for _, month := range months {
+		keyCond := expression.Key("userId#month").Equal(expression.Value(userId + "#" + month))
+		expr, err := expression.NewBuilder().WithKeyCondition(keyCond).Build()
+		if err != nil {
+			return fmt.Errorf("failed to build expression: %v", err)
+		}
+
+		input := &dynamodb.QueryInput{
+			TableName:                 aws.String(tableName),
+			KeyConditionExpression:    expr.KeyCondition(),
+			ExpressionAttributeNames:  expr.Names(),
+			ExpressionAttributeValues: expr.Values(),
+		}
+
+		var callbackErr error
+		err = db.QueryPages(input, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+			for _, item := range page.Items {
+				if callbackErr = fn(item); callbackErr != nil {
+					return false
+				}
+			}
+			return true
+		})
+		if callbackErr != nil {
+			return callbackErr
+		}
+		if err != nil {
+			return fmt.Errorf("failed to query %s items: %v", tableName, err)
+		}
+	}
+
+	return nil
+}
+
+// ScanAllItems calls fn for every item in a table, across all users. It is
+// meant for admin commands such as migrations.
+func ScanAllItems(tableName string, fn func(item map[string]*dynamodb.AttributeValue) error) error {
+	input := &dynamodb.ScanInput{
+		TableName: aws.String(tableName),
+	}
+
+	var callbackErr error
+	err := db.ScanPages(input, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			if callbackErr = fn(item); callbackErr != nil {
+				return false
+			}
+		}
+		return true
+	})
+	if callbackErr != nil {
+		return callbackErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to scan %s items: %v", tableName, err)
+	}
+
+	return nil
+}
+
+// RewriteMoney writes the exact form of an item's amounts. Only those
+// attributes are written, and only while they and the item's currency hold
+// the values they were read with. It reports false, without an error, when
+// the item has changed or been deleted since it was read.
+func RewriteMoney(tableName string, key map[string]*dynamodb.AttributeValue, currency string, rewrites []moneyRewrite) (bool, error) {
+	if len(rewrites) == 0 {
+		return false, nil
+	}
+
+	condition := expression.Name("currency").Equal(expression.Value(currency))
+	if currency == "" {
+		condition = expression.Or(
+			expression.AttributeNotExists(expression.Name("currency")),
+			expression.Name("currency").Equal(expression.Value("")),
+		)
+	}
+	var update expression.UpdateBuilder
+	for _, rewrite := range rewrites {
+		update = update.Set(expression.Name(rewrite.Name), expression.Value(dynamodbattribute.Number(rewrite.Exact)))
+		condition = condition.And(expression.Name(rewrite.Name).Equal(expression.Value(dynamodbattribute.Number(rewrite.Old))))
+	}
+	expr, err := expression.NewBuilder().WithUpdate(update).WithCondition(condition).Build()
+	if err != nil {
+		return false, fmt.Errorf("failed to build expression: %v", err)
+	}
+
+	input := &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(tableName),
+		Key:                       key,
+		UpdateExpression:          expr.Update(),
+		ConditionExpression:       expr.Condition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+	}
+
+	_, err = db.UpdateItem(input)
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to rewrite %s amounts: %v", tableName, err)
+	}
+
+	return true, nil
+}
+
+// SetMissingCurrency sets the currency of an item that does not have one.
+// It reports false, without an error, when the item has been given a
+// currency or deleted since it was read.
+func SetMissingCurrency(tableName string, key map[string]*dynamodb.AttributeValue, currency string) (bool, error) {
+	update := expression.Set(expression.Name("currency"), expression.Value(currency))
+	condition := expression.AttributeExists(expression.Name("userId")).And(
+		expression.Or(
+			expression.AttributeNotExists(expression.Name("currency")),
+			expression.Name("currency").Equal(expression.Value("")),
+		))
+	expr, err := expression.NewBuilder().WithUpdate(update).WithCondition(condition).Build()
+	if err != nil {
+		return false, fmt.Errorf("failed to build expression: %v", err)
+	}
+
+	input := &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(tableName),
+		Key:                       key,
+		UpdateExpression:          expr.Update(),
+		ConditionExpression:       expr.Condition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+	}
+
+	_, err = db.UpdateItem(input)
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to update %s item: %v", tableName, err)
+	}
+
+	return true, nil
+}
+
+// GetUserSettings returns a user's settings, with defaults for a user who
+// has not saved any
+func GetUserSettings(userId string) (*UserSettings, error) {
+	input := &dynamodb.GetItemInput{
+		TableName: aws.String("UserSettings"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"userId": {S: aws.String(userId)},
+		},
+	}
+
+	result, err := db.GetItem(input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get UserSettings: %v", err)
+	}
+
+	settings := UserSettings{UserId: userId}
+	if result.Item != nil {
+		err = dynamodbattribute.UnmarshalMap(result.Item, &settings)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal UserSettings: %v", err)
+		}
+	}
+	if settings.BaseCurrency == "" {
+		settings.BaseCurrency = defaultBaseCurrency
+	}
+
+	return &settings, nil
+}
+
+// PutUserSettings creates or replaces a user's settings
+func PutUserSettings(settings UserSettings) error {
+	av, err := dynamodbattribute.MarshalMap(settings)
+	if err != nil {
+		return fmt.Errorf("failed to marshal UserSettings: %v", err)
+	}
+
+	input := &dynamodb.PutItemInput{
+		TableName: aws.String("UserSettings"),
+		Item:      av,
+	}
+
+	_, err = db.PutItem(input)
+	if err != nil {
+		return fmt.Errorf("failed to put UserSettings: %v", err)
+	}
+
+	return nil
+}
+
+// AddExchangeRates stores exchange rates, replacing any with the same pair
+// and date
+func AddExchangeRates(rates []ExchangeRate) error {
+	items := make([]map[string]*dynamodb.AttributeValue, 0, len(rates))
+	for _, rate := range rates {
+		av, err := dynamodbattribute.MarshalMap(rate)
+		if err != nil {
+			return fmt.Errorf("failed to marshal ExchangeRate: %v", err)
+		}
+		items = append(items, av)
+	}
+
+	return PutItems("ExchangeRates", items)
+}
+
+func GetAllExchangeRates(userId string) ([]ExchangeRate, error) {
+	rates := []ExchangeRate{}
+	err := QueryUserItems("ExchangeRates", userId, func(av map[string]*dynamodb.AttributeValue) error {
+		var rate ExchangeRate
+		if err := dynamodbattribute.UnmarshalMap(av, &rate); err != nil {
+			return fmt.Errorf("failed to unmarshal ExchangeRate: %v", err)
+		}
+		rates = append(rates, rate)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return rates, nil
+}
+
+// DeleteExchangeRate removes an exchange rate from the ExchangeRates table
+func DeleteExchangeRate(userId string, rateId string) error {
+	input := &dynamodb.DeleteItemInput{
+		TableName: aws.String("ExchangeRates"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"userId": {S: aws.String(userId)},
+			"rateId": {S: aws.String(rateId)},
+		},
+	}
+
+	_, err := db.DeleteItem(input)
+	if err != nil {
+		return fmt.Errorf("failed to delete ExchangeRate: %v", err)
+	}
+
+	return nil
+}
+
+// queryAllUserMonthItems reads every item of a user's month partitions in a
+// table
+func queryAllUserMonthItems[T any](tableName string, userId string) ([]T, error) {
+	items := []T{}
+	err := QueryUserMonthItems(tableName, userId, func(av map[string]*dynamodb.AttributeValue) error {
+		var item T
+		if err := dynamodbattribute.UnmarshalMap(av, &item); err != nil {
+			return fmt.Errorf("failed to unmarshal %s item: %v", tableName, err)
+		}
+		items = append(items, item)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// queryAllUserItems reads every item of a table partitioned by userId alone
+func queryAllUserItems[T any](tableName string, userId string) ([]T, error) {
+	items := []T{}
+	err := QueryUserItems(tableName, userId, func(av map[string]*dynamodb.AttributeValue) error {
+		var item T
+		if err := dynamodbattribute.UnmarshalMap(av, &item); err != nil {
+			return fmt.Errorf("failed to unmarshal %s item: %v", tableName, err)
+		}
+		items = append(items, item)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// putUserItem adds or replaces an item of a table partitioned by userId alone
+func putUserItem(tableName string, item interface{}) error {
+	av, err := dynamodbattribute.MarshalMap(item)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s item: %v", tableName, err)
+	}
+
+	input := &dynamodb.PutItemInput{
+		TableName: aws.String(tableName),
+		Item:      av,
+	}
+
+	_, err = db.PutItem(input)
+	if err != nil {
+		return fmt.Errorf("failed to put %s item: %v", tableName, err)
+	}
+
+	return nil
+}
+
+// getUserItem reads one item of a table partitioned by userId alone, or
+// returns nil if it does not exist
+func getUserItem[T any](tableName string, userId string, sortKey string, id string) (*T, error) {
+	input := &dynamodb.GetItemInput{
+		TableName: aws.String(tableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			"userId": {S: aws.String(userId)},
+			sortKey:  {S: aws.String(id)},
+		},
+	}
+
+	result, err := db.GetItem(input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s item: %v", tableName, err)
+	}
+
+	if result.Item == nil {
+		return nil, nil
+	}
+
+	var item T
+	err = dynamodbattribute.UnmarshalMap(result.Item, &item)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal %s item: %v", tableName, err)
+	}
+
+	return &item, nil
+}
+
+// deleteUserItem removes one item of a table partitioned by userId alone
+func deleteUserItem(tableName string, userId string, sortKey string, id string) error {
+	input := &dynamodb.DeleteItemInput{
+		TableName: aws.String(tableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			"userId": {S: aws.String(userId)},
+			sortKey:  {S: aws.String(id)},
+		},
+	}
+
+	_, err := db.DeleteItem(input)
+	if err != nil {
+		return fmt.Errorf("failed to delete %s item: %v", tableName, err)
 	}
 
-	for _, table := range tables {
+	return nil
+}
 
-		input := &dynamodb.CreateTableInput{
-			AttributeDefinitions: table.Attributes,
-			KeySchema:            table.KeySchema,
-			BillingMode:          aws.String("PAY_PER_REQUEST"), // This enables on-demand capacity
-			TableName:            aws.String(table.Name),
-		}
+// GetAllUserIncome returns a user's income items across all months
+func GetAllUserIncome(userId string) ([]IncomeItem, error) {
+	return queryAllUserMonthItems[IncomeItem]("Income", userId)
+}
 
-		log.Println("Creating table %v", input)
-		_, err := db.CreateTable(input)
-		if err != nil {
-			log.Println("failed %v", err)
-			return fmt.Errorf("failed to create table %s: %v", table.Name, err)
+// GetAllUserExpenses returns a user's expense items across all months
+func GetAllUserExpenses(userId string) ([]ExpenseItem, error) {
+	return queryAllUserMonthItems[ExpenseItem]("Expenses", userId)
+}
+
+// GetAllUserTransfers returns a user's transfers across all months
+func GetAllUserTransfers(userId string) ([]Transfer, error) {
+	return queryAllUserMonthItems[Transfer]("Transfers", userId)
+}
+
+// QueryUserItems calls fn for every item of a table partitioned by userId
+// alone, page by page as they are read
+func QueryUserItems(tableName string, userId string, fn func(item map[string]*dynamodb.AttributeValue) error) error {
+	keyCond := expression.Key("userId").Equal(expression.Value(userId))
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCond).Build()
+	if err != nil {
+		return fmt.Errorf("failed to build expression: %v", err)
+	}
+
+	input := &dynamodb.QueryInput{
+		TableName:                 aws.String(tableName),
+		KeyConditionExpression:    expr.KeyCondition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+	}
+
+	var callbackErr error
+	err = db.QueryPages(input, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			if callbackErr = fn(item); callbackErr != nil {
+				return false
+			}
 		}
-		fmt.Printf("Created table %s\n", table.Name)
+		return true
+	})
+	if callbackErr != nil {
+		return callbackErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to query %s items: %v", tableName, err)
 	}
 
 	return nil
 }
 
-// AddIncome adds a new income item to the Income table
-func AddIncome(item IncomeItem) error {
-	// Create the composite key
-	userIdMonth := fmt.Sprintf("%s#%s", item.UserId, item.Month)
+func CreateUserEntry(registerData RegisterData) error {
+	// Generate a unique ID for the user
+	userID := uuid.New().String()
+
+	// Store user data in DynamoDB
+	_, err := db.PutItem(&dynamodb.PutItemInput{
+		TableName: aws.String("Users"),
+		Item: map[string]*dynamodb.AttributeValue{
+			"userName": {
+				S: aws.String(registerData.Username),
+			},
+			"userId": {
+				S: aws.String(userID),
+			},
+		},
+	})
 
-	av, err := dynamodbattribute.MarshalMap(item)
 	if err != nil {
-		return fmt.Errorf("failed to marshal Income item: %v", err)
+		return fmt.Errorf("Failed to create user in DB :  " + err.Error())
+	}
+	return nil
+
+}
+
+func GetUserIdByUserName(userName string) (string, error) {
+
+	input := &dynamodb.GetItemInput{
+		TableName: aws.String("Users"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"userName": {
+				S: aws.String(userName),
+			},
+		},
+	}
+
+	result, err := db.GetItem(input)
+	if err != nil {
+		return "", err
+	}
+
+	if result.Item == nil {
+		return "", fmt.Errorf("user not found")
+	}
+
+	var userData UserData
+	err = dynamodbattribute.UnmarshalMap(result.Item, &userData)
+	if err != nil {
+		return "", err
+	}
+
+	return userData.UserId, nil
+}
+
+// AddHousehold adds a new household to the Households table
+func AddHousehold(household Household) error {
+	av, err := dynamodbattribute.MarshalMap(household)
+	if err != nil {
+		return fmt.Errorf("failed to marshal Household: %v", err)
 	}
 
-	// Add the composite key to the item
-	av["userId#month"] = &dynamodb.AttributeValue{S: aws.String(userIdMonth)}
-	log.Printf("Adding : %v", av)
 	input := &dynamodb.PutItemInput{
-		TableName: aws.String("Income"),
+		TableName: aws.String("Households"),
 		Item:      av,
 	}
 
 	_, err = db.PutItem(input)
 	if err != nil {
-		return fmt.Errorf("failed to add Income item: %v", err)
+		return fmt.Errorf("failed to add Household: %v", err)
 	}
 
 	return nil
 }
 
-func GetAllIncome(userId string, month string) ([]IncomeItem, error) {
-	// Create the composite key
-	userIdMonth := fmt.Sprintf("%s#%s", userId, month)
+// GetHousehold returns a household, or nil if it does not exist
+func GetHousehold(householdId string) (*Household, error) {
+	input := &dynamodb.GetItemInput{
+		TableName: aws.String("Households"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"householdId": {S: aws.String(householdId)},
+		},
+	}
 
-	// Create the query input
-	keyCond := expression.Key("userId#month").Equal(expression.Value(userIdMonth))
+	result, err := db.GetItem(input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Household: %v", err)
+	}
+
+	if result.Item == nil {
+		return nil, nil
+	}
+
+	var household Household
+	err = dynamodbattribute.UnmarshalMap(result.Item, &household)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal Household: %v", err)
+	}
+
+	return &household, nil
+}
+
+// PutHouseholdMember adds a member to a household or changes their role
+func PutHouseholdMember(member HouseholdMember) error {
+	av, err := dynamodbattribute.MarshalMap(member)
+	if err != nil {
+		return fmt.Errorf("failed to marshal HouseholdMember: %v", err)
+	}
+
+	input := &dynamodb.PutItemInput{
+		TableName: aws.String("HouseholdMembers"),
+		Item:      av,
+	}
+
+	_, err = db.PutItem(input)
+	if err != nil {
+		return fmt.Errorf("failed to put HouseholdMember: %v", err)
+	}
+
+	return nil
+}
+
+// GetHouseholdMember returns a user's membership of a household, or nil if
+// they are not a member
+func GetHouseholdMember(householdId string, userId string) (*HouseholdMember, error) {
+	input := &dynamodb.GetItemInput{
+		TableName: aws.String("HouseholdMembers"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"householdId": {S: aws.String(householdId)},
+			"userId":      {S: aws.String(userId)},
+		},
+	}
+
+	result, err := db.GetItem(input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get HouseholdMember: %v", err)
+	}
+
+	if result.Item == nil {
+		return nil, nil
+	}
+
+	var member HouseholdMember
+	err = dynamodbattribute.UnmarshalMap(result.Item, &member)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal HouseholdMember: %v", err)
+	}
+
+	return &member, nil
+}
+
+func GetHouseholdMembers(householdId string) ([]HouseholdMember, error) {
+	keyCond := expression.Key("householdId").Equal(expression.Value(householdId))
 	expr, err := expression.NewBuilder().WithKeyCondition(keyCond).Build()
 	if err != nil {
 		return nil, fmt.Errorf("failed to build expression: %v", err)
 	}
 
 	input := &dynamodb.QueryInput{
-		TableName:                 aws.String("Income"),
+		TableName:                 aws.String("HouseholdMembers"),
 		KeyConditionExpression:    expr.KeyCondition(),
 		ExpressionAttributeNames:  expr.Names(),
 		ExpressionAttributeValues: expr.Values(),
 	}
 
-	// Execute the query
 	result, err := db.Query(input)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query Income items: %v", err)
+		return nil, fmt.Errorf("failed to query HouseholdMembers: %v", err)
 	}
 
-	// Unmarshal the results
-	var incomeItems []IncomeItem
-	err = dynamodbattribute.UnmarshalListOfMaps(result.Items, &incomeItems)
+	var members []HouseholdMember
+	err = dynamodbattribute.UnmarshalListOfMaps(result.Items, &members)
 	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal Income items: %v", err)
+		return nil, fmt.Errorf("failed to unmarshal HouseholdMembers: %v", err)
 	}
 
-	return incomeItems, nil
+	return members, nil
 }
 
-func UpdateIncome(userId string, month string, incomeItemName string, newValue float64) error {
-	// Create the composite key
-	userIdMonth := fmt.Sprintf("%s#%s", userId, month)
-
-	// Create the update expression
-	update := expression.Set(expression.Name("incomeItemValue"), expression.Value(newValue))
-	expr, err := expression.NewBuilder().WithUpdate(update).Build()
+// GetUserMemberships returns every household membership of a user
+func GetUserMemberships(userId string) ([]HouseholdMember, error) {
+	filter := expression.Name("userId").Equal(expression.Value(userId))
+	expr, err := expression.NewBuilder().WithFilter(filter).Build()
 	if err != nil {
-		return fmt.Errorf("failed to build expression: %v", err)
+		return nil, fmt.Errorf("failed to build expression: %v", err)
 	}
 
-	// Create the update item input
-	input := &dynamodb.UpdateItemInput{
-		TableName: aws.String("Income"),
-		Key: map[string]*dynamodb.AttributeValue{
-			"userId#month":   {S: aws.String(userIdMonth)},
-			"incomeItemName": {S: aws.String(incomeItemName)},
-		},
-		UpdateExpression:          expr.Update(),
+	input := &dynamodb.ScanInput{
+		TableName:                 aws.String("HouseholdMembers"),
+		FilterExpression:          expr.Filter(),
 		ExpressionAttributeNames:  expr.Names(),
 		ExpressionAttributeValues: expr.Values(),
-		ReturnValues:              aws.String("UPDATED_NEW"),
 	}
 
-	// Execute the update
-	_, err = db.UpdateItem(input)
+	var members []HouseholdMember
+	var unmarshalErr error
+	err = db.ScanPages(input, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+		var pageMembers []HouseholdMember
+		if unmarshalErr = dynamodbattribute.UnmarshalListOfMaps(page.Items, &pageMembers); unmarshalErr != nil {
+			return false
+		}
+		members = append(members, pageMembers...)
+		return true
+	})
+	if unmarshalErr != nil {
+		return nil, fmt.Errorf("failed to unmarshal HouseholdMembers: %v", unmarshalErr)
+	}
 	if err != nil {
-		return fmt.Errorf("failed to update Income item: %v", err)
+		return nil, fmt.Errorf("failed to scan HouseholdMembers: %v", err)
 	}
 
-	return nil
+	return members, nil
 }
 
-// DeleteIncome removes an income item from the Income table
-func DeleteIncome(userId string, month string, incomeItemName string) error {
-	// Create the composite key
-	userIdMonth := fmt.Sprintf("%s#%s", userId, month)
-
-	// Create the delete item input
+// DeleteHouseholdMember removes a member from a household
+func DeleteHouseholdMember(householdId string, userId string) error {
 	input := &dynamodb.DeleteItemInput{
-		TableName: aws.String("Income"),
+		TableName: aws.String("HouseholdMembers"),
 		Key: map[string]*dynamodb.AttributeValue{
-			"userId#month":   {S: aws.String(userIdMonth)},
-			"incomeItemName": {S: aws.String(incomeItemName)},
+			"householdId": {S: aws.String(householdId)},
+			"userId":      {S: aws.String(userId)},
 		},
 	}
 
-	// Execute the delete operation
 	_, err := db.DeleteItem(input)
 	if err != nil {
-		return fmt.Errorf("failed to delete Income item: %v", err)
+		return fmt.Errorf("failed to delete HouseholdMember: %v", err)
 	}
 
 	return nil
 }
 
-// AddBudget adds a new budget item to the Budget table
-func AddBudget(item BudgetItem) error {
-	// Create the composite key
-	userIdMonth := fmt.Sprintf("%s#%s", item.UserID, item.Month)
-
-	av, err := dynamodbattribute.MarshalMap(item)
+// AddHouseholdInvitation adds a new invitation to the HouseholdInvitations
+// table
+func AddHouseholdInvitation(invitation HouseholdInvitation) error {
+	av, err := dynamodbattribute.MarshalMap(invitation)
 	if err != nil {
-		return fmt.Errorf("failed to marshal Budget item: %v", err)
+		return fmt.Errorf("failed to marshal HouseholdInvitation: %v", err)
 	}
 
-	// Add the composite key to the item
-	av["userId#month"] = &dynamodb.AttributeValue{S: aws.String(userIdMonth)}
-
 	input := &dynamodb.PutItemInput{
-		TableName: aws.String("Budget"),
+		TableName: aws.String("HouseholdInvitations"),
 		Item:      av,
 	}
 
 	_, err = db.PutItem(input)
 	if err != nil {
-		return fmt.Errorf("failed to add Budget item: %v", err)
+		return fmt.Errorf("failed to add HouseholdInvitation: %v", err)
 	}
 
 	return nil
 }
 
-func GetAllBudget(userId string, month string) ([]BudgetItem, error) {
-	// Create the composite key
-	userIdMonth := fmt.Sprintf("%s#%s", userId, month)
+// GetHouseholdInvitation returns an invitation, or nil if it does not exist
+func GetHouseholdInvitation(householdId string, invitationId string) (*HouseholdInvitation, error) {
+	input := &dynamodb.GetItemInput{
+		TableName: aws.String("HouseholdInvitations"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"householdId":  {S: aws.String(householdId)},
+			"invitationId": {S: aws.String(invitationId)},
+		},
+	}
 
-	// Create the query input
-	keyCond := expression.Key("userId#month").Equal(expression.Value(userIdMonth))
+	result, err := db.GetItem(input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get HouseholdInvitation: %v", err)
+	}
+
+	if result.Item == nil {
+		return nil, nil
+	}
+
+	var invitation HouseholdInvitation
+	err = dynamodbattribute.UnmarshalMap(result.Item, &invitation)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal HouseholdInvitation: %v", err)
+	}
+
+	return &invitation, nil
+}
+
+func GetHouseholdInvitations(householdId string) ([]HouseholdInvitation, error) {
+	keyCond := expression.Key("householdId").Equal(expression.Value(householdId))
 	expr, err := expression.NewBuilder().WithKeyCondition(keyCond).Build()
 	if err != nil {
 		return nil, fmt.Errorf("failed to build expression: %v", err)
 	}
 
 	input := &dynamodb.QueryInput{
-		TableName:                 aws.String("Budget"),
+		TableName:                 aws.String("HouseholdInvitations"),
 		KeyConditionExpression:    expr.KeyCondition(),
 		ExpressionAttributeNames:  expr.Names(),
 		ExpressionAttributeValues: expr.Values(),
 	}
 
-	// Execute the query
 	result, err := db.Query(input)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query Budget items: %v", err)
+		return nil, fmt.Errorf("failed to query HouseholdInvitations: %v", err)
 	}
 
-	// Unmarshal the results
-	var budgetItems []BudgetItem
-	err = dynamodbattribute.UnmarshalListOfMaps(result.Items, &budgetItems)
+	var invitations []HouseholdInvitation
+	err = dynamodbattribute.UnmarshalListOfMaps(result.Items, &invitations)
 	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal Budget items: %v", err)
+		return nil, fmt.Errorf("failed to unmarshal HouseholdInvitations: %v", err)
 	}
 
-	return budgetItems, nil
+	return invitations, nil
 }
 
-func UpdateBudget(userId string, month string, budgetItemName string, newValue float64) error {
-	// Create the composite key
-	userIdMonth := fmt.Sprintf("%s#%s", userId, month)
-
-	// Create the update expression
-	update := expression.Set(expression.Name("budgetItemValue"), expression.Value(newValue))
-	expr, err := expression.NewBuilder().WithUpdate(update).Build()
+// GetInvitationsFor returns the pending invitations addressed to any of the
+// given usernames or emails
+func GetInvitationsFor(invitees []string) ([]HouseholdInvitation, error) {
+	var operands []expression.OperandBuilder
+	for _, invitee := range invitees {
+		operands = append(operands, expression.Value(invitee))
+	}
+	if len(operands) == 0 {
+		return nil, nil
+	}
+	filter := expression.Name("invitee").In(operands[0], operands[1:]...)
+	expr, err := expression.NewBuilder().WithFilter(filter).Build()
 	if err != nil {
-		return fmt.Errorf("failed to build expression: %v", err)
+		return nil, fmt.Errorf("failed to build expression: %v", err)
 	}
 
-	// Create the update item input
-	input := &dynamodb.UpdateItemInput{
-		TableName: aws.String("Budget"),
-		Key: map[string]*dynamodb.AttributeValue{
-			"userId#month":   {S: aws.String(userIdMonth)},
-			"budgetItemName": {S: aws.String(budgetItemName)},
-		},
-		UpdateExpression:          expr.Update(),
+	input := &dynamodb.ScanInput{
+		TableName:                 aws.String("HouseholdInvitations"),
+		FilterExpression:          expr.Filter(),
 		ExpressionAttributeNames:  expr.Names(),
 		ExpressionAttributeValues: expr.Values(),
-		ReturnValues:              aws.String("UPDATED_NEW"),
 	}
 
-	// Execute the update
-	_, err = db.UpdateItem(input)
+	var invitations []HouseholdInvitation
+	var unmarshalErr error
+	err = db.ScanPages(input, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+		var pageInvitations []HouseholdInvitation
+		if unmarshalErr = dynamodbattribute.UnmarshalListOfMaps(page.Items, &pageInvitations); unmarshalErr != nil {
+			return false
+		}
+		invitations = append(invitations, pageInvitations...)
+		return true
+	})
+	if unmarshalErr != nil {
+		return nil, fmt.Errorf("failed to unmarshal HouseholdInvitations: %v", unmarshalErr)
+	}
 	if err != nil {
-		return fmt.Errorf("failed to update Budget item: %v", err)
+		return nil, fmt.Errorf("failed to scan HouseholdInvitations: %v", err)
 	}
 
-	return nil
+	return invitations, nil
 }
 
-func DeleteBudget(userId string, month string, budgetItemName string) error {
-	// Create the composite key
-	userIdMonth := fmt.Sprintf("%s#%s", userId, month)
-
-	// Create the delete item input
+// DeleteHouseholdInvitation removes an invitation once it is accepted,
+// declined or withdrawn
+func DeleteHouseholdInvitation(householdId string, invitationId string) error {
 	input := &dynamodb.DeleteItemInput{
-		TableName: aws.String("Budget"),
+		TableName: aws.String("HouseholdInvitations"),
 		Key: map[string]*dynamodb.AttributeValue{
-			"userId#month":   {S: aws.String(userIdMonth)},
-			"budgetItemName": {S: aws.String(budgetItemName)},
+			"householdId":  {S: aws.String(householdId)},
+			"invitationId": {S: aws.String(invitationId)},
 		},
 	}
 
-	// Execute the delete operation
 	_, err := db.DeleteItem(input)
 	if err != nil {
-		return fmt.Errorf("failed to delete Budget item: %v", err)
+		return fmt.Errorf("failed to delete HouseholdInvitation: %v", err)
 	}
 
 	return nil
 }
 
-func AddExpenses(items []ExpenseItem) error {
-	// Create a list to hold the write requests
-	var writeRequests []*dynamodb.WriteRequest
+// AddGoal adds or replaces a savings goal in the Goals table
+func AddGoal(goal Goal) error {
+	return putUserItem("Goals", goal)
+}
 
-	for _, item := range items {
-		// Create the composite key
-		userIdMonth := fmt.Sprintf("%s#%s", item.UserId, item.Month)
+func GetAllGoals(userId string) ([]Goal, error) {
+	return queryAllUserItems[Goal]("Goals", userId)
+}
 
-		av, err := dynamodbattribute.MarshalMap(item)
-		if err != nil {
-			return fmt.Errorf("failed to marshal Expense item: %v", err)
-		}
+// GetGoal returns a goal, or nil if it does not exist
+func GetGoal(userId string, goalId string) (*Goal, error) {
+	return getUserItem[Goal]("Goals", userId, "goalId", goalId)
+}
 
-		// Add the composite key to the item
-		av["userId#month"] = &dynamodb.AttributeValue{S: aws.String(userIdMonth)}
+// DeleteGoal removes a goal from the Goals table
+func DeleteGoal(userId string, goalId string) error {
+	return deleteUserItem("Goals", userId, "goalId", goalId)
+}
 
-		// Create a PutRequest for each item
-		writeRequests = append(writeRequests, &dynamodb.WriteRequest{
-			PutRequest: &dynamodb.PutRequest{
-				Item: av,
-			},
-		})
+// AddGoalContribution adds a contribution to the GoalContributions table
+func AddGoalContribution(contribution GoalContribution) error {
+	return putUserItem("GoalContributions", contribution)
+}
+
+// GetGoalContributions returns the contributions made towards a goal
+func GetGoalContributions(userId string, goalId string) ([]GoalContribution, error) {
+	all, err := queryAllUserItems[GoalContribution]("GoalContributions", userId)
+	if err != nil {
+		return nil, err
 	}
 
-	// Split the write requests into batches of 25 (DynamoDB limit)
-	for i := 0; i < len(writeRequests); i += 25 {
-		end := i + 25
-		if end > len(writeRequests) {
-			end = len(writeRequests)
+	contributions := []GoalContribution{}
+	for _, contribution := range all {
+		if contribution.GoalId == goalId {
+			contributions = append(contributions, contribution)
 		}
+	}
+	return contributions, nil
+}
 
-		input := &dynamodb.BatchWriteItemInput{
-			RequestItems: map[string][]*dynamodb.WriteRequest{
-				"Expenses": writeRequests[i:end],
-			},
-		}
+// DeleteGoalContribution removes a contribution from the GoalContributions
+// table
+func DeleteGoalContribution(userId string, contributionId string) error {
+	return deleteUserItem("GoalContributions", userId, "contributionId", contributionId)
+}
 
-		_, err := db.BatchWriteItem(input)
-		if err != nil {
-			return fmt.Errorf("failed to add Expense items: %v", err)
-		}
-	}
+// AddDebt adds or replaces a debt in the Debts table
+func AddDebt(debt Debt) error {
+	return putUserItem("Debts", debt)
+}
 
-	return nil
+func GetAllDebts(userId string) ([]Debt, error) {
+	return queryAllUserItems[Debt]("Debts", userId)
 }
 
-func GetAllExpenses(userId string, month string) ([]ExpenseItem, error) {
-	// Create the composite key
-	userIdMonth := fmt.Sprintf("%s#%s", userId, month)
+// GetDebt returns a debt, or nil if it does not exist
+func GetDebt(userId string, debtId string) (*Debt, error) {
+	return getUserItem[Debt]("Debts", userId, "debtId", debtId)
+}
 
-	// Create the query input
-	keyCond := expression.Key("userId#month").Equal(expression.Value(userIdMonth))
-	expr, err := expression.NewBuilder().WithKeyCondition(keyCond).Build()
+// DeleteDebt removes a debt from the Debts table
+func DeleteDebt(userId string, debtId string) error {
+	return deleteUserItem("Debts", userId, "debtId", debtId)
+}
+
+// AddDebtPayment adds a payment to the DebtPayments table
+func AddDebtPayment(payment DebtPayment) error {
+	return putUserItem("DebtPayments", payment)
+}
+
+// GetAllDebtPayments returns the payments made against all of a user's debts
+func GetAllDebtPayments(userId string) ([]DebtPayment, error) {
+	return queryAllUserItems[DebtPayment]("DebtPayments", userId)
+}
+
+// GetDebtPayments returns the payments made against one debt
+func GetDebtPayments(userId string, debtId string) ([]DebtPayment, error) {
+	all, err := GetAllDebtPayments(userId)
 	if err != nil {
-		return nil, fmt.Errorf("failed to build expression: %v", err)
+		return nil, err
 	}
 
-	input := &dynamodb.QueryInput{
-		TableName:                 aws.String("Expenses"),
-		KeyConditionExpression:    expr.KeyCondition(),
-		ExpressionAttributeNames:  expr.Names(),
-		ExpressionAttributeValues: expr.Values(),
+	payments := []DebtPayment{}
+	for _, payment := range all {
+		if payment.DebtId == debtId {
+			payments = append(payments, payment)
+		}
 	}
+	return payments, nil
+}
 
-	// Execute the query
-	result, err := db.Query(input)
+// DeleteDebtPayment removes a payment from the DebtPayments table
+func DeleteDebtPayment(userId string, paymentId string) error {
+	return deleteUserItem("DebtPayments", userId, "paymentId", paymentId)
+}
+
+// AddHolding adds or replaces a holding in the Holdings table
+func AddHolding(holding Holding) error {
+	return putUserItem("Holdings", holding)
+}
+
+func GetAllHoldings(userId string) ([]Holding, error) {
+	return queryAllUserItems[Holding]("Holdings", userId)
+}
+
+// GetHolding returns a holding, or nil if it does not exist
+func GetHolding(userId string, holdingId string) (*Holding, error) {
+	return getUserItem[Holding]("Holdings", userId, "holdingId", holdingId)
+}
+
+// DeleteHolding removes a holding from the Holdings table
+func DeleteHolding(userId string, holdingId string) error {
+	return deleteUserItem("Holdings", userId, "holdingId", holdingId)
+}
+
+// AddHoldingValuation adds a valuation to the HoldingValuations table
+func AddHoldingValuation(valuation HoldingValuation) error {
+	return putUserItem("HoldingValuations", valuation)
+}
+
+// GetAllHoldingValuations returns the valuations of all of a user's holdings
+func GetAllHoldingValuations(userId string) ([]HoldingValuation, error) {
+	return queryAllUserItems[HoldingValuation]("HoldingValuations", userId)
+}
+
+// GetHoldingValuations returns the valuations of one holding
+func GetHoldingValuations(userId string, holdingId string) ([]HoldingValuation, error) {
+	all, err := GetAllHoldingValuations(userId)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query Expense items: %v", err)
+		return nil, err
 	}
 
-	// Unmarshal the results
-	var expenseItems []ExpenseItem
-	err = dynamodbattribute.UnmarshalListOfMaps(result.Items, &expenseItems)
-	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal Expense items: %v", err)
+	valuations := []HoldingValuation{}
+	for _, valuation := range all {
+		if valuation.HoldingId == holdingId {
+			valuations = append(valuations, valuation)
+		}
 	}
+	return valuations, nil
+}
 
-	return expenseItems, nil
+// DeleteHoldingValuation removes a valuation from the HoldingValuations table
+func DeleteHoldingValuation(userId string, valuationId string) error {
+	return deleteUserItem("HoldingValuations", userId, "valuationId", valuationId)
 }
 
-func UpdateExpense(userId string, month string, expenseItemName string, newValue float64, newTags []string) error {
-	// Create the composite key
-	userIdMonth := fmt.Sprintf("%s#%s", userId, month)
+// AddInvestmentTransaction adds a transaction to the InvestmentTransactions
+// table
+func AddInvestmentTransaction(transaction InvestmentTransaction) error {
+	return putUserItem("InvestmentTransactions", transaction)
+}
 
-	// Create the update expression
-	update := expression.
-		Set(expression.Name("expenseItemValue"), expression.Value(newValue)).
-		Set(expression.Name("expenseTags"), expression.Value(newTags))
+// GetAllInvestmentTransactions returns the transactions of all of a user's
+// investment accounts
+func GetAllInvestmentTransactions(userId string) ([]InvestmentTransaction, error) {
+	return queryAllUserItems[InvestmentTransaction]("InvestmentTransactions", userId)
+}
 
-	expr, err := expression.NewBuilder().WithUpdate(update).Build()
+// DeleteInvestmentTransaction removes a transaction from the
+// InvestmentTransactions table
+func DeleteInvestmentTransaction(userId string, transactionId string) error {
+	return deleteUserItem("InvestmentTransactions", userId, "transactionId", transactionId)
+}
+
+func AddSecurityPrices(prices []SecurityPrice) error {
+	items := make([]map[string]*dynamodb.AttributeValue, 0, len(prices))
+	for _, price := range prices {
+		av, err := dynamodbattribute.MarshalMap(price)
+		if err != nil {
+			return fmt.Errorf("failed to marshal SecurityPrice: %v", err)
+		}
+		items = append(items, av)
+	}
+
+	return PutItems("SecurityPrices", items)
+}
+
+func GetAllSecurityPrices(userId string) ([]SecurityPrice, error) {
+	return queryAllUserItems[SecurityPrice]("SecurityPrices", userId)
+}
+
+// DeleteSecurityPrice removes a price from the SecurityPrices table
+func DeleteSecurityPrice(userId string, priceId string) error {
+	return deleteUserItem("SecurityPrices", userId, "priceId", priceId)
+}
+
+// AddRecurringItem adds or replaces a recurring item in the RecurringItems
+// table
+func AddRecurringItem(item RecurringItem) error {
+	return putUserItem("RecurringItems", item)
+}
+
+func GetAllRecurringItems(userId string) ([]RecurringItem, error) {
+	return queryAllUserItems[RecurringItem]("RecurringItems", userId)
+}
+
+// GetRecurringItem returns a recurring item, or nil if it does not exist
+func GetRecurringItem(userId string, recurringId string) (*RecurringItem, error) {
+	return getUserItem[RecurringItem]("RecurringItems", userId, "recurringId", recurringId)
+}
+
+// DeleteRecurringItem removes a recurring item from the RecurringItems table
+func DeleteRecurringItem(userId string, recurringId string) error {
+	return deleteUserItem("RecurringItems", userId, "recurringId", recurringId)
+}
+
+// AddScenario adds or replaces a scenario in the Scenarios table
+func AddScenario(scenario Scenario) error {
+	return putUserItem("Scenarios", scenario)
+}
+
+func GetAllScenarios(userId string) ([]Scenario, error) {
+	return queryAllUserItems[Scenario]("Scenarios", userId)
+}
+
+// GetScenario returns a scenario, or nil if it does not exist
+func GetScenario(userId string, scenarioId string) (*Scenario, error) {
+	return getUserItem[Scenario]("Scenarios", userId, "scenarioId", scenarioId)
+}
+
+// DeleteScenario removes a scenario from the Scenarios table
+func DeleteScenario(userId string, scenarioId string) error {
+	return deleteUserItem("Scenarios", userId, "scenarioId", scenarioId)
+}
+
+// AddAlertRule adds or replaces an alert rule in the AlertRules table
+func AddAlertRule(rule AlertRule) error {
+	return putUserItem("AlertRules", rule)
+}
+
+func GetAllAlertRules(userId string) ([]AlertRule, error) {
+	return queryAllUserItems[AlertRule]("AlertRules", userId)
+}
+
+// GetAlertRule returns an alert rule, or nil if it does not exist
+func GetAlertRule(userId string, ruleId string) (*AlertRule, error) {
+	return getUserItem[AlertRule]("AlertRules", userId, "ruleId", ruleId)
+}
+
+// DeleteAlertRule removes an alert rule from the AlertRules table
+func DeleteAlertRule(userId string, ruleId string) error {
+	return deleteUserItem("AlertRules", userId, "ruleId", ruleId)
+}
+
+// AddNotification adds or replaces a notification in the Notifications
+// table
+func AddNotification(notification Notification) error {
+	return putUserItem("Notifications", notification)
+}
+
+func GetAllNotifications(userId string) ([]Notification, error) {
+	return queryAllUserItems[Notification]("Notifications", userId)
+}
+
+// GetNotification returns a notification, or nil if it does not exist
+func GetNotification(userId string, notificationId string) (*Notification, error) {
+	return getUserItem[Notification]("Notifications", userId, "notificationId", notificationId)
+}
+
+// DeleteNotification removes a notification from the Notifications table
+func DeleteNotification(userId string, notificationId string) error {
+	return deleteUserItem("Notifications", userId, "notificationId", notificationId)
+}
+
+// AddEmailSubscription adds or replaces a member's email subscription in the
+// EmailSubscriptions table
+func AddEmailSubscription(subscription EmailSubscription) error {
+	return putUserItem("EmailSubscriptions", subscription)
+}
+
+func GetEmailSubscriptions(userId string) ([]EmailSubscription, error) {
+	return queryAllUserItems[EmailSubscription]("EmailSubscriptions", userId)
+}
+
+// GetEmailSubscription returns a member's email subscription to a workspace,
+// or nil if they have none
+func GetEmailSubscription(userId string, subscriberId string) (*EmailSubscription, error) {
+	return getUserItem[EmailSubscription]("EmailSubscriptions", userId, "subscriberId", subscriberId)
+}
+
+// DeleteEmailSubscription removes a member's email subscription to a
+// workspace from the EmailSubscriptions table
+func DeleteEmailSubscription(userId string, subscriberId string) error {
+	return deleteUserItem("EmailSubscriptions", userId, "subscriberId", subscriberId)
+}
+
+// MarkDigestSent records the period of the last weekly or monthly digest
+// sent to a member. Only that field is written, so changes made to the
+// subscription while the digest was sent are kept. It reports false, without
+// an error, when the subscription has been deleted since it was read.
+func MarkDigestSent(userId string, subscriberId string, period string, key string) (bool, error) {
+	field := "lastWeekly"
+	if period == DigestMonthly {
+		field = "lastMonthly"
+	}
+	update := expression.Set(expression.Name(field), expression.Value(key))
+	condition := expression.AttributeExists(expression.Name("subscriberId"))
+	expr, err := expression.NewBuilder().WithUpdate(update).WithCondition(condition).Build()
 	if err != nil {
-		return fmt.Errorf("failed to build expression: %v", err)
+		return false, fmt.Errorf("failed to build expression: %v", err)
 	}
 
-	// Create the update item input
 	input := &dynamodb.UpdateItemInput{
-		TableName: aws.String("Expenses"),
+		TableName: aws.String("EmailSubscriptions"),
 		Key: map[string]*dynamodb.AttributeValue{
-			"userId#month":    {S: aws.String(userIdMonth)},
-			"expenseItemName": {S: aws.String(expenseItemName)},
+			"userId":       {S: aws.String(userId)},
+			"subscriberId": {S: aws.String(subscriberId)},
 		},
 		UpdateExpression:          expr.Update(),
+		ConditionExpression:       expr.Condition(),
 		ExpressionAttributeNames:  expr.Names(),
 		ExpressionAttributeValues: expr.Values(),
-		ReturnValues:              aws.String("UPDATED_NEW"),
 	}
 
-	// Execute the update
 	_, err = db.UpdateItem(input)
 	if err != nil {
-		return fmt.Errorf("failed to update Expense item: %v", err)
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to update EmailSubscriptions item: %v", err)
 	}
 
-	return nil
+	return true, nil
 }
 
-// DeleteExpense removes an expense item from the Expenses table
-func DeleteExpense(userId string, month string, expenseItemName string) error {
-	// Create the composite key
-	userIdMonth := fmt.Sprintf("%s#%s", userId, month)
+// AddWebhook adds or replaces a webhook in the Webhooks table
+func AddWebhook(webhook Webhook) error {
+	return putUserItem("Webhooks", webhook)
+}
 
-	// Create the delete item input
-	input := &dynamodb.DeleteItemInput{
-		TableName: aws.String("Expenses"),
-		Key: map[string]*dynamodb.AttributeValue{
-			"userId#month":    {S: aws.String(userIdMonth)},
-			"expenseItemName": {S: aws.String(expenseItemName)},
-		},
-	}
+func GetAllWebhooks(userId string) ([]Webhook, error) {
+	return queryAllUserItems[Webhook]("Webhooks", userId)
+}
 
-	// Execute the delete operation
-	_, err := db.DeleteItem(input)
+// GetWebhook returns a webhook, or nil if it does not exist
+func GetWebhook(userId string, webhookId string) (*Webhook, error) {
+	return getUserItem[Webhook]("Webhooks", userId, "webhookId", webhookId)
+}
+
+// DeleteWebhook removes a webhook from the Webhooks table
+func DeleteWebhook(userId string, webhookId string) error {
+	return deleteUserItem("Webhooks", userId, "webhookId", webhookId)
+}
+
+// AddWebhookDelivery adds or replaces a delivery in the WebhookDeliveries
+// table
+func AddWebhookDelivery(delivery WebhookDelivery) error {
+	return putUserItem("WebhookDeliveries", delivery)
+}
+
+// GetWebhookDeliveries returns the deliveries to one webhook
+func GetWebhookDeliveries(userId string, webhookId string) ([]WebhookDelivery, error) {
+	all, err := queryAllUserItems[WebhookDelivery]("WebhookDeliveries", userId)
 	if err != nil {
-		return fmt.Errorf("failed to delete Expense item: %v", err)
+		return nil, err
 	}
 
-	return nil
+	deliveries := []WebhookDelivery{}
+	for _, delivery := range all {
+		if delivery.WebhookId == webhookId {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	return deliveries, nil
 }
 
-func CreateUserEntry(registerData RegisterData) error {
-	// Generate a unique ID for the user
-	userID := uuid.New().String()
+// GetWebhookDelivery returns a delivery, or nil if it does not exist
+func GetWebhookDelivery(userId string, deliveryId string) (*WebhookDelivery, error) {
+	return getUserItem[WebhookDelivery]("WebhookDeliveries", userId, "deliveryId", deliveryId)
+}
 
-	// Store user data in DynamoDB
-	_, err := db.PutItem(&dynamodb.PutItemInput{
-		TableName: aws.String("Users"),
-		Item: map[string]*dynamodb.AttributeValue{
-			"userName": {
-				S: aws.String(registerData.Username),
-			},
-			"userId": {
-				S: aws.String(userID),
-			},
-		},
+// GetDueWebhookDeliveries returns the pending deliveries of every workspace
+// whose next attempt is due by a time. Deliveries recorded without one are
+// due straight away.
+func GetDueWebhookDeliveries(now time.Time) ([]WebhookDelivery, error) {
+	var deliveries []WebhookDelivery
+	err := ScanAllItems("WebhookDeliveries", func(item map[string]*dynamodb.AttributeValue) error {
+		var delivery WebhookDelivery
+		if err := dynamodbattribute.UnmarshalMap(item, &delivery); err != nil {
+			return fmt.Errorf("failed to unmarshal WebhookDeliveries item: %v", err)
+		}
+		if delivery.Status != DeliveryPending {
+			return nil
+		}
+		if next, err := time.Parse(time.RFC3339, delivery.NextAttemptAt); err == nil && next.After(now) {
+			return nil
+		}
+		deliveries = append(deliveries, delivery)
+		return nil
 	})
-
 	if err != nil {
-		return fmt.Errorf("Failed to create user in DB :  " + err.Error())
+		return nil, err
 	}
-	return nil
-
+	return deliveries, nil
 }
 
-func GetUserIdByUserName(userName string) (string, error) {
+// ClaimWebhookDelivery moves the next attempt of a pending delivery to a
+// later time, so that no other server makes it in the meantime. It reports
+// false, without an error, when the delivery has been attempted or claimed
+// since it was read.
+func ClaimWebhookDelivery(delivery WebhookDelivery, until string) (bool, error) {
+	update := expression.Set(expression.Name("nextAttemptAt"), expression.Value(until))
+	seen := expression.AttributeNotExists(expression.Name("nextAttemptAt"))
+	if delivery.NextAttemptAt != "" {
+		seen = expression.Name("nextAttemptAt").Equal(expression.Value(delivery.NextAttemptAt))
+	}
+	condition := expression.Name("status").Equal(expression.Value(DeliveryPending)).And(seen)
+	expr, err := expression.NewBuilder().WithUpdate(update).WithCondition(condition).Build()
+	if err != nil {
+		return false, fmt.Errorf("failed to build expression: %v", err)
+	}
 
-	input := &dynamodb.GetItemInput{
-		TableName: aws.String("Users"),
+	input := &dynamodb.UpdateItemInput{
+		TableName: aws.String("WebhookDeliveries"),
 		Key: map[string]*dynamodb.AttributeValue{
-			"userName": {
-				S: aws.String(userName),
-			},
+			"userId":     {S: aws.String(delivery.UserId)},
+			"deliveryId": {S: aws.String(delivery.DeliveryId)},
 		},
+		UpdateExpression:          expr.Update(),
+		ConditionExpression:       expr.Condition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
 	}
 
-	result, err := db.GetItem(input)
+	_, err = db.UpdateItem(input)
 	if err != nil {
-		return "", err
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to update WebhookDeliveries item: %v", err)
 	}
 
-	if result.Item == nil {
-		return "", fmt.Errorf("user not found")
+	return true, nil
+}
+
+// AddEvent keeps an event in the Events table until it expires
+func AddEvent(event Event, expires time.Time) error {
+	return putUserItem("Events", storedEvent{
+		UserId:    event.UserId,
+		EventId:   event.EventId,
+		Type:      event.Type,
+		Month:     event.Month,
+		CreatedAt: event.CreatedAt,
+		Data:      string(event.Data),
+		ExpiresAt: expires.Unix(),
+	})
+}
+
+// GetEventsAfter returns a workspace's events that came after an event, in
+// order. Expired events that DynamoDB has not deleted yet are left out.
+func GetEventsAfter(userId string, eventId string) ([]Event, error) {
+	keyCond := expression.Key("userId").Equal(expression.Value(userId)).
+		And(expression.Key("eventId").GreaterThan(expression.Value(eventId)))
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCond).Build()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build expression: %v", err)
 	}
 
-	var userData UserData
-	err = dynamodbattribute.UnmarshalMap(result.Item, &userData)
+	input := &dynamodb.QueryInput{
+		TableName:                 aws.String("Events"),
+		KeyConditionExpression:    expr.KeyCondition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+	}
+
+	events := []Event{}
+	now := time.Now().Unix()
+	var unmarshalErr error
+	err = db.QueryPages(input, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			var stored storedEvent
+			if unmarshalErr = dynamodbattribute.UnmarshalMap(item, &stored); unmarshalErr != nil {
+				return false
+			}
+			if stored.ExpiresAt < now {
+				continue
+			}
+			events = append(events, Event{
+				EventId:   stored.EventId,
+				Type:      stored.Type,
+				UserId:    stored.UserId,
+				Month:     stored.Month,
+				CreatedAt: stored.CreatedAt,
+				Data:      []byte(stored.Data),
+			})
+		}
+		return true
+	})
+	if unmarshalErr != nil {
+		return nil, fmt.Errorf("failed to unmarshal Events item: %v", unmarshalErr)
+	}
 	if err != nil {
-		return "", err
+		return nil, fmt.Errorf("failed to query Events items: %v", err)
 	}
 
-	return userData.UserId, nil
+	return events, nil
 }
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Debt payoff strategies. Avalanche pays extra towards the highest rate
+// first, which costs the least interest; snowball pays extra towards the
+// smallest balance first, which clears individual debts soonest.
+const (
+	StrategyAvalanche = "avalanche"
+	StrategySnowball  = "snowball"
+)
+
+// maxPayoffMonths caps a payoff simulation, so debts whose payments never
+// cover their interest are reported instead of simulated forever.
+const maxPayoffMonths = 600
+
+// ValidateDebt checks a debt's fields and normalizes its currency code.
+func ValidateDebt(debt *Debt) error {
+	debt.DebtName = strings.TrimSpace(debt.DebtName)
+	if debt.DebtName == "" {
+		return fmt.Errorf("debtName is required")
+	}
+	if debt.Currency != "" {
+		currency, err := normalizeCurrency(debt.Currency)
+		if err != nil {
+			return err
+		}
+		debt.Currency = currency
+	}
+	debt.Balance = debt.Balance.Round(debt.Currency)
+	debt.MinimumPayment = debt.MinimumPayment.Round(debt.Currency)
+	if debt.Balance < 0 {
+		return fmt.Errorf("balance cannot be negative")
+	}
+	if debt.MinimumPayment <= 0 {
+		return fmt.Errorf("minimumPayment must be positive")
+	}
+	if debt.APR < 0 || debt.APR > 100 {
+		return fmt.Errorf("apr must be a percentage between 0 and 100")
+	}
+	if debt.DueDay < 1 || debt.DueDay > 31 {
+		return fmt.Errorf("dueDay must be between 1 and 31")
+	}
+	if debt.BalanceDate == "" {
+		debt.BalanceDate = time.Now().UTC().Format("2006-01-02")
+	}
+	if _, err := time.Parse("2006-01-02", debt.BalanceDate); err != nil {
+		return fmt.Errorf("invalid balanceDate, expected YYYY-MM-DD")
+	}
+	return nil
+}
+
+// ValidateDebtPayment checks a payment's link to the expense item that paid
+// it.
+func ValidateDebtPayment(payment *DebtPayment) error {
+	if payment.Month == "" || payment.ExpenseItemName == "" {
+		return fmt.Errorf("month and expenseItemName are required")
+	}
+	if _, err := parseMonth(payment.Month); err != nil {
+		return err
+	}
+	if payment.Date == "" {
+		payment.Date = time.Now().UTC().Format("2006-01-02")
+	}
+	if _, err := time.Parse("2006-01-02", payment.Date); err != nil {
+		return fmt.Errorf("invalid date, expected YYYY-MM-DD")
+	}
+	return nil
+}
+
+// ComputeDebtStatus applies the payments made on or after a debt's balance
+// date to its balance. Interest charged since then is not known, so the
+// balance should be refreshed from a statement from time to time.
+func ComputeDebtStatus(debt Debt, payments []DebtPayment) DebtStatus {
+	status := DebtStatus{Debt: debt, CurrentBalance: debt.Balance}
+	for _, payment := range payments {
+		if payment.DebtId != debt.DebtId || payment.Date < debt.BalanceDate {
+			continue
+		}
+		status.PaidToDate += payment.Amount
+		status.CurrentBalance -= payment.Amount
+	}
+	if status.CurrentBalance < 0 {
+		status.CurrentBalance = 0
+	}
+	return status
+}
+
+// ComparePayoffPlans simulates paying off the debts with both strategies.
+// All debts must share a currency.
+func ComparePayoffPlans(debts []DebtStatus, extra Money, now time.Time) (*PayoffComparison, error) {
+	comparison := &PayoffComparison{}
+	for i, debt := range debts {
+		if i > 0 && debt.Currency != comparison.Currency {
+			return nil, fmt.Errorf("debts are in more than one currency (%s and %s)", comparison.Currency, debt.Currency)
+		}
+		comparison.Currency = debt.Currency
+	}
+
+	avalanche, err := PlanPayoff(debts, StrategyAvalanche, extra, now)
+	if err != nil {
+		return nil, err
+	}
+	snowball, err := PlanPayoff(debts, StrategySnowball, extra, now)
+	if err != nil {
+		return nil, err
+	}
+	comparison.Avalanche = *avalanche
+	comparison.Snowball = *snowball
+	comparison.InterestSaved = snowball.TotalInterest - avalanche.TotalInterest
+	return comparison, nil
+}
+
+// PlanPayoff simulates paying off debts month by month, starting next month.
+// Each month interest is added at a twelfth of the APR, every debt gets its
+// minimum payment, and whatever is left of the monthly budget goes to debts
+// in strategy order. The budget is the sum of the minimums plus the extra
+// amount and stays the same throughout, so the minimum of a debt that is
+// paid off rolls over to the next one.
+func PlanPayoff(debts []DebtStatus, strategy string, extra Money, now time.Time) (*PayoffPlan, error) {
+	if strategy != StrategyAvalanche && strategy != StrategySnowball {
+		return nil, fmt.Errorf("invalid strategy %q, expected avalanche or snowball", strategy)
+	}
+	if extra < 0 {
+		return nil, fmt.Errorf("extra monthly amount cannot be negative")
+	}
+
+	type simulated struct {
+		debt     DebtStatus
+		balance  Money
+		payoff   DebtPayoff
+		paidOff  bool
+		interest Money
+	}
+	var active []*simulated
+	var budget Money
+	for _, debt := range debts {
+		if debt.CurrentBalance <= 0 {
+			continue
+		}
+		active = append(active, &simulated{
+			debt:    debt,
+			balance: debt.CurrentBalance,
+			payoff:  DebtPayoff{DebtId: debt.DebtId, DebtName: debt.DebtName},
+		})
+		budget += debt.MinimumPayment
+	}
+	budget += extra
+
+	// Extra payments go to debts in a fixed order, decided by the balances
+	// at the start
+	sort.SliceStable(active, func(i, j int) bool {
+		a, b := active[i], active[j]
+		if strategy == StrategyAvalanche && a.debt.APR != b.debt.APR {
+			return a.debt.APR > b.debt.APR
+		}
+		if a.balance != b.balance {
+			return a.balance < b.balance
+		}
+		if a.debt.APR != b.debt.APR {
+			return a.debt.APR > b.debt.APR
+		}
+		return a.debt.DebtId < b.debt.DebtId
+	})
+
+	plan := &PayoffPlan{
+		Strategy:     strategy,
+		ExtraMonthly: extra,
+		Debts:        []DebtPayoff{},
+		Schedule:     []PayoffMonth{},
+	}
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	remainingDebts := len(active)
+	for month := 1; remainingDebts > 0; month++ {
+		if month > maxPayoffMonths {
+			return nil, fmt.Errorf("debts are not paid off within %d years; the payments do not cover the interest", maxPayoffMonths/12)
+		}
+		date := monthStart.AddDate(0, month, 0)
+		scheduled := PayoffMonth{Month: date.Format(monthLayout)}
+
+		payments := make(map[*simulated]*DebtMonthPayment)
+		available := budget
+		for _, s := range active {
+			if s.paidOff {
+				continue
+			}
+			payment := &DebtMonthPayment{DebtId: s.debt.DebtId}
+			payment.Interest = s.balance.Mul(s.debt.APR / 1200).Round(s.debt.Currency)
+			s.balance += payment.Interest
+			s.interest += payment.Interest
+
+			minimum := s.debt.MinimumPayment
+			if minimum > s.balance {
+				minimum = s.balance
+			}
+			payment.Payment = minimum
+			s.balance -= minimum
+			available -= minimum
+			payments[s] = payment
+		}
+		for _, s := range active {
+			if available <= 0 {
+				break
+			}
+			if s.paidOff || s.balance == 0 {
+				continue
+			}
+			amount := available
+			if amount > s.balance {
+				amount = s.balance
+			}
+			payments[s].Payment += amount
+			s.balance -= amount
+			available -= amount
+		}
+
+		for _, s := range active {
+			payment, ok := payments[s]
+			if !ok {
+				continue
+			}
+			payment.Balance = s.balance
+			scheduled.Payments = append(scheduled.Payments, *payment)
+			plan.TotalInterest += payment.Interest
+			plan.TotalPaid += payment.Payment
+			s.payoff.TotalPaid += payment.Payment
+
+			if s.balance == 0 {
+				s.paidOff = true
+				remainingDebts--
+				s.payoff.Months = month
+				s.payoff.PayoffDate = dueDate(date, s.debt.DueDay)
+				s.payoff.InterestPaid = s.interest
+				plan.Debts = append(plan.Debts, s.payoff)
+				if s.payoff.PayoffDate > plan.PayoffDate {
+					plan.PayoffDate = s.payoff.PayoffDate
+				}
+			}
+		}
+		plan.Schedule = append(plan.Schedule, scheduled)
+		plan.Months = month
+	}
+	return plan, nil
+}
+
+// dueDate returns the date a payment is due in a month, moved back to the
+// last day of the month for due days the month does not have.
+func dueDate(month time.Time, dueDay int) string {
+	lastDay := time.Date(month.Year(), month.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	if dueDay > lastDay {
+		dueDay = lastDay
+	}
+	return time.Date(month.Year(), month.Month(), dueDay, 0, 0, 0, 0, time.UTC).Format("2006-01-02")
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPlanPayoff(t *testing.T) {
+	now := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	debt := func(id string, balance Money, apr float64, minimum Money) DebtStatus {
+		return DebtStatus{
+			Debt:           Debt{DebtId: id, DebtName: id, APR: apr, MinimumPayment: minimum, DueDay: 31},
+			CurrentBalance: balance,
+		}
+	}
+
+	tests := []struct {
+		name         string
+		debts        []DebtStatus
+		strategy     string
+		extra        Money
+		wantErr      bool
+		wantMonths   int
+		wantInterest Money
+		wantOrder    []string
+		wantDate     string
+	}{
+		{
+			name:       "minimum rolls over once a debt is paid off",
+			debts:      []DebtStatus{debt("card", 3000000, 0, 1000000), debt("loan", 1000000, 0, 500000)},
+			strategy:   StrategySnowball,
+			extra:      500000,
+			wantMonths: 2,
+			wantOrder:  []string{"loan", "card"},
+			wantDate:   "2024-03-31",
+		},
+		{
+			name:         "interest at a twelfth of the APR",
+			debts:        []DebtStatus{debt("card", 10000000, 12, 20000000)},
+			strategy:     StrategyAvalanche,
+			wantMonths:   1,
+			wantInterest: 100000,
+			wantOrder:    []string{"card"},
+			wantDate:     "2024-02-29",
+		},
+		{
+			name:       "avalanche pays the highest rate first",
+			debts:      []DebtStatus{debt("small", 1000000, 5, 100000), debt("dear", 5000000, 25, 100000)},
+			strategy:   StrategyAvalanche,
+			extra:      2000000,
+			wantMonths: 3,
+			wantOrder:  []string{"dear", "small"},
+		},
+		{
+			name:       "snowball pays the smallest balance first",
+			debts:      []DebtStatus{debt("small", 1000000, 5, 100000), debt("dear", 5000000, 25, 100000)},
+			strategy:   StrategySnowball,
+			extra:      2000000,
+			wantMonths: 3,
+			wantOrder:  []string{"small", "dear"},
+		},
+		{
+			name:       "paid off debts are left out",
+			debts:      []DebtStatus{debt("done", 0, 10, 100000)},
+			strategy:   StrategySnowball,
+			wantMonths: 0,
+			wantOrder:  []string{},
+		},
+		{
+			name:     "payments that do not cover the interest",
+			debts:    []DebtStatus{debt("card", 10000000, 24, 100000)},
+			strategy: StrategyAvalanche,
+			wantErr:  true,
+		},
+		{
+			name:     "negative extra",
+			debts:    []DebtStatus{debt("card", 1000000, 0, 100000)},
+			strategy: StrategyAvalanche,
+			extra:    -1,
+			wantErr:  true,
+		},
+		{
+			name:     "unknown strategy",
+			debts:    []DebtStatus{debt("card", 1000000, 0, 100000)},
+			strategy: "biggest",
+			wantErr:  true,
+		},
+	}
+	for _, test := range tests {
+		plan, err := PlanPayoff(test.debts, test.strategy, test.extra, now)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected an error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if plan.Months != test.wantMonths || len(plan.Schedule) != test.wantMonths {
+			t.Errorf("%s: paid off in %d months with %d scheduled, want %d", test.name, plan.Months, len(plan.Schedule), test.wantMonths)
+		}
+		if test.wantInterest != 0 && plan.TotalInterest != test.wantInterest {
+			t.Errorf("%s: total interest %s, want %s", test.name, plan.TotalInterest, test.wantInterest)
+		}
+		if test.wantDate != "" && plan.PayoffDate != test.wantDate {
+			t.Errorf("%s: payoff date %s, want %s", test.name, plan.PayoffDate, test.wantDate)
+		}
+
+		var order []string
+		for _, payoff := range plan.Debts {
+			order = append(order, payoff.DebtId)
+		}
+		if len(order) != len(test.wantOrder) {
+			t.Errorf("%s: paid off %v, want %v", test.name, order, test.wantOrder)
+			continue
+		}
+		for i := range order {
+			if order[i] != test.wantOrder[i] {
+				t.Errorf("%s: paid off %v, want %v", test.name, order, test.wantOrder)
+				break
+			}
+		}
+
+		// Everything owed is paid, and no month goes over the budget
+		var owed, budget Money
+		for _, debt := range test.debts {
+			owed += debt.CurrentBalance
+			if debt.CurrentBalance > 0 {
+				budget += debt.MinimumPayment
+			}
+		}
+		budget += test.extra
+		if plan.TotalPaid != owed+plan.TotalInterest {
+			t.Errorf("%s: paid %s, want %s owed plus %s interest", test.name, plan.TotalPaid, owed, plan.TotalInterest)
+		}
+		for _, month := range plan.Schedule {
+			var paid Money
+			for _, payment := range month.Payments {
+				paid += payment.Payment
+			}
+			if paid > budget {
+				t.Errorf("%s: paid %s in %s, more than the budget of %s", test.name, paid, month.Month, budget)
+			}
+		}
+	}
+}
+
+func TestComparePayoffPlans(t *testing.T) {
+	now := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	debts := []DebtStatus{
+		{Debt: Debt{DebtId: "small", APR: 5, MinimumPayment: 100000, Currency: "USD"}, CurrentBalance: 1000000},
+		{Debt: Debt{DebtId: "dear", APR: 25, MinimumPayment: 100000, Currency: "USD"}, CurrentBalance: 5000000},
+	}
+	comparison, err := ComparePayoffPlans(debts, 500000, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if comparison.InterestSaved <= 0 {
+		t.Errorf("avalanche saved %s over snowball, want more than zero", comparison.InterestSaved)
+	}
+
+	debts[1].Currency = "EUR"
+	if _, err := ComparePayoffPlans(debts, 500000, now); err == nil {
+		t.Error("expected an error for debts in more than one currency")
+	}
+}
@@ -0,0 +1,635 @@
+package main
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	htmltemplate "html/template"
+	"log"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// Digest periods, which are also the names of the lists a member can
+// unsubscribe from along with alerts.
+const (
+	DigestWeekly  = "weekly"
+	DigestMonthly = "monthly"
+	AlertsList    = "alerts"
+)
+
+// digestTopCategories is how many categories a digest lists.
+const digestTopCategories = 5
+
+// digestPeriod returns the last complete week, Monday to Sunday, or calendar
+// month before now, and the key that identifies it.
+func digestPeriod(period string, now time.Time) (time.Time, time.Time, string, error) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	switch period {
+	case DigestWeekly:
+		monday := today.AddDate(0, 0, -((int(today.Weekday()) + 6) % 7))
+		from := monday.AddDate(0, 0, -7)
+		year, week := from.ISOWeek()
+		return from, monday.AddDate(0, 0, -1), fmt.Sprintf("%d-W%02d", year, week), nil
+	case DigestMonthly:
+		first := time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, time.UTC)
+		from := first.AddDate(0, -1, 0)
+		return from, first.AddDate(0, 0, -1), from.Format(monthLayout), nil
+	}
+	return time.Time{}, time.Time{}, "", fmt.Errorf("invalid period %q, expected weekly or monthly", period)
+}
+
+// BuildDigest summarizes the income and expenses dated within a period, the
+// budget of the month the period ends in against that month's spending so
+// far, and the expenses flagged as unusual. Items without a date count as
+// dated on the first of their month.
+func BuildDigest(userId string, period string, key string, from time.Time, to time.Time, base string, rates *RateTable, income []IncomeItem, budget []BudgetItem, expenses []ExpenseItem) Digest {
+	inPeriod := func(date time.Time) bool {
+		return !date.Before(from) && !date.After(to)
+	}
+	budgetMonth := to.Format(monthLayout)
+
+	var periodIncome []IncomeItem
+	for _, item := range income {
+		if inPeriod(itemDate(item.Date, item.Month)) {
+			periodIncome = append(periodIncome, item)
+		}
+	}
+	var periodExpenses, monthToDate []ExpenseItem
+	for _, item := range expenses {
+		date := itemDate(item.Date, item.Month)
+		if inPeriod(date) {
+			periodExpenses = append(periodExpenses, item)
+		}
+		if item.Month == budgetMonth && !date.After(to) {
+			monthToDate = append(monthToDate, item)
+		}
+	}
+	report := BuildCurrencyReport(budgetMonth, base, rates, periodIncome, nil, periodExpenses)
+	budgetReport := BuildCurrencyReport(budgetMonth, base, rates, nil, budget, monthToDate)
+
+	digest := Digest{
+		UserId:        userId,
+		Period:        period,
+		PeriodKey:     key,
+		From:          from.Format("2006-01-02"),
+		To:            to.Format("2006-01-02"),
+		BaseCurrency:  base,
+		Income:        report.Income,
+		Spending:      report.Expenses,
+		Net:           report.Net,
+		BudgetMonth:   budgetMonth,
+		Budgets:       budgetReport.Budgets,
+		TopCategories: []CategoryAmount{},
+		Anomalies:     []DigestAnomaly{},
+		MissingRates:  report.MissingRates,
+	}
+	for _, rate := range budgetReport.MissingRates {
+		if !containsString(digest.MissingRates, rate) {
+			digest.MissingRates = append(digest.MissingRates, rate)
+		}
+	}
+
+	for category, amount := range report.ExpensesByCategory {
+		digest.TopCategories = append(digest.TopCategories, CategoryAmount{Category: category, Amount: amount})
+	}
+	sort.Slice(digest.TopCategories, func(i, j int) bool {
+		a, b := digest.TopCategories[i], digest.TopCategories[j]
+		if a.Amount != b.Amount {
+			return a.Amount > b.Amount
+		}
+		return a.Category < b.Category
+	})
+	if len(digest.TopCategories) > digestTopCategories {
+		digest.TopCategories = digest.TopCategories[:digestTopCategories]
+	}
+
+	for _, item := range periodExpenses {
+		if len(item.Anomalies) == 0 {
+			continue
+		}
+		currency := item.Currency
+		if currency == "" {
+			currency = base
+		}
+		digest.Anomalies = append(digest.Anomalies, DigestAnomaly{
+			Date:         itemDate(item.Date, item.Month).Format("2006-01-02"),
+			Description:  expenseDescription(item),
+			Amount:       item.ExpenseValue,
+			Currency:     currency,
+			Explanations: item.Anomalies,
+		})
+	}
+	sort.SliceStable(digest.Anomalies, func(i, j int) bool { return digest.Anomalies[i].Date < digest.Anomalies[j].Date })
+	return digest
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadDigest builds a workspace's digest for the last complete week or month
+// before now.
+func LoadDigest(userId string, period string, now time.Time) (*Digest, error) {
+	from, to, key, err := digestPeriod(period, now)
+	if err != nil {
+		return nil, err
+	}
+	months, err := monthsBetween(from.Format(monthLayout), to.Format(monthLayout))
+	if err != nil {
+		return nil, err
+	}
+
+	settings, err := GetUserSettings(userId)
+	if err != nil {
+		return nil, err
+	}
+	rates, err := GetAllExchangeRates(userId)
+	if err != nil {
+		return nil, err
+	}
+	var income []IncomeItem
+	var expenses []ExpenseItem
+	for _, month := range months {
+		incomeItems, err := GetAllIncome(userId, month)
+		if err != nil {
+			return nil, err
+		}
+		expenseItems, err := GetAllExpenses(userId, month)
+		if err != nil {
+			return nil, err
+		}
+		income = append(income, incomeItems...)
+		expenses = append(expenses, expenseItems...)
+	}
+	budget, err := GetAllBudget(userId, to.Format(monthLayout))
+	if err != nil {
+		return nil, err
+	}
+
+	digest := BuildDigest(userId, period, key, from, to, settings.BaseCurrency, NewRateTable(rates), income, budget, expenses)
+	return &digest, nil
+}
+
+const digestTextTemplate = `{{.Title}}
+{{.From}} to {{.To}}
+
+Income:   {{money .Income}}
+Spending: {{money .Spending}}
+Net:      {{money .Net}}
+
+Spending against budget, {{.BudgetMonth}} so far
+{{range .Budgets}}- {{.BudgetItemName}}: {{money .Spent}} of {{money .Budget}}{{if lt .Remaining 0}}, over by {{money (negate .Remaining)}}{{end}}
+{{else}}No budget items.
+{{end}}
+Top categories
+{{range .TopCategories}}- {{.Category}}: {{money .Amount}}
+{{else}}No spending.
+{{end}}
+{{- if .Anomalies}}
+Unusual expenses
+{{range .Anomalies}}- {{.Date}} {{.Description}}: {{.Amount.Format .Currency}} {{.Currency}}
+{{range .Explanations}}  {{.}}
+{{end}}{{end}}{{end}}
+{{- if .MissingRates}}
+Some amounts are left out because these exchange rates are missing: {{join .MissingRates ", "}}
+{{end}}
+To stop getting these emails, visit {{.UnsubscribeURL}}
+`
+
+const digestHTMLTemplate = `<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif; color: #222;">
+<h1 style="font-size: 20px;">{{.Title}}</h1>
+<p>{{.From}} to {{.To}}</p>
+<table cellpadding="4">
+<tr><td>Income</td><td align="right">{{money .Income}}</td></tr>
+<tr><td>Spending</td><td align="right">{{money .Spending}}</td></tr>
+<tr><td><strong>Net</strong></td><td align="right"><strong>{{money .Net}}</strong></td></tr>
+</table>
+<h2 style="font-size: 16px;">Spending against budget, {{.BudgetMonth}} so far</h2>
+{{if .Budgets}}<table cellpadding="4">
+<tr><th align="left">Budget item</th><th align="right">Spent</th><th align="right">Budget</th><th align="right">Remaining</th></tr>
+{{range .Budgets}}<tr><td>{{.BudgetItemName}}</td><td align="right">{{money .Spent}}</td><td align="right">{{money .Budget}}</td><td align="right"{{if lt .Remaining 0}} style="color: #c00;"{{end}}>{{money .Remaining}}</td></tr>
+{{end}}</table>{{else}}<p>No budget items.</p>{{end}}
+<h2 style="font-size: 16px;">Top categories</h2>
+{{if .TopCategories}}<ol>
+{{range .TopCategories}}<li>{{.Category}}: {{money .Amount}}</li>
+{{end}}</ol>{{else}}<p>No spending.</p>{{end}}
+{{if .Anomalies}}<h2 style="font-size: 16px;">Unusual expenses</h2>
+<ul>
+{{range .Anomalies}}<li>{{.Date}} {{.Description}}: {{.Amount.Format .Currency}} {{.Currency}}{{range .Explanations}}<br><small>{{.}}</small>{{end}}</li>
+{{end}}</ul>{{end}}
+{{if .MissingRates}}<p><small>Some amounts are left out because these exchange rates are missing: {{join .MissingRates ", "}}</small></p>{{end}}
+<p><small><a href="{{.UnsubscribeURL}}">Unsubscribe</a> from these emails.</small></p>
+</body>
+</html>
+`
+
+const alertTextTemplate = `{{.Title}}
+
+{{.Message}}
+
+To stop getting alert emails, visit {{.UnsubscribeURL}}
+`
+
+const alertHTMLTemplate = `<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif; color: #222;">
+<h1 style="font-size: 18px;">{{.Title}}</h1>
+<p>{{.Message}}</p>
+<p><small><a href="{{.UnsubscribeURL}}">Unsubscribe</a> from alert emails.</small></p>
+</body>
+</html>
+`
+
+const confirmTextTemplate = `Confirm your email address
+
+Someone asked for budget emails to be sent to {{.Email}}. To confirm, visit
+{{.ConfirmURL}}
+
+If it was not you, ignore this email and nothing will be sent.
+`
+
+const confirmHTMLTemplate = `<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif; color: #222;">
+<h1 style="font-size: 18px;">Confirm your email address</h1>
+<p>Someone asked for budget emails to be sent to {{.Email}}.</p>
+<p><a href="{{.ConfirmURL}}">Confirm this address</a></p>
+<p><small>If it was not you, ignore this email and nothing will be sent.</small></p>
+</body>
+</html>
+`
+
+// unsubscribePageTemplate asks before unsubscribing, since mail scanners
+// follow the links in emails. Mail clients that support one-click
+// unsubscribe post to the link directly.
+const unsubscribePageTemplate = `<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif; color: #222;">
+<form method="post">
+<input type="hidden" name="token" value="{{.Token}}">
+<input type="hidden" name="list" value="{{.List}}">
+<p>Stop sending {{if eq .List "all"}}all emails{{else}}{{.List}} emails{{end}} about this budget to {{.Email}}?</p>
+<button type="submit">Unsubscribe</button>
+</form>
+</body>
+</html>
+`
+
+var (
+	digestText      = texttemplate.Must(texttemplate.New("digest").Funcs(templateFuncs("")).Parse(digestTextTemplate))
+	digestHTML      = htmltemplate.Must(htmltemplate.New("digest").Funcs(templateFuncs("")).Parse(digestHTMLTemplate))
+	alertText       = texttemplate.Must(texttemplate.New("alert").Parse(alertTextTemplate))
+	alertHTML       = htmltemplate.Must(htmltemplate.New("alert").Parse(alertHTMLTemplate))
+	confirmText     = texttemplate.Must(texttemplate.New("confirm").Parse(confirmTextTemplate))
+	confirmHTML     = htmltemplate.Must(htmltemplate.New("confirm").Parse(confirmHTMLTemplate))
+	unsubscribePage = htmltemplate.Must(htmltemplate.New("unsubscribe").Parse(unsubscribePageTemplate))
+)
+
+// templateFuncs are the functions the email templates use. Amounts are
+// formatted in the given currency.
+func templateFuncs(currency string) map[string]interface{} {
+	return map[string]interface{}{
+		"money":  func(m Money) string { return m.Format(currency) + " " + currency },
+		"negate": func(m Money) Money { return -m },
+		"join":   strings.Join,
+	}
+}
+
+// RenderDigest renders a digest as an email, linking to an unsubscribe page.
+func RenderDigest(digest Digest, unsubscribeURL string) (Email, error) {
+	title := "Your weekly budget digest"
+	if digest.Period == DigestMonthly {
+		title = "Your monthly budget digest"
+	}
+	data := struct {
+		Digest
+		Title          string
+		UnsubscribeURL string
+	}{digest, title, unsubscribeURL}
+	funcs := templateFuncs(digest.BaseCurrency)
+
+	var text, html bytes.Buffer
+	textTemplate, _ := digestText.Clone()
+	if err := textTemplate.Funcs(funcs).Execute(&text, data); err != nil {
+		return Email{}, err
+	}
+	htmlTemplate, _ := digestHTML.Clone()
+	if err := htmlTemplate.Funcs(funcs).Execute(&html, data); err != nil {
+		return Email{}, err
+	}
+	return Email{
+		Subject: fmt.Sprintf("%s, %s to %s", title, digest.From, digest.To),
+		Text:    text.String(),
+		HTML:    html.String(),
+	}, nil
+}
+
+// renderAlertEmail renders a notification as an email.
+func renderAlertEmail(notification Notification, unsubscribeURL string) (Email, error) {
+	data := struct {
+		Notification
+		UnsubscribeURL string
+	}{notification, unsubscribeURL}
+
+	var text, html bytes.Buffer
+	if err := alertText.Execute(&text, data); err != nil {
+		return Email{}, err
+	}
+	if err := alertHTML.Execute(&html, data); err != nil {
+		return Email{}, err
+	}
+	return Email{Subject: notification.Title, Text: text.String(), HTML: html.String()}, nil
+}
+
+// renderConfirmEmail renders the email that asks a member to confirm a new
+// address.
+func renderConfirmEmail(subscription EmailSubscription) (Email, error) {
+	data := struct {
+		Email      string
+		ConfirmURL string
+	}{subscription.PendingEmail, confirmURL(subscription)}
+
+	var text, html bytes.Buffer
+	if err := confirmText.Execute(&text, data); err != nil {
+		return Email{}, err
+	}
+	if err := confirmHTML.Execute(&html, data); err != nil {
+		return Email{}, err
+	}
+	return Email{To: subscription.PendingEmail, Subject: "Confirm your email address", Text: text.String(), HTML: html.String()}, nil
+}
+
+// subscriptionLinkToken identifies a subscription in the links sent by
+// email. It holds the workspace and subscriber, so the link works without
+// signing in, and one of the subscription's secrets, so it cannot be guessed.
+func subscriptionLinkToken(subscription EmailSubscription, secret string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(subscription.UserId + "\n" + subscription.SubscriberId + "\n" + secret))
+}
+
+// subscriptionForLinkToken returns the subscription a link token was made
+// for with the secret, or nil if the token does not match one.
+func subscriptionForLinkToken(token string, secret func(EmailSubscription) string) (*EmailSubscription, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, nil
+	}
+	parts := strings.Split(string(decoded), "\n")
+	if len(parts) != 3 || parts[2] == "" {
+		return nil, nil
+	}
+	subscription, err := GetEmailSubscription(parts[0], parts[1])
+	if err != nil || subscription == nil {
+		return nil, err
+	}
+	expected := secret(*subscription)
+	if expected == "" || subtle.ConstantTimeCompare([]byte(expected), []byte(parts[2])) != 1 {
+		return nil, nil
+	}
+	return subscription, nil
+}
+
+// unsubscribeToken identifies a subscription in unsubscribe links.
+func unsubscribeToken(subscription EmailSubscription) string {
+	return subscriptionLinkToken(subscription, subscription.UnsubscribeToken)
+}
+
+// subscriptionForToken returns the subscription an unsubscribe token was
+// made for, or nil if the token does not match one.
+func subscriptionForToken(token string) (*EmailSubscription, error) {
+	return subscriptionForLinkToken(token, func(subscription EmailSubscription) string { return subscription.UnsubscribeToken })
+}
+
+// confirmURL links to the page that confirms a subscription's pending
+// address.
+func confirmURL(subscription EmailSubscription) string {
+	return publicURL() + "/api/email-subscriptions/confirm?token=" + url.QueryEscape(subscriptionLinkToken(subscription, subscription.ConfirmToken))
+}
+
+// subscriptionForConfirmToken returns the subscription a confirmation token
+// was made for, or nil if the token does not match one.
+func subscriptionForConfirmToken(token string) (*EmailSubscription, error) {
+	return subscriptionForLinkToken(token, func(subscription EmailSubscription) string { return subscription.ConfirmToken })
+}
+
+// isSubscriber reports whether a subscription should still be sent emails:
+// it has a confirmed address and its member still belongs to the
+// workspace.
+func isSubscriber(subscription EmailSubscription) (bool, error) {
+	if subscription.Email == "" {
+		return false, nil
+	}
+	role, err := WorkspaceRole(subscription.SubscriberId, subscription.UserId)
+	if err != nil {
+		return false, err
+	}
+	return role != "", nil
+}
+
+// unsubscribeURL links to the page that turns off one list, or all of them.
+func unsubscribeURL(subscription EmailSubscription, list string) string {
+	return publicURL() + "/api/unsubscribe?token=" + url.QueryEscape(unsubscribeToken(subscription)) + "&list=" + url.QueryEscape(list)
+}
+
+// Unsubscribe turns off a list of a subscription, or every list for "all".
+func Unsubscribe(subscription *EmailSubscription, list string) error {
+	switch list {
+	case AlertsList:
+		subscription.Alerts = false
+	case DigestWeekly:
+		subscription.Weekly = false
+	case DigestMonthly:
+		subscription.Monthly = false
+	case "all":
+		subscription.Alerts, subscription.Weekly, subscription.Monthly = false, false, false
+	default:
+		return fmt.Errorf("invalid list %q, expected alerts, weekly, monthly or all", list)
+	}
+	return nil
+}
+
+// sendEmail sends an email to a subscriber with one-click unsubscribe
+// headers for a list.
+func sendEmail(subscription EmailSubscription, list string, email Email) error {
+	email.To = subscription.Email
+	email.Headers = map[string]string{
+		"List-Unsubscribe":      "<" + unsubscribeURL(subscription, list) + ">",
+		"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+	}
+	return SMTPSenderFromEnv().Send(email)
+}
+
+// emailChannel sends notifications to the members of the workspace who have
+// opted in to alert emails and confirmed their address.
+type emailChannel struct{}
+
+func (emailChannel) Name() string { return "email" }
+
+func (emailChannel) Send(notification Notification) error {
+	subscriptions, err := GetEmailSubscriptions(notification.UserId)
+	if err != nil {
+		return err
+	}
+	// Each member is sent their own email, so one address that fails does
+	// not keep the alert from the others
+	sent, wanted := 0, 0
+	var failed []string
+	for _, subscription := range subscriptions {
+		if !subscription.Alerts {
+			continue
+		}
+		ok, err := isSubscriber(subscription)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		wanted++
+		email, err := renderAlertEmail(notification, unsubscribeURL(subscription, AlertsList))
+		if err == nil {
+			err = sendEmail(subscription, AlertsList, email)
+		}
+		if err != nil {
+			log.Printf("Notification %s: emailing %s failed: %v", notification.NotificationId, subscription.Email, err)
+			failed = append(failed, fmt.Sprintf("%s: %v", subscription.Email, err))
+			continue
+		}
+		sent++
+	}
+	if wanted == 0 {
+		return fmt.Errorf("no members have opted in to alert emails")
+	}
+	if sent == 0 {
+		return fmt.Errorf("emailing every member failed: %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// DigestRunResult reports what SendDigests sent.
+type DigestRunResult struct {
+	Period    string   `json:"period"`
+	PeriodKey string   `json:"periodKey"`
+	DryRun    bool     `json:"dryRun"`
+	Sent      int      `json:"sent"`
+	Skipped   int      `json:"skipped"`
+	Failed    []string `json:"failed"`
+}
+
+// SendDigests emails the weekly or monthly digest for the last complete
+// period to every subscriber who opted in, is still a member of the
+// workspace and has not had it yet, so it can be run again after a failure
+// without sending twice.
+func SendDigests(period string, now time.Time, dryRun bool) (*DigestRunResult, error) {
+	_, _, key, err := digestPeriod(period, now)
+	if err != nil {
+		return nil, err
+	}
+	result := &DigestRunResult{Period: period, PeriodKey: key, DryRun: dryRun, Failed: []string{}}
+
+	var subscriptions []EmailSubscription
+	err = ScanAllItems("EmailSubscriptions", func(item map[string]*dynamodb.AttributeValue) error {
+		var subscription EmailSubscription
+		if err := dynamodbattribute.UnmarshalMap(item, &subscription); err != nil {
+			return fmt.Errorf("failed to unmarshal EmailSubscriptions item: %v", err)
+		}
+		subscriptions = append(subscriptions, subscription)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	digests := make(map[string]*Digest)
+	for _, subscription := range subscriptions {
+		wanted, last := subscription.Weekly, subscription.LastWeekly
+		if period == DigestMonthly {
+			wanted, last = subscription.Monthly, subscription.LastMonthly
+		}
+		if !wanted {
+			continue
+		}
+		if last == key {
+			result.Skipped++
+			continue
+		}
+		ok, err := isSubscriber(subscription)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			result.Skipped++
+			continue
+		}
+
+		digest, ok := digests[subscription.UserId]
+		if !ok {
+			digest, err = LoadDigest(subscription.UserId, period, now)
+			if err != nil {
+				return nil, err
+			}
+			digests[subscription.UserId] = digest
+		}
+		if dryRun {
+			result.Sent++
+			continue
+		}
+
+		email, err := RenderDigest(*digest, unsubscribeURL(subscription, period))
+		if err == nil {
+			err = sendEmail(subscription, period, email)
+		}
+		if err != nil {
+			result.Failed = append(result.Failed, fmt.Sprintf("%s: %v", subscription.Email, err))
+			continue
+		}
+		if _, err := MarkDigestSent(subscription.UserId, subscription.SubscriberId, period, key); err != nil {
+			return nil, err
+		}
+		result.Sent++
+	}
+	return result, nil
+}
+
+// SendDigestsCommand implements the "send-digests" admin command, meant to
+// be run on a schedule:
+//
+//	backend send-digests -period weekly|monthly [-dry-run]
+func SendDigestsCommand(args []string) int {
+	flags := flag.NewFlagSet("send-digests", flag.ContinueOnError)
+	period := flags.String("period", "", "digest to send: weekly or monthly")
+	dryRun := flags.Bool("dry-run", false, "report what would be sent without sending")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	result, err := SendDigests(*period, time.Now().UTC(), *dryRun)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "send-digests: %v\n", err)
+		return 1
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(result)
+	if len(result.Failed) > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/base64"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDigestPeriod(t *testing.T) {
+	now := time.Date(2024, 3, 6, 15, 0, 0, 0, time.UTC) // a Wednesday
+	tests := []struct {
+		period   string
+		from, to string
+		key      string
+	}{
+		{DigestWeekly, "2024-02-26", "2024-03-03", "2024-W09"},
+		{DigestMonthly, "2024-02-01", "2024-02-29", "2024-02"},
+	}
+	for _, test := range tests {
+		from, to, key, err := digestPeriod(test.period, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if from.Format("2006-01-02") != test.from || to.Format("2006-01-02") != test.to || key != test.key {
+			t.Errorf("%s: got %s to %s (%s), want %s to %s (%s)", test.period,
+				from.Format("2006-01-02"), to.Format("2006-01-02"), key, test.from, test.to, test.key)
+		}
+	}
+	if _, _, _, err := digestPeriod("daily", now); err == nil {
+		t.Error("expected an error for an unknown period")
+	}
+}
+
+func TestUnsubscribe(t *testing.T) {
+	tests := []struct {
+		list                    string
+		alerts, weekly, monthly bool
+	}{
+		{AlertsList, false, true, true},
+		{DigestWeekly, true, false, true},
+		{DigestMonthly, true, true, false},
+		{"all", false, false, false},
+	}
+	for _, test := range tests {
+		subscription := EmailSubscription{Alerts: true, Weekly: true, Monthly: true}
+		if err := Unsubscribe(&subscription, test.list); err != nil {
+			t.Fatal(err)
+		}
+		if subscription.Alerts != test.alerts || subscription.Weekly != test.weekly || subscription.Monthly != test.monthly {
+			t.Errorf("%s: got %+v", test.list, subscription)
+		}
+	}
+	if err := Unsubscribe(&EmailSubscription{}, "daily"); err == nil {
+		t.Error("expected an error for an unknown list")
+	}
+}
+
+func TestRenderConfirmEmail(t *testing.T) {
+	subscription := EmailSubscription{
+		UserId:           "household-1",
+		SubscriberId:     "user-2",
+		Email:            "old@example.com",
+		PendingEmail:     "new@example.com",
+		UnsubscribeToken: "unsubscribe-secret",
+		ConfirmToken:     "confirm-secret",
+	}
+	email, err := renderConfirmEmail(subscription)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if email.To != "new@example.com" {
+		t.Errorf("sent to %s, want the pending address", email.To)
+	}
+
+	// The link carries the confirmation secret, not the unsubscribe one
+	link := confirmURL(subscription)
+	if !strings.Contains(email.Text, link) {
+		t.Errorf("text does not link to %s:\n%s", link, email.Text)
+	}
+	parsed, err := url.Parse(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := base64.RawURLEncoding.DecodeString(parsed.Query().Get("token"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(token) != "household-1\nuser-2\nconfirm-secret" {
+		t.Errorf("token holds %q", token)
+	}
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	// duplicateThreshold is the minimum score for two expenses to be flagged
+	duplicateThreshold = 0.75
+	// duplicateMaxDays is how far apart two dated expenses may be and still
+	// be considered the same transaction, allowing for posting delays
+	duplicateMaxDays = 3
+)
+
+// FlagDuplicateExpenses compares new expense items against the ones already
+// stored in the same months and against each other. An item dated within
+// duplicateMaxDays of the start or end of its month is also compared with
+// the neighbouring month, since a posting delay can move the same purchase
+// across the boundary. Likely duplicates get their DuplicateOf field set to
+// the name of the item they duplicate, and DuplicateOfMonth when that item is
+// in another month, and the matches are returned for review. Items are still
+// saved; nothing is dropped.
+func FlagDuplicateExpenses(items []ExpenseItem) ([]DuplicateMatch, error) {
+	existingByPartition := make(map[string][]ExpenseItem)
+	matches := []DuplicateMatch{}
+
+	load := func(userId string, month string) ([]ExpenseItem, error) {
+		partition := userId + "#" + month
+		if existing, ok := existingByPartition[partition]; ok {
+			return existing, nil
+		}
+		stored, err := GetAllExpenses(userId, month)
+		if err != nil {
+			return nil, err
+		}
+		existingByPartition[partition] = stored
+		return stored, nil
+	}
+
+	for i := range items {
+		item := &items[i]
+		partition := item.UserId + "#" + item.Month
+
+		existing, err := load(item.UserId, item.Month)
+		if err != nil {
+			return nil, err
+		}
+
+		// Re-saving an item that already exists keeps its review state, so a
+		// re-import does not resurrect flags the user already dismissed
+		if previous := findExpense(existing, item.ExpenseItemName); previous != nil {
+			item.DuplicateOf = previous.DuplicateOf
+			item.DuplicateOfMonth = previous.DuplicateOfMonth
+			continue
+		}
+
+		candidates := existing
+		for _, month := range adjacentDuplicateMonths(*item) {
+			neighbours, err := load(item.UserId, month)
+			if err != nil {
+				return nil, err
+			}
+			candidates = append(append([]ExpenseItem{}, candidates...), neighbours...)
+		}
+
+		item.DuplicateOf = ""
+		item.DuplicateOfMonth = ""
+		var best *ExpenseItem
+		bestScore := 0.0
+		for j := range candidates {
+			score := DuplicateScore(*item, candidates[j])
+			if score > bestScore {
+				best, bestScore = &candidates[j], score
+			}
+		}
+
+		if best != nil && bestScore >= duplicateThreshold {
+			item.DuplicateOf = best.ExpenseItemName
+			if best.Month != item.Month {
+				item.DuplicateOfMonth = best.Month
+			}
+			matches = append(matches, DuplicateMatch{
+				Month:            item.Month,
+				ExpenseItemName:  item.ExpenseItemName,
+				DuplicateOf:      best.ExpenseItemName,
+				DuplicateOfMonth: best.Month,
+				Score:            math.Round(bestScore*100) / 100,
+			})
+		}
+
+		existingByPartition[partition] = append(existing, *item)
+	}
+
+	return matches, nil
+}
+
+// adjacentDuplicateMonths returns the neighbouring month an expense should
+// also be compared with when its date is within duplicateMaxDays of the
+// boundary, or nothing for undated expenses and dates mid-month.
+func adjacentDuplicateMonths(item ExpenseItem) []string {
+	date, err := time.Parse("2006-01-02", item.Date)
+	if err != nil {
+		return nil
+	}
+	var months []string
+	if before := date.AddDate(0, 0, -duplicateMaxDays); before.Format(monthLayout) != item.Month {
+		months = append(months, before.Format(monthLayout))
+	}
+	if after := date.AddDate(0, 0, duplicateMaxDays); after.Format(monthLayout) != item.Month {
+		months = append(months, after.Format(monthLayout))
+	}
+	return months
+}
+
+// DuplicateScore rates how likely two expenses are the same transaction, from
+// 0 to 1. The amounts must match to the cent; the dates, when both are known,
+// must be within a few days; and the descriptions are compared fuzzily.
+func DuplicateScore(a ExpenseItem, b ExpenseItem) float64 {
+	if a.ExpenseItemName == b.ExpenseItemName {
+		return 0
+	}
+	if a.Currency != b.Currency || a.ExpenseValue.Round(a.Currency) != b.ExpenseValue.Round(b.Currency) {
+		return 0
+	}
+
+	dateScore := 0.5
+	dateA, errA := time.Parse("2006-01-02", a.Date)
+	dateB, errB := time.Parse("2006-01-02", b.Date)
+	if errA == nil && errB == nil {
+		days := math.Abs(dateA.Sub(dateB).Hours() / 24)
+		if days > duplicateMaxDays {
+			return 0
+		}
+		dateScore = 1 - days/(duplicateMaxDays+1)
+	}
+
+	nameScore := NameSimilarity(expenseDescription(a), expenseDescription(b))
+
+	return 0.3 + 0.25*dateScore + 0.45*nameScore
+}
+
+// NameSimilarity compares two merchant names or descriptions, ignoring case,
+// punctuation and digits such as card numbers or store ids. It returns the
+// better of a token overlap and an edit distance ratio, from 0 to 1.
+func NameSimilarity(a string, b string) float64 {
+	tokensA := normalizeName(a)
+	tokensB := normalizeName(b)
+	if len(tokensA) == 0 || len(tokensB) == 0 {
+		return 0
+	}
+
+	joinedA := strings.Join(tokensA, " ")
+	joinedB := strings.Join(tokensB, " ")
+	if joinedA == joinedB {
+		return 1
+	}
+
+	// Token overlap relative to the shorter name, so "AMAZON" matches
+	// "AMAZON MKTPLACE SEATTLE WA"
+	set := make(map[string]bool, len(tokensA))
+	for _, token := range tokensA {
+		set[token] = true
+	}
+	common := 0
+	for _, token := range tokensB {
+		if set[token] {
+			common++
+			delete(set, token)
+		}
+	}
+	overlap := float64(common) / float64(min(len(tokensA), len(tokensB)))
+
+	distance := levenshtein(joinedA, joinedB)
+	ratio := 1 - float64(distance)/float64(max(len(joinedA), len(joinedB)))
+
+	return math.Max(overlap, ratio)
+}
+
+// nameNoiseTokens are words banks add to descriptions that say nothing about
+// the merchant.
+var nameNoiseTokens = map[string]bool{
+	"pos": true, "purchase": true, "debit": true, "card": true, "payment": true,
+	"www": true, "com": true, "inc": true, "llc": true, "ltd": true, "co": true,
+}
+
+func normalizeName(name string) []string {
+	var tokens []string
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	for _, word := range words {
+		if !nameNoiseTokens[word] {
+			tokens = append(tokens, word)
+		}
+	}
+	return tokens
+}
+
+func levenshtein(a string, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(rb)]
+}
+
+// expenseDescription is the text used to compare expenses. Imported items are
+// named after the bank transaction id, so the merchant is preferred.
+func expenseDescription(item ExpenseItem) string {
+	if item.Merchant != "" {
+		return item.Merchant
+	}
+	return item.ExpenseItemName
+}
+
+func findExpense(items []ExpenseItem, expenseItemName string) *ExpenseItem {
+	for i := range items {
+		if items[i].ExpenseItemName == expenseItemName {
+			return &items[i]
+		}
+	}
+	return nil
+}
+
+// MergeExpenses folds a duplicate into the expense that is kept: tags are
+// combined, a missing date, merchant or split is filled in, and the duplicate
+// flag is cleared. The caller is responsible for deleting the duplicate and
+// moving flags that name it over to the kept expense with repointDuplicates.
+func MergeExpenses(kept ExpenseItem, duplicate ExpenseItem) ExpenseItem {
+	seen := make(map[string]bool)
+	tags := []string{}
+	for _, tag := range append(append([]string{}, kept.ExpenseTags...), duplicate.ExpenseTags...) {
+		if !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	kept.ExpenseTags = tags
+
+	if kept.Date == "" {
+		kept.Date = duplicate.Date
+	}
+	if kept.Merchant == "" {
+		kept.Merchant = duplicate.Merchant
+	}
+	if len(kept.Splits) == 0 && kept.ExpenseValue == duplicate.ExpenseValue {
+		kept.Splits = duplicate.Splits
+	}
+	kept.DuplicateOf = ""
+	kept.DuplicateOfMonth = ""
+	return kept
+}
+
+// repointDuplicates returns the expenses flagged as duplicates of an expense
+// that was merged into kept, flagged as duplicates of kept instead, so that
+// no flag is left naming the deleted item. Only the duplicate's month and
+// its neighbours need to be passed, since flags never reach further.
+func repointDuplicates(items []ExpenseItem, kept ExpenseItem, duplicate ExpenseItem) []ExpenseItem {
+	var repointed []ExpenseItem
+	for _, item := range items {
+		if item.DuplicateOf != duplicate.ExpenseItemName {
+			continue
+		}
+		month := item.DuplicateOfMonth
+		if month == "" {
+			month = item.Month
+		}
+		if month != duplicate.Month {
+			continue
+		}
+		if item.Month == kept.Month && item.ExpenseItemName == kept.ExpenseItemName {
+			continue
+		}
+		if item.Month == duplicate.Month && item.ExpenseItemName == duplicate.ExpenseItemName {
+			continue
+		}
+		item.DuplicateOf = kept.ExpenseItemName
+		item.DuplicateOfMonth = ""
+		if kept.Month != item.Month {
+			item.DuplicateOfMonth = kept.Month
+		}
+		repointed = append(repointed, item)
+	}
+	return repointed
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAdjacentDuplicateMonths(t *testing.T) {
+	tests := []struct {
+		date  string
+		month string
+		want  []string
+	}{
+		{"2024-01-15", "2024-01", nil},
+		{"2024-01-02", "2024-01", []string{"2023-12"}},
+		{"2024-01-29", "2024-01", []string{"2024-02"}},
+		{"2024-01-28", "2024-01", nil},
+		{"2024-02-27", "2024-02", []string{"2024-03"}},
+		{"", "2024-01", nil},
+	}
+	for _, test := range tests {
+		got := adjacentDuplicateMonths(ExpenseItem{Date: test.date, Month: test.month})
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("adjacentDuplicateMonths(%s) = %v, want %v", test.date, got, test.want)
+		}
+	}
+}
+
+func TestDuplicateScore(t *testing.T) {
+	base := ExpenseItem{ExpenseItemName: "a", Month: "2024-01", ExpenseValue: 125000, Date: "2024-01-31", Merchant: "AMAZON MKTPLACE SEATTLE WA"}
+	tests := []struct {
+		name      string
+		other     ExpenseItem
+		duplicate bool
+	}{
+		{"same purchase posted next month", ExpenseItem{ExpenseItemName: "b", Month: "2024-02", ExpenseValue: 125000, Date: "2024-02-02", Merchant: "Amazon"}, true},
+		{"different amount", ExpenseItem{ExpenseItemName: "b", Month: "2024-01", ExpenseValue: 125100, Date: "2024-01-31", Merchant: "Amazon"}, false},
+		{"too far apart", ExpenseItem{ExpenseItemName: "b", Month: "2024-02", ExpenseValue: 125000, Date: "2024-02-05", Merchant: "Amazon"}, false},
+		{"different currency", ExpenseItem{ExpenseItemName: "b", Month: "2024-01", ExpenseValue: 125000, Date: "2024-01-31", Merchant: "Amazon", Currency: "EUR"}, false},
+		{"same item", base, false},
+	}
+	for _, test := range tests {
+		score := DuplicateScore(base, test.other)
+		if (score >= duplicateThreshold) != test.duplicate {
+			t.Errorf("%s: score %.2f, want duplicate %v", test.name, score, test.duplicate)
+		}
+	}
+}
+
+func TestRepointDuplicates(t *testing.T) {
+	kept := ExpenseItem{ExpenseItemName: "kept", Month: "2024-02"}
+	duplicate := ExpenseItem{ExpenseItemName: "dup", Month: "2024-01", DuplicateOf: "kept", DuplicateOfMonth: "2024-02"}
+	items := []ExpenseItem{
+		duplicate,
+		kept,
+		{ExpenseItemName: "same month", Month: "2024-01", DuplicateOf: "dup"},
+		{ExpenseItemName: "kept's month", Month: "2024-02", DuplicateOf: "dup", DuplicateOfMonth: "2024-01"},
+		{ExpenseItemName: "earlier month", Month: "2023-12", DuplicateOf: "dup", DuplicateOfMonth: "2024-01"},
+		{ExpenseItemName: "same name elsewhere", Month: "2023-12", DuplicateOf: "dup"},
+		{ExpenseItemName: "other flag", Month: "2024-01", DuplicateOf: "something else"},
+		{ExpenseItemName: "not flagged", Month: "2024-01"},
+	}
+
+	got := repointDuplicates(items, kept, duplicate)
+	want := []ExpenseItem{
+		{ExpenseItemName: "same month", Month: "2024-01", DuplicateOf: "kept", DuplicateOfMonth: "2024-02"},
+		{ExpenseItemName: "kept's month", Month: "2024-02", DuplicateOf: "kept"},
+		{ExpenseItemName: "earlier month", Month: "2023-12", DuplicateOf: "kept", DuplicateOfMonth: "2024-02"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	// The kept item itself is never flagged against itself
+	kept.DuplicateOf, kept.DuplicateOfMonth = "dup", "2024-01"
+	if got := repointDuplicates([]ExpenseItem{kept}, kept, duplicate); len(got) != 0 {
+		t.Errorf("got %+v", got)
+	}
+}
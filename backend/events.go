@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Types of event published when a workspace's data changes.
+const (
+	EventIncomeCreated  = "income.created"
+	EventIncomeUpdated  = "income.updated"
+	EventIncomeDeleted  = "income.deleted"
+	EventBudgetCreated  = "budget.created"
+	EventBudgetUpdated  = "budget.updated"
+	EventBudgetDeleted  = "budget.deleted"
+	EventBudgetExceeded = "budget.exceeded"
+	EventExpenseCreated = "expense.created"
+	EventExpenseUpdated = "expense.updated"
+	EventExpenseDeleted = "expense.deleted"
+)
+
+var eventTypes = map[string]bool{
+	EventIncomeCreated:  true,
+	EventIncomeUpdated:  true,
+	EventIncomeDeleted:  true,
+	EventBudgetCreated:  true,
+	EventBudgetUpdated:  true,
+	EventBudgetDeleted:  true,
+	EventBudgetExceeded: true,
+	EventExpenseCreated: true,
+	EventExpenseUpdated: true,
+	EventExpenseDeleted: true,
+}
+
+// Event is a change to a workspace's data. Event ids are time-ordered.
+type Event struct {
+	EventId   string          `json:"id"`
+	Type      string          `json:"type"`
+	UserId    string          `json:"userId"`
+	Month     string          `json:"month"`
+	CreatedAt string          `json:"createdAt"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// eventListeners are called with every event published, such as the webhook
+// dispatcher.
+var eventListeners []func(Event)
+
+// AddEventListener registers a function to be called with every event.
+func AddEventListener(listener func(Event)) {
+	eventListeners = append(eventListeners, listener)
+}
+
+// PublishEvent tells the event listeners about a change to a month of a
+// workspace. The change has already been saved, so failures are logged
+// rather than returned.
+func PublishEvent(userId string, eventType string, month string, data interface{}) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("Publishing %s for %s failed: %v", eventType, userId, err)
+		return
+	}
+	event := Event{
+		EventId:   uuid.Must(uuid.NewV7()).String(),
+		Type:      eventType,
+		UserId:    userId,
+		Month:     month,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339Nano),
+		Data:      payload,
+	}
+	for _, listener := range eventListeners {
+		listener(event)
+	}
+}
+
+// BudgetWatch remembers which budget items of a month were already over
+// budget before a change, so that budget.exceeded is only published for the
+// items the change pushed over.
+type BudgetWatch struct {
+	userId   string
+	month    string
+	exceeded map[string]bool
+}
+
+// WatchBudgets notes the budget items of a month that are over budget. Call
+// it before a change and PublishExceeded after.
+func WatchBudgets(userId string, month string) *BudgetWatch {
+	watch := &BudgetWatch{userId: userId, month: month}
+	lines, _, err := exceededBudgets(userId, month)
+	if err != nil {
+		log.Printf("Checking budgets for %s in %s failed: %v", userId, month, err)
+		return watch
+	}
+	watch.exceeded = make(map[string]bool)
+	for _, line := range lines {
+		watch.exceeded[strings.ToLower(line.BudgetItemName)] = true
+	}
+	return watch
+}
+
+// PublishExceeded publishes budget.exceeded for each budget item that is
+// over budget now but was not when the watch started.
+func (watch *BudgetWatch) PublishExceeded() {
+	if watch.exceeded == nil {
+		return
+	}
+	lines, base, err := exceededBudgets(watch.userId, watch.month)
+	if err != nil {
+		log.Printf("Checking budgets for %s in %s failed: %v", watch.userId, watch.month, err)
+		return
+	}
+	for _, line := range lines {
+		if watch.exceeded[strings.ToLower(line.BudgetItemName)] {
+			continue
+		}
+		PublishEvent(watch.userId, EventBudgetExceeded, watch.month, struct {
+			BudgetLine
+			Month        string `json:"month"`
+			BaseCurrency string `json:"baseCurrency"`
+		}{line, watch.month, base})
+	}
+}
+
+// exceededBudgets returns the budget lines of a month whose spending is more
+// than the budget, in the base currency.
+func exceededBudgets(userId string, month string) ([]BudgetLine, string, error) {
+	settings, err := GetUserSettings(userId)
+	if err != nil {
+		return nil, "", err
+	}
+	rates, err := GetAllExchangeRates(userId)
+	if err != nil {
+		return nil, "", err
+	}
+	budget, err := GetAllBudget(userId, month)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(budget) == 0 {
+		return nil, settings.BaseCurrency, nil
+	}
+	expenses, err := GetAllExpenses(userId, month)
+	if err != nil {
+		return nil, "", err
+	}
+
+	report := BuildCurrencyReport(month, settings.BaseCurrency, NewRateTable(rates), nil, budget, expenses)
+	var lines []BudgetLine
+	for _, line := range report.Budgets {
+		if line.Spent > line.Budget {
+			lines = append(lines, line)
+		}
+	}
+	return lines, settings.BaseCurrency, nil
+}
@@ -0,0 +1,439 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// ExportSchemaVersion is bumped whenever the layout of an export changes in a
+// way an importer needs to know about.
+const ExportSchemaVersion = 1
+
+// exportSection describes one kind of user data included in an export. Items
+// are partitioned either per month ("userId#month") or per user ("userId").
+// Item is a zero value of the model type; its json tags double as the CSV
+// column names.
+type exportSection struct {
+	Name         string
+	Table        string
+	PartitionKey string
+	SortKey      string
+	Item         interface{}
+	// OwnerOnly sections are only exported for the workspace's owner
+	OwnerOnly bool
+	// Export, when set, prepares an item for export, such as by blanking
+	// secrets the API does not return either
+	Export func(item interface{}) interface{}
+	// Restore, when set, prepares an archived item to be written back
+	Restore func(item interface{}) interface{}
+}
+
+// exportSections lists the data included in an export, in output order.
+var exportSections = []exportSection{
+	{Name: "income", Table: "Income", PartitionKey: "userId#month", SortKey: "incomeItemName", Item: IncomeItem{}},
+	{Name: "budget", Table: "Budget", PartitionKey: "userId#month", SortKey: "budgetItemName", Item: BudgetItem{}},
+	{Name: "expenses", Table: "Expenses", PartitionKey: "userId#month", SortKey: "expenseItemName", Item: ExpenseItem{}},
+	{Name: "accounts", Table: "Accounts", PartitionKey: "userId", SortKey: "accountId", Item: Account{}},
+	{Name: "transfers", Table: "Transfers", PartitionKey: "userId#month", SortKey: "transferId", Item: Transfer{}},
+	{Name: "settings", Table: "UserSettings", PartitionKey: "userId", Item: UserSettings{}},
+	{Name: "exchangeRates", Table: "ExchangeRates", PartitionKey: "userId", SortKey: "rateId", Item: ExchangeRate{}},
+	{Name: "goals", Table: "Goals", PartitionKey: "userId", SortKey: "goalId", Item: Goal{}},
+	{Name: "goalContributions", Table: "GoalContributions", PartitionKey: "userId", SortKey: "contributionId", Item: GoalContribution{}},
+	{Name: "debts", Table: "Debts", PartitionKey: "userId", SortKey: "debtId", Item: Debt{}},
+	{Name: "debtPayments", Table: "DebtPayments", PartitionKey: "userId", SortKey: "paymentId", Item: DebtPayment{}},
+	{Name: "holdings", Table: "Holdings", PartitionKey: "userId", SortKey: "holdingId", Item: Holding{}},
+	{Name: "holdingValuations", Table: "HoldingValuations", PartitionKey: "userId", SortKey: "valuationId", Item: HoldingValuation{}},
+	{Name: "investmentTransactions", Table: "InvestmentTransactions", PartitionKey: "userId", SortKey: "transactionId", Item: InvestmentTransaction{}},
+	{Name: "securityPrices", Table: "SecurityPrices", PartitionKey: "userId", SortKey: "priceId", Item: SecurityPrice{}},
+	{Name: "recurringItems", Table: "RecurringItems", PartitionKey: "userId", SortKey: "recurringId", Item: RecurringItem{}},
+	{Name: "scenarios", Table: "Scenarios", PartitionKey: "userId", SortKey: "scenarioId", Item: Scenario{}},
+	{Name: "alertRules", Table: "AlertRules", PartitionKey: "userId", SortKey: "ruleId", Item: AlertRule{}},
+	{Name: "notifications", Table: "Notifications", PartitionKey: "userId", SortKey: "notificationId", Item: Notification{}},
+	{Name: "emailSubscriptions", Table: "EmailSubscriptions", PartitionKey: "userId", SortKey: "subscriberId", Item: EmailSubscription{}, Export: exportEmailSubscription, Restore: restoreEmailSubscription},
+	{Name: "webhooks", Table: "Webhooks", PartitionKey: "userId", SortKey: "webhookId", Item: Webhook{}, OwnerOnly: true, Export: exportWebhook, Restore: restoreWebhook},
+	{Name: "webhookDeliveries", Table: "WebhookDeliveries", PartitionKey: "userId", SortKey: "deliveryId", Item: WebhookDelivery{}, OwnerOnly: true, Restore: restoreWebhookDelivery},
+}
+
+// exportSectionsFor returns the sections exported for a member with the
+// given role in the workspace.
+func exportSectionsFor(role string) []exportSection {
+	var sections []exportSection
+	for _, section := range exportSections {
+		if section.OwnerOnly && role != RoleOwner {
+			continue
+		}
+		sections = append(sections, section)
+	}
+	return sections
+}
+
+// exportEmailSubscription blanks the secrets of a member's email links,
+// which would let anyone holding the export unsubscribe them or confirm an
+// address for them.
+func exportEmailSubscription(item interface{}) interface{} {
+	subscription := item.(EmailSubscription)
+	subscription.UnsubscribeToken = ""
+	subscription.ConfirmToken = ""
+	return subscription
+}
+
+// restoreEmailSubscription gives a restored subscription new link secrets,
+// as exports do not hold them. Links in emails sent before stop working.
+func restoreEmailSubscription(item interface{}) interface{} {
+	subscription := item.(EmailSubscription)
+	subscription.UnsubscribeToken = randomHex(16)
+	subscription.ConfirmToken = ""
+	if subscription.PendingEmail != "" {
+		subscription.ConfirmToken = randomHex(16)
+	}
+	return subscription
+}
+
+// exportWebhook blanks a webhook's signing secret, which would let anyone
+// holding the export forge its deliveries.
+func exportWebhook(item interface{}) interface{} {
+	webhook := item.(Webhook)
+	webhook.Secret = ""
+	return webhook
+}
+
+// restoreWebhook gives a restored webhook a new signing secret, as exports
+// do not hold them. Its receiver needs to be told the new one.
+func restoreWebhook(item interface{}) interface{} {
+	webhook := item.(Webhook)
+	if webhook.Secret == "" {
+		webhook.Secret = "whsec_" + randomHex(24)
+	}
+	return webhook
+}
+
+// restoreWebhookDelivery marks a delivery that was still pending when it
+// was exported as failed, so that the poller does not send an old event
+// again. It can still be redelivered by hand.
+func restoreWebhookDelivery(item interface{}) interface{} {
+	delivery := item.(WebhookDelivery)
+	if delivery.Status == DeliveryPending {
+		delivery.Status = DeliveryFailed
+		delivery.Error = "restored from an export before it was delivered"
+		delivery.NextAttemptAt = ""
+	}
+	return delivery
+}
+
+func (s exportSection) monthly() bool {
+	return s.PartitionKey == "userId#month"
+}
+
+// itemKey is the attribute that tells items of one partition apart. Tables
+// holding a single item per user have no sort key and use userId.
+func (s exportSection) itemKey() string {
+	if s.SortKey == "" {
+		return s.PartitionKey
+	}
+	return s.SortKey
+}
+
+// decode unmarshals a stored item into a value of the section's model type,
+// prepared for export.
+func (s exportSection) decode(av map[string]*dynamodb.AttributeValue) (interface{}, error) {
+	item := reflect.New(reflect.TypeOf(s.Item))
+	if err := dynamodbattribute.UnmarshalMap(av, item.Interface()); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal %s item: %v", s.Name, err)
+	}
+	if s.Export != nil {
+		return s.Export(item.Elem().Interface()), nil
+	}
+	return item.Elem().Interface(), nil
+}
+
+// forEachItem calls fn for every stored item of the section that belongs to
+// the user.
+func (s exportSection) forEachItem(userId string, fn func(item map[string]*dynamodb.AttributeValue) error) error {
+	if s.monthly() {
+		return QueryUserMonthItems(s.Table, userId, fn)
+	}
+	return QueryUserItems(s.Table, userId, fn)
+}
+
+// ExportManifest describes an export. It is the header of a JSON export and
+// the manifest.json entry of a CSV archive.
+type ExportManifest struct {
+	SchemaVersion int       `json:"schemaVersion"`
+	ExportedAt    time.Time `json:"exportedAt"`
+	UserId        string    `json:"userId"`
+	Sections      []string  `json:"sections"`
+}
+
+func newExportManifest(userId string, sections []exportSection) ExportManifest {
+	manifest := ExportManifest{
+		SchemaVersion: ExportSchemaVersion,
+		ExportedAt:    time.Now().UTC(),
+		UserId:        userId,
+	}
+	for _, section := range sections {
+		manifest.Sections = append(manifest.Sections, section.Name)
+	}
+	return manifest
+}
+
+// exportSource calls fn for every stored item of a section that is
+// exported.
+type exportSource func(section exportSection, fn func(item map[string]*dynamodb.AttributeValue) error) error
+
+// storedItems is the exportSource reading a user's items from the tables.
+func storedItems(userId string) exportSource {
+	return func(section exportSection, fn func(item map[string]*dynamodb.AttributeValue) error) error {
+		return section.forEachItem(userId, fn)
+	}
+}
+
+// WriteJSONExport streams all of a user's data that a member with the given
+// role may export as a single JSON document: the manifest fields followed by
+// one array per section.
+func WriteJSONExport(w io.Writer, userId string, role string) error {
+	return writeJSONExport(w, userId, exportSectionsFor(role), storedItems(userId))
+}
+
+func writeJSONExport(w io.Writer, userId string, sections []exportSection, source exportSource) error {
+	header, err := json.Marshal(newExportManifest(userId, sections))
+	if err != nil {
+		return fmt.Errorf("failed to marshal export manifest: %v", err)
+	}
+
+	// Reopen the manifest object so the sections can be appended to it
+	if _, err := w.Write(header[:len(header)-1]); err != nil {
+		return err
+	}
+
+	for _, section := range sections {
+		if _, err := fmt.Fprintf(w, ",%q:[", section.Name); err != nil {
+			return err
+		}
+
+		first := true
+		err := source(section, func(av map[string]*dynamodb.AttributeValue) error {
+			item, err := section.decode(av)
+			if err != nil {
+				return err
+			}
+			data, err := json.Marshal(item)
+			if err != nil {
+				return fmt.Errorf("failed to marshal %s item: %v", section.Name, err)
+			}
+			if !first {
+				if _, err := w.Write([]byte(",")); err != nil {
+					return err
+				}
+			}
+			first = false
+			_, err = w.Write(data)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		if _, err := w.Write([]byte("]")); err != nil {
+			return err
+		}
+	}
+
+	_, err = w.Write([]byte("}\n"))
+	return err
+}
+
+// WriteCSVExport streams all of a user's data that a member with the given
+// role may export as a zip archive holding a manifest.json and one CSV file
+// per section.
+func WriteCSVExport(w io.Writer, userId string, role string) error {
+	return writeCSVExport(w, userId, exportSectionsFor(role), storedItems(userId))
+}
+
+func writeCSVExport(w io.Writer, userId string, sections []exportSection, source exportSource) error {
+	archive := zip.NewWriter(w)
+
+	manifestFile, err := archive.Create("manifest.json")
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(manifestFile).Encode(newExportManifest(userId, sections)); err != nil {
+		return fmt.Errorf("failed to write export manifest: %v", err)
+	}
+
+	for _, section := range sections {
+		file, err := archive.Create(section.Name + ".csv")
+		if err != nil {
+			return err
+		}
+
+		writer := csv.NewWriter(file)
+		if err := writer.Write(csvHeader(reflect.TypeOf(section.Item))); err != nil {
+			return err
+		}
+		err = source(section, func(av map[string]*dynamodb.AttributeValue) error {
+			item, err := section.decode(av)
+			if err != nil {
+				return err
+			}
+			row, err := csvRow(reflect.ValueOf(item))
+			if err != nil {
+				return fmt.Errorf("failed to write %s item: %v", section.Name, err)
+			}
+			return writer.Write(row)
+		})
+		if err != nil {
+			return err
+		}
+		writer.Flush()
+		if err := writer.Error(); err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+// csvFields returns the exported struct fields that have a json name, with
+// that name.
+func csvFields(t reflect.Type) ([]int, []string) {
+	var indexes []int
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if !field.IsExported() || name == "" || name == "-" {
+			continue
+		}
+		indexes = append(indexes, i)
+		names = append(names, name)
+	}
+	return indexes, names
+}
+
+func csvHeader(t reflect.Type) []string {
+	_, names := csvFields(t)
+	return names
+}
+
+// csvRow renders a model as CSV cells. Fields with their own text form, such
+// as Money, use it; lists of strings are joined with ";" and any other
+// composite field is written as JSON.
+func csvRow(v reflect.Value) ([]string, error) {
+	indexes, _ := csvFields(v.Type())
+	row := make([]string, 0, len(indexes))
+	for _, i := range indexes {
+		field := v.Field(i)
+		if marshaler, ok := field.Interface().(encoding.TextMarshaler); ok {
+			text, err := marshaler.MarshalText()
+			if err != nil {
+				return nil, err
+			}
+			row = append(row, string(text))
+			continue
+		}
+		switch field.Kind() {
+		case reflect.String:
+			row = append(row, field.String())
+		case reflect.Float32, reflect.Float64:
+			row = append(row, strconv.FormatFloat(field.Float(), 'f', -1, 64))
+		case reflect.Int, reflect.Int32, reflect.Int64:
+			row = append(row, strconv.FormatInt(field.Int(), 10))
+		case reflect.Bool:
+			row = append(row, strconv.FormatBool(field.Bool()))
+		case reflect.Slice:
+			if field.Type().Elem().Kind() == reflect.String {
+				row = append(row, strings.Join(field.Interface().([]string), ";"))
+				continue
+			}
+			fallthrough
+		default:
+			data, err := json.Marshal(field.Interface())
+			if err != nil {
+				return nil, err
+			}
+			row = append(row, string(data))
+		}
+	}
+	return row, nil
+}
+
+// csvItem is the inverse of csvRow: it builds a model of type t from a CSV
+// row, matching cells to fields by the column names in header. Columns the
+// model does not know are ignored, and missing ones are left at zero.
+func csvItem(t reflect.Type, header []string, row []string) (interface{}, error) {
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[name] = i
+	}
+
+	item := reflect.New(t).Elem()
+	indexes, names := csvFields(t)
+	for n, i := range indexes {
+		column, ok := columns[names[n]]
+		if !ok || column >= len(row) {
+			continue
+		}
+		cell := row[column]
+		field := item.Field(i)
+
+		if unmarshaler, ok := field.Addr().Interface().(encoding.TextUnmarshaler); ok {
+			if err := unmarshaler.UnmarshalText([]byte(cell)); err != nil {
+				return nil, fmt.Errorf("invalid %s %q", names[n], cell)
+			}
+			continue
+		}
+		switch field.Kind() {
+		case reflect.String:
+			field.SetString(cell)
+		case reflect.Float32, reflect.Float64:
+			if cell == "" {
+				continue
+			}
+			value, err := strconv.ParseFloat(cell, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s %q", names[n], cell)
+			}
+			field.SetFloat(value)
+		case reflect.Int, reflect.Int32, reflect.Int64:
+			if cell == "" {
+				continue
+			}
+			value, err := strconv.ParseInt(cell, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s %q", names[n], cell)
+			}
+			field.SetInt(value)
+		case reflect.Bool:
+			field.SetBool(cell == "true")
+		case reflect.Slice:
+			if field.Type().Elem().Kind() == reflect.String {
+				values := []string{}
+				if cell != "" {
+					values = strings.Split(cell, ";")
+				}
+				field.Set(reflect.ValueOf(values))
+				continue
+			}
+			fallthrough
+		default:
+			if cell == "" {
+				continue
+			}
+			if err := json.Unmarshal([]byte(cell), field.Addr().Interface()); err != nil {
+				return nil, fmt.Errorf("invalid %s: %v", names[n], err)
+			}
+		}
+	}
+	return item.Interface(), nil
+}
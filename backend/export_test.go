@@ -0,0 +1,122 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExportSectionsFor(t *testing.T) {
+	has := func(sections []exportSection, name string) bool {
+		for _, section := range sections {
+			if section.Name == name {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, role := range []string{RoleEditor, RoleViewer} {
+		sections := exportSectionsFor(role)
+		if has(sections, "webhooks") || has(sections, "webhookDeliveries") {
+			t.Errorf("%s: webhooks are exported", role)
+		}
+		if !has(sections, "expenses") {
+			t.Errorf("%s: expenses are not exported", role)
+		}
+	}
+	if sections := exportSectionsFor(RoleOwner); len(sections) != len(exportSections) {
+		t.Errorf("owner: got %d sections, want %d", len(sections), len(exportSections))
+	}
+}
+
+func TestWebhookExportAndRestore(t *testing.T) {
+	section, _ := findExportSection("webhooks")
+	exported := section.Export(Webhook{WebhookId: "w1", URL: "https://example.com/hook", Secret: "whsec_old"}).(Webhook)
+	if exported.Secret != "" {
+		t.Errorf("exported secret %q", exported.Secret)
+	}
+
+	restored := section.Restore(exported).(Webhook)
+	if !strings.HasPrefix(restored.Secret, "whsec_") || restored.Secret == "whsec_old" {
+		t.Errorf("restored secret %q", restored.Secret)
+	}
+
+	deliveries, _ := findExportSection("webhookDeliveries")
+	tests := []struct {
+		status string
+		want   string
+	}{
+		{DeliveryPending, DeliveryFailed},
+		{DeliverySucceeded, DeliverySucceeded},
+		{DeliveryFailed, DeliveryFailed},
+	}
+	for _, test := range tests {
+		delivery := deliveries.Restore(WebhookDelivery{Status: test.status, NextAttemptAt: "2024-03-06T15:00:00Z"}).(WebhookDelivery)
+		if delivery.Status != test.want {
+			t.Errorf("%s: got %s, want %s", test.status, delivery.Status, test.want)
+		}
+		if delivery.Status == DeliveryFailed && test.status == DeliveryPending && delivery.NextAttemptAt != "" {
+			t.Errorf("%s: still due at %s", test.status, delivery.NextAttemptAt)
+		}
+	}
+}
+
+func TestEmailSubscriptionExportAndRestore(t *testing.T) {
+	section, _ := findExportSection("emailSubscriptions")
+	subscription := EmailSubscription{
+		SubscriberId:     "member-1",
+		Email:            "member@example.com",
+		UnsubscribeToken: "unsubscribe-secret",
+		PendingEmail:     "new@example.com",
+		ConfirmToken:     "confirm-secret",
+	}
+	exported := section.Export(subscription).(EmailSubscription)
+	if exported.UnsubscribeToken != "" || exported.ConfirmToken != "" {
+		t.Errorf("exported tokens %q and %q", exported.UnsubscribeToken, exported.ConfirmToken)
+	}
+
+	restored := section.Restore(exported).(EmailSubscription)
+	if restored.UnsubscribeToken == "" || restored.UnsubscribeToken == subscription.UnsubscribeToken {
+		t.Errorf("restored unsubscribe token %q", restored.UnsubscribeToken)
+	}
+	if restored.ConfirmToken == "" || restored.ConfirmToken == subscription.ConfirmToken {
+		t.Errorf("restored confirm token %q", restored.ConfirmToken)
+	}
+
+	// A restored subscription with no pending address has nothing to confirm
+	exported.PendingEmail = ""
+	if restored := section.Restore(exported).(EmailSubscription); restored.ConfirmToken != "" {
+		t.Errorf("restored confirm token %q without a pending address", restored.ConfirmToken)
+	}
+}
+
+func TestCSVItem(t *testing.T) {
+	header := []string{"expenseItemName", "unknown", "expenseItemValue", "expenseTags"}
+	item, err := csvItem(reflect.TypeOf(ExpenseItem{}), header, []string{"rent", "ignored", "1200.5", ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expense := item.(ExpenseItem)
+	if expense.ExpenseItemName != "rent" || expense.ExpenseValue != 12005000 || expense.Month != "" || len(expense.ExpenseTags) != 0 {
+		t.Errorf("got %+v", expense)
+	}
+
+	// A short row leaves the missing cells at zero
+	if item, err := csvItem(reflect.TypeOf(ExpenseItem{}), header, []string{"rent"}); err != nil || item.(ExpenseItem).ExpenseValue != 0 {
+		t.Errorf("got %+v, %v", item, err)
+	}
+
+	invalid := [][]string{
+		{"rent", "", "12,00", ""},
+		{"rent", "", "0x10", ""},
+	}
+	for _, row := range invalid {
+		if _, err := csvItem(reflect.TypeOf(ExpenseItem{}), header, row); err == nil {
+			t.Errorf("%v: expected an error", row)
+		}
+	}
+	if _, err := csvItem(reflect.TypeOf(Scenario{}), []string{"lines"}, []string{"[{"}); err == nil {
+		t.Error("expected an error for invalid JSON")
+	}
+}
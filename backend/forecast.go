@@ -0,0 +1,240 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Kinds and frequencies of recurring item.
+const (
+	RecurringIncome  = "income"
+	RecurringExpense = "expense"
+
+	FrequencyMonthly   = "monthly"
+	FrequencyQuarterly = "quarterly"
+	FrequencyYearly    = "yearly"
+)
+
+var frequencyMonths = map[string]int{
+	FrequencyMonthly:   1,
+	FrequencyQuarterly: 3,
+	FrequencyYearly:    12,
+}
+
+// forecastBandZ is the number of standard deviations either side of the
+// expected amount that the confidence bands cover, about 80% of outcomes.
+const forecastBandZ = 1.28
+
+// ValidateRecurringItem checks a recurring item's fields and normalizes its
+// currency code.
+func ValidateRecurringItem(item *RecurringItem) error {
+	item.Name = strings.TrimSpace(item.Name)
+	if item.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if item.Kind != RecurringIncome && item.Kind != RecurringExpense {
+		return fmt.Errorf("invalid kind %q, expected income or expense", item.Kind)
+	}
+	if item.Frequency == "" {
+		item.Frequency = FrequencyMonthly
+	}
+	if _, ok := frequencyMonths[item.Frequency]; !ok {
+		return fmt.Errorf("invalid frequency %q, expected monthly, quarterly or yearly", item.Frequency)
+	}
+	if item.Currency != "" {
+		currency, err := normalizeCurrency(item.Currency)
+		if err != nil {
+			return err
+		}
+		item.Currency = currency
+	}
+	item.Amount = item.Amount.Round(item.Currency)
+	if item.Amount <= 0 {
+		return fmt.Errorf("amount must be positive")
+	}
+	if item.StartDate == "" {
+		item.StartDate = time.Now().UTC().Format("2006-01-02")
+	}
+	if _, err := time.Parse("2006-01-02", item.StartDate); err != nil {
+		return fmt.Errorf("invalid startDate, expected YYYY-MM-DD")
+	}
+	if item.EndDate != "" {
+		if _, err := time.Parse("2006-01-02", item.EndDate); err != nil {
+			return fmt.Errorf("invalid endDate, expected YYYY-MM-DD")
+		}
+		if item.EndDate < item.StartDate {
+			return fmt.Errorf("endDate is before startDate")
+		}
+	}
+	return nil
+}
+
+// recurringDue reports whether a recurring item falls in a month: from the
+// month it starts, every one, three or twelve months, until it ends.
+func recurringDue(item RecurringItem, month string) bool {
+	start := item.StartDate[:7]
+	if month < start || (item.EndDate != "" && month > item.EndDate[:7]) {
+		return false
+	}
+	from, _ := parseMonth(start)
+	to, _ := parseMonth(month)
+	elapsed := (to.Year()-from.Year())*12 + int(to.Month()) - int(from.Month())
+	return elapsed%frequencyMonths[item.Frequency] == 0
+}
+
+// recurringMatcher recognizes past items that are occurrences of the known
+// recurring items, so they are not counted twice.
+type recurringMatcher map[string]bool
+
+func newRecurringMatcher(items []RecurringItem) recurringMatcher {
+	matcher := make(recurringMatcher)
+	for _, item := range items {
+		if key := merchantKey(item.Name); key != "" {
+			matcher[item.Kind+":"+key] = true
+		}
+	}
+	return matcher
+}
+
+func (m recurringMatcher) matches(kind string, names ...string) bool {
+	for _, name := range names {
+		if key := merchantKey(name); key != "" && m[kind+":"+key] {
+			return true
+		}
+	}
+	return false
+}
+
+// forecastStats is the mean and standard deviation of a monthly series.
+type forecastStats struct {
+	mean   float64
+	stddev float64
+}
+
+func newForecastStats(values []float64) forecastStats {
+	baseline := newAnomalyBaseline(values)
+	return forecastStats{mean: baseline.mean, stddev: baseline.stddev}
+}
+
+// ForecastCashFlow projects the months after the current one from the
+// completed months in history, which must be currency reports built from
+// items that are not occurrences of a recurring item. Each category, and
+// income, is expected to continue at its monthly average, with the known
+// recurring items added in the months they fall due. The bands come from the
+// month-to-month variation in the history, and widen over time for the
+// ending balance. openingMissing lists the rates the opening balance could
+// not be converted at.
+func ForecastCashFlow(history []CurrencyReport, recurring []RecurringItem, openingBalance Money, openingMissing []string, base string, rates *RateTable, months int, now time.Time) CashFlowForecast {
+	forecast := CashFlowForecast{
+		BaseCurrency:    base,
+		HistoryMonths:   len(history),
+		OpeningBalance:  openingBalance,
+		Months:          []ForecastMonth{},
+		ShortfallMonths: []string{},
+		MissingRates:    []string{},
+	}
+	missing := make(map[string]bool)
+	addMissing := func(rates []string) {
+		for _, rate := range rates {
+			if !missing[rate] {
+				missing[rate] = true
+				forecast.MissingRates = append(forecast.MissingRates, rate)
+			}
+		}
+	}
+	addMissing(openingMissing)
+
+	var incomes, spendings, nets []float64
+	categoryValues := make(map[string][]float64)
+	for _, report := range history {
+		for category := range report.ExpensesByCategory {
+			categoryValues[category] = nil
+		}
+	}
+	for _, report := range history {
+		incomes = append(incomes, report.Income.Float64())
+		spendings = append(spendings, report.Expenses.Float64())
+		nets = append(nets, report.Net.Float64())
+		for category := range categoryValues {
+			categoryValues[category] = append(categoryValues[category], report.ExpensesByCategory[category].Float64())
+		}
+		addMissing(report.MissingRates)
+	}
+	income := newForecastStats(incomes)
+	spending := newForecastStats(spendings)
+	net := newForecastStats(nets)
+	categories := make(map[string]forecastStats)
+	for category, values := range categoryValues {
+		categories[category] = newForecastStats(values)
+	}
+
+	money := func(value float64) Money {
+		return MoneyFromFloat(value).Round(base)
+	}
+	band := func(expected float64, stddev float64, floor bool) ForecastRange {
+		low := expected - forecastBandZ*stddev
+		if floor && low < 0 {
+			low = 0
+		}
+		return ForecastRange{Expected: money(expected), Low: money(low), High: money(expected + forecastBandZ*stddev)}
+	}
+
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	balance := openingBalance.Float64()
+	for i := 1; i <= months; i++ {
+		month := monthStart.AddDate(0, i, 0).Format(monthLayout)
+		point := ForecastMonth{Month: month, SpendingByCategory: make(map[string]Money), Recurring: []string{}}
+
+		for category, stats := range categories {
+			if stats.mean != 0 {
+				point.SpendingByCategory[category] = money(stats.mean)
+			}
+		}
+		recurringIncome, recurringSpending := 0.0, 0.0
+		for _, item := range recurring {
+			if !recurringDue(item, month) {
+				continue
+			}
+			currency := item.Currency
+			if currency == "" {
+				currency = base
+			}
+			amount, ok := rates.Convert(item.Amount, currency, base, now)
+			if !ok {
+				addMissing([]string{fmt.Sprintf("%s/%s@%s", currency, base, now.Format("2006-01-02"))})
+				continue
+			}
+			point.Recurring = append(point.Recurring, item.Name)
+			if item.Kind == RecurringIncome {
+				recurringIncome += amount.Float64()
+				continue
+			}
+			recurringSpending += amount.Float64()
+			category := strings.ToLower(item.Category)
+			if category == "" {
+				category = "uncategorized"
+			}
+			point.SpendingByCategory[category] += amount
+		}
+		sort.Strings(point.Recurring)
+
+		expectedIncome := income.mean + recurringIncome
+		expectedSpending := spending.mean + recurringSpending
+		point.Income = band(expectedIncome, income.stddev, true)
+		point.Spending = band(expectedSpending, spending.stddev, true)
+		point.Net = point.Income.Expected - point.Spending.Expected
+		point.Shortfall = point.Spending.Expected > point.Income.Expected
+
+		balance += expectedIncome - expectedSpending
+		point.EndingBalance = band(balance, net.stddev*math.Sqrt(float64(i)), false)
+
+		if point.Shortfall {
+			forecast.ShortfallMonths = append(forecast.ShortfallMonths, month)
+		}
+		forecast.Months = append(forecast.Months, point)
+	}
+	return forecast
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestForecastCashFlowMissingRates(t *testing.T) {
+	now := time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC)
+	history := []CurrencyReport{
+		{Month: "2024-01", BaseCurrency: "USD", Income: 10000000, Expenses: 8000000, Net: 2000000, MissingRates: []string{"EUR/USD@2024-01-15"}},
+		{Month: "2024-02", BaseCurrency: "USD", Income: 10000000, Expenses: 8000000, Net: 2000000, MissingRates: []string{"EUR/USD@2024-01-15"}},
+	}
+	forecast := ForecastCashFlow(history, nil, 5000000, []string{"GBP/USD@2024-03-10", "EUR/USD@2024-01-15"}, "USD", NewRateTable(nil), 2, now)
+
+	want := []string{"GBP/USD@2024-03-10", "EUR/USD@2024-01-15"}
+	if len(forecast.MissingRates) != len(want) {
+		t.Fatalf("missing rates %v, want %v", forecast.MissingRates, want)
+	}
+	for i := range want {
+		if forecast.MissingRates[i] != want[i] {
+			t.Fatalf("missing rates %v, want %v", forecast.MissingRates, want)
+		}
+	}
+	if len(forecast.Months) != 2 || forecast.OpeningBalance != 5000000 {
+		t.Errorf("got %d months from %s, want 2 from 500", len(forecast.Months), forecast.OpeningBalance)
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// goalRateMonths is how many months, counting the current one, the recent
+// contribution rate of a goal is averaged over.
+const goalRateMonths = 3
+
+// Sources of a goal contribution.
+const (
+	ContributionManual  = "manual"
+	ContributionIncome  = "income"
+	ContributionExpense = "expense"
+)
+
+// ValidateGoal checks a goal's fields and normalizes its currency code.
+func ValidateGoal(goal *Goal) error {
+	goal.GoalName = strings.TrimSpace(goal.GoalName)
+	if goal.GoalName == "" {
+		return fmt.Errorf("goalName is required")
+	}
+	if goal.Currency != "" {
+		currency, err := normalizeCurrency(goal.Currency)
+		if err != nil {
+			return err
+		}
+		goal.Currency = currency
+	}
+	goal.TargetAmount = goal.TargetAmount.Round(goal.Currency)
+	goal.StartingAmount = goal.StartingAmount.Round(goal.Currency)
+	if goal.TargetAmount <= 0 {
+		return fmt.Errorf("targetAmount must be positive")
+	}
+	if _, err := time.Parse("2006-01-02", goal.TargetDate); err != nil {
+		return fmt.Errorf("invalid targetDate, expected YYYY-MM-DD")
+	}
+	return nil
+}
+
+// ValidateGoalContribution checks a contribution's fields. Contributions
+// linked to an income or expense item need the item's month and name.
+func ValidateGoalContribution(contribution *GoalContribution) error {
+	switch contribution.Source {
+	case "":
+		contribution.Source = ContributionManual
+	case ContributionManual:
+	case ContributionIncome, ContributionExpense:
+		if contribution.Month == "" || contribution.ItemName == "" {
+			return fmt.Errorf("contributions from %s items need the item's month and itemName", contribution.Source)
+		}
+		if _, err := parseMonth(contribution.Month); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("invalid source %q, expected manual, income or expense", contribution.Source)
+	}
+	if contribution.Date == "" {
+		contribution.Date = time.Now().UTC().Format("2006-01-02")
+	}
+	if _, err := time.Parse("2006-01-02", contribution.Date); err != nil {
+		return fmt.Errorf("invalid date, expected YYYY-MM-DD")
+	}
+	return nil
+}
+
+// ComputeGoalProgress sums a goal's contributions and works out the monthly
+// amount still needed to reach the target on time, and when the target will
+// be reached if contributions continue at their recent rate.
+func ComputeGoalProgress(goal Goal, contributions []GoalContribution, now time.Time) GoalProgress {
+	progress := GoalProgress{Goal: goal, Saved: goal.StartingAmount}
+
+	// Month arithmetic starts from the first of the month so that adding
+	// months never spills over from a long month into the next
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	currentMonth := monthStart.Format(monthLayout)
+	rateFrom := monthStart.AddDate(0, -(goalRateMonths - 1), 0).Format(monthLayout)
+	var recent Money
+	for _, contribution := range contributions {
+		progress.Saved += contribution.Amount
+		month := contribution.Date
+		if len(month) > 7 {
+			month = month[:7]
+		}
+		if month >= rateFrom && month <= currentMonth {
+			recent += contribution.Amount
+		}
+	}
+
+	if goal.TargetAmount > progress.Saved {
+		progress.Remaining = goal.TargetAmount - progress.Saved
+	}
+	progress.PercentComplete = math.Min(100, math.Round(progress.Saved.Float64()/goal.TargetAmount.Float64()*1000)/10)
+	progress.RecentMonthlyRate = (recent / goalRateMonths).Round(goal.Currency)
+
+	// Months left counts the current month, so a goal due at the end of next
+	// month has two months of contributions left
+	target, _ := time.Parse("2006-01-02", goal.TargetDate)
+	months := (target.Year()-now.Year())*12 + int(target.Month()) - int(now.Month()) + 1
+	if months < 0 {
+		months = 0
+	}
+	progress.MonthsRemaining = months
+
+	if progress.Remaining == 0 {
+		progress.ProjectedCompletion = currentMonth
+		progress.OnTrack = true
+		return progress
+	}
+
+	if months > 0 {
+		progress.RequiredMonthly = ceilMoney(progress.Remaining, months, goal.Currency)
+	} else {
+		progress.RequiredMonthly = progress.Remaining
+	}
+
+	if progress.RecentMonthlyRate > 0 {
+		needed := int((progress.Remaining + progress.RecentMonthlyRate - 1) / progress.RecentMonthlyRate)
+		projected := monthStart.AddDate(0, needed-1, 0).Format(monthLayout)
+		progress.ProjectedCompletion = projected
+		progress.OnTrack = projected <= target.Format(monthLayout)
+	}
+	return progress
+}
+
+// ceilMoney divides an amount into n parts, rounding up to the currency's
+// minor unit so that n payments of the result cover the amount.
+func ceilMoney(amount Money, n int, currency string) Money {
+	step := Money(math.Pow10(moneyScale - currencyMinorUnits(currency)))
+	units := (amount + step - 1) / step
+	return ((units + Money(n) - 1) / Money(n)) * step
+}
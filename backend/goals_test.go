@@ -0,0 +1,122 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCeilMoney(t *testing.T) {
+	tests := []struct {
+		amount   Money
+		n        int
+		currency string
+		want     Money
+	}{
+		{10000000, 3, "USD", 3333400},
+		{90000, 3, "USD", 30000},
+		{100050, 1, "USD", 100100},
+		{100000000, 3, "JPY", 33340000},
+		{100000, 3, "jpy", 40000},
+		{1000000, 3, "KWD", 333340},
+		{1000000, 3, "", 333400},
+	}
+	for _, test := range tests {
+		got := ceilMoney(test.amount, test.n, test.currency)
+		if got != test.want {
+			t.Errorf("%s / %d %s: got %s, want %s", test.amount, test.n, test.currency, got, test.want)
+		}
+		if got.Mul(float64(test.n)) < test.amount {
+			t.Errorf("%s / %d %s: %d parts of %s do not cover the amount", test.amount, test.n, test.currency, test.n, got)
+		}
+	}
+}
+
+func TestComputeGoalProgress(t *testing.T) {
+	now := time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)
+	contribute := func(date string, amount Money) GoalContribution {
+		return GoalContribution{Date: date, Amount: amount, Source: ContributionManual}
+	}
+	// 1000.00 in each of the last three months, and 500.00 before them
+	// that does not count towards the recent rate
+	contributions := []GoalContribution{
+		contribute("2023-12-20", 5000000),
+		contribute("2024-01-10", 10000000),
+		contribute("2024-02-10", 10000000),
+		contribute("2024-03-10", 10000000),
+	}
+
+	tests := []struct {
+		name       string
+		goal       Goal
+		remaining  Money
+		months     int
+		required   Money
+		projected  string
+		onTrack    bool
+		percentage float64
+	}{
+		{
+			"reached on time",
+			Goal{TargetAmount: 125000000, TargetDate: "2024-12-31", Currency: "USD"},
+			90000000, 10, 9000000, "2024-11", true, 28,
+		},
+		{
+			"a part month of saving is still a month",
+			Goal{TargetAmount: 125000100, TargetDate: "2024-12-31", Currency: "USD"},
+			90000100, 10, 9000100, "2024-12", true, 28,
+		},
+		{
+			"reached late",
+			Goal{TargetAmount: 135000100, TargetDate: "2024-12-31", Currency: "USD"},
+			100000100, 10, 10000100, "2025-01", false, 25.9,
+		},
+		{
+			"due this month",
+			Goal{TargetAmount: 125000000, TargetDate: "2024-03-31", Currency: "USD"},
+			90000000, 1, 90000000, "2024-11", false, 28,
+		},
+		{
+			"target date has passed",
+			Goal{TargetAmount: 125000000, TargetDate: "2024-01-31", Currency: "USD"},
+			90000000, 0, 90000000, "2024-11", false, 28,
+		},
+		{
+			"starting amount counts as saved",
+			Goal{TargetAmount: 125000000, StartingAmount: 20000000, TargetDate: "2024-12-31", Currency: "USD"},
+			70000000, 10, 7000000, "2024-09", true, 44,
+		},
+		{
+			"required amount rounds up to whole yen",
+			Goal{TargetAmount: 1000000000, TargetDate: "2024-05-31", Currency: "JPY"},
+			965000000, 3, 321670000, "2032-03", false, 3.5,
+		},
+		{
+			"already reached",
+			Goal{TargetAmount: 30000000, TargetDate: "2024-01-31", Currency: "USD"},
+			0, 0, 0, "2024-03", true, 100,
+		},
+	}
+	for _, test := range tests {
+		progress := ComputeGoalProgress(test.goal, contributions, now)
+		if progress.Remaining != test.remaining || progress.MonthsRemaining != test.months || progress.RequiredMonthly != test.required {
+			t.Errorf("%s: got remaining %s over %d months at %s, want %s over %d months at %s", test.name,
+				progress.Remaining, progress.MonthsRemaining, progress.RequiredMonthly, test.remaining, test.months, test.required)
+		}
+		if progress.ProjectedCompletion != test.projected || progress.OnTrack != test.onTrack {
+			t.Errorf("%s: got projected %s on track %v, want %s %v", test.name,
+				progress.ProjectedCompletion, progress.OnTrack, test.projected, test.onTrack)
+		}
+		if progress.PercentComplete != test.percentage {
+			t.Errorf("%s: got %v%%, want %v%%", test.name, progress.PercentComplete, test.percentage)
+		}
+		if progress.RecentMonthlyRate != 10000000 {
+			t.Errorf("%s: got a recent rate of %s, want 1000", test.name, progress.RecentMonthlyRate)
+		}
+	}
+
+	// Without recent contributions there is nothing to project from
+	progress := ComputeGoalProgress(Goal{TargetAmount: 125000000, TargetDate: "2024-12-31"}, contributions[:1], now)
+	if progress.RecentMonthlyRate != 0 || progress.ProjectedCompletion != "" || progress.OnTrack {
+		t.Errorf("got rate %s, projected %q, on track %v", progress.RecentMonthlyRate, progress.ProjectedCompletion, progress.OnTrack)
+	}
+}
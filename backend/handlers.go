@@ -1,11 +1,20 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"net/mail"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 )
 
@@ -78,14 +87,26 @@ func AddIncomeHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// TODO: Get the userId from the authenticated user's session
-	// For now, we'll use the userId passed in the request
-
 	// Validate the input
 	if incomeItem.UserId == "" || incomeItem.IncomeItemName == "" || incomeItem.Month == "" {
 		http.Error(w, "Missing required fields", http.StatusBadRequest)
 		return
 	}
+	if incomeItem.Currency != "" {
+		if incomeItem.Currency, err = normalizeCurrency(incomeItem.Currency); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	incomeItem.IncomeItemValue = incomeItem.IncomeItemValue.Round(incomeItem.Currency)
+
+	// Check the caller can change the workspace
+	if !requireRole(w, r, incomeItem.UserId, RoleEditor) {
+		return
+	}
+	if !requireAccount(w, incomeItem.UserId, incomeItem.AccountId, incomeItem.Currency) {
+		return
+	}
 
 	// Add the income item to the database
 	err = AddIncome(incomeItem)
@@ -96,6 +117,10 @@ func AddIncomeHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	log.Printf("Added income")
+
+	// Publish the change
+	PublishEvent(incomeItem.UserId, EventIncomeCreated, incomeItem.Month, incomeItem)
+
 	// Return success response
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(map[string]string{
@@ -108,15 +133,17 @@ func GetAllIncomeHandler(w http.ResponseWriter, r *http.Request) {
 	userId := r.URL.Query().Get("userId")
 	monthStr := r.URL.Query().Get("month")
 
-	// TODO: In a real application, get the userId from the authenticated user's session
-	// instead of from query parameters
-
 	// Validate the input
 	if userId == "" || monthStr == "" {
 		http.Error(w, "Missing required query parameters: userId and month", http.StatusBadRequest)
 		return
 	}
 
+	// Check the caller can read the workspace
+	if !requireRole(w, r, userId, RoleViewer) {
+		return
+	}
+
 	// Get the income items from the database
 	incomeItems, err := GetAllIncome(userId, monthStr)
 	if err != nil {
@@ -136,18 +163,20 @@ func UpdateIncomeHandler(w http.ResponseWriter, r *http.Request) {
 	monthStr := vars["month"]
 	incomeItemName := vars["incomeItemName"]
 
-	// TODO:get the userId from the authenticated user's session
-	// instead of from URL parameters
-
 	// Validate the input
 	if userId == "" || monthStr == "" || incomeItemName == "" {
 		http.Error(w, "Missing required parameters: userId, month, and incomeItemName", http.StatusBadRequest)
 		return
 	}
 
+	// Check the caller can change the workspace
+	if !requireRole(w, r, userId, RoleEditor) {
+		return
+	}
+
 	// Parse the request body to get the new value
 	var updateRequest struct {
-		NewValue float64 `json:"newValue"`
+		NewValue Money `json:"newValue"`
 	}
 	err := json.NewDecoder(r.Body).Decode(&updateRequest)
 	if err != nil {
@@ -155,6 +184,14 @@ func UpdateIncomeHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Round the new value to the minor unit of the item's currency
+	currency, err := GetItemCurrency("Income", userId, monthStr, "incomeItemName", incomeItemName)
+	if err != nil {
+		http.Error(w, "Failed to get income item: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	updateRequest.NewValue = updateRequest.NewValue.Round(currency)
+
 	// Update the income item in the database
 	err = UpdateIncome(userId, monthStr, incomeItemName, updateRequest.NewValue)
 	if err != nil {
@@ -162,6 +199,14 @@ func UpdateIncomeHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Publish the change
+	PublishEvent(userId, EventIncomeUpdated, monthStr, map[string]interface{}{
+		"userId":          userId,
+		"month":           monthStr,
+		"incomeItemName":  incomeItemName,
+		"incomeItemValue": updateRequest.NewValue,
+	})
+
 	// Return success response
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{
@@ -176,15 +221,17 @@ func DeleteIncomeHandler(w http.ResponseWriter, r *http.Request) {
 	monthStr := vars["month"]
 	incomeItemName := vars["incomeItemName"]
 
-	// TODO: get the userId from the authenticated user's session
-	// instead of from URL parameters
-
 	// Validate the input
 	if userId == "" || monthStr == "" || incomeItemName == "" {
 		http.Error(w, "Missing required parameters: userId, month, and incomeItemName", http.StatusBadRequest)
 		return
 	}
 
+	// Check the caller can change the workspace
+	if !requireRole(w, r, userId, RoleEditor) {
+		return
+	}
+
 	// Delete the income item from the database
 	err := DeleteIncome(userId, monthStr, incomeItemName)
 	if err != nil {
@@ -192,6 +239,13 @@ func DeleteIncomeHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Publish the change
+	PublishEvent(userId, EventIncomeDeleted, monthStr, map[string]interface{}{
+		"userId":         userId,
+		"month":          monthStr,
+		"incomeItemName": incomeItemName,
+	})
+
 	// Return success response
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{
@@ -209,14 +263,26 @@ func AddBudgetHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// TODO: Get the userId from the authenticated user's session
-	// For now, we'll use the userId passed in the request
-
 	// Validate the input
 	if budgetItem.UserID == "" || budgetItem.BudgetItemName == "" || budgetItem.Month == "" {
 		http.Error(w, "Missing required fields", http.StatusBadRequest)
 		return
 	}
+	if budgetItem.Currency != "" {
+		if budgetItem.Currency, err = normalizeCurrency(budgetItem.Currency); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	budgetItem.BudgetItemValue = budgetItem.BudgetItemValue.Round(budgetItem.Currency)
+
+	// Check the caller can change the workspace
+	if !requireRole(w, r, budgetItem.UserID, RoleEditor) {
+		return
+	}
+
+	// Note which budget items are already over budget
+	watch := WatchBudgets(budgetItem.UserID, budgetItem.Month)
 
 	// Add the budget item to the database
 	err = AddBudget(budgetItem)
@@ -225,6 +291,13 @@ func AddBudgetHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Check the alert rules against the changed month
+	NotifyAlerts(budgetItem.UserID, budgetItem.Month)
+
+	// Publish the change, and any budget items it put over budget
+	PublishEvent(budgetItem.UserID, EventBudgetCreated, budgetItem.Month, budgetItem)
+	watch.PublishExceeded()
+
 	// Return success response
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(map[string]string{
@@ -237,15 +310,17 @@ func GetAllBudgetHandler(w http.ResponseWriter, r *http.Request) {
 	userId := r.URL.Query().Get("userId")
 	monthStr := r.URL.Query().Get("month")
 
-	// TODO: get the userId from the authenticated user's session
-	// instead of from query parameters
-
 	// Validate the input
 	if userId == "" || monthStr == "" {
 		http.Error(w, "Missing required query parameters: userId and month", http.StatusBadRequest)
 		return
 	}
 
+	// Check the caller can read the workspace
+	if !requireRole(w, r, userId, RoleViewer) {
+		return
+	}
+
 	// Get the budget items from the database
 	budgetItems, err := GetAllBudget(userId, monthStr)
 	if err != nil {
@@ -265,18 +340,20 @@ func UpdateBudgetHandler(w http.ResponseWriter, r *http.Request) {
 	monthStr := vars["month"]
 	budgetItemName := vars["budgetItemName"]
 
-	// TODO:get the userId from the authenticated user's session
-	// instead of from URL parameters
-
 	// Validate the input
 	if userId == "" || monthStr == "" || budgetItemName == "" {
 		http.Error(w, "Missing required parameters: userId, month, and budgetItemName", http.StatusBadRequest)
 		return
 	}
 
+	// Check the caller can change the workspace
+	if !requireRole(w, r, userId, RoleEditor) {
+		return
+	}
+
 	// Parse the request body to get the new value
 	var updateRequest struct {
-		NewValue float64 `json:"newValue"`
+		NewValue Money `json:"newValue"`
 	}
 	err := json.NewDecoder(r.Body).Decode(&updateRequest)
 	if err != nil {
@@ -284,6 +361,17 @@ func UpdateBudgetHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Round the new value to the minor unit of the item's currency
+	currency, err := GetItemCurrency("Budget", userId, monthStr, "budgetItemName", budgetItemName)
+	if err != nil {
+		http.Error(w, "Failed to get budget item: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	updateRequest.NewValue = updateRequest.NewValue.Round(currency)
+
+	// Note which budget items are already over budget
+	watch := WatchBudgets(userId, monthStr)
+
 	// Update the budget item in the database
 	err = UpdateBudget(userId, monthStr, budgetItemName, updateRequest.NewValue)
 	if err != nil {
@@ -291,6 +379,18 @@ func UpdateBudgetHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Check the alert rules against the changed month
+	NotifyAlerts(userId, monthStr)
+
+	// Publish the change, and any budget items it put over budget
+	PublishEvent(userId, EventBudgetUpdated, monthStr, map[string]interface{}{
+		"userId":          userId,
+		"month":           monthStr,
+		"budgetItemName":  budgetItemName,
+		"budgetItemValue": updateRequest.NewValue,
+	})
+	watch.PublishExceeded()
+
 	// Return success response
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{
@@ -305,15 +405,17 @@ func DeleteBudgetHandler(w http.ResponseWriter, r *http.Request) {
 	monthStr := vars["month"]
 	budgetItemName := vars["budgetItemName"]
 
-	// TODO:get the userId from the authenticated user's session
-	// instead of from URL parameters
-
 	// Validate the input
 	if userId == "" || monthStr == "" || budgetItemName == "" {
 		http.Error(w, "Missing required parameters: userId, month, and budgetItemName", http.StatusBadRequest)
 		return
 	}
 
+	// Check the caller can change the workspace
+	if !requireRole(w, r, userId, RoleEditor) {
+		return
+	}
+
 	// Delete the budget item from the database
 	err := DeleteBudget(userId, monthStr, budgetItemName)
 	if err != nil {
@@ -321,6 +423,13 @@ func DeleteBudgetHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Publish the change
+	PublishEvent(userId, EventBudgetDeleted, monthStr, map[string]interface{}{
+		"userId":         userId,
+		"month":          monthStr,
+		"budgetItemName": budgetItemName,
+	})
+
 	// Return success response
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{
@@ -347,15 +456,68 @@ func AddExpensesHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// TODO: Get the userId from the authenticated user's session
-	// For now, we'll use the userId passed in the first expense item
-
 	// Validate the input
-	for _, item := range requestBody.Expenses {
+	for i, item := range requestBody.Expenses {
 		if item.UserId == "" || item.ExpenseItemName == "" || item.Month == "" {
 			http.Error(w, "Missing required fields in one or more expense items", http.StatusBadRequest)
 			return
 		}
+		if item.Currency != "" {
+			if requestBody.Expenses[i].Currency, err = normalizeCurrency(item.Currency); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		requestBody.Expenses[i].ExpenseValue = item.ExpenseValue.Round(requestBody.Expenses[i].Currency)
+		if err := ValidateSplits(&requestBody.Expenses[i]); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid expense item %s: %v", item.ExpenseItemName, err), http.StatusBadRequest)
+			return
+		}
+		if err := ComputeShares(&requestBody.Expenses[i]); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid expense item %s: %v", item.ExpenseItemName, err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Check the caller can change every workspace the items belong to
+	checked := make(map[string]bool)
+	for _, item := range requestBody.Expenses {
+		if checked[item.UserId] {
+			continue
+		}
+		if !requireRole(w, r, item.UserId, RoleEditor) {
+			return
+		}
+		checked[item.UserId] = true
+	}
+
+	// Items booked against an account must name one of its accounts
+	for _, item := range requestBody.Expenses {
+		if !requireAccount(w, item.UserId, item.AccountId, item.Currency) {
+			return
+		}
+	}
+
+	// Flag items that look like expenses already recorded
+	duplicates, err := FlagDuplicateExpenses(requestBody.Expenses)
+	if err != nil {
+		http.Error(w, "Failed to check for duplicate expenses: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Flag items that are unusual compared with past expenses
+	anomalies, err := FlagAnomalousExpenses(requestBody.Expenses)
+	if err != nil {
+		http.Error(w, "Failed to check for unusual expenses: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Note which budget items are already over budget in each month
+	watches := make(map[string]*BudgetWatch)
+	for _, item := range requestBody.Expenses {
+		if watches[item.UserId+"#"+item.Month] == nil {
+			watches[item.UserId+"#"+item.Month] = WatchBudgets(item.UserId, item.Month)
+		}
 	}
 
 	// Add the expense items to the database
@@ -365,10 +527,30 @@ func AddExpensesHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Return success response
+	// Check the alert rules of every month the items were added to
+	evaluated := make(map[string]bool)
+	for _, item := range requestBody.Expenses {
+		if !evaluated[item.UserId+"#"+item.Month] {
+			evaluated[item.UserId+"#"+item.Month] = true
+			NotifyAlerts(item.UserId, item.Month)
+		}
+	}
+
+	// Publish the changes, and any budget items they put over budget
+	for _, item := range requestBody.Expenses {
+		PublishEvent(item.UserId, EventExpenseCreated, item.Month, item)
+	}
+	for _, watch := range watches {
+		watch.PublishExceeded()
+	}
+
+	// Return success response, with any likely duplicates and unusual
+	// expenses for review
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]string{
-		"message": fmt.Sprintf("%d expense(s) added successfully", len(requestBody.Expenses)),
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":    fmt.Sprintf("%d expense(s) added successfully", len(requestBody.Expenses)),
+		"duplicates": duplicates,
+		"anomalies":  anomalies,
 	})
 }
 
@@ -377,15 +559,17 @@ func GetAllExpenseHandler(w http.ResponseWriter, r *http.Request) {
 	userId := r.URL.Query().Get("userId")
 	monthStr := r.URL.Query().Get("month")
 
-	// TODO: get the userId from the authenticated user's session
-	// instead of from query parameters
-
 	// Validate the input
 	if userId == "" || monthStr == "" {
 		http.Error(w, "Missing required query parameters: userId and month", http.StatusBadRequest)
 		return
 	}
 
+	// Check the caller can read the workspace
+	if !requireRole(w, r, userId, RoleViewer) {
+		return
+	}
+
 	// Get the expense items from the database
 	expenseItems, err := GetAllExpenses(userId, monthStr)
 	if err != nil {
@@ -405,19 +589,23 @@ func UpdateExpenseHandler(w http.ResponseWriter, r *http.Request) {
 	monthStr := vars["month"]
 	expenseItemName := vars["expenseItemName"]
 
-	// TODO: get the userId from the authenticated user's session
-	// instead of from URL parameters
-
 	// Validate the input
 	if userId == "" || monthStr == "" || expenseItemName == "" {
 		http.Error(w, "Missing required parameters: userId, month, and expenseItemName", http.StatusBadRequest)
 		return
 	}
 
+	// Check the caller can change the workspace
+	if !requireRole(w, r, userId, RoleEditor) {
+		return
+	}
+
 	// Parse the request body to get the new values
 	var updateRequest struct {
-		NewValue float64  `json:"newValue"`
-		NewTags  []string `json:"newTags"`
+		NewValue   Money           `json:"newValue"`
+		NewTags    []string        `json:"newTags"`
+		NewSplits  []ExpenseSplit  `json:"newSplits"`
+		NewSharing *ExpenseSharing `json:"newSharing"`
 	}
 	err := json.NewDecoder(r.Body).Decode(&updateRequest)
 	if err != nil {
@@ -425,13 +613,54 @@ func UpdateExpenseHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Round the new value to the minor unit of the item's currency and check
+	// the split lines and sharing, keeping the current ones unless new ones
+	// are given
+	existing, err := GetExpense(userId, monthStr, expenseItemName)
+	if err != nil {
+		http.Error(w, "Failed to get expense item: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if existing == nil {
+		http.Error(w, "Expense item not found", http.StatusNotFound)
+		return
+	}
+	updated := ExpenseItem{ExpenseValue: updateRequest.NewValue, Splits: updateRequest.NewSplits, Sharing: updateRequest.NewSharing}
+	updated.Currency = existing.Currency
+	if updated.Splits == nil {
+		updated.Splits = existing.Splits
+	}
+	if updated.Sharing == nil {
+		updated.Sharing = existing.Sharing
+	}
+	updated.ExpenseValue = updated.ExpenseValue.Round(updated.Currency)
+	if err := ValidateSplits(&updated); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := ComputeShares(&updated); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Note which budget items are already over budget
+	watch := WatchBudgets(userId, monthStr)
+
 	// Update the expense item in the database
-	err = UpdateExpense(userId, monthStr, expenseItemName, updateRequest.NewValue, updateRequest.NewTags)
+	err = UpdateExpense(userId, monthStr, expenseItemName, updated.ExpenseValue, updateRequest.NewTags, updated.Splits, updated.Sharing)
 	if err != nil {
 		http.Error(w, "Failed to update expense item: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	// Check the alert rules against the changed month
+	NotifyAlerts(userId, monthStr)
+
+	// Publish the change, and any budget items it put over budget
+	updated.UserId, updated.Month, updated.ExpenseItemName, updated.ExpenseTags = userId, monthStr, expenseItemName, updateRequest.NewTags
+	PublishEvent(userId, EventExpenseUpdated, monthStr, updated)
+	watch.PublishExceeded()
+
 	// Return success response
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{
@@ -446,15 +675,17 @@ func DeleteExpenseHandler(w http.ResponseWriter, r *http.Request) {
 	monthStr := vars["month"]
 	expenseItemName := vars["expenseItemName"]
 
-	// TODO: get the userId from the authenticated user's session
-	// instead of from URL parameters
-
 	// Validate the input
 	if userId == "" || monthStr == "" || expenseItemName == "" {
 		http.Error(w, "Missing required parameters: userId, month, and expenseItemName", http.StatusBadRequest)
 		return
 	}
 
+	// Check the caller can change the workspace
+	if !requireRole(w, r, userId, RoleEditor) {
+		return
+	}
+
 	// Delete the expense item from the database
 	err := DeleteExpense(userId, monthStr, expenseItemName)
 	if err != nil {
@@ -462,9 +693,4824 @@ func DeleteExpenseHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Publish the change
+	PublishEvent(userId, EventExpenseDeleted, monthStr, map[string]interface{}{
+		"userId":          userId,
+		"month":           monthStr,
+		"expenseItemName": expenseItemName,
+	})
+
 	// Return success response
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{
 		"message": "Expense item deleted successfully",
 	})
 }
+
+func GetDuplicateExpensesHandler(w http.ResponseWriter, r *http.Request) {
+	// Get userId and month from query parameters
+	userId := r.URL.Query().Get("userId")
+	monthStr := r.URL.Query().Get("month")
+
+	// Validate the input
+	if userId == "" || monthStr == "" {
+		http.Error(w, "Missing required query parameters: userId and month", http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can read the workspace
+	if !requireRole(w, r, userId, RoleViewer) {
+		return
+	}
+
+	// Get the expense items from the database
+	expenseItems, err := GetAllExpenses(userId, monthStr)
+	if err != nil {
+		http.Error(w, "Failed to get expense items: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Keep only the items flagged as likely duplicates
+	flagged := []ExpenseItem{}
+	for _, item := range expenseItems {
+		if item.DuplicateOf != "" {
+			flagged = append(flagged, item)
+		}
+	}
+
+	// Return the flagged expense items
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(flagged)
+}
+
+func GetExpenseAnomaliesHandler(w http.ResponseWriter, r *http.Request) {
+	// Get userId and month from query parameters
+	userId := r.URL.Query().Get("userId")
+	monthStr := r.URL.Query().Get("month")
+
+	// Validate the input
+	if userId == "" || monthStr == "" {
+		http.Error(w, "Missing required query parameters: userId and month", http.StatusBadRequest)
+		return
+	}
+	if _, err := parseMonth(monthStr); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can read the workspace
+	if !requireRole(w, r, userId, RoleViewer) {
+		return
+	}
+
+	// Compare the month's expenses with the months before it
+	anomalies, err := FindMonthAnomalies(userId, monthStr)
+	if err != nil {
+		http.Error(w, "Failed to find unusual expenses: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the anomalies with their explanations
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(anomalies)
+}
+
+func GetSubscriptionsHandler(w http.ResponseWriter, r *http.Request) {
+	// Get userId and the number of months to analyze from query parameters
+	userId := r.URL.Query().Get("userId")
+	months := subscriptionHistoryMonths
+
+	// Validate the input
+	if userId == "" {
+		http.Error(w, "Missing required query parameter: userId", http.StatusBadRequest)
+		return
+	}
+	if value := r.URL.Query().Get("months"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxMonthRange {
+			http.Error(w, fmt.Sprintf("Invalid months, expected a number from 1 to %d", maxMonthRange), http.StatusBadRequest)
+			return
+		}
+		months = parsed
+	}
+
+	// Check the caller can read the workspace
+	if !requireRole(w, r, userId, RoleViewer) {
+		return
+	}
+
+	// Get the expenses of the months analyzed, up to the current one
+	now := time.Now().UTC()
+	toMonth := now.Format(monthLayout)
+	fromMonth, _ := addMonths(toMonth, -(months - 1))
+	monthList, err := monthsBetween(fromMonth, toMonth)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var expenses []ExpenseItem
+	for _, month := range monthList {
+		items, err := GetAllExpenses(userId, month)
+		if err != nil {
+			http.Error(w, "Failed to get expense items: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		expenses = append(expenses, items...)
+	}
+	recurring, err := GetAllRecurringItems(userId)
+	if err != nil {
+		http.Error(w, "Failed to get recurring items: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the detected subscriptions
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(DetectSubscriptions(expenses, recurring, now))
+}
+
+func MergeExpenseHandler(w http.ResponseWriter, r *http.Request) {
+	// Get userId, month, and the name of the expense to keep from URL parameters
+	vars := mux.Vars(r)
+	userId := vars["userId"]
+	monthStr := vars["month"]
+	expenseItemName := vars["expenseItemName"]
+
+	// Parse the request body to get the duplicate to merge in. The duplicate
+	// may be in a neighbouring month when the dates straddle the boundary
+	var mergeRequest struct {
+		DuplicateItemName string `json:"duplicateItemName"`
+		DuplicateMonth    string `json:"duplicateMonth"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&mergeRequest)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Validate the input
+	if userId == "" || monthStr == "" || expenseItemName == "" || mergeRequest.DuplicateItemName == "" {
+		http.Error(w, "Missing required parameters: userId, month, expenseItemName, and duplicateItemName", http.StatusBadRequest)
+		return
+	}
+	if mergeRequest.DuplicateMonth == "" {
+		mergeRequest.DuplicateMonth = monthStr
+	}
+	if mergeRequest.DuplicateItemName == expenseItemName && mergeRequest.DuplicateMonth == monthStr {
+		http.Error(w, "Cannot merge an expense item into itself", http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can change the workspace
+	if !requireRole(w, r, userId, RoleEditor) {
+		return
+	}
+
+	// Load both expense items
+	kept, err := GetExpense(userId, monthStr, expenseItemName)
+	if err != nil {
+		http.Error(w, "Failed to get expense item: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	duplicate, err := GetExpense(userId, mergeRequest.DuplicateMonth, mergeRequest.DuplicateItemName)
+	if err != nil {
+		http.Error(w, "Failed to get expense item: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if kept == nil || duplicate == nil {
+		http.Error(w, "Expense item not found", http.StatusNotFound)
+		return
+	}
+
+	// Note which budget items are already over budget in the kept item's
+	// month
+	watch := WatchBudgets(userId, monthStr)
+
+	// Save the merged item before removing the duplicate, so a failure
+	// part way through never loses data
+	merged := MergeExpenses(*kept, *duplicate)
+
+	// Score the merged item again, as it may have gained the duplicate's
+	// merchant and tags
+	scored := []ExpenseItem{merged}
+	if _, err := FlagAnomalousExpenses(scored); err != nil {
+		http.Error(w, "Failed to check for unusual expenses: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	merged = scored[0]
+
+	err = AddExpenses([]ExpenseItem{merged})
+	if err != nil {
+		http.Error(w, "Failed to merge expense items: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	err = DeleteExpense(userId, mergeRequest.DuplicateMonth, duplicate.ExpenseItemName)
+	if err != nil {
+		http.Error(w, "Failed to delete duplicate expense item: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Items flagged as duplicates of the deleted item are flagged against
+	// the kept one instead. Flags only reach the neighbouring months
+	var nearby []ExpenseItem
+	for _, offset := range []int{-1, 0, 1} {
+		month, err := addMonths(mergeRequest.DuplicateMonth, offset)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		items, err := GetAllExpenses(userId, month)
+		if err != nil {
+			http.Error(w, "Failed to get expense items: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		nearby = append(nearby, items...)
+	}
+	for _, item := range repointDuplicates(nearby, merged, *duplicate) {
+		if _, err := RepointExpenseDuplicate(item, duplicate.ExpenseItemName); err != nil {
+			http.Error(w, "Failed to update duplicate flags: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Check the alert rules of both months
+	NotifyAlerts(userId, monthStr)
+	if mergeRequest.DuplicateMonth != monthStr {
+		NotifyAlerts(userId, mergeRequest.DuplicateMonth)
+	}
+
+	// Publish the changes, and any budget items the merge put over budget
+	PublishEvent(userId, EventExpenseUpdated, monthStr, merged)
+	PublishEvent(userId, EventExpenseDeleted, mergeRequest.DuplicateMonth, map[string]interface{}{
+		"userId":          userId,
+		"month":           mergeRequest.DuplicateMonth,
+		"expenseItemName": duplicate.ExpenseItemName,
+	})
+	watch.PublishExceeded()
+
+	// Return the merged item
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(merged)
+}
+
+func DismissDuplicateHandler(w http.ResponseWriter, r *http.Request) {
+	// Get userId, month, and expenseItemName from URL parameters
+	vars := mux.Vars(r)
+	userId := vars["userId"]
+	monthStr := vars["month"]
+	expenseItemName := vars["expenseItemName"]
+
+	// Validate the input
+	if userId == "" || monthStr == "" || expenseItemName == "" {
+		http.Error(w, "Missing required parameters: userId, month, and expenseItemName", http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can change the workspace
+	if !requireRole(w, r, userId, RoleEditor) {
+		return
+	}
+
+	// Clear the duplicate flag
+	err := ClearExpenseDuplicate(userId, monthStr, expenseItemName)
+	if err != nil {
+		http.Error(w, "Failed to dismiss duplicate: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return success response
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Duplicate flag dismissed successfully",
+	})
+}
+
+// Import handlers
+func ImportStatementHandler(w http.ResponseWriter, r *http.Request) {
+	// Get the statement format from the URL and userId from query parameters
+	format := mux.Vars(r)["format"]
+	userId := r.URL.Query().Get("userId")
+	accountId := r.URL.Query().Get("accountId")
+
+	// Validate the input
+	if userId == "" || format == "" {
+		http.Error(w, "Missing required parameters: userId and format", http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can change the workspace
+	if !requireRole(w, r, userId, RoleEditor) {
+		return
+	}
+
+	parse, err := LookupStatementParser(format)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The request body is the statement file itself
+	transactions, err := parse(r.Body)
+	if err != nil {
+		http.Error(w, "Failed to parse statement: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Book the transactions against the account when one is given, in the
+	// account's currency
+	currency := ""
+	if accountId != "" {
+		account, err := GetAccount(userId, accountId)
+		if err != nil {
+			http.Error(w, "Failed to get account: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if account == nil {
+			http.Error(w, "Account not found", http.StatusNotFound)
+			return
+		}
+		currency = account.Currency
+	}
+
+	// Store the transactions as expense and income items
+	result, err := ImportTransactions(userId, accountId, currency, transactions)
+	if err != nil {
+		log.Printf("Failed to import %s statement: %v", format, err)
+		http.Error(w, "Failed to import statement: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	result.Format = strings.ToLower(format)
+
+	// Return the import summary
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(result)
+}
+
+// Export handlers
+func ExportHandler(w http.ResponseWriter, r *http.Request) {
+	// Get userId and format from query parameters
+	userId := r.URL.Query().Get("userId")
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+	}
+
+	// Validate the input
+	if userId == "" {
+		http.Error(w, "Missing required query parameter: userId", http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can read the workspace
+	if !requireRole(w, r, userId, RoleViewer) {
+		return
+	}
+
+	// Sections only the owner manages, such as webhooks, are left out of
+	// exports made by other members
+	caller, _ := CallerFromRequest(r)
+	role, err := WorkspaceRole(caller.UserId, userId)
+	if err != nil {
+		http.Error(w, "Failed to check workspace membership: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	filename := fmt.Sprintf("budget-export-%s", time.Now().UTC().Format("20060102"))
+	switch format {
+	case "json":
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename+".json"))
+		err = WriteJSONExport(w, userId, role)
+	case "csv":
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename+".zip"))
+		err = WriteCSVExport(w, userId, role)
+	default:
+		http.Error(w, "Unsupported export format: "+format, http.StatusBadRequest)
+		return
+	}
+
+	// The response is already streaming, so a failure can only be logged;
+	// the client receives a truncated document it will fail to parse
+	if err != nil {
+		log.Printf("Failed to export data for %s: %v", userId, err)
+	}
+}
+
+func ExportJournalHandler(w http.ResponseWriter, r *http.Request) {
+	// Parse the request body
+	var exportRequest struct {
+		UserId  string               `json:"userId"`
+		From    string               `json:"from"`
+		To      string               `json:"to"`
+		Dialect string               `json:"dialect"`
+		Mapping LedgerAccountMapping `json:"mapping"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&exportRequest)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Validate the input
+	if exportRequest.UserId == "" || exportRequest.From == "" || exportRequest.To == "" {
+		http.Error(w, "Missing required fields: userId, from, and to", http.StatusBadRequest)
+		return
+	}
+	if exportRequest.Dialect == "" {
+		exportRequest.Dialect = DialectLedger
+	}
+	from, err := time.Parse("2006-01-02", exportRequest.From)
+	if err != nil {
+		http.Error(w, "Invalid from date, expected YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+	to, err := time.Parse("2006-01-02", exportRequest.To)
+	if err != nil {
+		http.Error(w, "Invalid to date, expected YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+	months, err := monthsBetween(from.Format(monthLayout), to.Format(monthLayout))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can read the workspace
+	if !requireRole(w, r, exportRequest.UserId, RoleViewer) {
+		return
+	}
+
+	// Get the income and expense items for every month in the range
+	var incomeItems []IncomeItem
+	var expenseItems []ExpenseItem
+	for _, month := range months {
+		monthIncome, err := GetAllIncome(exportRequest.UserId, month)
+		if err != nil {
+			http.Error(w, "Failed to get income items: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		monthExpenses, err := GetAllExpenses(exportRequest.UserId, month)
+		if err != nil {
+			http.Error(w, "Failed to get expense items: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		incomeItems = append(incomeItems, monthIncome...)
+		expenseItems = append(expenseItems, monthExpenses...)
+	}
+
+	// Items without a currency are in the base currency, which is also the
+	// default commodity
+	if exportRequest.Mapping.Commodity == "" {
+		settings, err := GetUserSettings(exportRequest.UserId)
+		if err != nil {
+			http.Error(w, "Failed to get settings: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		exportRequest.Mapping.Commodity = settings.BaseCurrency
+	}
+
+	// Render the journal
+	transactions := BuildJournal(incomeItems, expenseItems, exportRequest.Mapping, from, to)
+	var journal bytes.Buffer
+	err = WriteJournal(&journal, exportRequest.Dialect, transactions)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Return the journal
+	extension := map[string]string{DialectLedger: "ledger", DialectHledger: "journal", DialectBeancount: "beancount"}[exportRequest.Dialect]
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "budget-"+exportRequest.From+"-"+exportRequest.To+"."+extension))
+	w.Write(journal.Bytes())
+}
+
+func RestoreHandler(w http.ResponseWriter, r *http.Request) {
+	// Get the restore options from query parameters
+	options := RestoreOptions{
+		UserId:   r.URL.Query().Get("userId"),
+		DryRun:   r.URL.Query().Get("dryRun") == "true",
+		Conflict: r.URL.Query().Get("conflict"),
+	}
+
+	// Validate the input
+	if options.UserId == "" {
+		http.Error(w, "Missing required query parameter: userId", http.StatusBadRequest)
+		return
+	}
+
+	// Only workspace owners can restore into it
+	if !requireRole(w, r, options.UserId, RoleOwner) {
+		return
+	}
+
+	// The request body is the export file itself
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, MaxRestoreSize))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, fmt.Sprintf("Export file is larger than %d MB", MaxRestoreSize>>20), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	archive, err := ReadExportArchive(data)
+	if err != nil {
+		http.Error(w, "Invalid export archive: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Restore the archived items
+	result, err := RestoreArchive(archive, options)
+	if errors.Is(err, ErrRestoreConflict) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(result)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to restore archive for %s: %v", options.UserId, err)
+		http.Error(w, "Failed to restore archive: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Publish the restored items and check the alert rules of their months
+	PublishRestore(result)
+
+	// Return the restore summary
+	w.Header().Set("Content-Type", "application/json")
+	if !result.DryRun {
+		w.WriteHeader(http.StatusCreated)
+	}
+	json.NewEncoder(w).Encode(result)
+}
+
+// Account handlers
+func AddAccountHandler(w http.ResponseWriter, r *http.Request) {
+	// Parse the request body
+	var account Account
+	err := json.NewDecoder(r.Body).Decode(&account)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Validate the input
+	if account.UserId == "" {
+		http.Error(w, "Missing required fields", http.StatusBadRequest)
+		return
+	}
+	if err := ValidateAccount(&account); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can change the workspace
+	if !requireRole(w, r, account.UserId, RoleEditor) {
+		return
+	}
+
+	// Add the account to the database
+	account.AccountId = uuid.New().String()
+	err = AddAccount(account)
+	if err != nil {
+		http.Error(w, "Failed to add account: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the created account
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(account)
+}
+
+func GetAllAccountsHandler(w http.ResponseWriter, r *http.Request) {
+	// Get userId from query parameters
+	userId := r.URL.Query().Get("userId")
+
+	// Validate the input
+	if userId == "" {
+		http.Error(w, "Missing required query parameter: userId", http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can read the workspace
+	if !requireRole(w, r, userId, RoleViewer) {
+		return
+	}
+
+	// Get the accounts from the database
+	accounts, err := GetAllAccounts(userId)
+	if err != nil {
+		http.Error(w, "Failed to get accounts: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the accounts
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(accounts)
+}
+
+func UpdateAccountHandler(w http.ResponseWriter, r *http.Request) {
+	// Get userId and accountId from URL parameters
+	vars := mux.Vars(r)
+	userId := vars["userId"]
+	accountId := vars["accountId"]
+
+	// Validate the input
+	if userId == "" || accountId == "" {
+		http.Error(w, "Missing required parameters: userId and accountId", http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can change the workspace
+	if !requireRole(w, r, userId, RoleEditor) {
+		return
+	}
+
+	// Parse the request body to get the new account details
+	var account Account
+	err := json.NewDecoder(r.Body).Decode(&account)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	account.UserId = userId
+	account.AccountId = accountId
+	if err := ValidateAccount(&account); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Make sure the account exists before replacing it
+	existing, err := GetAccount(userId, accountId)
+	if err != nil {
+		http.Error(w, "Failed to get account: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if existing == nil {
+		http.Error(w, "Account not found", http.StatusNotFound)
+		return
+	}
+
+	// The currency can only change while nothing is booked against the
+	// account
+	if account.Currency != existing.Currency {
+		income, err := GetAllUserIncome(userId)
+		if err != nil {
+			http.Error(w, "Failed to get income: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		expenses, err := GetAllUserExpenses(userId)
+		if err != nil {
+			http.Error(w, "Failed to get expenses: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		transfers, err := GetAllUserTransfers(userId)
+		if err != nil {
+			http.Error(w, "Failed to get transfers: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if accountHasActivity(accountId, income, expenses, transfers) {
+			http.Error(w, fmt.Sprintf("Cannot change the currency of account %s from %s to %s because items or transfers are booked against it", existing.AccountName, existing.Currency, account.Currency), http.StatusConflict)
+			return
+		}
+	}
+
+	// Update the account in the database
+	err = AddAccount(account)
+	if err != nil {
+		http.Error(w, "Failed to update account: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return success response
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Account updated successfully",
+	})
+}
+
+func DeleteAccountHandler(w http.ResponseWriter, r *http.Request) {
+	// Get userId and accountId from URL parameters
+	vars := mux.Vars(r)
+	userId := vars["userId"]
+	accountId := vars["accountId"]
+
+	// Validate the input
+	if userId == "" || accountId == "" {
+		http.Error(w, "Missing required parameters: userId and accountId", http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can change the workspace
+	if !requireRole(w, r, userId, RoleEditor) {
+		return
+	}
+
+	// Delete the account from the database. Items booked against it keep
+	// their accountId so they can be reassigned.
+	err := DeleteAccount(userId, accountId)
+	if err != nil {
+		http.Error(w, "Failed to delete account: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return success response
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Account deleted successfully",
+	})
+}
+
+func GetAccountBalancesHandler(w http.ResponseWriter, r *http.Request) {
+	// Get userId and accountId from URL parameters
+	vars := mux.Vars(r)
+	userId := vars["userId"]
+	accountId := vars["accountId"]
+	toMonth := r.URL.Query().Get("to")
+	if toMonth == "" {
+		toMonth = time.Now().UTC().Format(monthLayout)
+	}
+
+	// Validate the input
+	if userId == "" || accountId == "" {
+		http.Error(w, "Missing required parameters: userId and accountId", http.StatusBadRequest)
+		return
+	}
+	if _, err := parseMonth(toMonth); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can read the workspace
+	if !requireRole(w, r, userId, RoleViewer) {
+		return
+	}
+
+	// Get the account from the database
+	account, err := GetAccount(userId, accountId)
+	if err != nil {
+		http.Error(w, "Failed to get account: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if account == nil {
+		http.Error(w, "Account not found", http.StatusNotFound)
+		return
+	}
+
+	// Compute the running balance
+	balances, err := LoadAccountBalances(*account, toMonth)
+	if err != nil {
+		http.Error(w, "Failed to compute account balances: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the balances
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(balances)
+}
+
+// Transfer handlers
+func AddTransferHandler(w http.ResponseWriter, r *http.Request) {
+	// Parse the request body
+	var transfer Transfer
+	err := json.NewDecoder(r.Body).Decode(&transfer)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Validate the input
+	if transfer.UserId == "" {
+		http.Error(w, "Missing required fields", http.StatusBadRequest)
+		return
+	}
+	if err := ValidateTransfer(&transfer); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can change the workspace
+	if !requireRole(w, r, transfer.UserId, RoleEditor) {
+		return
+	}
+
+	// Both accounts must belong to the user
+	var accounts []Account
+	for _, accountId := range []string{transfer.FromAccountId, transfer.ToAccountId} {
+		account, err := GetAccount(transfer.UserId, accountId)
+		if err != nil {
+			http.Error(w, "Failed to get account: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if account == nil {
+			http.Error(w, "Account not found: "+accountId, http.StatusNotFound)
+			return
+		}
+		accounts = append(accounts, *account)
+	}
+	if err := ValidateTransferAccounts(&transfer, accounts[0], accounts[1]); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Add the transfer to the database
+	transfer.TransferId = uuid.New().String()
+	err = AddTransfer(transfer)
+	if err != nil {
+		http.Error(w, "Failed to add transfer: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the created transfer
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(transfer)
+}
+
+func GetAllTransfersHandler(w http.ResponseWriter, r *http.Request) {
+	// Get userId and month from query parameters
+	userId := r.URL.Query().Get("userId")
+	monthStr := r.URL.Query().Get("month")
+
+	// Validate the input
+	if userId == "" || monthStr == "" {
+		http.Error(w, "Missing required query parameters: userId and month", http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can read the workspace
+	if !requireRole(w, r, userId, RoleViewer) {
+		return
+	}
+
+	// Get the transfers from the database
+	transfers, err := GetAllTransfers(userId, monthStr)
+	if err != nil {
+		http.Error(w, "Failed to get transfers: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the transfers
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(transfers)
+}
+
+func DeleteTransferHandler(w http.ResponseWriter, r *http.Request) {
+	// Get userId, month, and transferId from URL parameters
+	vars := mux.Vars(r)
+	userId := vars["userId"]
+	monthStr := vars["month"]
+	transferId := vars["transferId"]
+
+	// Validate the input
+	if userId == "" || monthStr == "" || transferId == "" {
+		http.Error(w, "Missing required parameters: userId, month, and transferId", http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can change the workspace
+	if !requireRole(w, r, userId, RoleEditor) {
+		return
+	}
+
+	// Delete the transfer from the database
+	err := DeleteTransfer(userId, monthStr, transferId)
+	if err != nil {
+		http.Error(w, "Failed to delete transfer: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return success response
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Transfer deleted successfully",
+	})
+}
+
+// Settings handlers
+func GetSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	// Get userId from query parameters
+	userId := r.URL.Query().Get("userId")
+
+	// Validate the input
+	if userId == "" {
+		http.Error(w, "Missing required query parameter: userId", http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can read the workspace
+	if !requireRole(w, r, userId, RoleViewer) {
+		return
+	}
+
+	// Get the settings from the database
+	settings, err := GetUserSettings(userId)
+	if err != nil {
+		http.Error(w, "Failed to get settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the settings
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
+
+func UpdateSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	// Parse the request body
+	var settings UserSettings
+	err := json.NewDecoder(r.Body).Decode(&settings)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Validate the input
+	if settings.UserId == "" || settings.BaseCurrency == "" {
+		http.Error(w, "Missing required fields", http.StatusBadRequest)
+		return
+	}
+	if settings.BaseCurrency, err = normalizeCurrency(settings.BaseCurrency); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can change the workspace
+	if !requireRole(w, r, settings.UserId, RoleEditor) {
+		return
+	}
+
+	// Items without a currency are in the base currency, so before it
+	// changes they are given the old one to keep their meaning
+	current, err := GetUserSettings(settings.UserId)
+	if err != nil {
+		http.Error(w, "Failed to get settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if current.BaseCurrency != settings.BaseCurrency {
+		stamped, err := StampCurrency(settings.UserId, current.BaseCurrency)
+		if err != nil {
+			log.Printf("Failed to keep the currency of %s items after %d: %v", settings.UserId, stamped, err)
+			http.Error(w, "Failed to update settings: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Save the settings to the database
+	err = PutUserSettings(settings)
+	if err != nil {
+		http.Error(w, "Failed to update settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return success response
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Settings updated successfully",
+	})
+}
+
+// Exchange rate handlers
+func AddExchangeRatesHandler(w http.ResponseWriter, r *http.Request) {
+	// Get userId from query parameters
+	userId := r.URL.Query().Get("userId")
+
+	// Validate the input
+	if userId == "" {
+		http.Error(w, "Missing required query parameter: userId", http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can change the workspace
+	if !requireRole(w, r, userId, RoleEditor) {
+		return
+	}
+
+	// Parse the rates from either a CSV file or a JSON body
+	var rates []ExchangeRate
+	var err error
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "text/csv") {
+		rates, err = ParseExchangeRatesCSV(r.Body)
+	} else {
+		var requestBody struct {
+			Rates []ExchangeRate `json:"rates"`
+		}
+		err = json.NewDecoder(r.Body).Decode(&requestBody)
+		rates = requestBody.Rates
+	}
+	if err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(rates) == 0 {
+		http.Error(w, "No exchange rates provided", http.StatusBadRequest)
+		return
+	}
+
+	for i := range rates {
+		rates[i].UserId = userId
+		if err := ValidateExchangeRate(&rates[i]); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid exchange rate %d: %v", i+1, err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Add the rates to the database
+	err = AddExchangeRates(rates)
+	if err != nil {
+		http.Error(w, "Failed to add exchange rates: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return success response
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": fmt.Sprintf("%d exchange rate(s) added successfully", len(rates)),
+	})
+}
+
+func GetAllExchangeRatesHandler(w http.ResponseWriter, r *http.Request) {
+	// Get userId from query parameters
+	userId := r.URL.Query().Get("userId")
+
+	// Validate the input
+	if userId == "" {
+		http.Error(w, "Missing required query parameter: userId", http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can read the workspace
+	if !requireRole(w, r, userId, RoleViewer) {
+		return
+	}
+
+	// Get the rates from the database
+	rates, err := GetAllExchangeRates(userId)
+	if err != nil {
+		http.Error(w, "Failed to get exchange rates: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the rates
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rates)
+}
+
+func DeleteExchangeRateHandler(w http.ResponseWriter, r *http.Request) {
+	// Get userId and rateId from URL parameters
+	vars := mux.Vars(r)
+	userId := vars["userId"]
+	rateId := vars["rateId"]
+
+	// Validate the input
+	if userId == "" || rateId == "" {
+		http.Error(w, "Missing required parameters: userId and rateId", http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can change the workspace
+	if !requireRole(w, r, userId, RoleEditor) {
+		return
+	}
+
+	// Delete the rate from the database
+	err := DeleteExchangeRate(userId, rateId)
+	if err != nil {
+		http.Error(w, "Failed to delete exchange rate: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return success response
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Exchange rate deleted successfully",
+	})
+}
+
+// Report handlers
+func GetCurrencyReportHandler(w http.ResponseWriter, r *http.Request) {
+	// Get userId and the month range from query parameters
+	userId := r.URL.Query().Get("userId")
+	fromMonth := r.URL.Query().Get("from")
+	toMonth := r.URL.Query().Get("to")
+	if month := r.URL.Query().Get("month"); month != "" {
+		fromMonth, toMonth = month, month
+	}
+
+	// Validate the input
+	if userId == "" || fromMonth == "" || toMonth == "" {
+		http.Error(w, "Missing required query parameters: userId and either month or from and to", http.StatusBadRequest)
+		return
+	}
+	months, err := monthsBetween(fromMonth, toMonth)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can read the workspace
+	if !requireRole(w, r, userId, RoleViewer) {
+		return
+	}
+
+	// Get the base currency and exchange rates
+	settings, err := GetUserSettings(userId)
+	if err != nil {
+		http.Error(w, "Failed to get settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rates, err := GetAllExchangeRates(userId)
+	if err != nil {
+		http.Error(w, "Failed to get exchange rates: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rateTable := NewRateTable(rates)
+
+	// Build a report for every month in the range
+	reports := make([]CurrencyReport, 0, len(months))
+	for _, month := range months {
+		incomeItems, err := GetAllIncome(userId, month)
+		if err != nil {
+			http.Error(w, "Failed to get income items: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		budgetItems, err := GetAllBudget(userId, month)
+		if err != nil {
+			http.Error(w, "Failed to get budget items: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		expenseItems, err := GetAllExpenses(userId, month)
+		if err != nil {
+			http.Error(w, "Failed to get expense items: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		reports = append(reports, BuildCurrencyReport(month, settings.BaseCurrency, rateTable, incomeItems, budgetItems, expenseItems))
+	}
+
+	// Return the reports
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reports)
+}
+
+// Household handlers
+func CreateHouseholdHandler(w http.ResponseWriter, r *http.Request) {
+	// Parse the request body
+	var household Household
+	err := json.NewDecoder(r.Body).Decode(&household)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Validate the input
+	household.HouseholdName = strings.TrimSpace(household.HouseholdName)
+	if household.HouseholdName == "" {
+		http.Error(w, "Missing required field: householdName", http.StatusBadRequest)
+		return
+	}
+
+	caller, ok := CallerFromRequest(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Add the household to the database, with the caller as its owner
+	household.HouseholdId = householdIdPrefix + uuid.New().String()
+	household.CreatedBy = caller.UserId
+	household.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+	err = AddHousehold(household)
+	if err != nil {
+		http.Error(w, "Failed to create household: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	err = PutHouseholdMember(HouseholdMember{
+		HouseholdId: household.HouseholdId,
+		UserId:      caller.UserId,
+		UserName:    caller.UserName,
+		Role:        RoleOwner,
+		JoinedAt:    household.CreatedAt,
+	})
+	if err != nil {
+		http.Error(w, "Failed to add household owner: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the created household
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(household)
+}
+
+func GetHouseholdsHandler(w http.ResponseWriter, r *http.Request) {
+	caller, ok := CallerFromRequest(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Get the caller's memberships from the database
+	members, err := GetUserMemberships(caller.UserId)
+	if err != nil {
+		http.Error(w, "Failed to get households: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	memberships := []Membership{}
+	for _, member := range members {
+		household, err := GetHousehold(member.HouseholdId)
+		if err != nil {
+			http.Error(w, "Failed to get households: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if household == nil {
+			continue
+		}
+		memberships = append(memberships, Membership{Household: *household, Role: member.Role})
+	}
+
+	// Return the households
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(memberships)
+}
+
+func GetHouseholdMembersHandler(w http.ResponseWriter, r *http.Request) {
+	// Get householdId from URL parameters
+	householdId := mux.Vars(r)["householdId"]
+
+	// Check the caller belongs to the household
+	if !requireRole(w, r, householdId, RoleViewer) {
+		return
+	}
+
+	// Get the members from the database
+	members, err := GetHouseholdMembers(householdId)
+	if err != nil {
+		http.Error(w, "Failed to get household members: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the members
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(members)
+}
+
+func UpdateHouseholdMemberHandler(w http.ResponseWriter, r *http.Request) {
+	// Get householdId and the member's userId from URL parameters
+	vars := mux.Vars(r)
+	householdId := vars["householdId"]
+	userId := vars["userId"]
+
+	// Parse the request body to get the new role
+	var updateRequest struct {
+		Role string `json:"role"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&updateRequest)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Validate the input
+	if err := ValidateRole(updateRequest.Role); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Only owners can change roles
+	if !requireRole(w, r, householdId, RoleOwner) {
+		return
+	}
+
+	members, err := GetHouseholdMembers(householdId)
+	if err != nil {
+		http.Error(w, "Failed to get household members: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var member *HouseholdMember
+	for i := range members {
+		if members[i].UserId == userId {
+			member = &members[i]
+		}
+	}
+	if member == nil {
+		http.Error(w, "Household member not found", http.StatusNotFound)
+		return
+	}
+	if member.Role == RoleOwner && updateRequest.Role != RoleOwner && countOwners(members) == 1 {
+		http.Error(w, "A household must keep at least one owner", http.StatusConflict)
+		return
+	}
+
+	// Update the member in the database
+	member.Role = updateRequest.Role
+	err = PutHouseholdMember(*member)
+	if err != nil {
+		http.Error(w, "Failed to update household member: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the updated member
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(member)
+}
+
+func RemoveHouseholdMemberHandler(w http.ResponseWriter, r *http.Request) {
+	// Get householdId and the member's userId from URL parameters
+	vars := mux.Vars(r)
+	householdId := vars["householdId"]
+	userId := vars["userId"]
+
+	// Members can leave on their own; removing someone else takes an owner
+	caller, ok := CallerFromRequest(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	role := RoleOwner
+	if userId == caller.UserId {
+		role = RoleViewer
+	}
+	if !requireRole(w, r, householdId, role) {
+		return
+	}
+
+	members, err := GetHouseholdMembers(householdId)
+	if err != nil {
+		http.Error(w, "Failed to get household members: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, member := range members {
+		if member.UserId == userId && member.Role == RoleOwner && countOwners(members) == 1 {
+			http.Error(w, "A household must keep at least one owner", http.StatusConflict)
+			return
+		}
+	}
+
+	// Delete the member from the database, and stop the emails they get
+	// about the household
+	err = DeleteHouseholdMember(householdId, userId)
+	if err != nil {
+		http.Error(w, "Failed to remove household member: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	err = DeleteEmailSubscription(householdId, userId)
+	if err != nil {
+		http.Error(w, "Failed to delete email subscription: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return success response
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Household member removed successfully",
+	})
+}
+
+// Invitation handlers
+func InviteHouseholdMemberHandler(w http.ResponseWriter, r *http.Request) {
+	// Get householdId from URL parameters
+	householdId := mux.Vars(r)["householdId"]
+
+	// Parse the request body
+	var invitation HouseholdInvitation
+	err := json.NewDecoder(r.Body).Decode(&invitation)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Validate the input
+	invitation.Invitee = normalizeInvitee(invitation.Invitee)
+	if invitation.Invitee == "" {
+		http.Error(w, "Missing required field: invitee (username or email)", http.StatusBadRequest)
+		return
+	}
+	if invitation.Role == "" {
+		invitation.Role = RoleEditor
+	}
+	if err := ValidateRole(invitation.Role); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Only owners can invite members
+	if !requireRole(w, r, householdId, RoleOwner) {
+		return
+	}
+	caller, _ := CallerFromRequest(r)
+
+	household, err := GetHousehold(householdId)
+	if err != nil {
+		http.Error(w, "Failed to get household: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if household == nil {
+		http.Error(w, "Household not found", http.StatusNotFound)
+		return
+	}
+
+	// Add the invitation to the database
+	invitation.HouseholdId = householdId
+	invitation.InvitationId = uuid.New().String()
+	invitation.HouseholdName = household.HouseholdName
+	invitation.InvitedBy = caller.UserName
+	invitation.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+	err = AddHouseholdInvitation(invitation)
+	if err != nil {
+		http.Error(w, "Failed to create invitation: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the created invitation
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(invitation)
+}
+
+func GetHouseholdInvitationsHandler(w http.ResponseWriter, r *http.Request) {
+	// Get householdId from URL parameters
+	householdId := mux.Vars(r)["householdId"]
+
+	// Only owners can see a household's pending invitations
+	if !requireRole(w, r, householdId, RoleOwner) {
+		return
+	}
+
+	// Get the invitations from the database
+	invitations, err := GetHouseholdInvitations(householdId)
+	if err != nil {
+		http.Error(w, "Failed to get invitations: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the invitations
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(invitations)
+}
+
+func GetMyInvitationsHandler(w http.ResponseWriter, r *http.Request) {
+	caller, ok := CallerFromRequest(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Get the invitations addressed to the caller's username or verified
+	// email
+	invitations, err := GetInvitationsFor(callerInvitees(caller))
+	if err != nil {
+		http.Error(w, "Failed to get invitations: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if invitations == nil {
+		invitations = []HouseholdInvitation{}
+	}
+
+	// Return the invitations
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(invitations)
+}
+
+func AcceptInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	// Get householdId and invitationId from URL parameters
+	vars := mux.Vars(r)
+	householdId := vars["householdId"]
+	invitationId := vars["invitationId"]
+
+	caller, ok := CallerFromRequest(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// The invitation must be addressed to the caller
+	invitation, err := GetHouseholdInvitation(householdId, invitationId)
+	if err != nil {
+		http.Error(w, "Failed to get invitation: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if invitation == nil || !invitationMatches(*invitation, caller) {
+		http.Error(w, "Invitation not found", http.StatusNotFound)
+		return
+	}
+
+	// Add the caller to the household, keeping a higher role they already have
+	role := invitation.Role
+	existing, err := GetHouseholdMember(householdId, caller.UserId)
+	if err != nil {
+		http.Error(w, "Failed to get household member: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if existing != nil && roleRanks[existing.Role] > roleRanks[role] {
+		role = existing.Role
+	}
+	member := HouseholdMember{
+		HouseholdId: householdId,
+		UserId:      caller.UserId,
+		UserName:    caller.UserName,
+		Role:        role,
+		JoinedAt:    time.Now().UTC().Format(time.RFC3339),
+	}
+	err = PutHouseholdMember(member)
+	if err != nil {
+		http.Error(w, "Failed to join household: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	err = DeleteHouseholdInvitation(householdId, invitationId)
+	if err != nil {
+		http.Error(w, "Failed to delete invitation: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the new membership
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(member)
+}
+
+func DeleteInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	// Get householdId and invitationId from URL parameters
+	vars := mux.Vars(r)
+	householdId := vars["householdId"]
+	invitationId := vars["invitationId"]
+
+	caller, ok := CallerFromRequest(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	invitation, err := GetHouseholdInvitation(householdId, invitationId)
+	if err != nil {
+		http.Error(w, "Failed to get invitation: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if invitation == nil {
+		http.Error(w, "Invitation not found", http.StatusNotFound)
+		return
+	}
+
+	// The invitee can decline; otherwise only an owner can withdraw it
+	if !invitationMatches(*invitation, caller) && !requireRole(w, r, householdId, RoleOwner) {
+		return
+	}
+
+	// Delete the invitation from the database
+	err = DeleteHouseholdInvitation(householdId, invitationId)
+	if err != nil {
+		http.Error(w, "Failed to delete invitation: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return success response
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Invitation deleted successfully",
+	})
+}
+
+// Group handlers
+func GetGroupBalancesHandler(w http.ResponseWriter, r *http.Request) {
+	// Get userId and the optional group from query parameters
+	userId := r.URL.Query().Get("userId")
+	group := r.URL.Query().Get("group")
+
+	// Validate the input
+	if userId == "" {
+		http.Error(w, "Missing required query parameter: userId", http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can read the workspace
+	if !requireRole(w, r, userId, RoleViewer) {
+		return
+	}
+
+	// Get the shared expenses and settlements from the database
+	expenses, err := GetAllUserExpenses(userId)
+	if err != nil {
+		http.Error(w, "Failed to get expense items: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	transfers, err := GetAllUserTransfers(userId)
+	if err != nil {
+		http.Error(w, "Failed to get transfers: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	settings, err := GetUserSettings(userId)
+	if err != nil {
+		http.Error(w, "Failed to get settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Net the balances and suggest how to settle them
+	balances := ComputeGroupBalances(group, settings.BaseCurrency, expenses, transfers)
+	result := GroupBalances{
+		Group:       group,
+		Balances:    balances,
+		Settlements: SuggestSettlements(balances),
+	}
+
+	// Return the balances
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+func AddSettlementHandler(w http.ResponseWriter, r *http.Request) {
+	// Parse the request body
+	var settlement Transfer
+	err := json.NewDecoder(r.Body).Decode(&settlement)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Validate the input
+	if settlement.UserId == "" {
+		http.Error(w, "Missing required fields", http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can change the workspace
+	if !requireRole(w, r, settlement.UserId, RoleEditor) {
+		return
+	}
+
+	// A settlement without a currency is in the base currency
+	settings, err := GetUserSettings(settlement.UserId)
+	if err != nil {
+		http.Error(w, "Failed to get settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := ValidateSettlement(&settlement, settings.BaseCurrency); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Record the settlement as a transfer
+	settlement.TransferId = uuid.New().String()
+	if settlement.Description == "" {
+		settlement.Description = fmt.Sprintf("%s settles up with %s", settlement.FromParticipant, settlement.ToParticipant)
+	}
+	err = AddTransfer(settlement)
+	if err != nil {
+		http.Error(w, "Failed to add settlement: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the created settlement
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(settlement)
+}
+
+// Goal handlers
+func AddGoalHandler(w http.ResponseWriter, r *http.Request) {
+	// Parse the request body
+	var goal Goal
+	err := json.NewDecoder(r.Body).Decode(&goal)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Validate the input
+	if goal.UserId == "" {
+		http.Error(w, "Missing required fields", http.StatusBadRequest)
+		return
+	}
+	if err := ValidateGoal(&goal); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can change the workspace
+	if !requireRole(w, r, goal.UserId, RoleEditor) {
+		return
+	}
+
+	// Add the goal to the database
+	goal.GoalId = uuid.New().String()
+	goal.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+	err = AddGoal(goal)
+	if err != nil {
+		http.Error(w, "Failed to add goal: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the created goal
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(goal)
+}
+
+func GetAllGoalsHandler(w http.ResponseWriter, r *http.Request) {
+	// Get userId from query parameters
+	userId := r.URL.Query().Get("userId")
+
+	// Validate the input
+	if userId == "" {
+		http.Error(w, "Missing required query parameter: userId", http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can read the workspace
+	if !requireRole(w, r, userId, RoleViewer) {
+		return
+	}
+
+	// Get the goals from the database
+	goals, err := GetAllGoals(userId)
+	if err != nil {
+		http.Error(w, "Failed to get goals: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the goals
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(goals)
+}
+
+func UpdateGoalHandler(w http.ResponseWriter, r *http.Request) {
+	// Get userId and goalId from URL parameters
+	vars := mux.Vars(r)
+	userId := vars["userId"]
+	goalId := vars["goalId"]
+
+	// Validate the input
+	if userId == "" || goalId == "" {
+		http.Error(w, "Missing required parameters: userId and goalId", http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can change the workspace
+	if !requireRole(w, r, userId, RoleEditor) {
+		return
+	}
+
+	// Parse the request body to get the new goal details
+	var goal Goal
+	err := json.NewDecoder(r.Body).Decode(&goal)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	goal.UserId = userId
+	goal.GoalId = goalId
+	if err := ValidateGoal(&goal); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Make sure the goal exists before replacing it
+	existing, err := GetGoal(userId, goalId)
+	if err != nil {
+		http.Error(w, "Failed to get goal: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if existing == nil {
+		http.Error(w, "Goal not found", http.StatusNotFound)
+		return
+	}
+	goal.CreatedAt = existing.CreatedAt
+
+	// Update the goal in the database
+	err = AddGoal(goal)
+	if err != nil {
+		http.Error(w, "Failed to update goal: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return success response
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Goal updated successfully",
+	})
+}
+
+func DeleteGoalHandler(w http.ResponseWriter, r *http.Request) {
+	// Get userId and goalId from URL parameters
+	vars := mux.Vars(r)
+	userId := vars["userId"]
+	goalId := vars["goalId"]
+
+	// Validate the input
+	if userId == "" || goalId == "" {
+		http.Error(w, "Missing required parameters: userId and goalId", http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can change the workspace
+	if !requireRole(w, r, userId, RoleEditor) {
+		return
+	}
+
+	// Delete the goal and its contributions from the database
+	contributions, err := GetGoalContributions(userId, goalId)
+	if err != nil {
+		http.Error(w, "Failed to get goal contributions: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, contribution := range contributions {
+		if err := DeleteGoalContribution(userId, contribution.ContributionId); err != nil {
+			http.Error(w, "Failed to delete goal contribution: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	err = DeleteGoal(userId, goalId)
+	if err != nil {
+		http.Error(w, "Failed to delete goal: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return success response
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Goal deleted successfully",
+	})
+}
+
+func AddGoalContributionHandler(w http.ResponseWriter, r *http.Request) {
+	// Get userId and goalId from URL parameters
+	vars := mux.Vars(r)
+	userId := vars["userId"]
+	goalId := vars["goalId"]
+
+	// Validate the input
+	if userId == "" || goalId == "" {
+		http.Error(w, "Missing required parameters: userId and goalId", http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can change the workspace
+	if !requireRole(w, r, userId, RoleEditor) {
+		return
+	}
+
+	// Parse the request body
+	var contribution GoalContribution
+	err := json.NewDecoder(r.Body).Decode(&contribution)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	contribution.UserId = userId
+	contribution.GoalId = goalId
+	if err := ValidateGoalContribution(&contribution); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	goal, err := GetGoal(userId, goalId)
+	if err != nil {
+		http.Error(w, "Failed to get goal: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if goal == nil {
+		http.Error(w, "Goal not found", http.StatusNotFound)
+		return
+	}
+
+	// A linked item must exist, and contributes its whole value unless an
+	// amount is given
+	switch contribution.Source {
+	case ContributionIncome:
+		incomeItems, err := GetAllIncome(userId, contribution.Month)
+		if err != nil {
+			http.Error(w, "Failed to get income items: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		found := false
+		for _, item := range incomeItems {
+			if item.IncomeItemName == contribution.ItemName {
+				found = true
+				if contribution.Amount == 0 {
+					if item.Currency != goal.Currency {
+						http.Error(w, fmt.Sprintf("Income item is in %q but the goal is in %q; give the amount contributed", item.Currency, goal.Currency), http.StatusBadRequest)
+						return
+					}
+					contribution.Amount = item.IncomeItemValue
+				}
+				if item.Date != "" {
+					contribution.Date = item.Date
+				}
+			}
+		}
+		if !found {
+			http.Error(w, "Income item not found", http.StatusNotFound)
+			return
+		}
+	case ContributionExpense:
+		item, err := GetExpense(userId, contribution.Month, contribution.ItemName)
+		if err != nil {
+			http.Error(w, "Failed to get expense item: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if item == nil {
+			http.Error(w, "Expense item not found", http.StatusNotFound)
+			return
+		}
+		if contribution.Amount == 0 {
+			if item.Currency != goal.Currency {
+				http.Error(w, fmt.Sprintf("Expense item is in %q but the goal is in %q; give the amount contributed", item.Currency, goal.Currency), http.StatusBadRequest)
+				return
+			}
+			contribution.Amount = item.ExpenseValue
+		}
+		if item.Date != "" {
+			contribution.Date = item.Date
+		}
+	}
+	contribution.Amount = contribution.Amount.Round(goal.Currency)
+	if contribution.Amount == 0 {
+		http.Error(w, "Missing required field: amount", http.StatusBadRequest)
+		return
+	}
+
+	// Add the contribution to the database
+	contribution.ContributionId = uuid.New().String()
+	err = AddGoalContribution(contribution)
+	if err != nil {
+		http.Error(w, "Failed to add goal contribution: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the created contribution
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(contribution)
+}
+
+func GetGoalContributionsHandler(w http.ResponseWriter, r *http.Request) {
+	// Get userId and goalId from URL parameters
+	vars := mux.Vars(r)
+	userId := vars["userId"]
+	goalId := vars["goalId"]
+
+	// Validate the input
+	if userId == "" || goalId == "" {
+		http.Error(w, "Missing required parameters: userId and goalId", http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can read the workspace
+	if !requireRole(w, r, userId, RoleViewer) {
+		return
+	}
+
+	// Get the contributions from the database
+	contributions, err := GetGoalContributions(userId, goalId)
+	if err != nil {
+		http.Error(w, "Failed to get goal contributions: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the contributions
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(contributions)
+}
+
+func DeleteGoalContributionHandler(w http.ResponseWriter, r *http.Request) {
+	// Get userId and contributionId from URL parameters
+	vars := mux.Vars(r)
+	userId := vars["userId"]
+	contributionId := vars["contributionId"]
+
+	// Validate the input
+	if userId == "" || contributionId == "" {
+		http.Error(w, "Missing required parameters: userId and contributionId", http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can change the workspace
+	if !requireRole(w, r, userId, RoleEditor) {
+		return
+	}
+
+	// Delete the contribution from the database
+	err := DeleteGoalContribution(userId, contributionId)
+	if err != nil {
+		http.Error(w, "Failed to delete goal contribution: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return success response
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Goal contribution deleted successfully",
+	})
+}
+
+func GetGoalProgressHandler(w http.ResponseWriter, r *http.Request) {
+	// Get userId and goalId from URL parameters
+	vars := mux.Vars(r)
+	userId := vars["userId"]
+	goalId := vars["goalId"]
+
+	// Validate the input
+	if userId == "" || goalId == "" {
+		http.Error(w, "Missing required parameters: userId and goalId", http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can read the workspace
+	if !requireRole(w, r, userId, RoleViewer) {
+		return
+	}
+
+	// Get the goal and its contributions from the database
+	goal, err := GetGoal(userId, goalId)
+	if err != nil {
+		http.Error(w, "Failed to get goal: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if goal == nil {
+		http.Error(w, "Goal not found", http.StatusNotFound)
+		return
+	}
+	contributions, err := GetGoalContributions(userId, goalId)
+	if err != nil {
+		http.Error(w, "Failed to get goal contributions: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the progress report
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ComputeGoalProgress(*goal, contributions, time.Now().UTC()))
+}
+
+// Debt handlers
+func AddDebtHandler(w http.ResponseWriter, r *http.Request) {
+	// Parse the request body
+	var debt Debt
+	err := json.NewDecoder(r.Body).Decode(&debt)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Validate the input
+	if debt.UserId == "" {
+		http.Error(w, "Missing required fields", http.StatusBadRequest)
+		return
+	}
+	if err := ValidateDebt(&debt); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can change the workspace
+	if !requireRole(w, r, debt.UserId, RoleEditor) {
+		return
+	}
+
+	// Add the debt to the database
+	debt.DebtId = uuid.New().String()
+	err = AddDebt(debt)
+	if err != nil {
+		http.Error(w, "Failed to add debt: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the created debt
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(debt)
+}
+
+func GetAllDebtsHandler(w http.ResponseWriter, r *http.Request) {
+	// Get userId from query parameters
+	userId := r.URL.Query().Get("userId")
+
+	// Validate the input
+	if userId == "" {
+		http.Error(w, "Missing required query parameter: userId", http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can read the workspace
+	if !requireRole(w, r, userId, RoleViewer) {
+		return
+	}
+
+	// Get the debts and their payments from the database
+	statuses, err := getDebtStatuses(userId)
+	if err != nil {
+		http.Error(w, "Failed to get debts: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the debts with their current balances
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(statuses)
+}
+
+// getDebtStatuses returns a user's debts with their payments applied.
+func getDebtStatuses(userId string) ([]DebtStatus, error) {
+	debts, err := GetAllDebts(userId)
+	if err != nil {
+		return nil, err
+	}
+	payments, err := GetAllDebtPayments(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := []DebtStatus{}
+	for _, debt := range debts {
+		statuses = append(statuses, ComputeDebtStatus(debt, payments))
+	}
+	return statuses, nil
+}
+
+func UpdateDebtHandler(w http.ResponseWriter, r *http.Request) {
+	// Get userId and debtId from URL parameters
+	vars := mux.Vars(r)
+	userId := vars["userId"]
+	debtId := vars["debtId"]
+
+	// Validate the input
+	if userId == "" || debtId == "" {
+		http.Error(w, "Missing required parameters: userId and debtId", http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can change the workspace
+	if !requireRole(w, r, userId, RoleEditor) {
+		return
+	}
+
+	// Parse the request body to get the new debt details
+	var debt Debt
+	err := json.NewDecoder(r.Body).Decode(&debt)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	debt.UserId = userId
+	debt.DebtId = debtId
+	if err := ValidateDebt(&debt); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Make sure the debt exists before replacing it
+	existing, err := GetDebt(userId, debtId)
+	if err != nil {
+		http.Error(w, "Failed to get debt: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if existing == nil {
+		http.Error(w, "Debt not found", http.StatusNotFound)
+		return
+	}
+
+	// Update the debt in the database
+	err = AddDebt(debt)
+	if err != nil {
+		http.Error(w, "Failed to update debt: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return success response
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Debt updated successfully",
+	})
+}
+
+func DeleteDebtHandler(w http.ResponseWriter, r *http.Request) {
+	// Get userId and debtId from URL parameters
+	vars := mux.Vars(r)
+	userId := vars["userId"]
+	debtId := vars["debtId"]
+
+	// Validate the input
+	if userId == "" || debtId == "" {
+		http.Error(w, "Missing required parameters: userId and debtId", http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can change the workspace
+	if !requireRole(w, r, userId, RoleEditor) {
+		return
+	}
+
+	// Delete the debt and its payments from the database
+	payments, err := GetDebtPayments(userId, debtId)
+	if err != nil {
+		http.Error(w, "Failed to get debt payments: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, payment := range payments {
+		if err := DeleteDebtPayment(userId, payment.PaymentId); err != nil {
+			http.Error(w, "Failed to delete debt payment: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	err = DeleteDebt(userId, debtId)
+	if err != nil {
+		http.Error(w, "Failed to delete debt: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return success response
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Debt deleted successfully",
+	})
+}
+
+func AddDebtPaymentHandler(w http.ResponseWriter, r *http.Request) {
+	// Get userId and debtId from URL parameters
+	vars := mux.Vars(r)
+	userId := vars["userId"]
+	debtId := vars["debtId"]
+
+	// Validate the input
+	if userId == "" || debtId == "" {
+		http.Error(w, "Missing required parameters: userId and debtId", http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can change the workspace
+	if !requireRole(w, r, userId, RoleEditor) {
+		return
+	}
+
+	// Parse the request body
+	var payment DebtPayment
+	err := json.NewDecoder(r.Body).Decode(&payment)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	payment.UserId = userId
+	payment.DebtId = debtId
+	if err := ValidateDebtPayment(&payment); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	debt, err := GetDebt(userId, debtId)
+	if err != nil {
+		http.Error(w, "Failed to get debt: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if debt == nil {
+		http.Error(w, "Debt not found", http.StatusNotFound)
+		return
+	}
+
+	// The expense item that paid the debt must exist, and pays its whole
+	// value unless an amount is given
+	item, err := GetExpense(userId, payment.Month, payment.ExpenseItemName)
+	if err != nil {
+		http.Error(w, "Failed to get expense item: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if item == nil {
+		http.Error(w, "Expense item not found", http.StatusNotFound)
+		return
+	}
+	if payment.Amount == 0 {
+		if item.Currency != debt.Currency {
+			http.Error(w, fmt.Sprintf("Expense item is in %q but the debt is in %q; give the amount paid", item.Currency, debt.Currency), http.StatusBadRequest)
+			return
+		}
+		payment.Amount = item.ExpenseValue
+	}
+	if item.Date != "" {
+		payment.Date = item.Date
+	}
+	payment.Amount = payment.Amount.Round(debt.Currency)
+	if payment.Amount <= 0 {
+		http.Error(w, "Payment amount must be positive", http.StatusBadRequest)
+		return
+	}
+
+	// Add the payment to the database
+	payment.PaymentId = uuid.New().String()
+	err = AddDebtPayment(payment)
+	if err != nil {
+		http.Error(w, "Failed to add debt payment: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the created payment
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(payment)
+}
+
+func GetDebtPaymentsHandler(w http.ResponseWriter, r *http.Request) {
+	// Get userId and debtId from URL parameters
+	vars := mux.Vars(r)
+	userId := vars["userId"]
+	debtId := vars["debtId"]
+
+	// Validate the input
+	if userId == "" || debtId == "" {
+		http.Error(w, "Missing required parameters: userId and debtId", http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can read the workspace
+	if !requireRole(w, r, userId, RoleViewer) {
+		return
+	}
+
+	// Get the payments from the database
+	payments, err := GetDebtPayments(userId, debtId)
+	if err != nil {
+		http.Error(w, "Failed to get debt payments: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the payments
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(payments)
+}
+
+func DeleteDebtPaymentHandler(w http.ResponseWriter, r *http.Request) {
+	// Get userId and paymentId from URL parameters
+	vars := mux.Vars(r)
+	userId := vars["userId"]
+	paymentId := vars["paymentId"]
+
+	// Validate the input
+	if userId == "" || paymentId == "" {
+		http.Error(w, "Missing required parameters: userId and paymentId", http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can change the workspace
+	if !requireRole(w, r, userId, RoleEditor) {
+		return
+	}
+
+	// Delete the payment from the database
+	err := DeleteDebtPayment(userId, paymentId)
+	if err != nil {
+		http.Error(w, "Failed to delete debt payment: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return success response
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Debt payment deleted successfully",
+	})
+}
+
+func GetPayoffPlanHandler(w http.ResponseWriter, r *http.Request) {
+	// Get userId and the extra monthly amount from query parameters
+	userId := r.URL.Query().Get("userId")
+	extraParam := r.URL.Query().Get("extra")
+
+	// Validate the input
+	if userId == "" {
+		http.Error(w, "Missing required query parameter: userId", http.StatusBadRequest)
+		return
+	}
+	var extra Money
+	if extraParam != "" {
+		parsed, err := ParseMoney(extraParam)
+		if err != nil || parsed < 0 {
+			http.Error(w, "Invalid extra amount", http.StatusBadRequest)
+			return
+		}
+		extra = parsed
+	}
+
+	// Check the caller can read the workspace
+	if !requireRole(w, r, userId, RoleViewer) {
+		return
+	}
+
+	// Get the debts and their payments from the database
+	statuses, err := getDebtStatuses(userId)
+	if err != nil {
+		http.Error(w, "Failed to get debts: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Simulate both strategies
+	comparison, err := ComparePayoffPlans(statuses, extra, time.Now().UTC())
+	if err != nil {
+		http.Error(w, "Failed to plan payoff: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Return the plans
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(comparison)
+}
+
+// Holding handlers
+func AddHoldingHandler(w http.ResponseWriter, r *http.Request) {
+	// Parse the request body
+	var holding Holding
+	err := json.NewDecoder(r.Body).Decode(&holding)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Validate the input
+	if holding.UserId == "" {
+		http.Error(w, "Missing required fields", http.StatusBadRequest)
+		return
+	}
+	if err := ValidateHolding(&holding); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can change the workspace
+	if !requireRole(w, r, holding.UserId, RoleEditor) {
+		return
+	}
+
+	// Add the holding to the database
+	holding.HoldingId = uuid.New().String()
+	err = AddHolding(holding)
+	if err != nil {
+		http.Error(w, "Failed to add holding: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the created holding
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(holding)
+}
+
+func GetAllHoldingsHandler(w http.ResponseWriter, r *http.Request) {
+	// Get userId from query parameters
+	userId := r.URL.Query().Get("userId")
+
+	// Validate the input
+	if userId == "" {
+		http.Error(w, "Missing required query parameter: userId", http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can read the workspace
+	if !requireRole(w, r, userId, RoleViewer) {
+		return
+	}
+
+	// Get the holdings from the database
+	holdings, err := GetAllHoldings(userId)
+	if err != nil {
+		http.Error(w, "Failed to get holdings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the holdings
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(holdings)
+}
+
+func UpdateHoldingHandler(w http.ResponseWriter, r *http.Request) {
+	// Get userId and holdingId from URL parameters
+	vars := mux.Vars(r)
+	userId := vars["userId"]
+	holdingId := vars["holdingId"]
+
+	// Validate the input
+	if userId == "" || holdingId == "" {
+		http.Error(w, "Missing required parameters: userId and holdingId", http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can change the workspace
+	if !requireRole(w, r, userId, RoleEditor) {
+		return
+	}
+
+	// Parse the request body to get the new holding details
+	var holding Holding
+	err := json.NewDecoder(r.Body).Decode(&holding)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	holding.UserId = userId
+	holding.HoldingId = holdingId
+	if err := ValidateHolding(&holding); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Make sure the holding exists before replacing it
+	existing, err := GetHolding(userId, holdingId)
+	if err != nil {
+		http.Error(w, "Failed to get holding: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if existing == nil {
+		http.Error(w, "Holding not found", http.StatusNotFound)
+		return
+	}
+
+	// Update the holding in the database
+	err = AddHolding(holding)
+	if err != nil {
+		http.Error(w, "Failed to update holding: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return success response
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Holding updated successfully",
+	})
+}
+
+func DeleteHoldingHandler(w http.ResponseWriter, r *http.Request) {
+	// Get userId and holdingId from URL parameters
+	vars := mux.Vars(r)
+	userId := vars["userId"]
+	holdingId := vars["holdingId"]
+
+	// Validate the input
+	if userId == "" || holdingId == "" {
+		http.Error(w, "Missing required parameters: userId and holdingId", http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can change the workspace
+	if !requireRole(w, r, userId, RoleEditor) {
+		return
+	}
+
+	// Delete the holding and its valuations from the database
+	valuations, err := GetHoldingValuations(userId, holdingId)
+	if err != nil {
+		http.Error(w, "Failed to get holding valuations: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, valuation := range valuations {
+		if err := DeleteHoldingValuation(userId, valuation.ValuationId); err != nil {
+			http.Error(w, "Failed to delete holding valuation: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	err = DeleteHolding(userId, holdingId)
+	if err != nil {
+		http.Error(w, "Failed to delete holding: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return success response
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Holding deleted successfully",
+	})
+}
+
+func AddHoldingValuationHandler(w http.ResponseWriter, r *http.Request) {
+	// Get userId and holdingId from URL parameters
+	vars := mux.Vars(r)
+	userId := vars["userId"]
+	holdingId := vars["holdingId"]
+
+	// Validate the input
+	if userId == "" || holdingId == "" {
+		http.Error(w, "Missing required parameters: userId and holdingId", http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can change the workspace
+	if !requireRole(w, r, userId, RoleEditor) {
+		return
+	}
+
+	// Parse the request body
+	var valuation HoldingValuation
+	err := json.NewDecoder(r.Body).Decode(&valuation)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	holding, err := GetHolding(userId, holdingId)
+	if err != nil {
+		http.Error(w, "Failed to get holding: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if holding == nil {
+		http.Error(w, "Holding not found", http.StatusNotFound)
+		return
+	}
+	valuation.UserId = userId
+	valuation.HoldingId = holdingId
+	if err := ValidateHoldingValuation(&valuation, *holding); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Add the valuation to the database
+	valuation.ValuationId = uuid.New().String()
+	err = AddHoldingValuation(valuation)
+	if err != nil {
+		http.Error(w, "Failed to add holding valuation: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the created valuation
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(valuation)
+}
+
+func GetHoldingValuationsHandler(w http.ResponseWriter, r *http.Request) {
+	// Get userId and holdingId from URL parameters
+	vars := mux.Vars(r)
+	userId := vars["userId"]
+	holdingId := vars["holdingId"]
+
+	// Validate the input
+	if userId == "" || holdingId == "" {
+		http.Error(w, "Missing required parameters: userId and holdingId", http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can read the workspace
+	if !requireRole(w, r, userId, RoleViewer) {
+		return
+	}
+
+	// Get the valuations from the database
+	valuations, err := GetHoldingValuations(userId, holdingId)
+	if err != nil {
+		http.Error(w, "Failed to get holding valuations: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the valuations
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(valuations)
+}
+
+func DeleteHoldingValuationHandler(w http.ResponseWriter, r *http.Request) {
+	// Get userId and valuationId from URL parameters
+	vars := mux.Vars(r)
+	userId := vars["userId"]
+	valuationId := vars["valuationId"]
+
+	// Validate the input
+	if userId == "" || valuationId == "" {
+		http.Error(w, "Missing required parameters: userId and valuationId", http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can change the workspace
+	if !requireRole(w, r, userId, RoleEditor) {
+		return
+	}
+
+	// Delete the valuation from the database
+	err := DeleteHoldingValuation(userId, valuationId)
+	if err != nil {
+		http.Error(w, "Failed to delete holding valuation: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return success response
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Holding valuation deleted successfully",
+	})
+}
+
+func GetNetWorthHandler(w http.ResponseWriter, r *http.Request) {
+	// Get userId and the month range from query parameters. The range
+	// defaults to the twelve months up to the current one.
+	userId := r.URL.Query().Get("userId")
+	toMonth := r.URL.Query().Get("to")
+	if toMonth == "" {
+		toMonth = time.Now().UTC().Format(monthLayout)
+	}
+	fromMonth := r.URL.Query().Get("from")
+
+	// Validate the input
+	if userId == "" {
+		http.Error(w, "Missing required query parameter: userId", http.StatusBadRequest)
+		return
+	}
+	if fromMonth == "" {
+		var err error
+		fromMonth, err = addMonths(toMonth, -11)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	months, err := monthsBetween(fromMonth, toMonth)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can read the workspace
+	if !requireRole(w, r, userId, RoleViewer) {
+		return
+	}
+
+	// Get the base currency and exchange rates
+	settings, err := GetUserSettings(userId)
+	if err != nil {
+		http.Error(w, "Failed to get settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rates, err := GetAllExchangeRates(userId)
+	if err != nil {
+		http.Error(w, "Failed to get exchange rates: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Compute the running balance of every account
+	accounts, err := GetAllAccounts(userId)
+	if err != nil {
+		http.Error(w, "Failed to get accounts: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	income, err := GetAllUserIncome(userId)
+	if err != nil {
+		http.Error(w, "Failed to get income items: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	expenses, err := GetAllUserExpenses(userId)
+	if err != nil {
+		http.Error(w, "Failed to get expense items: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	transfers, err := GetAllUserTransfers(userId)
+	if err != nil {
+		http.Error(w, "Failed to get transfers: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	accountBalances := make(map[string][]AccountBalance)
+	for _, account := range accounts {
+		balances, err := ComputeAccountBalances(account, income, expenses, transfers, toMonth)
+		if err != nil {
+			http.Error(w, "Failed to compute account balances: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		accountBalances[account.AccountId] = balances
+	}
+
+	// Get the holdings and their valuations
+	holdings, err := GetAllHoldings(userId)
+	if err != nil {
+		http.Error(w, "Failed to get holdings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	valuations, err := GetAllHoldingValuations(userId)
+	if err != nil {
+		http.Error(w, "Failed to get holding valuations: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the net worth series
+	series := ComputeNetWorth(months, settings.BaseCurrency, NewRateTable(rates), accounts, accountBalances, holdings, valuations, time.Now().UTC())
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(series)
+}
+
+// Investment handlers
+func AddInvestmentTransactionHandler(w http.ResponseWriter, r *http.Request) {
+	// Parse the request body
+	var transaction InvestmentTransaction
+	err := json.NewDecoder(r.Body).Decode(&transaction)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Validate the input
+	if transaction.UserId == "" || transaction.AccountId == "" {
+		http.Error(w, "Missing required fields", http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can change the workspace
+	if !requireRole(w, r, transaction.UserId, RoleEditor) {
+		return
+	}
+
+	account, err := GetAccount(transaction.UserId, transaction.AccountId)
+	if err != nil {
+		http.Error(w, "Failed to get account: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if account == nil {
+		http.Error(w, "Account not found", http.StatusNotFound)
+		return
+	}
+	if err := ValidateInvestmentTransaction(&transaction, *account); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// A sell cannot close more than the account holds
+	transaction.TransactionId = uuid.New().String()
+	if transaction.Type == InvestmentSell {
+		transactions, err := GetAllInvestmentTransactions(transaction.UserId)
+		if err != nil {
+			http.Error(w, "Failed to get investment transactions: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if _, _, err := BuildLots(append(transactions, transaction), "9999-12-31"); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Add the transaction to the database
+	err = AddInvestmentTransaction(transaction)
+	if err != nil {
+		http.Error(w, "Failed to add investment transaction: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the created transaction
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(transaction)
+}
+
+func GetInvestmentTransactionsHandler(w http.ResponseWriter, r *http.Request) {
+	// Get userId and the optional accountId from query parameters
+	userId := r.URL.Query().Get("userId")
+	accountId := r.URL.Query().Get("accountId")
+
+	// Validate the input
+	if userId == "" {
+		http.Error(w, "Missing required query parameter: userId", http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can read the workspace
+	if !requireRole(w, r, userId, RoleViewer) {
+		return
+	}
+
+	// Get the transactions from the database
+	all, err := GetAllInvestmentTransactions(userId)
+	if err != nil {
+		http.Error(w, "Failed to get investment transactions: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	transactions := []InvestmentTransaction{}
+	for _, transaction := range all {
+		if accountId == "" || transaction.AccountId == accountId {
+			transactions = append(transactions, transaction)
+		}
+	}
+
+	// Return the transactions
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(transactions)
+}
+
+func DeleteInvestmentTransactionHandler(w http.ResponseWriter, r *http.Request) {
+	// Get userId and transactionId from URL parameters
+	vars := mux.Vars(r)
+	userId := vars["userId"]
+	transactionId := vars["transactionId"]
+
+	// Validate the input
+	if userId == "" || transactionId == "" {
+		http.Error(w, "Missing required parameters: userId and transactionId", http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can change the workspace
+	if !requireRole(w, r, userId, RoleEditor) {
+		return
+	}
+
+	// A buy cannot be removed while later sells depend on it
+	transactions, err := GetAllInvestmentTransactions(userId)
+	if err != nil {
+		http.Error(w, "Failed to get investment transactions: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	remaining := []InvestmentTransaction{}
+	for _, transaction := range transactions {
+		if transaction.TransactionId != transactionId {
+			remaining = append(remaining, transaction)
+		}
+	}
+	if _, _, err := BuildLots(remaining, "9999-12-31"); err != nil {
+		http.Error(w, "Cannot delete transaction: "+err.Error(), http.StatusConflict)
+		return
+	}
+
+	// Delete the transaction from the database
+	err = DeleteInvestmentTransaction(userId, transactionId)
+	if err != nil {
+		http.Error(w, "Failed to delete investment transaction: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return success response
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Investment transaction deleted successfully",
+	})
+}
+
+func AddSecurityPricesHandler(w http.ResponseWriter, r *http.Request) {
+	// Get userId from query parameters
+	userId := r.URL.Query().Get("userId")
+
+	// Validate the input
+	if userId == "" {
+		http.Error(w, "Missing required query parameter: userId", http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can change the workspace
+	if !requireRole(w, r, userId, RoleEditor) {
+		return
+	}
+
+	// Parse the prices from either a CSV file or a JSON body
+	var prices []SecurityPrice
+	var err error
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "text/csv") {
+		prices, err = ParseSecurityPricesCSV(r.Body)
+	} else {
+		var requestBody struct {
+			Prices []SecurityPrice `json:"prices"`
+		}
+		err = json.NewDecoder(r.Body).Decode(&requestBody)
+		prices = requestBody.Prices
+	}
+	if err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(prices) == 0 {
+		http.Error(w, "No prices provided", http.StatusBadRequest)
+		return
+	}
+
+	for i := range prices {
+		prices[i].UserId = userId
+		if err := ValidateSecurityPrice(&prices[i]); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid price %d: %v", i+1, err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Add the prices to the database
+	err = AddSecurityPrices(prices)
+	if err != nil {
+		http.Error(w, "Failed to add prices: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return success response
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": fmt.Sprintf("%d price(s) added successfully", len(prices)),
+	})
+}
+
+func GetSecurityPricesHandler(w http.ResponseWriter, r *http.Request) {
+	// Get userId and the optional symbol from query parameters
+	userId := r.URL.Query().Get("userId")
+	symbol := normalizeSymbol(r.URL.Query().Get("symbol"))
+
+	// Validate the input
+	if userId == "" {
+		http.Error(w, "Missing required query parameter: userId", http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can read the workspace
+	if !requireRole(w, r, userId, RoleViewer) {
+		return
+	}
+
+	// Get the prices from the database
+	all, err := GetAllSecurityPrices(userId)
+	if err != nil {
+		http.Error(w, "Failed to get prices: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	prices := []SecurityPrice{}
+	for _, price := range all {
+		if symbol == "" || price.Symbol == symbol {
+			prices = append(prices, price)
+		}
+	}
+
+	// Return the prices
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(prices)
+}
+
+func DeleteSecurityPriceHandler(w http.ResponseWriter, r *http.Request) {
+	// Get userId and priceId from URL parameters
+	vars := mux.Vars(r)
+	userId := vars["userId"]
+	priceId := vars["priceId"]
+
+	// Validate the input
+	if userId == "" || priceId == "" {
+		http.Error(w, "Missing required parameters: userId and priceId", http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can change the workspace
+	if !requireRole(w, r, userId, RoleEditor) {
+		return
+	}
+
+	// Delete the price from the database
+	err := DeleteSecurityPrice(userId, priceId)
+	if err != nil {
+		http.Error(w, "Failed to delete price: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return success response
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Price deleted successfully",
+	})
+}
+
+// loadInvestmentGains reads a user's investment accounts, or just one of
+// them, with their transactions and prices, and values them as of a date.
+func loadInvestmentGains(userId string, accountId string, day string) (*InvestmentGains, []Account, *RateTable, error) {
+	settings, err := GetUserSettings(userId)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	rates, err := GetAllExchangeRates(userId)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	allAccounts, err := GetAllAccounts(userId)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	var accounts []Account
+	for _, account := range allAccounts {
+		if account.AccountType == "investment" && (accountId == "" || account.AccountId == accountId) {
+			accounts = append(accounts, account)
+		}
+	}
+	transactions, err := GetAllInvestmentTransactions(userId)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	prices, err := GetAllSecurityPrices(userId)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	rateTable := NewRateTable(rates)
+	gains, err := ComputeInvestmentGains(day, settings.BaseCurrency, rateTable, NewPriceTable(prices), accounts, transactions)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return gains, accounts, rateTable, nil
+}
+
+func GetInvestmentGainsHandler(w http.ResponseWriter, r *http.Request) {
+	// Get userId, the optional accountId and the valuation date from query
+	// parameters. The date defaults to today.
+	userId := r.URL.Query().Get("userId")
+	accountId := r.URL.Query().Get("accountId")
+	day := r.URL.Query().Get("date")
+	if day == "" {
+		day = time.Now().UTC().Format("2006-01-02")
+	}
+
+	// Validate the input
+	if userId == "" {
+		http.Error(w, "Missing required query parameter: userId", http.StatusBadRequest)
+		return
+	}
+	if _, err := time.Parse("2006-01-02", day); err != nil {
+		http.Error(w, "Invalid date, expected YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can read the workspace
+	if !requireRole(w, r, userId, RoleViewer) {
+		return
+	}
+
+	// Value the investments
+	gains, _, _, err := loadInvestmentGains(userId, accountId, day)
+	if err != nil {
+		http.Error(w, "Failed to compute investment gains: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the gains
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(gains)
+}
+
+func GetInvestmentAllocationHandler(w http.ResponseWriter, r *http.Request) {
+	// Get userId, the optional accountId and the valuation date from query
+	// parameters. The date defaults to today.
+	userId := r.URL.Query().Get("userId")
+	accountId := r.URL.Query().Get("accountId")
+	day := r.URL.Query().Get("date")
+	if day == "" {
+		day = time.Now().UTC().Format("2006-01-02")
+	}
+
+	// Validate the input
+	if userId == "" {
+		http.Error(w, "Missing required query parameter: userId", http.StatusBadRequest)
+		return
+	}
+	if _, err := time.Parse("2006-01-02", day); err != nil {
+		http.Error(w, "Invalid date, expected YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can read the workspace
+	if !requireRole(w, r, userId, RoleViewer) {
+		return
+	}
+
+	// Value the investments
+	gains, accounts, rates, err := loadInvestmentGains(userId, accountId, day)
+	if err != nil {
+		http.Error(w, "Failed to compute investment allocation: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the allocation
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ComputeAllocation(gains, rates, accounts))
+}
+
+// Analytics handlers
+func GetTrendsHandler(w http.ResponseWriter, r *http.Request) {
+	// Get userId, the month range and the grouping from query parameters.
+	// The range defaults to the twelve months up to the current one, and
+	// spending is grouped by category over a three month rolling window.
+	query := r.URL.Query()
+	userId := query.Get("userId")
+	toMonth := query.Get("to")
+	if toMonth == "" {
+		toMonth = time.Now().UTC().Format(monthLayout)
+	}
+	fromMonth := query.Get("from")
+	groupBy := query.Get("groupBy")
+	if groupBy == "" {
+		groupBy = TrendByCategory
+	}
+	window, top := 3, 5
+
+	// Validate the input
+	if userId == "" {
+		http.Error(w, "Missing required query parameter: userId", http.StatusBadRequest)
+		return
+	}
+	if fromMonth == "" {
+		var err error
+		fromMonth, err = addMonths(toMonth, -11)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if value := query.Get("window"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > 24 {
+			http.Error(w, "Invalid window, expected a number of months from 1 to 24", http.StatusBadRequest)
+			return
+		}
+		window = parsed
+	}
+	if value := query.Get("top"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			http.Error(w, "Invalid top, expected a non-negative number", http.StatusBadRequest)
+			return
+		}
+		top = parsed
+	}
+	if _, err := monthsBetween(fromMonth, toMonth); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	firstMonth, _ := addMonths(fromMonth, -trendLookback(window))
+	months, err := monthsBetween(firstMonth, toMonth)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can read the workspace
+	if !requireRole(w, r, userId, RoleViewer) {
+		return
+	}
+
+	// Get the base currency and exchange rates
+	settings, err := GetUserSettings(userId)
+	if err != nil {
+		http.Error(w, "Failed to get settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rates, err := GetAllExchangeRates(userId)
+	if err != nil {
+		http.Error(w, "Failed to get exchange rates: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rateTable := NewRateTable(rates)
+
+	// Total each month's spending in the base currency, including the months
+	// before the range that the deltas and averages compare with
+	reports := make(map[string]CurrencyReport)
+	for _, month := range months {
+		expenseItems, err := GetAllExpenses(userId, month)
+		if err != nil {
+			http.Error(w, "Failed to get expense items: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		reports[month] = BuildCurrencyReport(month, settings.BaseCurrency, rateTable, nil, nil, expenseItems)
+	}
+
+	// Return the trends
+	report, err := BuildTrendReport(fromMonth, toMonth, groupBy, window, top, settings.BaseCurrency, reports)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// Recurring item handlers
+func AddRecurringItemHandler(w http.ResponseWriter, r *http.Request) {
+	// Parse the request body
+	var item RecurringItem
+	err := json.NewDecoder(r.Body).Decode(&item)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Validate the input
+	if item.UserId == "" {
+		http.Error(w, "Missing required fields", http.StatusBadRequest)
+		return
+	}
+	if err := ValidateRecurringItem(&item); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can change the workspace
+	if !requireRole(w, r, item.UserId, RoleEditor) {
+		return
+	}
+
+	// Add the recurring item to the database
+	item.RecurringId = uuid.New().String()
+	err = AddRecurringItem(item)
+	if err != nil {
+		http.Error(w, "Failed to add recurring item: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the created recurring item
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(item)
+}
+
+func GetAllRecurringItemsHandler(w http.ResponseWriter, r *http.Request) {
+	// Get userId from query parameters
+	userId := r.URL.Query().Get("userId")
+
+	// Validate the input
+	if userId == "" {
+		http.Error(w, "Missing required query parameter: userId", http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can read the workspace
+	if !requireRole(w, r, userId, RoleViewer) {
+		return
+	}
+
+	// Get the recurring items from the database
+	items, err := GetAllRecurringItems(userId)
+	if err != nil {
+		http.Error(w, "Failed to get recurring items: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the recurring items
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(items)
+}
+
+func UpdateRecurringItemHandler(w http.ResponseWriter, r *http.Request) {
+	// Get userId and recurringId from URL parameters
+	vars := mux.Vars(r)
+	userId := vars["userId"]
+	recurringId := vars["recurringId"]
+
+	// Validate the input
+	if userId == "" || recurringId == "" {
+		http.Error(w, "Missing required parameters: userId and recurringId", http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can change the workspace
+	if !requireRole(w, r, userId, RoleEditor) {
+		return
+	}
+
+	// Parse the request body to get the new recurring item details
+	var item RecurringItem
+	err := json.NewDecoder(r.Body).Decode(&item)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	item.UserId = userId
+	item.RecurringId = recurringId
+	if err := ValidateRecurringItem(&item); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Make sure the recurring item exists before replacing it
+	existing, err := GetRecurringItem(userId, recurringId)
+	if err != nil {
+		http.Error(w, "Failed to get recurring item: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if existing == nil {
+		http.Error(w, "Recurring item not found", http.StatusNotFound)
+		return
+	}
+
+	// Update the recurring item in the database
+	err = AddRecurringItem(item)
+	if err != nil {
+		http.Error(w, "Failed to update recurring item: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return success response
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Recurring item updated successfully",
+	})
+}
+
+func DeleteRecurringItemHandler(w http.ResponseWriter, r *http.Request) {
+	// Get userId and recurringId from URL parameters
+	vars := mux.Vars(r)
+	userId := vars["userId"]
+	recurringId := vars["recurringId"]
+
+	// Validate the input
+	if userId == "" || recurringId == "" {
+		http.Error(w, "Missing required parameters: userId and recurringId", http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can change the workspace
+	if !requireRole(w, r, userId, RoleEditor) {
+		return
+	}
+
+	// Delete the recurring item from the database
+	err := DeleteRecurringItem(userId, recurringId)
+	if err != nil {
+		http.Error(w, "Failed to delete recurring item: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return success response
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Recurring item deleted successfully",
+	})
+}
+
+// Forecast handlers
+func GetForecastHandler(w http.ResponseWriter, r *http.Request) {
+	// Get userId, the number of months to project and the number of past
+	// months to learn from from query parameters
+	query := r.URL.Query()
+	userId := query.Get("userId")
+	months, historyMonths := 6, 12
+
+	// Validate the input
+	if userId == "" {
+		http.Error(w, "Missing required query parameter: userId", http.StatusBadRequest)
+		return
+	}
+	if value := query.Get("months"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > 24 {
+			http.Error(w, "Invalid months, expected a number from 1 to 24", http.StatusBadRequest)
+			return
+		}
+		months = parsed
+	}
+	if value := query.Get("history"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > 60 {
+			http.Error(w, "Invalid history, expected a number of months from 1 to 60", http.StatusBadRequest)
+			return
+		}
+		historyMonths = parsed
+	}
+
+	// Check the caller can read the workspace
+	if !requireRole(w, r, userId, RoleViewer) {
+		return
+	}
+
+	// Get the base currency, exchange rates and known recurring items
+	settings, err := GetUserSettings(userId)
+	if err != nil {
+		http.Error(w, "Failed to get settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rates, err := GetAllExchangeRates(userId)
+	if err != nil {
+		http.Error(w, "Failed to get exchange rates: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rateTable := NewRateTable(rates)
+	recurring, err := GetAllRecurringItems(userId)
+	if err != nil {
+		http.Error(w, "Failed to get recurring items: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	matcher := newRecurringMatcher(recurring)
+
+	// Total each completed month in the history, leaving out occurrences of
+	// the recurring items, which are projected from their own schedule
+	now := time.Now().UTC()
+	currentMonth := now.Format(monthLayout)
+	firstMonth, _ := addMonths(currentMonth, -historyMonths)
+	lastMonth, _ := addMonths(currentMonth, -1)
+	history, err := monthsBetween(firstMonth, lastMonth)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	reports := make([]CurrencyReport, 0, len(history))
+	for _, month := range history {
+		incomeItems, err := GetAllIncome(userId, month)
+		if err != nil {
+			http.Error(w, "Failed to get income items: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		expenseItems, err := GetAllExpenses(userId, month)
+		if err != nil {
+			http.Error(w, "Failed to get expense items: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		var income []IncomeItem
+		for _, item := range incomeItems {
+			if !matcher.matches(RecurringIncome, item.IncomeItemName, item.Payer) {
+				income = append(income, item)
+			}
+		}
+		var expenses []ExpenseItem
+		for _, item := range expenseItems {
+			if !matcher.matches(RecurringExpense, item.ExpenseItemName, item.Merchant) {
+				expenses = append(expenses, item)
+			}
+		}
+		reports = append(reports, BuildCurrencyReport(month, settings.BaseCurrency, rateTable, income, nil, expenses))
+	}
+
+	// Start from the combined balance of the accounts, listing the balances
+	// there is no rate for
+	accounts, err := GetAllAccounts(userId)
+	if err != nil {
+		http.Error(w, "Failed to get accounts: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var openingBalance Money
+	var openingMissing []string
+	if len(accounts) > 0 {
+		income, err := GetAllUserIncome(userId)
+		if err != nil {
+			http.Error(w, "Failed to get income items: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		expenses, err := GetAllUserExpenses(userId)
+		if err != nil {
+			http.Error(w, "Failed to get expense items: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		transfers, err := GetAllUserTransfers(userId)
+		if err != nil {
+			http.Error(w, "Failed to get transfers: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for _, account := range accounts {
+			balances, err := ComputeAccountBalances(account, income, expenses, transfers, currentMonth)
+			if err != nil {
+				http.Error(w, "Failed to compute account balances: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if len(balances) == 0 {
+				continue
+			}
+			currency := account.Currency
+			if currency == "" {
+				currency = settings.BaseCurrency
+			}
+			balance, ok := rateTable.Convert(balances[len(balances)-1].Balance, currency, settings.BaseCurrency, now)
+			if !ok {
+				openingMissing = append(openingMissing, fmt.Sprintf("%s/%s@%s", currency, settings.BaseCurrency, now.Format("2006-01-02")))
+				continue
+			}
+			openingBalance += balance
+		}
+	}
+
+	// Return the forecast
+	forecast := ForecastCashFlow(reports, recurring, openingBalance, openingMissing, settings.BaseCurrency, rateTable, months, now)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(forecast)
+}
+
+// Scenario handlers
+func AddScenarioHandler(w http.ResponseWriter, r *http.Request) {
+	// Parse the request body. Without lines, the scenario starts as a copy
+	// of the base month's income and budget.
+	var scenario Scenario
+	err := json.NewDecoder(r.Body).Decode(&scenario)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Validate the input
+	if scenario.UserId == "" || scenario.BaseMonth == "" {
+		http.Error(w, "Missing required fields", http.StatusBadRequest)
+		return
+	}
+	if _, err := parseMonth(scenario.BaseMonth); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can change the workspace
+	if !requireRole(w, r, scenario.UserId, RoleEditor) {
+		return
+	}
+
+	// Copy the base month's income and budget
+	if scenario.Lines == nil {
+		incomeItems, err := GetAllIncome(scenario.UserId, scenario.BaseMonth)
+		if err != nil {
+			http.Error(w, "Failed to get income items: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		budgetItems, err := GetAllBudget(scenario.UserId, scenario.BaseMonth)
+		if err != nil {
+			http.Error(w, "Failed to get budget items: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		scenario = NewScenario(scenario.UserId, scenario.ScenarioName, scenario.BaseMonth, incomeItems, budgetItems)
+	} else {
+		scenario.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+	}
+	if err := ValidateScenario(&scenario); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Add the scenario to the database
+	scenario.ScenarioId = uuid.New().String()
+	err = AddScenario(scenario)
+	if err != nil {
+		http.Error(w, "Failed to add scenario: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the created scenario
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(scenario)
+}
+
+func GetAllScenariosHandler(w http.ResponseWriter, r *http.Request) {
+	// Get userId from query parameters
+	userId := r.URL.Query().Get("userId")
+
+	// Validate the input
+	if userId == "" {
+		http.Error(w, "Missing required query parameter: userId", http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can read the workspace
+	if !requireRole(w, r, userId, RoleViewer) {
+		return
+	}
+
+	// Get the scenarios from the database
+	scenarios, err := GetAllScenarios(userId)
+	if err != nil {
+		http.Error(w, "Failed to get scenarios: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the scenarios
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(scenarios)
+}
+
+func GetScenarioHandler(w http.ResponseWriter, r *http.Request) {
+	// Get userId and scenarioId from URL parameters
+	vars := mux.Vars(r)
+	userId := vars["userId"]
+	scenarioId := vars["scenarioId"]
+
+	// Validate the input
+	if userId == "" || scenarioId == "" {
+		http.Error(w, "Missing required parameters: userId and scenarioId", http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can read the workspace
+	if !requireRole(w, r, userId, RoleViewer) {
+		return
+	}
+
+	// Get the scenario from the database
+	scenario, err := GetScenario(userId, scenarioId)
+	if err != nil {
+		http.Error(w, "Failed to get scenario: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if scenario == nil {
+		http.Error(w, "Scenario not found", http.StatusNotFound)
+		return
+	}
+
+	// Return the scenario
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(scenario)
+}
+
+func UpdateScenarioHandler(w http.ResponseWriter, r *http.Request) {
+	// Get userId and scenarioId from URL parameters
+	vars := mux.Vars(r)
+	userId := vars["userId"]
+	scenarioId := vars["scenarioId"]
+
+	// Validate the input
+	if userId == "" || scenarioId == "" {
+		http.Error(w, "Missing required parameters: userId and scenarioId", http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can change the workspace
+	if !requireRole(w, r, userId, RoleEditor) {
+		return
+	}
+
+	// Parse the request body to get the new name and lines
+	var requestBody struct {
+		ScenarioName string         `json:"scenarioName"`
+		Lines        []ScenarioLine `json:"lines"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&requestBody)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Get the scenario from the database
+	scenario, err := GetScenario(userId, scenarioId)
+	if err != nil {
+		http.Error(w, "Failed to get scenario: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if scenario == nil {
+		http.Error(w, "Scenario not found", http.StatusNotFound)
+		return
+	}
+
+	// Apply the changes; a missing name or list of lines is left as it was
+	if requestBody.ScenarioName != "" {
+		scenario.ScenarioName = requestBody.ScenarioName
+	}
+	if requestBody.Lines != nil {
+		scenario.Lines = requestBody.Lines
+	}
+	if err := ValidateScenario(scenario); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Update the scenario in the database
+	err = AddScenario(*scenario)
+	if err != nil {
+		http.Error(w, "Failed to update scenario: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the updated scenario
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(scenario)
+}
+
+func DeleteScenarioHandler(w http.ResponseWriter, r *http.Request) {
+	// Get userId and scenarioId from URL parameters
+	vars := mux.Vars(r)
+	userId := vars["userId"]
+	scenarioId := vars["scenarioId"]
+
+	// Validate the input
+	if userId == "" || scenarioId == "" {
+		http.Error(w, "Missing required parameters: userId and scenarioId", http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can change the workspace
+	if !requireRole(w, r, userId, RoleEditor) {
+		return
+	}
+
+	// Delete the scenario from the database
+	err := DeleteScenario(userId, scenarioId)
+	if err != nil {
+		http.Error(w, "Failed to delete scenario: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return success response
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Scenario deleted successfully",
+	})
+}
+
+func CompareScenariosHandler(w http.ResponseWriter, r *http.Request) {
+	// Get userId, the scenarios to compare and the horizon from query
+	// parameters. Without scenarioIds every scenario is compared, from the
+	// current month over twelve months.
+	query := r.URL.Query()
+	userId := query.Get("userId")
+	startMonth := query.Get("start")
+	if startMonth == "" {
+		startMonth = time.Now().UTC().Format(monthLayout)
+	}
+	months := scenarioHorizon
+
+	// Validate the input
+	if userId == "" {
+		http.Error(w, "Missing required query parameter: userId", http.StatusBadRequest)
+		return
+	}
+	if _, err := parseMonth(startMonth); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if value := query.Get("months"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > 60 {
+			http.Error(w, "Invalid months, expected a number from 1 to 60", http.StatusBadRequest)
+			return
+		}
+		months = parsed
+	}
+
+	// Check the caller can read the workspace
+	if !requireRole(w, r, userId, RoleViewer) {
+		return
+	}
+
+	// Get the scenarios in the order they were asked for
+	all, err := GetAllScenarios(userId)
+	if err != nil {
+		http.Error(w, "Failed to get scenarios: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	scenarios := all
+	if ids := query.Get("scenarioIds"); ids != "" {
+		scenarios = nil
+		for _, id := range strings.Split(ids, ",") {
+			found := false
+			for _, scenario := range all {
+				if scenario.ScenarioId == strings.TrimSpace(id) {
+					scenarios = append(scenarios, scenario)
+					found = true
+				}
+			}
+			if !found {
+				http.Error(w, "Scenario not found: "+id, http.StatusNotFound)
+				return
+			}
+		}
+	}
+
+	// Get the base currency and exchange rates
+	settings, err := GetUserSettings(userId)
+	if err != nil {
+		http.Error(w, "Failed to get settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rates, err := GetAllExchangeRates(userId)
+	if err != nil {
+		http.Error(w, "Failed to get exchange rates: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Project the scenarios side by side
+	comparison, err := CompareScenarios(scenarios, startMonth, months, settings.BaseCurrency, NewRateTable(rates), time.Now().UTC())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Return the comparison
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(comparison)
+}
+
+// Alert handlers
+func AddAlertRuleHandler(w http.ResponseWriter, r *http.Request) {
+	// Parse the request body
+	var rule AlertRule
+	err := json.NewDecoder(r.Body).Decode(&rule)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Validate the input
+	if rule.UserId == "" {
+		http.Error(w, "Missing required fields", http.StatusBadRequest)
+		return
+	}
+	if err := ValidateAlertRule(&rule); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can change the workspace
+	if !requireRole(w, r, rule.UserId, RoleEditor) {
+		return
+	}
+
+	// Add the alert rule to the database
+	rule.RuleId = uuid.New().String()
+	err = AddAlertRule(rule)
+	if err != nil {
+		http.Error(w, "Failed to add alert rule: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the created alert rule
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(rule)
+}
+
+func GetAllAlertRulesHandler(w http.ResponseWriter, r *http.Request) {
+	// Get userId from query parameters
+	userId := r.URL.Query().Get("userId")
+
+	// Validate the input
+	if userId == "" {
+		http.Error(w, "Missing required query parameter: userId", http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can read the workspace
+	if !requireRole(w, r, userId, RoleViewer) {
+		return
+	}
+
+	// Get the alert rules from the database
+	rules, err := GetAllAlertRules(userId)
+	if err != nil {
+		http.Error(w, "Failed to get alert rules: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the alert rules
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rules)
+}
+
+func UpdateAlertRuleHandler(w http.ResponseWriter, r *http.Request) {
+	// Get userId and ruleId from URL parameters
+	vars := mux.Vars(r)
+	userId := vars["userId"]
+	ruleId := vars["ruleId"]
+
+	// Validate the input
+	if userId == "" || ruleId == "" {
+		http.Error(w, "Missing required parameters: userId and ruleId", http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can change the workspace
+	if !requireRole(w, r, userId, RoleEditor) {
+		return
+	}
+
+	// Parse the request body to get the new alert rule details
+	var rule AlertRule
+	err := json.NewDecoder(r.Body).Decode(&rule)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	rule.UserId = userId
+	rule.RuleId = ruleId
+	if err := ValidateAlertRule(&rule); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Make sure the alert rule exists before replacing it
+	existing, err := GetAlertRule(userId, ruleId)
+	if err != nil {
+		http.Error(w, "Failed to get alert rule: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if existing == nil {
+		http.Error(w, "Alert rule not found", http.StatusNotFound)
+		return
+	}
+
+	// Update the alert rule in the database
+	err = AddAlertRule(rule)
+	if err != nil {
+		http.Error(w, "Failed to update alert rule: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return success response
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Alert rule updated successfully",
+	})
+}
+
+func DeleteAlertRuleHandler(w http.ResponseWriter, r *http.Request) {
+	// Get userId and ruleId from URL parameters
+	vars := mux.Vars(r)
+	userId := vars["userId"]
+	ruleId := vars["ruleId"]
+
+	// Validate the input
+	if userId == "" || ruleId == "" {
+		http.Error(w, "Missing required parameters: userId and ruleId", http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can change the workspace
+	if !requireRole(w, r, userId, RoleEditor) {
+		return
+	}
+
+	// Delete the alert rule from the database
+	err := DeleteAlertRule(userId, ruleId)
+	if err != nil {
+		http.Error(w, "Failed to delete alert rule: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return success response
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Alert rule deleted successfully",
+	})
+}
+
+func EvaluateAlertsHandler(w http.ResponseWriter, r *http.Request) {
+	// Get userId and month from query parameters
+	userId := r.URL.Query().Get("userId")
+	month := r.URL.Query().Get("month")
+
+	// Validate the input
+	if userId == "" {
+		http.Error(w, "Missing required query parameter: userId", http.StatusBadRequest)
+		return
+	}
+	if month == "" {
+		month = time.Now().UTC().Format(monthLayout)
+	}
+	if _, err := parseMonth(month); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can change the workspace
+	if !requireRole(w, r, userId, RoleEditor) {
+		return
+	}
+
+	// Check the alert rules against the month
+	notifications, err := EvaluateAlerts(userId, month, time.Now().UTC())
+	if err != nil {
+		http.Error(w, "Failed to evaluate alerts: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the notifications that were raised
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(notifications)
+}
+
+// Notification handlers
+func GetNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	// Get userId from query parameters
+	userId := r.URL.Query().Get("userId")
+	unreadOnly := r.URL.Query().Get("unread") == "true"
+
+	// Validate the input
+	if userId == "" {
+		http.Error(w, "Missing required query parameter: userId", http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can read the workspace
+	if !requireRole(w, r, userId, RoleViewer) {
+		return
+	}
+
+	// Get the notifications from the database
+	all, err := GetAllNotifications(userId)
+	if err != nil {
+		http.Error(w, "Failed to get notifications: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Newest first, optionally only the unread ones
+	notifications := []Notification{}
+	unread := 0
+	for _, notification := range all {
+		if !notification.Read {
+			unread++
+		} else if unreadOnly {
+			continue
+		}
+		notifications = append(notifications, notification)
+	}
+	sort.Slice(notifications, func(i, j int) bool { return notifications[i].CreatedAt > notifications[j].CreatedAt })
+
+	// Return the notifications
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"unread":        unread,
+		"notifications": notifications,
+	})
+}
+
+func MarkNotificationReadHandler(w http.ResponseWriter, r *http.Request) {
+	// Get userId and notificationId from URL parameters
+	vars := mux.Vars(r)
+	userId := vars["userId"]
+	notificationId := vars["notificationId"]
+
+	// Validate the input
+	if userId == "" || notificationId == "" {
+		http.Error(w, "Missing required parameters: userId and notificationId", http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can read the workspace
+	if !requireRole(w, r, userId, RoleViewer) {
+		return
+	}
+
+	// Get the notification from the database
+	notification, err := GetNotification(userId, notificationId)
+	if err != nil {
+		http.Error(w, "Failed to get notification: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if notification == nil {
+		http.Error(w, "Notification not found", http.StatusNotFound)
+		return
+	}
+
+	// Mark the notification as read
+	notification.Read = true
+	err = AddNotification(*notification)
+	if err != nil {
+		http.Error(w, "Failed to update notification: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return success response
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Notification marked as read",
+	})
+}
+
+func DeleteNotificationHandler(w http.ResponseWriter, r *http.Request) {
+	// Get userId and notificationId from URL parameters
+	vars := mux.Vars(r)
+	userId := vars["userId"]
+	notificationId := vars["notificationId"]
+
+	// Validate the input
+	if userId == "" || notificationId == "" {
+		http.Error(w, "Missing required parameters: userId and notificationId", http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can read the workspace
+	if !requireRole(w, r, userId, RoleViewer) {
+		return
+	}
+
+	// Delete the notification from the database
+	err := DeleteNotification(userId, notificationId)
+	if err != nil {
+		http.Error(w, "Failed to delete notification: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return success response
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Notification deleted successfully",
+	})
+}
+
+// Email handlers
+func GetEmailSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
+	// Get userId from query parameters
+	userId := r.URL.Query().Get("userId")
+
+	// Validate the input
+	if userId == "" {
+		http.Error(w, "Missing required query parameter: userId", http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can read the workspace
+	if !requireRole(w, r, userId, RoleViewer) {
+		return
+	}
+	caller, _ := CallerFromRequest(r)
+
+	// Get the caller's subscription, which is empty until they opt in
+	subscription, err := GetEmailSubscription(userId, caller.UserId)
+	if err != nil {
+		http.Error(w, "Failed to get email subscription: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if subscription == nil {
+		subscription = &EmailSubscription{UserId: userId, SubscriberId: caller.UserId}
+		if caller.EmailVerified {
+			subscription.Email = caller.Email
+		}
+	}
+	subscription.UnsubscribeToken, subscription.ConfirmToken = "", ""
+
+	// Return the subscription
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(subscription)
+}
+
+func PutEmailSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
+	// Parse the request body
+	var subscription EmailSubscription
+	err := json.NewDecoder(r.Body).Decode(&subscription)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Validate the input
+	if subscription.UserId == "" {
+		http.Error(w, "Missing required fields", http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can read the workspace
+	if !requireRole(w, r, subscription.UserId, RoleViewer) {
+		return
+	}
+
+	// Members subscribe themselves, at their own address unless they give
+	// another one
+	caller, _ := CallerFromRequest(r)
+	subscription.SubscriberId = caller.UserId
+	if subscription.Email == "" {
+		subscription.Email = caller.Email
+	}
+	address, err := mail.ParseAddress(subscription.Email)
+	if err != nil {
+		http.Error(w, "Invalid email address", http.StatusBadRequest)
+		return
+	}
+
+	// Keep the unsubscribe links, sent digests and confirmed address of an
+	// existing subscription
+	existing, err := GetEmailSubscription(subscription.UserId, subscription.SubscriberId)
+	if err != nil {
+		http.Error(w, "Failed to get email subscription: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	subscription.Email, subscription.PendingEmail, subscription.ConfirmToken = "", "", ""
+	subscription.UnsubscribeToken = randomHex(16)
+	subscription.LastWeekly, subscription.LastMonthly = "", ""
+	if existing != nil {
+		subscription.Email = existing.Email
+		subscription.UnsubscribeToken = existing.UnsubscribeToken
+		subscription.LastWeekly, subscription.LastMonthly = existing.LastWeekly, existing.LastMonthly
+	}
+
+	// Only the caller's verified address is used straight away. Any other
+	// must be confirmed from a link sent to it, so that members cannot
+	// send the workspace's emails to someone else.
+	confirm := false
+	switch {
+	case caller.EmailVerified && strings.EqualFold(address.Address, caller.Email):
+		subscription.Email = address.Address
+	case !strings.EqualFold(address.Address, subscription.Email):
+		subscription.PendingEmail = address.Address
+		subscription.ConfirmToken = randomHex(16)
+		confirm = true
+	}
+
+	// Save the subscription to the database
+	err = AddEmailSubscription(subscription)
+	if err != nil {
+		http.Error(w, "Failed to save email subscription: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Ask for the new address to be confirmed
+	if confirm {
+		email, err := renderConfirmEmail(subscription)
+		if err == nil {
+			err = SMTPSenderFromEnv().Send(email)
+		}
+		if err != nil {
+			http.Error(w, "Failed to send confirmation email: "+err.Error(), http.StatusBadGateway)
+			return
+		}
+	}
+
+	// Return the saved subscription
+	subscription.UnsubscribeToken, subscription.ConfirmToken = "", ""
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(subscription)
+}
+
+func ConfirmEmailSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
+	// Find the subscription the token was made for
+	subscription, err := subscriptionForConfirmToken(r.URL.Query().Get("token"))
+	if err != nil {
+		http.Error(w, "Failed to get email subscription: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if subscription == nil {
+		http.Error(w, "Invalid or expired confirmation link", http.StatusNotFound)
+		return
+	}
+
+	// Send the emails to the confirmed address from now on
+	subscription.Email = subscription.PendingEmail
+	subscription.PendingEmail, subscription.ConfirmToken = "", ""
+	err = AddEmailSubscription(*subscription)
+	if err != nil {
+		http.Error(w, "Failed to update email subscription: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return a page for the browser
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintf(w, "%s is confirmed and will get the emails you chose about this budget.\n", subscription.Email)
+}
+
+func GetDigestPreviewHandler(w http.ResponseWriter, r *http.Request) {
+	// Get userId, period and format from query parameters
+	userId := r.URL.Query().Get("userId")
+	period := r.URL.Query().Get("period")
+	format := r.URL.Query().Get("format")
+
+	// Validate the input
+	if userId == "" {
+		http.Error(w, "Missing required query parameter: userId", http.StatusBadRequest)
+		return
+	}
+	if period == "" {
+		period = DigestWeekly
+	}
+	if format != "" && format != "json" && format != "text" && format != "html" {
+		http.Error(w, "Invalid format, expected json, text or html", http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller can read the workspace
+	if !requireRole(w, r, userId, RoleViewer) {
+		return
+	}
+
+	// Build the digest the next run would send
+	digest, err := LoadDigest(userId, period, time.Now().UTC())
+	if err != nil {
+		http.Error(w, "Failed to build digest: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if format == "" || format == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(digest)
+		return
+	}
+
+	// Render it as the email would be
+	email, err := RenderDigest(*digest, publicURL()+"/api/unsubscribe")
+	if err != nil {
+		http.Error(w, "Failed to render digest: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if format == "html" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(email.HTML))
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(email.Text))
+}
+
+func UnsubscribeHandler(w http.ResponseWriter, r *http.Request) {
+	// Get the token and list from query parameters, or from the form of the
+	// confirmation page
+	token := r.FormValue("token")
+	list := r.FormValue("list")
+	if list == "" {
+		list = "all"
+	}
+
+	// Find the subscription the token was made for
+	subscription, err := subscriptionForToken(token)
+	if err != nil {
+		http.Error(w, "Failed to get email subscription: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if subscription == nil {
+		http.Error(w, "Invalid or expired unsubscribe link", http.StatusNotFound)
+		return
+	}
+
+	// Turn the list off
+	if err := Unsubscribe(subscription, list); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Opening the link only asks; unsubscribing takes a POST, from the page
+	// or from a mail client's one-click unsubscribe (RFC 8058)
+	if r.Method != http.MethodPost {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		unsubscribePage.Execute(w, struct {
+			Token string
+			List  string
+			Email string
+		}{token, list, subscription.Email})
+		return
+	}
+
+	err = AddEmailSubscription(*subscription)
+	if err != nil {
+		http.Error(w, "Failed to update email subscription: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return a page for the browser
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if list == "all" {
+		fmt.Fprintf(w, "%s will no longer get emails about this budget.\n", subscription.Email)
+		return
+	}
+	fmt.Fprintf(w, "%s will no longer get %s emails about this budget.\n", subscription.Email, list)
+}
+
+// Webhook handlers
+func AddWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	// Parse the request body
+	var webhook Webhook
+	err := json.NewDecoder(r.Body).Decode(&webhook)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Validate the input
+	if webhook.UserId == "" {
+		http.Error(w, "Missing required fields", http.StatusBadRequest)
+		return
+	}
+	if err := ValidateWebhook(&webhook); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Webhooks send the workspace's data elsewhere, so only owners manage
+	// them
+	if !requireRole(w, r, webhook.UserId, RoleOwner) {
+		return
+	}
+
+	// Add the webhook to the database with a new signing secret
+	webhook.WebhookId = uuid.New().String()
+	webhook.Secret = "whsec_" + randomHex(24)
+	webhook.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+	err = AddWebhook(webhook)
+	if err != nil {
+		http.Error(w, "Failed to add webhook: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the created webhook, the only time its secret is shown
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(webhook)
+}
+
+func GetAllWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	// Get userId from query parameters
+	userId := r.URL.Query().Get("userId")
+
+	// Validate the input
+	if userId == "" {
+		http.Error(w, "Missing required query parameter: userId", http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller owns the workspace
+	if !requireRole(w, r, userId, RoleOwner) {
+		return
+	}
+
+	// Get the webhooks from the database
+	webhooks, err := GetAllWebhooks(userId)
+	if err != nil {
+		http.Error(w, "Failed to get webhooks: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for i := range webhooks {
+		webhooks[i].Secret = ""
+	}
+
+	// Return the webhooks
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(webhooks)
+}
+
+func UpdateWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	// Get userId and webhookId from URL parameters
+	vars := mux.Vars(r)
+	userId := vars["userId"]
+	webhookId := vars["webhookId"]
+
+	// Validate the input
+	if userId == "" || webhookId == "" {
+		http.Error(w, "Missing required parameters: userId and webhookId", http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller owns the workspace
+	if !requireRole(w, r, userId, RoleOwner) {
+		return
+	}
+
+	// Parse the request body to get the new webhook details
+	var webhook Webhook
+	err := json.NewDecoder(r.Body).Decode(&webhook)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := ValidateWebhook(&webhook); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Make sure the webhook exists, and keep its secret
+	existing, err := GetWebhook(userId, webhookId)
+	if err != nil {
+		http.Error(w, "Failed to get webhook: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if existing == nil {
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return
+	}
+	webhook.UserId = userId
+	webhook.WebhookId = webhookId
+	webhook.Secret = existing.Secret
+	webhook.CreatedAt = existing.CreatedAt
+
+	// Update the webhook in the database
+	err = AddWebhook(webhook)
+	if err != nil {
+		http.Error(w, "Failed to update webhook: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return success response
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Webhook updated successfully",
+	})
+}
+
+func DeleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	// Get userId and webhookId from URL parameters
+	vars := mux.Vars(r)
+	userId := vars["userId"]
+	webhookId := vars["webhookId"]
+
+	// Validate the input
+	if userId == "" || webhookId == "" {
+		http.Error(w, "Missing required parameters: userId and webhookId", http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller owns the workspace
+	if !requireRole(w, r, userId, RoleOwner) {
+		return
+	}
+
+	// Delete the webhook from the database
+	err := DeleteWebhook(userId, webhookId)
+	if err != nil {
+		http.Error(w, "Failed to delete webhook: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return success response
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Webhook deleted successfully",
+	})
+}
+
+func GetWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	// Get userId and webhookId from URL parameters
+	vars := mux.Vars(r)
+	userId := vars["userId"]
+	webhookId := vars["webhookId"]
+
+	// Validate the input
+	if userId == "" || webhookId == "" {
+		http.Error(w, "Missing required parameters: userId and webhookId", http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller owns the workspace
+	if !requireRole(w, r, userId, RoleOwner) {
+		return
+	}
+
+	// Get the delivery log from the database, newest first
+	deliveries, err := GetWebhookDeliveries(userId, webhookId)
+	if err != nil {
+		http.Error(w, "Failed to get webhook deliveries: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sort.Slice(deliveries, func(i, j int) bool { return deliveries[i].CreatedAt > deliveries[j].CreatedAt })
+
+	// Return the deliveries
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deliveries)
+}
+
+func RedeliverWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	// Get userId, webhookId and deliveryId from URL parameters
+	vars := mux.Vars(r)
+	userId := vars["userId"]
+	webhookId := vars["webhookId"]
+	deliveryId := vars["deliveryId"]
+
+	// Validate the input
+	if userId == "" || webhookId == "" || deliveryId == "" {
+		http.Error(w, "Missing required parameters: userId, webhookId and deliveryId", http.StatusBadRequest)
+		return
+	}
+
+	// Check the caller owns the workspace
+	if !requireRole(w, r, userId, RoleOwner) {
+		return
+	}
+
+	// Get the webhook and the delivery to send again
+	webhook, err := GetWebhook(userId, webhookId)
+	if err != nil {
+		http.Error(w, "Failed to get webhook: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if webhook == nil {
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return
+	}
+	delivery, err := GetWebhookDelivery(userId, deliveryId)
+	if err != nil {
+		http.Error(w, "Failed to get webhook delivery: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if delivery == nil || delivery.WebhookId != webhookId {
+		http.Error(w, "Webhook delivery not found", http.StatusNotFound)
+		return
+	}
+
+	// Send it again in the background
+	redelivery, err := RedeliverWebhook(*webhook, *delivery)
+	if err != nil {
+		http.Error(w, "Failed to redeliver webhook: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the new delivery, which is logged like any other
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(redelivery)
+}
+
+// Event stream handlers
+// StreamEventsHandler pushes the changes to a workspace's income, budget and
+// expenses as server-sent events until the client disconnects. A client
+// that reconnects with the Last-Event-ID header, or the lastEventId query
+// parameter, first gets the events it missed, going back as far as
+// eventRetention; from further back it is sent a reset event instead, and
+// should fetch the workspace's data again. The stream is closed once the
+// caller is no longer a member of the workspace or their token expires.
+func StreamEventsHandler(w http.ResponseWriter, r *http.Request) {
+	// Get userId and the last event seen from the request
+	userId := r.URL.Query().Get("userId")
+	lastEventId := r.Header.Get("Last-Event-ID")
+	if lastEventId == "" {
+		lastEventId = r.URL.Query().Get("lastEventId")
+	}
+
+	// Validate the input
+	if userId == "" {
+		http.Error(w, "Missing required query parameter: userId", http.StatusBadRequest)
+		return
+	}
+	if lastEventId != "" {
+		if _, err := uuid.Parse(lastEventId); err != nil {
+			http.Error(w, "Invalid last event id", http.StatusBadRequest)
+			return
+		}
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	// Check the caller can read the workspace
+	if !requireRole(w, r, userId, RoleViewer) {
+		return
+	}
+
+	// Subscribe before looking up missed events, so none are lost in
+	// between
+	stream := streamHub.subscribe(userId)
+	defer streamHub.unsubscribe(userId, stream)
+
+	// Look up the events missed since the last one seen. A new stream, or
+	// one resuming from further back than the events kept, starts from now
+	reset := lastEventId != "" && streamNeedsReset(lastEventId, time.Now())
+	resumeFrom := lastEventId
+	var missed []Event
+	if lastEventId == "" || reset {
+		resumeFrom = eventCursor(time.Now())
+	} else {
+		var err error
+		missed, err = GetEventsAfter(userId, lastEventId)
+		if err != nil {
+			http.Error(w, "Failed to get events: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", 3000)
+
+	if reset {
+		if err := writeStreamEvent(w, resetEvent(userId, lastEventId, time.Now())); err != nil {
+			return
+		}
+	}
+
+	// Events reach the stream both from this server and from the events
+	// table, so the ones sent are remembered until the table is no longer
+	// looked at that far back
+	sent := make(map[string]bool)
+	send := func(event Event) error {
+		if event.EventId <= resumeFrom || sent[event.EventId] {
+			return nil
+		}
+		sent[event.EventId] = true
+		return writeStreamEvent(w, event)
+	}
+	for _, event := range missed {
+		if err := send(event); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	// The caller's membership is checked again while the stream is open,
+	// and the stream ends when their token expires
+	caller, _ := CallerFromRequest(r)
+	lifetime := time.NewTimer(time.Until(streamDeadline(caller, time.Now())))
+	defer lifetime.Stop()
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+	poll := time.NewTicker(streamPollInterval)
+	defer poll.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-lifetime.C:
+			return
+		case event, ok := <-stream:
+			if !ok {
+				return
+			}
+			if err := send(event); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-poll.C:
+			role, err := WorkspaceRole(caller.UserId, userId)
+			if err != nil {
+				log.Printf("Checking workspace membership of %s failed: %v", caller.UserId, err)
+				continue
+			}
+			if role == "" {
+				return
+			}
+
+			// Events published by other servers only reach the stream
+			// through the events table
+			from := eventCursor(time.Now().Add(-streamPollLag))
+			if from < resumeFrom {
+				from = resumeFrom
+			}
+			events, err := GetEventsAfter(userId, from)
+			if err != nil {
+				log.Printf("Getting events for %s failed: %v", userId, err)
+				continue
+			}
+			for _, event := range events {
+				if err := send(event); err != nil {
+					return
+				}
+			}
+			for eventId := range sent {
+				if eventId <= from {
+					delete(sent, eventId)
+				}
+			}
+			flusher.Flush()
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
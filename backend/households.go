@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Household roles, from least to most privileged. Viewers can read the
+// household's data, editors can also change it, and owners can also manage
+// its members and invitations.
+const (
+	RoleViewer = "viewer"
+	RoleEditor = "editor"
+	RoleOwner  = "owner"
+)
+
+var roleRanks = map[string]int{
+	RoleViewer: 1,
+	RoleEditor: 2,
+	RoleOwner:  3,
+}
+
+// householdIdPrefix marks workspace ids that belong to a household rather
+// than to a single user.
+const householdIdPrefix = "household-"
+
+func isHouseholdId(workspaceId string) bool {
+	return strings.HasPrefix(workspaceId, householdIdPrefix)
+}
+
+// WorkspaceRole returns the role a user has in a workspace: owner of their
+// own personal workspace, their member role in a household, or "" if they
+// have no access.
+func WorkspaceRole(userId string, workspaceId string) (string, error) {
+	if workspaceId == userId {
+		return RoleOwner, nil
+	}
+	if !isHouseholdId(workspaceId) {
+		return "", nil
+	}
+
+	member, err := GetHouseholdMember(workspaceId, userId)
+	if err != nil {
+		return "", err
+	}
+	if member == nil {
+		return "", nil
+	}
+	return member.Role, nil
+}
+
+// requireRole checks that the caller has at least the given role in the
+// workspace whose id the request uses as its userId. If not, it writes the
+// error response and returns false. The userId in a request only names the
+// workspace; who is making the request comes from AuthMiddleware.
+func requireRole(w http.ResponseWriter, r *http.Request, workspaceId string, role string) bool {
+	caller, ok := CallerFromRequest(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+
+	callerRole, err := WorkspaceRole(caller.UserId, workspaceId)
+	if err != nil {
+		http.Error(w, "Failed to check workspace membership: "+err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	if callerRole == "" {
+		http.Error(w, "Forbidden: not a member of this workspace", http.StatusForbidden)
+		return false
+	}
+	if roleRanks[callerRole] < roleRanks[role] {
+		http.Error(w, fmt.Sprintf("Forbidden: requires the %s role", role), http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// ValidateRole checks a role given when inviting or updating a member.
+func ValidateRole(role string) error {
+	if _, ok := roleRanks[role]; !ok {
+		return fmt.Errorf("invalid role %q, expected owner, editor or viewer", role)
+	}
+	return nil
+}
+
+// normalizeInvitee lower-cases a username or email so invitations match
+// however the address was typed.
+func normalizeInvitee(invitee string) string {
+	return strings.ToLower(strings.TrimSpace(invitee))
+}
+
+// invitationMatches reports whether an invitation is addressed to the caller,
+// by username or, once the caller's email is verified, by email.
+func invitationMatches(invitation HouseholdInvitation, caller Caller) bool {
+	for _, invitee := range callerInvitees(caller) {
+		if invitation.Invitee == invitee {
+			return true
+		}
+	}
+	return false
+}
+
+// callerInvitees returns the invitee values invitations to the caller are
+// stored under: the username, and the email when it is verified.
+func callerInvitees(caller Caller) []string {
+	invitees := []string{normalizeInvitee(caller.UserName)}
+	if caller.Email != "" && caller.EmailVerified {
+		invitees = append(invitees, normalizeInvitee(caller.Email))
+	}
+	return invitees
+}
+
+// countOwners returns how many members of a household are owners, so the
+// last owner cannot leave or be demoted.
+func countOwners(members []HouseholdMember) int {
+	owners := 0
+	for _, member := range members {
+		if member.Role == RoleOwner {
+			owners++
+		}
+	}
+	return owners
+}
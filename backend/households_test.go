@@ -0,0 +1,34 @@
+package main
+
+import "testing"
+
+func TestInvitationMatches(t *testing.T) {
+	tests := []struct {
+		name    string
+		invitee string
+		caller  Caller
+		want    bool
+	}{
+		{"username", "alex", Caller{UserName: "Alex"}, true},
+		{"verified email", "alex@example.com", Caller{UserName: "alex", Email: "Alex@Example.com", EmailVerified: true}, true},
+		{"unverified email", "alex@example.com", Caller{UserName: "mallory", Email: "alex@example.com"}, false},
+		{"no match", "sam@example.com", Caller{UserName: "alex", Email: "alex@example.com", EmailVerified: true}, false},
+	}
+	for _, test := range tests {
+		got := invitationMatches(HouseholdInvitation{Invitee: test.invitee}, test.caller)
+		if got != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestWorkspaceRoleForPersonalWorkspaces(t *testing.T) {
+	role, err := WorkspaceRole("user-1", "user-1")
+	if err != nil || role != RoleOwner {
+		t.Errorf("own workspace: got %q, %v", role, err)
+	}
+	role, err = WorkspaceRole("user-1", "user-2")
+	if err != nil || role != "" {
+		t.Errorf("another user's workspace: got %q, %v", role, err)
+	}
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// StatementParser turns a bank statement file into normalized transactions.
+type StatementParser func(r io.Reader) ([]StatementTransaction, error)
+
+// statementParsers maps the format names accepted by the import endpoint to
+// their parsers.
+var statementParsers = map[string]StatementParser{
+	"ofx":     ParseOFX,
+	"qfx":     ParseOFX,
+	"qif":     ParseQIF,
+	"camt":    ParseCAMT053,
+	"camt053": ParseCAMT053,
+	"mt940":   ParseMT940,
+}
+
+// LookupStatementParser returns the parser registered for a format name.
+func LookupStatementParser(format string) (StatementParser, error) {
+	parse, ok := statementParsers[strings.ToLower(format)]
+	if !ok {
+		return nil, fmt.Errorf("unsupported statement format: %s", format)
+	}
+	return parse, nil
+}
+
+// ImportTransactions stores statement transactions as expense items (debits)
+// and income items (credits), booked against accountId when one is given.
+// Amounts are recorded in currency, or in the base currency when it is empty.
+// Items are keyed by the transaction id, and transactions that were imported
+// before are skipped, so importing the same statement again neither
+// duplicates them nor overwrites the tags and splits given to them since.
+// Transactions with a zero amount are ignored. New expenses are checked for
+// duplicates and scored for anomalies, and the additions are published and
+// the months' alert rules checked as for items added by hand.
+func ImportTransactions(userId string, accountId string, currency string, transactions []StatementTransaction) (*ImportResult, error) {
+	var expenses []ExpenseItem
+	var income []IncomeItem
+	counted := 0
+	skipped := 0
+
+	// The names already stored in each month, loaded as months come up
+	existingExpenses := make(map[string]map[string]bool)
+	existingIncome := make(map[string]map[string]bool)
+	exists := func(table string, sortKey string, loaded map[string]map[string]bool, month string, name string) (bool, error) {
+		names, ok := loaded[month]
+		if !ok {
+			var err error
+			names, err = GetItemNames(table, "userId#month", fmt.Sprintf("%s#%s", userId, month), sortKey)
+			if err != nil {
+				return false, err
+			}
+			loaded[month] = names
+		}
+		if names[name] {
+			return true, nil
+		}
+		// Remember the name so the same transaction twice in one file is
+		// only stored once
+		names[name] = true
+		return false, nil
+	}
+
+	for _, t := range transactions {
+		// Formats such as QIF do not always name the account, so key their
+		// transactions by the account they are booked against instead
+		if t.AccountId == "" {
+			t.AccountId = accountId
+		}
+		if t.Amount < 0 {
+			counted++
+			item := expenseFromTransaction(userId, t)
+			found, err := exists("Expenses", "expenseItemName", existingExpenses, item.Month, item.ExpenseItemName)
+			if err != nil {
+				return nil, err
+			}
+			if found {
+				skipped++
+				continue
+			}
+			item.AccountId = accountId
+			item.Currency = currency
+			expenses = append(expenses, item)
+		} else if t.Amount > 0 {
+			counted++
+			item := incomeFromTransaction(userId, t)
+			found, err := exists("Income", "incomeItemName", existingIncome, item.Month, item.IncomeItemName)
+			if err != nil {
+				return nil, err
+			}
+			if found {
+				skipped++
+				continue
+			}
+			item.AccountId = accountId
+			item.Currency = currency
+			income = append(income, item)
+		}
+	}
+
+	duplicates := []DuplicateMatch{}
+	anomalies := []ExpenseAnomaly{}
+	watches := make(map[string]*BudgetWatch)
+	if len(expenses) > 0 {
+		matches, err := FlagDuplicateExpenses(expenses)
+		if err != nil {
+			return nil, err
+		}
+		duplicates = append(duplicates, matches...)
+
+		anomalies, err = FlagAnomalousExpenses(expenses)
+		if err != nil {
+			return nil, err
+		}
+
+		// Note which budget items are already over budget in each month
+		for _, item := range expenses {
+			if watches[item.Month] == nil {
+				watches[item.Month] = WatchBudgets(userId, item.Month)
+			}
+		}
+
+		if err := AddExpenses(expenses); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, item := range income {
+		if err := AddIncome(item); err != nil {
+			return nil, err
+		}
+	}
+
+	// Check the alert rules of every month the items were added to, and
+	// publish the changes as adding them one at a time would
+	evaluated := make(map[string]bool)
+	for _, item := range expenses {
+		if !evaluated[item.Month] {
+			evaluated[item.Month] = true
+			NotifyAlerts(userId, item.Month)
+		}
+	}
+	for _, item := range income {
+		if !evaluated[item.Month] {
+			evaluated[item.Month] = true
+			NotifyAlerts(userId, item.Month)
+		}
+	}
+	for _, item := range expenses {
+		PublishEvent(userId, EventExpenseCreated, item.Month, item)
+	}
+	for _, item := range income {
+		PublishEvent(userId, EventIncomeCreated, item.Month, item)
+	}
+	for _, watch := range watches {
+		watch.PublishExceeded()
+	}
+
+	return &ImportResult{
+		Transactions:    counted,
+		ExpensesAdded:   len(expenses),
+		IncomeAdded:     len(income),
+		AlreadyImported: skipped,
+		Duplicates:      duplicates,
+		Anomalies:       anomalies,
+	}, nil
+}
+
+// transactionKey builds the item name used as the sort key for an imported
+// transaction. Bank transaction ids are only unique within an account.
+func transactionKey(t StatementTransaction) string {
+	if t.AccountId == "" {
+		return t.TransactionId
+	}
+	return t.AccountId + "-" + t.TransactionId
+}
+
+func expenseFromTransaction(userId string, t StatementTransaction) ExpenseItem {
+	return ExpenseItem{
+		UserId:          userId,
+		ExpenseItemName: transactionKey(t),
+		Month:           t.Date.Format("2006-01"),
+		ExpenseValue:    -t.Amount,
+		ExpenseTags:     []string{},
+		Date:            t.Date.Format("2006-01-02"),
+		Merchant:        transactionDescription(t),
+	}
+}
+
+func incomeFromTransaction(userId string, t StatementTransaction) IncomeItem {
+	return IncomeItem{
+		UserId:          userId,
+		IncomeItemName:  transactionKey(t),
+		Month:           t.Date.Format("2006-01"),
+		IncomeItemValue: t.Amount,
+		Date:            t.Date.Format("2006-01-02"),
+		Payer:           transactionDescription(t),
+	}
+}
+
+func transactionDescription(t StatementTransaction) string {
+	if t.Payee != "" {
+		return t.Payee
+	}
+	return t.Memo
+}
+
+// assignSyntheticIds gives a stable id to transactions whose format does not
+// carry one. The id is derived from the transaction contents, with a counter
+// to tell apart identical lines within the same statement, so re-importing a
+// file produces the same ids.
+func assignSyntheticIds(prefix string, transactions []StatementTransaction) {
+	seen := make(map[string]int)
+	for i := range transactions {
+		t := &transactions[i]
+		if t.TransactionId != "" {
+			continue
+		}
+		content := fmt.Sprintf("%s|%s|%s|%s|%s", t.AccountId, t.Date.Format("2006-01-02"), t.Amount.StringFixed(2), t.Payee, t.Memo)
+		seen[content]++
+		sum := sha1.Sum([]byte(fmt.Sprintf("%s|%d", content, seen[content])))
+		t.TransactionId = prefix + "-" + hex.EncodeToString(sum[:8])
+	}
+}
+
+// parseStatementAmount parses an amount that may use a comma as the decimal
+// separator and may contain thousands separators. A comma is the decimal
+// separator when it is the last separator and is followed by at most two
+// digits, as in 12,50 or MT940's 150, so that 1,234 is read as a thousand.
+func parseStatementAmount(value string) (Money, error) {
+	value = strings.ReplaceAll(strings.TrimSpace(value), " ", "")
+	lastComma := strings.LastIndex(value, ",")
+	lastDot := strings.LastIndex(value, ".")
+	if lastComma > lastDot && len(value)-lastComma-1 <= 2 && strings.Count(value, ",") == 1 {
+		// 1.234,56 or 12,50
+		value = strings.ReplaceAll(value, ".", "")
+		value = strings.Replace(value, ",", ".", 1)
+	} else {
+		// 1,234.56 or 1,234
+		value = strings.ReplaceAll(value, ",", "")
+	}
+	return ParseMoney(value)
+}
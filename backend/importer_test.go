@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// checkStatementGolden parses a statement from testdata and compares the
+// transactions with the .golden.json file next to it. Run the tests with
+// -update to rewrite the golden files after an intended change.
+func checkStatementGolden(t *testing.T, parse StatementParser, name string) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	transactions, err := parse(file)
+	if err != nil {
+		t.Fatalf("parsing %s: %v", name, err)
+	}
+	got, err := json.MarshalIndent(transactions, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = append(got, '\n')
+
+	golden := path + ".golden.json"
+	if *updateGolden {
+		if err := os.WriteFile(golden, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("%s: transactions differ from %s\ngot:\n%s\nwant:\n%s", name, golden, got, want)
+	}
+}
+
+func TestParseOFX(t *testing.T) {
+	checkStatementGolden(t, ParseOFX, "statement.ofx")
+}
+
+// The 2.x statement is XML, holds a bank and a credit card statement, and
+// has a transfer naming the account it went to
+func TestParseOFXVersion2(t *testing.T) {
+	checkStatementGolden(t, ParseOFX, "statement-v2.ofx")
+}
+
+func TestParseOFXRejectsMissingFITID(t *testing.T) {
+	_, err := ParseOFX(strings.NewReader("<OFX><STMTTRN><DTPOSTED>20240105<TRNAMT>-1.00</STMTTRN></OFX>"))
+	if err == nil {
+		t.Fatal("expected an error for a transaction without FITID")
+	}
+}
+
+func TestParseStatementAmount(t *testing.T) {
+	tests := []struct {
+		value string
+		want  Money
+	}{
+		{"12.50", 125000},
+		{"-12.50", -125000},
+		{"12,50", 125000},
+		{"1,234.56", 12345600},
+		{"1.234,56", 12345600},
+		{"1 234,56", 12345600},
+		{"1,234", 12340000},
+		{"-1,234,567", -12345670000},
+		{"12,5", 125000},
+		{"150,", 1500000},
+		{"1.234.567,89", 12345678900},
+	}
+	for _, test := range tests {
+		got, err := parseStatementAmount(test.value)
+		if err != nil {
+			t.Errorf("parseStatementAmount(%q): %v", test.value, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("parseStatementAmount(%q) = %d, want %d", test.value, got, test.want)
+		}
+	}
+}
+
+func TestParseQIF(t *testing.T) {
+	checkStatementGolden(t, ParseQIF, "statement-us.qif")
+}
+
+func TestParseQIFDayFirst(t *testing.T) {
+	checkStatementGolden(t, ParseQIF, "statement-eu.qif")
+}
+
+func TestParseQIFDate(t *testing.T) {
+	tests := []struct {
+		value    string
+		dayFirst bool
+		want     string
+	}{
+		{"01/05/2024", false, "2024-01-05"},
+		{"01/05/2024", true, "2024-05-01"},
+		{"1/5'24", false, "2024-01-05"},
+		{"31.01.2024", true, "2024-01-31"},
+		{"2024-01-31", true, "2024-01-31"},
+		{"12/31/99", false, "1999-12-31"},
+	}
+	for _, test := range tests {
+		got, err := parseQIFDate(test.value, test.dayFirst)
+		if err != nil {
+			t.Errorf("parseQIFDate(%q, %v): %v", test.value, test.dayFirst, err)
+			continue
+		}
+		if got.Format("2006-01-02") != test.want {
+			t.Errorf("parseQIFDate(%q, %v) = %s, want %s", test.value, test.dayFirst, got.Format("2006-01-02"), test.want)
+		}
+	}
+
+	for _, value := range []string{"02/30/2024", "13/13/2024", "yesterday"} {
+		if _, err := parseQIFDate(value, false); err == nil {
+			t.Errorf("parseQIFDate(%q) did not fail", value)
+		}
+	}
+}
+
+func TestQIFDayFirst(t *testing.T) {
+	tests := []struct {
+		dates []string
+		want  bool
+	}{
+		{[]string{"01/05/2024", "01/31/2024"}, false},
+		{[]string{"01/05/2024", "31/01/2024"}, true},
+		{[]string{"01.05.2024"}, true},
+		{[]string{"01/05/2024"}, false},
+	}
+	for _, test := range tests {
+		got, err := qifDayFirst(test.dates)
+		if err != nil {
+			t.Errorf("qifDayFirst(%v): %v", test.dates, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("qifDayFirst(%v) = %v, want %v", test.dates, got, test.want)
+		}
+	}
+
+	if _, err := qifDayFirst([]string{"31/01/2024", "01/31/2024"}); err == nil {
+		t.Error("qifDayFirst accepted mixed date orders")
+	}
+}
+
+func TestQIFIdsDependOnAccount(t *testing.T) {
+	record := "!Type:Bank\nD01/05/2024\nT-1.00\nPShop\n^\n"
+	first, err := ParseQIF(strings.NewReader("!Account\nNChecking\n^\n" + record))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := ParseQIF(strings.NewReader("!Account\nNSavings\n^\n" + record))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if transactionKey(first[0]) == transactionKey(second[0]) {
+		t.Errorf("the same line in two accounts has the same key %s", transactionKey(first[0]))
+	}
+}
+
+func TestParseCAMT053(t *testing.T) {
+	checkStatementGolden(t, ParseCAMT053, "statement.camt053.xml")
+}
+
+func TestParseMT940(t *testing.T) {
+	checkStatementGolden(t, ParseMT940, "statement.mt940")
+}
@@ -0,0 +1,446 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Types of investment transaction.
+const (
+	InvestmentBuy      = "buy"
+	InvestmentSell     = "sell"
+	InvestmentDividend = "dividend"
+)
+
+// quantityEpsilon is how close two share quantities must be to count as
+// equal, so that selling a whole lot bought in fractions closes it.
+const quantityEpsilon = 1e-9
+
+// normalizeSymbol upper-cases a ticker symbol.
+func normalizeSymbol(symbol string) string {
+	return strings.ToUpper(strings.TrimSpace(symbol))
+}
+
+// ValidateInvestmentTransaction checks a transaction's fields and rounds its
+// amounts to the currency of the account it belongs to.
+func ValidateInvestmentTransaction(transaction *InvestmentTransaction, account Account) error {
+	if account.AccountType != "investment" {
+		return fmt.Errorf("account %s is not an investment account", account.AccountName)
+	}
+	transaction.Currency = account.Currency
+	transaction.Symbol = normalizeSymbol(transaction.Symbol)
+	if transaction.Symbol == "" {
+		return fmt.Errorf("symbol is required")
+	}
+	if _, err := time.Parse("2006-01-02", transaction.Date); err != nil {
+		return fmt.Errorf("invalid date, expected YYYY-MM-DD")
+	}
+	transaction.Fees = transaction.Fees.Round(transaction.Currency)
+	transaction.Amount = transaction.Amount.Round(transaction.Currency)
+	if transaction.Fees < 0 {
+		return fmt.Errorf("fees cannot be negative")
+	}
+
+	switch transaction.Type {
+	case InvestmentBuy, InvestmentSell:
+		if transaction.Quantity <= 0 {
+			return fmt.Errorf("quantity must be positive")
+		}
+		if transaction.Price < 0 {
+			return fmt.Errorf("price cannot be negative")
+		}
+		transaction.Amount = 0
+	case InvestmentDividend:
+		if transaction.Amount <= 0 {
+			return fmt.Errorf("amount must be positive")
+		}
+		transaction.Quantity = 0
+		transaction.Price = 0
+	default:
+		return fmt.Errorf("invalid type %q, expected buy, sell or dividend", transaction.Type)
+	}
+	return nil
+}
+
+// ValidateSecurityPrice checks a price and fills in its PriceId, which makes
+// a second import of the same symbol, date and currency replace the first.
+func ValidateSecurityPrice(price *SecurityPrice) error {
+	price.Symbol = normalizeSymbol(price.Symbol)
+	if price.Symbol == "" {
+		return fmt.Errorf("symbol is required")
+	}
+	if _, err := time.Parse("2006-01-02", price.Date); err != nil {
+		return fmt.Errorf("invalid price date %q, expected YYYY-MM-DD", price.Date)
+	}
+	if math.IsNaN(price.Price) || math.IsInf(price.Price, 0) {
+		return fmt.Errorf("price must be a number")
+	}
+	if price.Price < 0 {
+		return fmt.Errorf("price cannot be negative")
+	}
+	price.PriceId = fmt.Sprintf("%s#%s", price.Symbol, price.Date)
+	if price.Currency != "" {
+		currency, err := normalizeCurrency(price.Currency)
+		if err != nil {
+			return err
+		}
+		price.Currency = currency
+		price.PriceId += "#" + currency
+	}
+	return nil
+}
+
+// ParseSecurityPricesCSV reads prices from a CSV file with a header row
+// naming the symbol, date and price columns, in any order, and optionally a
+// currency column. A "close" column is accepted in place of "price", as
+// exported by most quote services.
+func ParseSecurityPricesCSV(r io.Reader) ([]SecurityPrice, error) {
+	rows, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read prices: %v", err)
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("price file is empty")
+	}
+
+	columns := make(map[string]int)
+	for i, name := range rows[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["price"]; !ok {
+		if i, ok := columns["close"]; ok {
+			columns["price"] = i
+		}
+	}
+	for _, name := range []string{"symbol", "date", "price"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("price file is missing the %s column", name)
+		}
+	}
+
+	var prices []SecurityPrice
+	for line, row := range rows[1:] {
+		if len(row) < len(rows[0]) {
+			return nil, fmt.Errorf("row %d: expected %d columns", line+2, len(rows[0]))
+		}
+		value, err := strconv.ParseFloat(strings.TrimSpace(row[columns["price"]]), 64)
+		if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+			return nil, fmt.Errorf("row %d: invalid price %q", line+2, row[columns["price"]])
+		}
+		price := SecurityPrice{
+			Symbol: row[columns["symbol"]],
+			Date:   strings.TrimSpace(row[columns["date"]]),
+			Price:  value,
+		}
+		if i, ok := columns["currency"]; ok {
+			price.Currency = strings.TrimSpace(row[i])
+		}
+		prices = append(prices, price)
+	}
+	return prices, nil
+}
+
+// PriceTable answers price queries from a user's imported prices.
+type PriceTable struct {
+	symbols map[string][]SecurityPrice
+}
+
+func NewPriceTable(prices []SecurityPrice) *PriceTable {
+	table := &PriceTable{symbols: make(map[string][]SecurityPrice)}
+	for _, price := range prices {
+		table.symbols[price.Symbol] = append(table.symbols[price.Symbol], price)
+	}
+	for _, prices := range table.symbols {
+		sort.Slice(prices, func(i, j int) bool { return prices[i].Date < prices[j].Date })
+	}
+	return table
+}
+
+// Price returns the latest price of a symbol on or before a date that is in
+// the currency or has none.
+func (t *PriceTable) Price(symbol string, currency string, day string) (SecurityPrice, bool) {
+	prices := t.symbols[symbol]
+	i := sort.Search(len(prices), func(i int) bool { return prices[i].Date > day })
+	for i--; i >= 0; i-- {
+		if prices[i].Currency == "" || prices[i].Currency == currency {
+			return prices[i], true
+		}
+	}
+	return SecurityPrice{}, false
+}
+
+// tradeValue returns the value of a quantity at a unit price, rounded to the
+// minor unit of the currency.
+func tradeValue(quantity float64, price float64, currency string) Money {
+	return MoneyFromFloat(price).Mul(quantity).Round(currency)
+}
+
+// BuildLots replays an account's transactions up to a date in date order.
+// Every buy opens a lot whose cost basis includes its fees, and every sell
+// closes the oldest lots of the symbol first. Sell proceeds are net of fees
+// and shared across the lots they close in proportion to quantity, as is the
+// cost basis of a lot that is closed in part.
+func BuildLots(transactions []InvestmentTransaction, day string) ([]Lot, []RealizedGain, error) {
+	sorted := make([]InvestmentTransaction, 0, len(transactions))
+	for _, transaction := range transactions {
+		if transaction.Date <= day {
+			sorted = append(sorted, transaction)
+		}
+	}
+	// Buys come before sells on the same day, so a lot can be bought and sold
+	// on one day
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Date != sorted[j].Date {
+			return sorted[i].Date < sorted[j].Date
+		}
+		return sorted[i].Type == InvestmentBuy && sorted[j].Type != InvestmentBuy
+	})
+
+	type key struct{ accountId, symbol string }
+	open := make(map[key][]*Lot)
+	var order []*Lot
+	realized := []RealizedGain{}
+	for _, transaction := range sorted {
+		k := key{transaction.AccountId, transaction.Symbol}
+		switch transaction.Type {
+		case InvestmentBuy:
+			lot := &Lot{
+				LotId:     transaction.TransactionId,
+				AccountId: transaction.AccountId,
+				Symbol:    transaction.Symbol,
+				Date:      transaction.Date,
+				Quantity:  transaction.Quantity,
+				CostBasis: tradeValue(transaction.Quantity, transaction.Price, transaction.Currency) + transaction.Fees,
+			}
+			open[k] = append(open[k], lot)
+			order = append(order, lot)
+		case InvestmentSell:
+			remaining := transaction.Quantity
+			proceeds := tradeValue(transaction.Quantity, transaction.Price, transaction.Currency) - transaction.Fees
+			for remaining > quantityEpsilon {
+				if len(open[k]) == 0 {
+					return nil, nil, fmt.Errorf("sell of %g %s on %s is more than was held", transaction.Quantity, transaction.Symbol, transaction.Date)
+				}
+				lot := open[k][0]
+				closed := math.Min(remaining, lot.Quantity)
+
+				cost := lot.CostBasis
+				if lot.Quantity-closed > quantityEpsilon {
+					cost = lot.CostBasis.Mul(closed / lot.Quantity).Round(transaction.Currency)
+				}
+				share := proceeds
+				if remaining-closed > quantityEpsilon {
+					share = proceeds.Mul(closed / remaining).Round(transaction.Currency)
+				}
+				realized = append(realized, RealizedGain{
+					AccountId: transaction.AccountId,
+					Symbol:    transaction.Symbol,
+					LotId:     lot.LotId,
+					BuyDate:   lot.Date,
+					SellDate:  transaction.Date,
+					Quantity:  closed,
+					CostBasis: cost,
+					Proceeds:  share,
+					Gain:      share - cost,
+				})
+
+				lot.Quantity -= closed
+				lot.CostBasis -= cost
+				remaining -= closed
+				proceeds -= share
+				if lot.Quantity <= quantityEpsilon {
+					lot.Quantity = 0
+					open[k] = open[k][1:]
+				}
+			}
+		}
+	}
+
+	lots := []Lot{}
+	for _, lot := range order {
+		if lot.Quantity > 0 {
+			lots = append(lots, *lot)
+		}
+	}
+	return lots, realized, nil
+}
+
+// investmentConverter converts account amounts to the base currency and
+// remembers the pairs it had no rate for.
+type investmentConverter struct {
+	base    string
+	rates   *RateTable
+	date    time.Time
+	missing []string
+	seen    map[string]bool
+}
+
+func (c *investmentConverter) convert(amount Money, currency string) Money {
+	if currency == "" {
+		currency = c.base
+	}
+	converted, ok := c.rates.Convert(amount, currency, c.base, c.date)
+	if !ok {
+		key := fmt.Sprintf("%s/%s@%s", currency, c.base, c.date.Format("2006-01-02"))
+		if !c.seen[key] {
+			c.seen[key] = true
+			c.missing = append(c.missing, key)
+		}
+	}
+	return converted
+}
+
+// ComputeInvestmentGains values the open lots of the given accounts at the
+// latest prices on or before a date, in the account's currency, and totals
+// the realized gains and dividends up to it. Lots of symbols without a price
+// are valued at their cost basis, so they show no gain, and the symbols are
+// listed.
+func ComputeInvestmentGains(day string, base string, rates *RateTable, prices *PriceTable, accounts []Account, transactions []InvestmentTransaction) (*InvestmentGains, error) {
+	date, err := time.Parse("2006-01-02", day)
+	if err != nil {
+		return nil, fmt.Errorf("invalid date, expected YYYY-MM-DD")
+	}
+	gains := &InvestmentGains{
+		Date:          day,
+		BaseCurrency:  base,
+		Positions:     []Position{},
+		MissingPrices: []string{},
+	}
+	converter := &investmentConverter{base: base, rates: rates, date: date, missing: []string{}, seen: make(map[string]bool)}
+
+	currencies := make(map[string]string)
+	included := make(map[string]bool)
+	for _, account := range accounts {
+		currencies[account.AccountId] = account.Currency
+		included[account.AccountId] = true
+	}
+	var accountTransactions []InvestmentTransaction
+	for _, transaction := range transactions {
+		if included[transaction.AccountId] {
+			accountTransactions = append(accountTransactions, transaction)
+		}
+	}
+
+	lots, realized, err := BuildLots(accountTransactions, day)
+	if err != nil {
+		return nil, err
+	}
+
+	type key struct{ accountId, symbol string }
+	positions := make(map[key]*Position)
+	var order []key
+	position := func(accountId string, symbol string) *Position {
+		k := key{accountId, symbol}
+		if positions[k] == nil {
+			positions[k] = &Position{AccountId: accountId, Symbol: symbol, Currency: currencies[accountId]}
+			order = append(order, k)
+		}
+		return positions[k]
+	}
+
+	missingPrices := make(map[string]bool)
+	for i := range lots {
+		lot := &lots[i]
+		currency := currencies[lot.AccountId]
+		priceCurrency := currency
+		if priceCurrency == "" {
+			priceCurrency = base
+		}
+		lot.MarketValue = lot.CostBasis
+		if price, ok := prices.Price(lot.Symbol, priceCurrency, day); ok {
+			lot.Price = price.Price
+			lot.PriceDate = price.Date
+			lot.MarketValue = tradeValue(lot.Quantity, price.Price, currency)
+		} else if !missingPrices[lot.Symbol] {
+			missingPrices[lot.Symbol] = true
+			gains.MissingPrices = append(gains.MissingPrices, lot.Symbol)
+		}
+		lot.UnrealizedGain = lot.MarketValue - lot.CostBasis
+
+		p := position(lot.AccountId, lot.Symbol)
+		p.Quantity += lot.Quantity
+		p.CostBasis += lot.CostBasis
+		p.MarketValue += lot.MarketValue
+		p.UnrealizedGain += lot.UnrealizedGain
+		p.Price = lot.Price
+		p.PriceDate = lot.PriceDate
+
+		gains.TotalCostBasis += converter.convert(lot.CostBasis, currency)
+		gains.TotalValue += converter.convert(lot.MarketValue, currency)
+		gains.TotalUnrealized += converter.convert(lot.UnrealizedGain, currency)
+	}
+	for _, gain := range realized {
+		gains.TotalRealized += converter.convert(gain.Gain, currencies[gain.AccountId])
+	}
+	for _, transaction := range accountTransactions {
+		if transaction.Type != InvestmentDividend || transaction.Date > day {
+			continue
+		}
+		if p, ok := positions[key{transaction.AccountId, transaction.Symbol}]; ok {
+			p.Dividends += transaction.Amount
+		}
+		gains.TotalDividends += converter.convert(transaction.Amount, currencies[transaction.AccountId])
+	}
+
+	for _, k := range order {
+		gains.Positions = append(gains.Positions, *positions[k])
+	}
+	gains.Lots = lots
+	gains.Realized = realized
+	gains.MissingRates = converter.missing
+	return gains, nil
+}
+
+// ComputeAllocation breaks the market value of the open positions down by
+// symbol and by account, largest first.
+func ComputeAllocation(gains *InvestmentGains, rates *RateTable, accounts []Account) InvestmentAllocation {
+	allocation := InvestmentAllocation{
+		Date:          gains.Date,
+		BaseCurrency:  gains.BaseCurrency,
+		MissingPrices: gains.MissingPrices,
+	}
+	date, _ := time.Parse("2006-01-02", gains.Date)
+	converter := &investmentConverter{base: gains.BaseCurrency, rates: rates, date: date, missing: []string{}, seen: make(map[string]bool)}
+
+	names := make(map[string]string)
+	for _, account := range accounts {
+		names[account.AccountId] = account.AccountName
+	}
+	bySymbol := make(map[string]Money)
+	byAccount := make(map[string]Money)
+	for _, position := range gains.Positions {
+		value := converter.convert(position.MarketValue, position.Currency)
+		allocation.Total += value
+		bySymbol[position.Symbol] += value
+		byAccount[names[position.AccountId]] += value
+	}
+
+	allocation.BySymbol = allocationSlices(bySymbol, allocation.Total)
+	allocation.ByAccount = allocationSlices(byAccount, allocation.Total)
+	allocation.MissingRates = converter.missing
+	return allocation
+}
+
+func allocationSlices(values map[string]Money, total Money) []AllocationSlice {
+	slices := []AllocationSlice{}
+	for name, value := range values {
+		slice := AllocationSlice{Name: name, Value: value}
+		if total != 0 {
+			slice.Percent = math.Round(value.Float64()/total.Float64()*1000) / 10
+		}
+		slices = append(slices, slice)
+	}
+	sort.Slice(slices, func(i, j int) bool {
+		if slices[i].Value != slices[j].Value {
+			return slices[i].Value > slices[j].Value
+		}
+		return slices[i].Name < slices[j].Name
+	})
+	return slices
+}
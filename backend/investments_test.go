@@ -0,0 +1,138 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBuildLots(t *testing.T) {
+	trade := func(id string, kind string, date string, quantity float64, price float64, fees Money) InvestmentTransaction {
+		return InvestmentTransaction{
+			TransactionId: id, AccountId: "broker", Type: kind, Symbol: "ACME",
+			Date: date, Quantity: quantity, Price: price, Fees: fees, Currency: "USD",
+		}
+	}
+	transactions := []InvestmentTransaction{
+		trade("sell", InvestmentSell, "2024-03-01", 15, 30, 30000),
+		trade("second", InvestmentBuy, "2024-02-01", 10, 20, 0),
+		trade("first", InvestmentBuy, "2024-01-02", 10, 10, 10000),
+	}
+
+	tests := []struct {
+		name         string
+		transactions []InvestmentTransaction
+		day          string
+		wantLots     []Lot
+		wantRealized []RealizedGain
+		wantErr      bool
+	}{
+		{
+			"oldest lot sold first, the next in part",
+			transactions, "2024-12-31",
+			[]Lot{{LotId: "second", AccountId: "broker", Symbol: "ACME", Date: "2024-02-01", Quantity: 5, CostBasis: 1000000}},
+			[]RealizedGain{
+				{AccountId: "broker", Symbol: "ACME", LotId: "first", BuyDate: "2024-01-02", SellDate: "2024-03-01",
+					Quantity: 10, CostBasis: 1010000, Proceeds: 2980000, Gain: 1970000},
+				{AccountId: "broker", Symbol: "ACME", LotId: "second", BuyDate: "2024-02-01", SellDate: "2024-03-01",
+					Quantity: 5, CostBasis: 1000000, Proceeds: 1490000, Gain: 490000},
+			},
+			false,
+		},
+		{
+			"transactions after the date left out",
+			transactions, "2024-02-15",
+			[]Lot{
+				{LotId: "first", AccountId: "broker", Symbol: "ACME", Date: "2024-01-02", Quantity: 10, CostBasis: 1010000},
+				{LotId: "second", AccountId: "broker", Symbol: "ACME", Date: "2024-02-01", Quantity: 10, CostBasis: 2000000},
+			},
+			[]RealizedGain{},
+			false,
+		},
+		{
+			"bought and sold on one day",
+			[]InvestmentTransaction{
+				trade("sell", InvestmentSell, "2024-01-02", 4, 12, 0),
+				trade("buy", InvestmentBuy, "2024-01-02", 4, 10, 0),
+			},
+			"2024-01-02",
+			[]Lot{},
+			[]RealizedGain{{AccountId: "broker", Symbol: "ACME", LotId: "buy", BuyDate: "2024-01-02", SellDate: "2024-01-02",
+				Quantity: 4, CostBasis: 400000, Proceeds: 480000, Gain: 80000}},
+			false,
+		},
+		{
+			"sell of more than was held",
+			[]InvestmentTransaction{
+				trade("buy", InvestmentBuy, "2024-01-02", 4, 10, 0),
+				trade("sell", InvestmentSell, "2024-01-03", 5, 12, 0),
+			},
+			"2024-12-31", nil, nil, true,
+		},
+	}
+	for _, test := range tests {
+		lots, realized, err := BuildLots(test.transactions, test.day)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected an error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(lots, test.wantLots) {
+			t.Errorf("%s: lots %+v, want %+v", test.name, lots, test.wantLots)
+		}
+		if !reflect.DeepEqual(realized, test.wantRealized) {
+			t.Errorf("%s: realized %+v, want %+v", test.name, realized, test.wantRealized)
+		}
+	}
+}
+
+func TestParseSecurityPricesCSV(t *testing.T) {
+	prices, err := ParseSecurityPricesCSV(strings.NewReader("Date,Symbol,Close,Currency\n2024-01-02,acme,12.5,usd\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateSecurityPrice(&prices[0]); err != nil {
+		t.Fatal(err)
+	}
+	want := SecurityPrice{PriceId: "ACME#2024-01-02#USD", Symbol: "ACME", Date: "2024-01-02", Price: 12.5, Currency: "USD"}
+	if prices[0] != want {
+		t.Errorf("got %+v, want %+v", prices[0], want)
+	}
+
+	for _, value := range []string{"NaN", "Inf", "-Infinity", "abc"} {
+		if _, err := ParseSecurityPricesCSV(strings.NewReader("symbol,date,price\nACME,2024-01-02," + value + "\n")); err == nil {
+			t.Errorf("price %s: expected an error", value)
+		}
+	}
+}
+
+func TestPriceTable(t *testing.T) {
+	table := NewPriceTable([]SecurityPrice{
+		{Symbol: "ACME", Date: "2024-01-01", Price: 10},
+		{Symbol: "ACME", Date: "2024-01-05", Price: 11, Currency: "USD"},
+		{Symbol: "ACME", Date: "2024-01-06", Price: 9, Currency: "EUR"},
+	})
+	tests := []struct {
+		currency string
+		day      string
+		want     float64
+		found    bool
+	}{
+		{"USD", "2024-01-10", 11, true},
+		{"EUR", "2024-01-10", 9, true},
+		{"GBP", "2024-01-10", 10, true},
+		{"EUR", "2024-01-05", 10, true},
+		{"USD", "2023-12-31", 0, false},
+	}
+	for _, test := range tests {
+		price, ok := table.Price("ACME", test.currency, test.day)
+		if ok != test.found || price.Price != test.want {
+			t.Errorf("%s on %s: got %g (%v), want %g (%v)", test.currency, test.day, price.Price, ok, test.want, test.found)
+		}
+	}
+}
@@ -0,0 +1,429 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Supported plain-text accounting dialects. ledger and hledger share a syntax
+// for everything exported here; beancount differs in quoting and directives.
+const (
+	DialectLedger    = "ledger"
+	DialectHledger   = "hledger"
+	DialectBeancount = "beancount"
+)
+
+// LedgerAccountMapping decides which accounts income and expenses are posted
+// to. Tags maps an expense tag, or an income item name, to an account.
+type LedgerAccountMapping struct {
+	Tags          map[string]string `json:"tags"`
+	AssetAccount  string            `json:"assetAccount"`
+	IncomeAccount string            `json:"incomeAccount"`
+	ExpensesRoot  string            `json:"expensesRoot"`
+	Uncategorized string            `json:"uncategorizedAccount"`
+	Commodity     string            `json:"commodity"`
+}
+
+// JournalTransaction is one transaction of a plain-text accounting journal.
+type JournalTransaction struct {
+	Date     time.Time
+	Payee    string
+	Id       string
+	Postings []JournalPosting
+}
+
+type JournalPosting struct {
+	Account   string
+	Amount    Money
+	Commodity string
+	// Elided is set on a parsed posting written without an amount until
+	// the amount is inferred from the other postings
+	Elided bool
+}
+
+func (m *LedgerAccountMapping) applyDefaults() {
+	if m.AssetAccount == "" {
+		m.AssetAccount = "Assets:Checking"
+	}
+	if m.IncomeAccount == "" {
+		m.IncomeAccount = "Income:Other"
+	}
+	if m.ExpensesRoot == "" {
+		m.ExpensesRoot = "Expenses"
+	}
+	if m.Uncategorized == "" {
+		m.Uncategorized = m.ExpensesRoot + ":Uncategorized"
+	}
+	if m.Commodity == "" {
+		m.Commodity = "USD"
+	}
+}
+
+// expenseAccount picks the account for an expense line: its category or
+// first tag with an explicit mapping, otherwise an account named after its
+// category or first tag.
+func (m LedgerAccountMapping) expenseAccount(line ExpenseSplit) string {
+	if account, ok := m.Tags[line.Category]; ok && line.Category != "" {
+		return sanitizeAccount(account)
+	}
+	for _, tag := range line.Tags {
+		if account, ok := m.Tags[tag]; ok {
+			return sanitizeAccount(account)
+		}
+	}
+	if line.Category != "" {
+		return sanitizeAccount(m.ExpensesRoot + ":" + line.Category)
+	}
+	if len(line.Tags) > 0 && line.Tags[0] != "" {
+		return sanitizeAccount(m.ExpensesRoot + ":" + line.Tags[0])
+	}
+	return sanitizeAccount(m.Uncategorized)
+}
+
+func (m LedgerAccountMapping) incomeAccount(item IncomeItem) string {
+	if account, ok := m.Tags[item.IncomeItemName]; ok {
+		return sanitizeAccount(account)
+	}
+	return sanitizeAccount(m.IncomeAccount)
+}
+
+// BuildJournal turns income and expense items into balanced journal
+// transactions, sorted by date. Items dated outside [from, to] are skipped.
+// Each item is posted in its own currency, or the mapping's commodity when it
+// has none, and its amounts are rounded to that currency's minor unit.
+func BuildJournal(income []IncomeItem, expenses []ExpenseItem, mapping LedgerAccountMapping, from time.Time, to time.Time) []JournalTransaction {
+	mapping.applyDefaults()
+	asset := sanitizeAccount(mapping.AssetAccount)
+	commodity := func(currency string) string {
+		if currency == "" {
+			return mapping.Commodity
+		}
+		return currency
+	}
+
+	var transactions []JournalTransaction
+	for _, item := range income {
+		date := itemDate(item.Date, item.Month)
+		if date.Before(from) || date.After(to) {
+			continue
+		}
+		currency := commodity(item.Currency)
+		value := item.IncomeItemValue.Round(currency)
+		transactions = append(transactions, JournalTransaction{
+			Date:  date,
+			Payee: firstNonEmpty(item.Payer, item.IncomeItemName),
+			Id:    item.IncomeItemName,
+			Postings: []JournalPosting{
+				{Account: asset, Amount: value, Commodity: currency},
+				{Account: mapping.incomeAccount(item), Amount: -value, Commodity: currency},
+			},
+		})
+	}
+	for _, item := range expenses {
+		date := itemDate(item.Date, item.Month)
+		if date.Before(from) || date.After(to) {
+			continue
+		}
+		currency := commodity(item.Currency)
+		total := item.ExpenseValue.Round(currency)
+
+		// A split expense gets one posting per split line. Lines are rounded
+		// one by one, so any difference from the rounded total goes to the
+		// largest line to keep the transaction balanced.
+		var postings []JournalPosting
+		var sum, largestValue Money
+		largest := 0
+		for i, line := range expenseLines(item) {
+			value := line.Amount.Round(currency)
+			sum += value
+			if magnitude := max(value, -value); magnitude > largestValue {
+				largest, largestValue = i, magnitude
+			}
+			postings = append(postings, JournalPosting{Account: mapping.expenseAccount(line), Amount: value, Commodity: currency})
+		}
+		postings[largest].Amount += total - sum
+		postings = append(postings, JournalPosting{Account: asset, Amount: -total, Commodity: currency})
+
+		transactions = append(transactions, JournalTransaction{
+			Date:     date,
+			Payee:    firstNonEmpty(item.Merchant, item.ExpenseItemName),
+			Id:       item.ExpenseItemName,
+			Postings: postings,
+		})
+	}
+
+	sort.SliceStable(transactions, func(i, j int) bool {
+		return transactions[i].Date.Before(transactions[j].Date)
+	})
+	return transactions
+}
+
+// WriteJournal renders transactions in the given dialect. Every account used
+// is declared up front, which beancount requires and ledger and hledger
+// accept.
+func WriteJournal(w io.Writer, dialect string, transactions []JournalTransaction) error {
+	accounts := make(map[string]time.Time)
+	for _, t := range transactions {
+		for _, p := range t.Postings {
+			if opened, ok := accounts[p.Account]; !ok || t.Date.Before(opened) {
+				accounts[p.Account] = t.Date
+			}
+		}
+	}
+	names := make([]string, 0, len(accounts))
+	for name := range accounts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	out := bufio.NewWriter(w)
+	switch dialect {
+	case DialectBeancount:
+		for _, name := range names {
+			fmt.Fprintf(out, "%s open %s\n", accounts[name].Format("2006-01-02"), name)
+		}
+	case DialectLedger, DialectHledger:
+		for _, name := range names {
+			fmt.Fprintf(out, "account %s\n", name)
+		}
+	default:
+		return fmt.Errorf("unsupported journal dialect: %s", dialect)
+	}
+
+	for _, t := range transactions {
+		fmt.Fprintln(out)
+		if dialect == DialectBeancount {
+			fmt.Fprintf(out, "%s * %s\n", t.Date.Format("2006-01-02"), beancountString(t.Payee))
+			fmt.Fprintf(out, "  id: %s\n", beancountString(t.Id))
+		} else {
+			fmt.Fprintf(out, "%s * %s\n", t.Date.Format("2006-01-02"), ledgerPayee(t.Payee))
+			fmt.Fprintf(out, "    ; id: %s\n", ledgerPayee(t.Id))
+		}
+		for _, p := range t.Postings {
+			fmt.Fprintf(out, "    %-40s  %s %s\n", p.Account, formatJournalAmount(p.Amount, p.Commodity), p.Commodity)
+		}
+	}
+
+	return out.Flush()
+}
+
+// ParseJournal reads back the subset of ledger, hledger and beancount syntax
+// that WriteJournal produces: dated transactions with an optional id and
+// postings with an amount and commodity, one of which may be left for the
+// parser to balance.
+func ParseJournal(r io.Reader, dialect string) ([]JournalTransaction, error) {
+	var transactions []JournalTransaction
+	var current *JournalTransaction
+
+	finish := func() error {
+		if current == nil {
+			return nil
+		}
+		if err := balanceJournalTransaction(current); err != nil {
+			return err
+		}
+		transactions = append(transactions, *current)
+		current = nil
+		return nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		trimmed := strings.TrimSpace(line)
+
+		if trimmed == "" {
+			if err := finish(); err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineNumber, err)
+			}
+			continue
+		}
+
+		indented := line[0] == ' ' || line[0] == '\t'
+		if !indented {
+			if err := finish(); err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineNumber, err)
+			}
+			if strings.HasPrefix(line, ";") || strings.HasPrefix(line, "account ") || strings.HasPrefix(line, "option ") {
+				continue
+			}
+
+			fields := strings.SplitN(line, " ", 3)
+			date, err := time.Parse("2006-01-02", fields[0])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid date %q", lineNumber, fields[0])
+			}
+			if len(fields) >= 2 && fields[1] == "open" {
+				continue
+			}
+			if len(fields) < 3 || (fields[1] != "*" && fields[1] != "!") {
+				return nil, fmt.Errorf("line %d: expected a transaction header", lineNumber)
+			}
+
+			payee := fields[2]
+			if dialect == DialectBeancount {
+				payee, err = unquoteBeancount(payee)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %v", lineNumber, err)
+				}
+			}
+			current = &JournalTransaction{Date: date, Payee: payee}
+			continue
+		}
+
+		if current == nil {
+			return nil, fmt.Errorf("line %d: posting outside of a transaction", lineNumber)
+		}
+
+		// Metadata: "; id: x" in ledger and hledger, "id: "x"" in beancount
+		if value, ok := strings.CutPrefix(trimmed, "; id:"); ok {
+			current.Id = strings.TrimSpace(value)
+			continue
+		}
+		if value, ok := strings.CutPrefix(trimmed, "id:"); ok && dialect == DialectBeancount {
+			id, err := unquoteBeancount(strings.TrimSpace(value))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineNumber, err)
+			}
+			current.Id = id
+			continue
+		}
+		if strings.HasPrefix(trimmed, ";") {
+			continue
+		}
+
+		posting, err := parseJournalPosting(trimmed)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNumber, err)
+		}
+		current.Postings = append(current.Postings, posting)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if err := finish(); err != nil {
+		return nil, fmt.Errorf("line %d: %v", lineNumber, err)
+	}
+
+	return transactions, nil
+}
+
+func parseJournalPosting(line string) (JournalPosting, error) {
+	// The account is separated from the amount by at least two spaces or a tab
+	account, rest := line, ""
+	if i := strings.Index(line, "  "); i >= 0 {
+		account, rest = line[:i], strings.TrimSpace(line[i:])
+	} else if i := strings.IndexByte(line, '\t'); i >= 0 {
+		account, rest = line[:i], strings.TrimSpace(line[i:])
+	}
+	posting := JournalPosting{Account: strings.TrimSpace(account)}
+	if rest == "" {
+		posting.Elided = true
+		return posting, nil
+	}
+
+	fields := strings.Fields(rest)
+	if len(fields) != 2 {
+		return posting, fmt.Errorf("invalid posting amount %q", rest)
+	}
+	amount, err := ParseMoney(fields[0])
+	if err != nil {
+		return posting, fmt.Errorf("invalid posting amount %q", fields[0])
+	}
+	posting.Amount = amount
+	posting.Commodity = fields[1]
+	return posting, nil
+}
+
+// balanceJournalTransaction fills in an elided posting amount and checks that
+// the postings sum to zero.
+func balanceJournalTransaction(t *JournalTransaction) error {
+	if len(t.Postings) < 2 {
+		return fmt.Errorf("transaction on %s needs at least two postings", t.Date.Format("2006-01-02"))
+	}
+	var sum Money
+	elided := -1
+	commodity := ""
+	for i, p := range t.Postings {
+		if p.Elided {
+			if elided >= 0 {
+				return fmt.Errorf("transaction on %s has more than one posting without an amount", t.Date.Format("2006-01-02"))
+			}
+			elided = i
+			continue
+		}
+		sum += p.Amount
+		commodity = p.Commodity
+	}
+	if elided >= 0 {
+		t.Postings[elided].Amount = -sum
+		t.Postings[elided].Commodity = commodity
+		t.Postings[elided].Elided = false
+		return nil
+	}
+	if sum.Round(commodity) != 0 {
+		return fmt.Errorf("transaction on %s does not balance: off by %s", t.Date.Format("2006-01-02"), sum)
+	}
+	return nil
+}
+
+// sanitizeAccount makes an account name valid in all three dialects: colon
+// separated components that start with a capital letter or digit and contain
+// only letters, digits and dashes.
+func sanitizeAccount(account string) string {
+	var components []string
+	for _, component := range strings.Split(account, ":") {
+		var b strings.Builder
+		for _, r := range strings.TrimSpace(component) {
+			switch {
+			case unicode.IsLetter(r) || unicode.IsDigit(r):
+				b.WriteRune(r)
+			case b.Len() > 0:
+				b.WriteRune('-')
+			}
+		}
+		cleaned := strings.Trim(b.String(), "-")
+		if cleaned == "" {
+			continue
+		}
+		runes := []rune(cleaned)
+		runes[0] = unicode.ToUpper(runes[0])
+		components = append(components, string(runes))
+	}
+	if len(components) == 0 {
+		return "Expenses:Uncategorized"
+	}
+	return strings.Join(components, ":")
+}
+
+func formatJournalAmount(amount Money, commodity string) string {
+	return amount.Format(commodity)
+}
+
+// ledgerPayee keeps a payee on one line; ledger reads the rest of the header
+// line as the payee.
+func ledgerPayee(payee string) string {
+	return strings.Join(strings.Fields(payee), " ")
+}
+
+func beancountString(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
+
+func unquoteBeancount(s string) (string, error) {
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return "", fmt.Errorf("expected a quoted string, got %s", s)
+	}
+	s = s[1 : len(s)-1]
+	s = strings.ReplaceAll(s, `\"`, `"`)
+	return strings.ReplaceAll(s, `\\`, `\`), nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// verifyJournalRoundTrip parses a rendered journal back and checks that every
+// transaction survived with the same date, id, accounts and amounts.
+func verifyJournalRoundTrip(dialect string, transactions []JournalTransaction, rendered []byte) error {
+	parsed, err := ParseJournal(bytes.NewReader(rendered), dialect)
+	if err != nil {
+		return fmt.Errorf("rendered journal does not parse: %v", err)
+	}
+	if len(parsed) != len(transactions) {
+		return fmt.Errorf("rendered journal has %d transactions, expected %d", len(parsed), len(transactions))
+	}
+	for i := range transactions {
+		want, got := transactions[i], parsed[i]
+		if !want.Date.Equal(got.Date) || ledgerPayee(want.Id) != got.Id || len(want.Postings) != len(got.Postings) {
+			return fmt.Errorf("transaction %s did not round-trip", want.Id)
+		}
+		for j := range want.Postings {
+			if want.Postings[j].Account != got.Postings[j].Account || want.Postings[j].Amount != got.Postings[j].Amount ||
+				want.Postings[j].Commodity != got.Postings[j].Commodity {
+				return fmt.Errorf("posting %d of transaction %s did not round-trip", j, want.Id)
+			}
+		}
+	}
+	return nil
+}
+
+// journalFixture is a month of items covering income, a tagged expense, a
+// split expense, an uncategorized expense and an expense in another currency.
+func journalFixture() ([]IncomeItem, []ExpenseItem) {
+	income := []IncomeItem{
+		{UserId: "u", IncomeItemName: "Salary", Month: "2024-01", IncomeItemValue: 25000000, Date: "2024-01-25", Payer: "Acme Corp"},
+	}
+	expenses := []ExpenseItem{
+		{UserId: "u", ExpenseItemName: "groceries-1", Month: "2024-01", ExpenseValue: 421700, ExpenseTags: []string{"groceries"}, Date: "2024-01-05", Merchant: "Corner \"Fresh\" Grocery"},
+		{UserId: "u", ExpenseItemName: "target-1", Month: "2024-01", ExpenseValue: 1000000, ExpenseTags: []string{}, Date: "2024-01-10", Merchant: "Target",
+			Splits: []ExpenseSplit{
+				{Category: "household", Amount: 650000, Tags: []string{}},
+				{Category: "clothing", Amount: 350000, Tags: []string{}},
+			}},
+		{UserId: "u", ExpenseItemName: "misc-1", Month: "2024-01", ExpenseValue: 9900, ExpenseTags: []string{}},
+		{UserId: "u", ExpenseItemName: "ramen-1", Month: "2024-01", ExpenseValue: 12000000, ExpenseTags: []string{"dining"}, Date: "2024-01-20", Merchant: "Ichiran", Currency: "JPY"},
+	}
+	return income, expenses
+}
+
+func TestWriteJournalGolden(t *testing.T) {
+	income, expenses := journalFixture()
+	mapping := LedgerAccountMapping{Tags: map[string]string{"dining": "Expenses:Food:Dining-Out"}}
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)
+	transactions := BuildJournal(income, expenses, mapping, from, to)
+
+	for _, dialect := range []string{DialectLedger, DialectHledger, DialectBeancount} {
+		var rendered bytes.Buffer
+		if err := WriteJournal(&rendered, dialect, transactions); err != nil {
+			t.Fatalf("%s: %v", dialect, err)
+		}
+
+		golden := filepath.Join("testdata", "journal."+dialect)
+		if *updateGolden {
+			if err := os.WriteFile(golden, rendered.Bytes(), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		want, err := os.ReadFile(golden)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rendered.String() != string(want) {
+			t.Errorf("%s: journal differs from %s\ngot:\n%s\nwant:\n%s", dialect, golden, rendered.String(), want)
+		}
+
+		if err := verifyJournalRoundTrip(dialect, transactions, rendered.Bytes()); err != nil {
+			t.Errorf("%s: %v", dialect, err)
+		}
+	}
+}
+
+func TestBuildJournalBalancesRoundedSplits(t *testing.T) {
+	// Three equal thirds of 100 JPY cannot each be rounded to whole yen and
+	// still add up to the total
+	expenses := []ExpenseItem{{
+		UserId: "u", ExpenseItemName: "split", Month: "2024-01", ExpenseValue: 1000000, Currency: "JPY", Date: "2024-01-10",
+		Splits: []ExpenseSplit{
+			{Category: "a", Amount: 333334},
+			{Category: "b", Amount: 333333},
+			{Category: "c", Amount: 333333},
+		},
+	}}
+	transactions := BuildJournal(nil, expenses, LedgerAccountMapping{}, time.Time{}, time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC))
+	if len(transactions) != 1 {
+		t.Fatalf("got %d transactions, want 1", len(transactions))
+	}
+
+	var sum Money
+	for _, posting := range transactions[0].Postings {
+		if posting.Commodity != "JPY" {
+			t.Errorf("posting %s is in %s, want JPY", posting.Account, posting.Commodity)
+		}
+		if posting.Amount != posting.Amount.Round("JPY") {
+			t.Errorf("posting %s of %s is not in whole yen", posting.Account, posting.Amount)
+		}
+		sum += posting.Amount
+	}
+	if sum != 0 {
+		t.Errorf("transaction is off by %s", sum)
+	}
+
+	for _, dialect := range []string{DialectLedger, DialectBeancount} {
+		var rendered bytes.Buffer
+		if err := WriteJournal(&rendered, dialect, transactions); err != nil {
+			t.Fatal(err)
+		}
+		if err := verifyJournalRoundTrip(dialect, transactions, rendered.Bytes()); err != nil {
+			t.Errorf("%s: %v", dialect, err)
+		}
+	}
+}
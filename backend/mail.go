@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strings"
+	"time"
+)
+
+// SMTPSender sends email through an SMTP server. Without a username it sends
+// without authenticating, as local SMTP sinks such as the one in
+// docker-compose.yml expect.
+type SMTPSender struct {
+	Addr     string
+	Username string
+	Password string
+	From     string
+}
+
+// SMTPSenderFromEnv configures a sender from SMTP_ADDR, SMTP_USERNAME,
+// SMTP_PASSWORD and SMTP_FROM, defaulting to the local SMTP sink.
+func SMTPSenderFromEnv() SMTPSender {
+	sender := SMTPSender{
+		Addr:     os.Getenv("SMTP_ADDR"),
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     os.Getenv("SMTP_FROM"),
+	}
+	if sender.Addr == "" {
+		sender.Addr = "localhost:1025"
+	}
+	if sender.From == "" {
+		sender.From = "Budget <budget@localhost>"
+	}
+	return sender
+}
+
+// Email is a message with a plain text and an HTML version. Headers are
+// added to the standard ones, such as List-Unsubscribe.
+type Email struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+	Headers map[string]string
+}
+
+// Send delivers an email to its recipient.
+func (s SMTPSender) Send(email Email) error {
+	from, err := mail.ParseAddress(s.From)
+	if err != nil {
+		return fmt.Errorf("invalid SMTP_FROM address: %v", err)
+	}
+	to, err := mail.ParseAddress(email.To)
+	if err != nil {
+		return fmt.Errorf("invalid recipient address: %v", err)
+	}
+	message, err := buildEmailMessage(s.From, email)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if s.Username != "" {
+		host, _, err := net.SplitHostPort(s.Addr)
+		if err != nil {
+			return fmt.Errorf("invalid SMTP_ADDR: %v", err)
+		}
+		auth = smtp.PlainAuth("", s.Username, s.Password, host)
+	}
+	if err := smtp.SendMail(s.Addr, auth, from.Address, []string{to.Address}, message); err != nil {
+		return fmt.Errorf("failed to send email: %v", err)
+	}
+	return nil
+}
+
+// buildEmailMessage writes an email as a multipart/alternative MIME message,
+// with the text version first so that clients prefer the HTML one.
+func buildEmailMessage(from string, email Email) ([]byte, error) {
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+	for _, part := range []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain; charset=utf-8", email.Text},
+		{"text/html; charset=utf-8", email.HTML},
+	} {
+		w, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+
+	var message bytes.Buffer
+	writeHeader := func(name string, value string) {
+		// Header values must not break the header block
+		value = strings.NewReplacer("\r", "", "\n", "").Replace(value)
+		fmt.Fprintf(&message, "%s: %s\r\n", name, value)
+	}
+	writeHeader("From", from)
+	writeHeader("To", email.To)
+	writeHeader("Subject", mime.QEncoding.Encode("utf-8", email.Subject))
+	writeHeader("Date", time.Now().Format(time.RFC1123Z))
+	writeHeader("Message-ID", fmt.Sprintf("<%s@budget>", randomHex(16)))
+	writeHeader("MIME-Version", "1.0")
+	for name, value := range email.Headers {
+		writeHeader(name, value)
+	}
+	writeHeader("Content-Type", "multipart/alternative; boundary="+parts.Boundary())
+	message.WriteString("\r\n")
+	message.Write(body.Bytes())
+	return message.Bytes(), nil
+}
+
+// randomHex returns n random bytes, hex encoded.
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// publicURL is the address the API is reached at from outside, used in links
+// in emails.
+func publicURL() string {
+	if url := os.Getenv("PUBLIC_URL"); url != "" {
+		return strings.TrimSuffix(url, "/")
+	}
+	return "http://localhost:8080"
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"log"
 	"net/http"
+	"os"
 
 	"github.com/gorilla/mux"
 	"github.com/rs/cors"
@@ -16,6 +17,23 @@ func HealthCheckHandler(w http.ResponseWriter, r *http.Request) {
 
 func main() {
 
+	// Admin commands run instead of the server
+	if len(os.Args) > 1 && os.Args[1] == "restore" {
+		os.Exit(RestoreCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "migrate-money" {
+		os.Exit(MigrateMoneyCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "index-months" {
+		os.Exit(IndexMonthsCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "send-digests" {
+		os.Exit(SendDigestsCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "evaluate-alerts" {
+		os.Exit(EvaluateAlertsCommand(os.Args[2:]))
+	}
+
 	//CreateTables()
 	r := mux.NewRouter()
 
@@ -25,6 +43,14 @@ func main() {
 	r.HandleFunc("/api/register", RegisterHandler).Methods("POST")
 	r.HandleFunc("/api/login", LoginHandler).Methods("POST")
 
+	// Unsubscribe links in emails work without signing in
+	r.HandleFunc("/api/unsubscribe", UnsubscribeHandler).Methods("GET", "POST")
+	r.HandleFunc("/api/email-subscriptions/confirm", ConfirmEmailSubscriptionHandler).Methods("GET")
+
+	// The event stream also takes its token from the query string, see
+	// StreamAuthMiddleware
+	r.Handle("/api/events/stream", StreamAuthMiddleware(http.HandlerFunc(StreamEventsHandler))).Methods("GET")
+
 	// Protected routes
 	api := r.PathPrefix("/api").Subrouter()
 	api.Use(AuthMiddleware)
@@ -44,8 +70,153 @@ func main() {
 	// Expense routes
 	api.HandleFunc("/expense", AddExpensesHandler).Methods("POST")
 	api.HandleFunc("/expense", GetAllExpenseHandler).Methods("GET")
+	api.HandleFunc("/expense/duplicates", GetDuplicateExpensesHandler).Methods("GET")
+	api.HandleFunc("/expense/anomalies", GetExpenseAnomaliesHandler).Methods("GET")
+	api.HandleFunc("/expense/subscriptions", GetSubscriptionsHandler).Methods("GET")
 	api.HandleFunc("/expense/{userId}/{month}/{expenseItemName}", UpdateExpenseHandler).Methods("PUT")
 	api.HandleFunc("/expense/{userId}/{month}/{expenseItemName}", DeleteExpenseHandler).Methods("DELETE")
+	api.HandleFunc("/expense/{userId}/{month}/{expenseItemName}/merge", MergeExpenseHandler).Methods("POST")
+	api.HandleFunc("/expense/{userId}/{month}/{expenseItemName}/duplicate", DismissDuplicateHandler).Methods("DELETE")
+
+	// Account routes
+	api.HandleFunc("/accounts", AddAccountHandler).Methods("POST")
+	api.HandleFunc("/accounts", GetAllAccountsHandler).Methods("GET")
+	api.HandleFunc("/accounts/{userId}/{accountId}", UpdateAccountHandler).Methods("PUT")
+	api.HandleFunc("/accounts/{userId}/{accountId}", DeleteAccountHandler).Methods("DELETE")
+	api.HandleFunc("/accounts/{userId}/{accountId}/balances", GetAccountBalancesHandler).Methods("GET")
+
+	// Transfer routes
+	api.HandleFunc("/transfers", AddTransferHandler).Methods("POST")
+	api.HandleFunc("/transfers", GetAllTransfersHandler).Methods("GET")
+	api.HandleFunc("/transfers/{userId}/{month}/{transferId}", DeleteTransferHandler).Methods("DELETE")
+
+	// Goal routes
+	api.HandleFunc("/goals", AddGoalHandler).Methods("POST")
+	api.HandleFunc("/goals", GetAllGoalsHandler).Methods("GET")
+	api.HandleFunc("/goals/{userId}/{goalId}", UpdateGoalHandler).Methods("PUT")
+	api.HandleFunc("/goals/{userId}/{goalId}", DeleteGoalHandler).Methods("DELETE")
+	api.HandleFunc("/goals/{userId}/{goalId}/progress", GetGoalProgressHandler).Methods("GET")
+	api.HandleFunc("/goals/{userId}/{goalId}/contributions", AddGoalContributionHandler).Methods("POST")
+	api.HandleFunc("/goals/{userId}/{goalId}/contributions", GetGoalContributionsHandler).Methods("GET")
+	api.HandleFunc("/goals/{userId}/{goalId}/contributions/{contributionId}", DeleteGoalContributionHandler).Methods("DELETE")
+
+	// Debt routes
+	api.HandleFunc("/debts", AddDebtHandler).Methods("POST")
+	api.HandleFunc("/debts", GetAllDebtsHandler).Methods("GET")
+	api.HandleFunc("/debts/payoff-plan", GetPayoffPlanHandler).Methods("GET")
+	api.HandleFunc("/debts/{userId}/{debtId}", UpdateDebtHandler).Methods("PUT")
+	api.HandleFunc("/debts/{userId}/{debtId}", DeleteDebtHandler).Methods("DELETE")
+	api.HandleFunc("/debts/{userId}/{debtId}/payments", AddDebtPaymentHandler).Methods("POST")
+	api.HandleFunc("/debts/{userId}/{debtId}/payments", GetDebtPaymentsHandler).Methods("GET")
+	api.HandleFunc("/debts/{userId}/{debtId}/payments/{paymentId}", DeleteDebtPaymentHandler).Methods("DELETE")
+
+	// Holding routes
+	api.HandleFunc("/holdings", AddHoldingHandler).Methods("POST")
+	api.HandleFunc("/holdings", GetAllHoldingsHandler).Methods("GET")
+	api.HandleFunc("/holdings/{userId}/{holdingId}", UpdateHoldingHandler).Methods("PUT")
+	api.HandleFunc("/holdings/{userId}/{holdingId}", DeleteHoldingHandler).Methods("DELETE")
+	api.HandleFunc("/holdings/{userId}/{holdingId}/valuations", AddHoldingValuationHandler).Methods("POST")
+	api.HandleFunc("/holdings/{userId}/{holdingId}/valuations", GetHoldingValuationsHandler).Methods("GET")
+	api.HandleFunc("/holdings/{userId}/{holdingId}/valuations/{valuationId}", DeleteHoldingValuationHandler).Methods("DELETE")
+
+	// Net worth routes
+	api.HandleFunc("/net-worth", GetNetWorthHandler).Methods("GET")
+
+	// Investment routes
+	api.HandleFunc("/investments/transactions", AddInvestmentTransactionHandler).Methods("POST")
+	api.HandleFunc("/investments/transactions", GetInvestmentTransactionsHandler).Methods("GET")
+	api.HandleFunc("/investments/transactions/{userId}/{transactionId}", DeleteInvestmentTransactionHandler).Methods("DELETE")
+	api.HandleFunc("/investments/prices", AddSecurityPricesHandler).Methods("POST")
+	api.HandleFunc("/investments/prices", GetSecurityPricesHandler).Methods("GET")
+	api.HandleFunc("/investments/prices/{userId}/{priceId}", DeleteSecurityPriceHandler).Methods("DELETE")
+	api.HandleFunc("/investments/gains", GetInvestmentGainsHandler).Methods("GET")
+	api.HandleFunc("/investments/allocation", GetInvestmentAllocationHandler).Methods("GET")
+
+	// Group routes
+	api.HandleFunc("/groups/balances", GetGroupBalancesHandler).Methods("GET")
+	api.HandleFunc("/groups/settlements", AddSettlementHandler).Methods("POST")
+
+	// Household routes
+	api.HandleFunc("/households", CreateHouseholdHandler).Methods("POST")
+	api.HandleFunc("/households", GetHouseholdsHandler).Methods("GET")
+	api.HandleFunc("/households/{householdId}/members", GetHouseholdMembersHandler).Methods("GET")
+	api.HandleFunc("/households/{householdId}/members/{userId}", UpdateHouseholdMemberHandler).Methods("PUT")
+	api.HandleFunc("/households/{householdId}/members/{userId}", RemoveHouseholdMemberHandler).Methods("DELETE")
+
+	// Invitation routes
+	api.HandleFunc("/invitations", GetMyInvitationsHandler).Methods("GET")
+	api.HandleFunc("/households/{householdId}/invitations", InviteHouseholdMemberHandler).Methods("POST")
+	api.HandleFunc("/households/{householdId}/invitations", GetHouseholdInvitationsHandler).Methods("GET")
+	api.HandleFunc("/households/{householdId}/invitations/{invitationId}/accept", AcceptInvitationHandler).Methods("POST")
+	api.HandleFunc("/households/{householdId}/invitations/{invitationId}", DeleteInvitationHandler).Methods("DELETE")
+
+	// Settings routes
+	api.HandleFunc("/settings", GetSettingsHandler).Methods("GET")
+	api.HandleFunc("/settings", UpdateSettingsHandler).Methods("PUT")
+
+	// Exchange rate routes
+	api.HandleFunc("/exchange-rates", AddExchangeRatesHandler).Methods("POST")
+	api.HandleFunc("/exchange-rates", GetAllExchangeRatesHandler).Methods("GET")
+	api.HandleFunc("/exchange-rates/{userId}/{rateId}", DeleteExchangeRateHandler).Methods("DELETE")
+
+	// Report routes
+	api.HandleFunc("/reports/currency", GetCurrencyReportHandler).Methods("GET")
+
+	// Analytics routes
+	api.HandleFunc("/analytics/trends", GetTrendsHandler).Methods("GET")
+
+	// Recurring item routes
+	api.HandleFunc("/recurring", AddRecurringItemHandler).Methods("POST")
+	api.HandleFunc("/recurring", GetAllRecurringItemsHandler).Methods("GET")
+	api.HandleFunc("/recurring/{userId}/{recurringId}", UpdateRecurringItemHandler).Methods("PUT")
+	api.HandleFunc("/recurring/{userId}/{recurringId}", DeleteRecurringItemHandler).Methods("DELETE")
+
+	// Forecast routes
+	api.HandleFunc("/forecast", GetForecastHandler).Methods("GET")
+
+	// Scenario routes
+	api.HandleFunc("/scenarios", AddScenarioHandler).Methods("POST")
+	api.HandleFunc("/scenarios", GetAllScenariosHandler).Methods("GET")
+	api.HandleFunc("/scenarios/compare", CompareScenariosHandler).Methods("GET")
+	api.HandleFunc("/scenarios/{userId}/{scenarioId}", GetScenarioHandler).Methods("GET")
+	api.HandleFunc("/scenarios/{userId}/{scenarioId}", UpdateScenarioHandler).Methods("PUT")
+	api.HandleFunc("/scenarios/{userId}/{scenarioId}", DeleteScenarioHandler).Methods("DELETE")
+
+	// Alert routes
+	api.HandleFunc("/alerts", AddAlertRuleHandler).Methods("POST")
+	api.HandleFunc("/alerts", GetAllAlertRulesHandler).Methods("GET")
+	api.HandleFunc("/alerts/evaluate", EvaluateAlertsHandler).Methods("POST")
+	api.HandleFunc("/alerts/{userId}/{ruleId}", UpdateAlertRuleHandler).Methods("PUT")
+	api.HandleFunc("/alerts/{userId}/{ruleId}", DeleteAlertRuleHandler).Methods("DELETE")
+
+	// Notification routes
+	api.HandleFunc("/notifications", GetNotificationsHandler).Methods("GET")
+	api.HandleFunc("/notifications/{userId}/{notificationId}/read", MarkNotificationReadHandler).Methods("PUT")
+	api.HandleFunc("/notifications/{userId}/{notificationId}", DeleteNotificationHandler).Methods("DELETE")
+
+	// Email routes
+	api.HandleFunc("/email-subscriptions", GetEmailSubscriptionHandler).Methods("GET")
+	api.HandleFunc("/email-subscriptions", PutEmailSubscriptionHandler).Methods("PUT")
+	api.HandleFunc("/digests/preview", GetDigestPreviewHandler).Methods("GET")
+
+	// Webhook routes
+	api.HandleFunc("/webhooks", AddWebhookHandler).Methods("POST")
+	api.HandleFunc("/webhooks", GetAllWebhooksHandler).Methods("GET")
+	api.HandleFunc("/webhooks/{userId}/{webhookId}", UpdateWebhookHandler).Methods("PUT")
+	api.HandleFunc("/webhooks/{userId}/{webhookId}", DeleteWebhookHandler).Methods("DELETE")
+	api.HandleFunc("/webhooks/{userId}/{webhookId}/deliveries", GetWebhookDeliveriesHandler).Methods("GET")
+	api.HandleFunc("/webhooks/{userId}/{webhookId}/deliveries/{deliveryId}/redeliver", RedeliverWebhookHandler).Methods("POST")
+
+	// Import routes
+	api.HandleFunc("/import/{format}", ImportStatementHandler).Methods("POST")
+
+	// Export routes
+	api.HandleFunc("/export", ExportHandler).Methods("GET")
+	api.HandleFunc("/export/journal", ExportJournalHandler).Methods("POST")
+	api.HandleFunc("/restore", RestoreHandler).Methods("POST")
+
+	// Retry webhook deliveries that failed or were cut short by a restart
+	go PollWebhookDeliveries()
 
 	log.Println("Server starting on port 8080...")
 
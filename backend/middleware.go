@@ -1,8 +1,13 @@
 package main
 
 import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
 	"log"
 	"net/http"
+	"strings"
+	"time"
 )
 
 func AuthMiddleware(next http.Handler) http.Handler {
@@ -25,21 +30,99 @@ func AuthMiddleware(next http.Handler) http.Handler {
 		token := authHeader
 
 		log.Printf("Validating token : " + token)
-		// Validate the token using Cognito
-		valid, err := ValidateToken(token)
-		log.Printf("Got output : %v ", valid)
-
+		caller, err := callerForToken(token)
 		if err != nil {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
 
-		if !valid {
+		// Token is valid, proceed to the next handler
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), callerContextKey, caller)))
+	})
+}
+
+// StreamAuthMiddleware authenticates like AuthMiddleware, but also takes the
+// token from the access_token query parameter, since browsers cannot set
+// headers on EventSource requests.
+func StreamAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get("Authorization")
+		if token == "" {
+			token = r.URL.Query().Get("access_token")
+		}
+		if token == "" {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
 
-		// Token is valid, proceed to the next handler
-		next.ServeHTTP(w, r)
+		caller, err := callerForToken(token)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), callerContextKey, caller)))
 	})
 }
+
+// callerForToken validates a token using Cognito and looks up the caller so
+// handlers can check workspace membership
+func callerForToken(token string) (Caller, error) {
+	userName, email, emailVerified, err := GetTokenUser(token)
+	log.Printf("Got user : %v ", userName)
+	if err != nil {
+		return Caller{}, err
+	}
+
+	userId, err := GetUserIdByUserName(userName)
+	if err != nil {
+		return Caller{}, err
+	}
+	caller := Caller{UserId: userId, UserName: userName, Email: email, EmailVerified: emailVerified}
+	caller.ExpiresAt, _ = tokenExpiry(token)
+	return caller, nil
+}
+
+// tokenExpiry reads when a token expires from its exp claim. The token has
+// already been validated by Cognito, so the signature is not checked again.
+func tokenExpiry(token string) (time.Time, bool) {
+	parts := strings.Split(strings.TrimPrefix(token, "Bearer "), ".")
+	if len(parts) != 3 {
+		return time.Time{}, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}, false
+	}
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp == 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(claims.Exp, 0), true
+}
+
+type contextKey string
+
+// callerContextKey holds the Caller of an authenticated request
+const callerContextKey contextKey = "caller"
+
+// Caller is the authenticated user making a request
+type Caller struct {
+	UserId   string
+	UserName string
+	Email    string
+	// EmailVerified is set when Cognito has confirmed the user owns Email.
+	// Anyone can sign up with any address, so an unverified one must not
+	// be trusted to identify the user.
+	EmailVerified bool
+	// ExpiresAt is when the caller's token expires, when it says
+	ExpiresAt time.Time
+}
+
+// CallerFromRequest returns the authenticated user making a request, as set
+// by AuthMiddleware
+func CallerFromRequest(r *http.Request) (Caller, bool) {
+	caller, ok := r.Context().Value(callerContextKey).(Caller)
+	return caller, ok
+}
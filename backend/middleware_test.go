@@ -0,0 +1,31 @@
+package main
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+)
+
+func TestTokenExpiry(t *testing.T) {
+	token := func(payload string) string {
+		return "header." + base64.RawURLEncoding.EncodeToString([]byte(payload)) + ".signature"
+	}
+	tests := []struct {
+		name   string
+		token  string
+		expiry int64
+		ok     bool
+	}{
+		{"access token", token(`{"sub":"abc","exp":1709737200}`), 1709737200, true},
+		{"bearer prefix", "Bearer " + token(`{"exp":1709737200}`), 1709737200, true},
+		{"no exp claim", token(`{"sub":"abc"}`), 0, false},
+		{"not a JWT", "opaque-token", 0, false},
+		{"bad payload", "header.!!!.signature", 0, false},
+	}
+	for _, test := range tests {
+		expiry, ok := tokenExpiry(test.token)
+		if ok != test.ok || (ok && !expiry.Equal(time.Unix(test.expiry, 0))) {
+			t.Errorf("%s: got %v %v, want %v %v", test.name, expiry, ok, time.Unix(test.expiry, 0), test.ok)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// MoneyMigrationResult reports what MigrateMoney changed in each table.
+type MoneyMigrationResult struct {
+	DryRun bool                        `json:"dryRun"`
+	Tables []MoneyMigrationTableResult `json:"tables"`
+}
+
+type MoneyMigrationTableResult struct {
+	Table   string `json:"table"`
+	Scanned int    `json:"scanned"`
+	Updated int    `json:"updated"`
+	// Skipped items changed between being read and rewritten; running the
+	// migration again picks them up
+	Skipped int `json:"skipped,omitempty"`
+}
+
+// moneyAttributes returns the attribute names of the Money fields of a model.
+func moneyAttributes(t reflect.Type) []string {
+	var attributes []string
+	indexes, names := csvFields(t)
+	for n, i := range indexes {
+		if t.Field(i).Type == reflect.TypeOf(Money(0)) {
+			attributes = append(attributes, names[n])
+		}
+	}
+	return attributes
+}
+
+// moneyRewrite is a stored amount and the exact form it is rewritten to.
+type moneyRewrite struct {
+	Name  string
+	Old   string
+	Exact string
+}
+
+// moneyRewrites returns the amount attributes of a stored item that are not
+// in exact form, rounded to the minor unit of currency.
+func moneyRewrites(table string, item map[string]*dynamodb.AttributeValue, attributes []string, currency string) ([]moneyRewrite, error) {
+	var rewrites []moneyRewrite
+	for _, name := range attributes {
+		value, ok := item[name]
+		if !ok || value.N == nil {
+			continue
+		}
+		amount, err := ParseMoney(*value.N)
+		if err != nil {
+			return nil, fmt.Errorf("%s item has an invalid %s: %v", table, name, err)
+		}
+		if exact := amount.Round(currency).String(); exact != *value.N {
+			rewrites = append(rewrites, moneyRewrite{Name: name, Old: *value.N, Exact: exact})
+		}
+	}
+	return rewrites, nil
+}
+
+// MigrateMoney rewrites stored amounts in their exact decimal form, rounded to
+// the minor unit of the item's currency. Amounts saved before Money existed
+// may hold binary float expansions such as 0.30000000000000004. Only the
+// amount attributes are written, and only while they and the currency are
+// still as they were read, so edits made during the migration are kept.
+// Items already in exact form are left alone, so the migration can be run
+// more than once.
+func MigrateMoney(dryRun bool) (*MoneyMigrationResult, error) {
+	result := &MoneyMigrationResult{DryRun: dryRun}
+	for _, section := range exportSections {
+		attributes := moneyAttributes(reflect.TypeOf(section.Item))
+		if len(attributes) == 0 {
+			continue
+		}
+
+		tableResult := MoneyMigrationTableResult{Table: section.Table}
+		type pending struct {
+			key      map[string]*dynamodb.AttributeValue
+			currency string
+			rewrites []moneyRewrite
+		}
+		var updates []pending
+		err := ScanAllItems(section.Table, func(item map[string]*dynamodb.AttributeValue) error {
+			tableResult.Scanned++
+
+			currency := ""
+			if value, ok := item["currency"]; ok {
+				currency = aws.StringValue(value.S)
+			}
+			rewrites, err := moneyRewrites(section.Table, item, attributes, currency)
+			if err != nil {
+				return err
+			}
+			if len(rewrites) == 0 {
+				return nil
+			}
+			key := map[string]*dynamodb.AttributeValue{section.PartitionKey: item[section.PartitionKey]}
+			if section.SortKey != "" {
+				key[section.SortKey] = item[section.SortKey]
+			}
+			updates = append(updates, pending{key: key, currency: currency, rewrites: rewrites})
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if dryRun {
+			tableResult.Updated = len(updates)
+			result.Tables = append(result.Tables, tableResult)
+			continue
+		}
+		for _, update := range updates {
+			updated, err := RewriteMoney(section.Table, update.key, update.currency, update.rewrites)
+			if err != nil {
+				return nil, err
+			}
+			if updated {
+				tableResult.Updated++
+			} else {
+				tableResult.Skipped++
+			}
+		}
+		result.Tables = append(result.Tables, tableResult)
+	}
+	return result, nil
+}
+
+// MigrateMoneyCommand implements the "migrate-money" admin command:
+//
+//	backend migrate-money [-dry-run]
+func MigrateMoneyCommand(args []string) int {
+	flags := flag.NewFlagSet("migrate-money", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "report what would be rewritten without writing")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	result, err := MigrateMoney(*dryRun)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "migrate-money: %v\n", err)
+		return 1
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(result)
+	return 0
+}
+
+// MonthIndexResult reports what IndexUserMonths found in each table.
+type MonthIndexResult struct {
+	DryRun bool                    `json:"dryRun"`
+	Months int                     `json:"months"`
+	Tables []MonthIndexTableResult `json:"tables"`
+}
+
+type MonthIndexTableResult struct {
+	Table   string `json:"table"`
+	Scanned int    `json:"scanned"`
+}
+
+// IndexUserMonths records the months of every item stored before the
+// UserMonths table existed. Reads across all of a user's months only look at
+// the months recorded there, so this must be run once when upgrading. It can
+// be run again safely.
+func IndexUserMonths(dryRun bool) (*MonthIndexResult, error) {
+	result := &MonthIndexResult{DryRun: dryRun}
+	months := make(map[string]map[string]bool)
+	for _, section := range exportSections {
+		if !section.monthly() {
+			continue
+		}
+
+		tableResult := MonthIndexTableResult{Table: section.Table}
+		err := ScanAllItems(section.Table, func(item map[string]*dynamodb.AttributeValue) error {
+			tableResult.Scanned++
+			partition, ok := item["userId#month"]
+			if !ok {
+				return nil
+			}
+			userId, month, ok := strings.Cut(aws.StringValue(partition.S), "#")
+			if !ok {
+				return nil
+			}
+			if months[userId] == nil {
+				months[userId] = make(map[string]bool)
+			}
+			if !months[userId][month] {
+				months[userId][month] = true
+				result.Months++
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		result.Tables = append(result.Tables, tableResult)
+	}
+
+	if dryRun {
+		return result, nil
+	}
+	for userId, userMonths := range months {
+		var list []string
+		for month := range userMonths {
+			list = append(list, month)
+		}
+		if err := AddUserMonths(userId, list...); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// IndexMonthsCommand implements the "index-months" admin command:
+//
+//	backend index-months [-dry-run]
+func IndexMonthsCommand(args []string) int {
+	flags := flag.NewFlagSet("index-months", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "report what would be recorded without writing")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	result, err := IndexUserMonths(*dryRun)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "index-months: %v\n", err)
+		return 1
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(result)
+	return 0
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func TestMoneyRewrites(t *testing.T) {
+	attributes := moneyAttributes(reflect.TypeOf(ExpenseItem{}))
+	number := func(value string) *dynamodb.AttributeValue {
+		return &dynamodb.AttributeValue{N: aws.String(value)}
+	}
+
+	tests := []struct {
+		name     string
+		item     map[string]*dynamodb.AttributeValue
+		currency string
+		want     []moneyRewrite
+	}{
+		{
+			"float expansion",
+			map[string]*dynamodb.AttributeValue{"expenseItemValue": number("0.30000000000000004")},
+			"USD",
+			[]moneyRewrite{{Name: "expenseItemValue", Old: "0.30000000000000004", Exact: "0.3"}},
+		},
+		{
+			"rounded to the currency",
+			map[string]*dynamodb.AttributeValue{"expenseItemValue": number("1234.5")},
+			"JPY",
+			[]moneyRewrite{{Name: "expenseItemValue", Old: "1234.5", Exact: "1234"}},
+		},
+		{
+			"already exact",
+			map[string]*dynamodb.AttributeValue{"expenseItemValue": number("12.5")},
+			"EUR",
+			nil,
+		},
+		{
+			"other attributes are ignored",
+			map[string]*dynamodb.AttributeValue{"expenseItemName": {S: aws.String("rent")}, "notes": number("0.1000001")},
+			"",
+			nil,
+		},
+	}
+	for _, test := range tests {
+		got, err := moneyRewrites("Expenses", test.item, attributes, test.currency)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %+v, want %+v", test.name, got, test.want)
+		}
+	}
+
+	if _, err := moneyRewrites("Expenses", map[string]*dynamodb.AttributeValue{"expenseItemValue": number("0x10")}, attributes, "USD"); err == nil {
+		t.Error("expected an error for an invalid amount")
+	}
+}
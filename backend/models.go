@@ -1,5 +1,7 @@
 package main
 
+import "time"
+
 type UserData struct {
 	Username string `json:"username"`
 	UserId   string `json:"userId"`
@@ -26,23 +28,842 @@ type AuthResult struct {
 }
 
 type IncomeItem struct {
-	UserId          string  `json:"userId"`
-	IncomeItemName  string  `json:"incomeItemName"`
-	Month           string  `json:"month"`
-	IncomeItemValue float64 `json:"incomeItemValue"`
+	UserId          string `json:"userId"`
+	IncomeItemName  string `json:"incomeItemName"`
+	Month           string `json:"month"`
+	IncomeItemValue Money  `json:"incomeItemValue"`
+	Date            string `json:"date,omitempty"`
+	Payer           string `json:"payer,omitempty"`
+	AccountId       string `json:"accountId,omitempty"`
+	Currency        string `json:"currency,omitempty"`
 }
 
 type BudgetItem struct {
-	UserID          string  `json:"userId"`
-	Month           string  `json:"month"`
-	BudgetItemName  string  `json:"budgetItemName"`
-	BudgetItemValue float64 `json:"budgetItemValue"`
+	UserID          string `json:"userId"`
+	Month           string `json:"month"`
+	BudgetItemName  string `json:"budgetItemName"`
+	BudgetItemValue Money  `json:"budgetItemValue"`
+	Currency        string `json:"currency,omitempty"`
 }
 
 type ExpenseItem struct {
 	UserId          string   `json:"userId"`
 	ExpenseItemName string   `json:"expenseItemName"`
 	Month           string   `json:"month"`
-	ExpenseValue    float64  `json:"expenseItemValue"`
+	ExpenseValue    Money    `json:"expenseItemValue"`
 	ExpenseTags     []string `json:"expenseTags"`
+	Date            string   `json:"date,omitempty"`
+	Merchant        string   `json:"merchant,omitempty"`
+	DuplicateOf     string   `json:"duplicateOf,omitempty"`
+	// DuplicateOfMonth is the month of the DuplicateOf item when it is not
+	// the same as this item's
+	DuplicateOfMonth string          `json:"duplicateOfMonth,omitempty"`
+	AccountId        string          `json:"accountId,omitempty"`
+	Currency         string          `json:"currency,omitempty"`
+	Splits           []ExpenseSplit  `json:"splits,omitempty"`
+	Sharing          *ExpenseSharing `json:"sharing,omitempty"`
+	AnomalyScore     float64         `json:"anomalyScore,omitempty"`
+	Anomalies        []string        `json:"anomalies,omitempty"`
+}
+
+// ExpenseSplit is one line of an expense that covers several categories,
+// such as the groceries on a supermarket receipt that also has pharmacy
+// items. The lines of an expense add up to its value.
+type ExpenseSplit struct {
+	Amount   Money    `json:"amount"`
+	Category string   `json:"category"`
+	Tags     []string `json:"tags"`
+	Note     string   `json:"note,omitempty"`
+}
+
+// UserSettings holds per-user preferences. Amounts without a currency are in
+// the base currency.
+type UserSettings struct {
+	UserId       string `json:"userId"`
+	BaseCurrency string `json:"baseCurrency"`
+}
+
+// ExchangeRate is the number of units of ToCurrency one unit of FromCurrency
+// was worth on Date.
+type ExchangeRate struct {
+	UserId       string  `json:"userId"`
+	RateId       string  `json:"rateId"`
+	FromCurrency string  `json:"fromCurrency"`
+	ToCurrency   string  `json:"toCurrency"`
+	Date         string  `json:"date"`
+	Rate         float64 `json:"rate"`
+}
+
+// CurrencyReport summarizes a month with every amount converted to the
+// user's base currency.
+type CurrencyReport struct {
+	Month         string           `json:"month"`
+	BaseCurrency  string           `json:"baseCurrency"`
+	Income        Money            `json:"income"`
+	Budget        Money            `json:"budget"`
+	Expenses      Money            `json:"expenses"`
+	Net           Money            `json:"net"`
+	ExpensesByTag map[string]Money `json:"expensesByTag"`
+	// ExpensesByCategory attributes split expenses line by line; expenses
+	// that are not split are counted under "uncategorized"
+	ExpensesByCategory map[string]Money `json:"expensesByCategory"`
+	Budgets            []BudgetLine     `json:"budgets"`
+	MissingRates       []string         `json:"missingRates"`
+}
+
+// BudgetLine compares a budget item with the spending in the category of the
+// same name.
+type BudgetLine struct {
+	BudgetItemName string `json:"budgetItemName"`
+	Budget         Money  `json:"budget"`
+	Spent          Money  `json:"spent"`
+	Remaining      Money  `json:"remaining"`
+}
+
+type Account struct {
+	UserId         string `json:"userId"`
+	AccountId      string `json:"accountId"`
+	AccountName    string `json:"accountName"`
+	AccountType    string `json:"accountType"`
+	Currency       string `json:"currency"`
+	OpeningBalance Money  `json:"openingBalance"`
+	OpeningDate    string `json:"openingDate"`
+}
+
+// Transfer moves money between two of a user's accounts. Transfers are kept
+// apart from income and expenses so they never count as spending.
+type Transfer struct {
+	UserId        string `json:"userId"`
+	TransferId    string `json:"transferId"`
+	Month         string `json:"month"`
+	Date          string `json:"date"`
+	FromAccountId string `json:"fromAccountId"`
+	ToAccountId   string `json:"toAccountId"`
+	Amount        Money  `json:"amount"`
+	// ToAmount is what arrived in the to account, in its currency, when
+	// the two accounts are in different currencies
+	ToAmount    Money  `json:"toAmount,omitempty"`
+	Description string `json:"description,omitempty"`
+	// Settlements between members of a group record who paid whom rather
+	// than which accounts the money moved between
+	Group           string `json:"group,omitempty"`
+	FromParticipant string `json:"fromParticipant,omitempty"`
+	ToParticipant   string `json:"toParticipant,omitempty"`
+	Currency        string `json:"currency,omitempty"`
+}
+
+// ExpenseSharing records who paid an expense and how it is shared among a
+// group of participants, such as friends on a trip. Method is one of equal,
+// shares, exact or percent.
+type ExpenseSharing struct {
+	Group        string         `json:"group"`
+	PaidBy       string         `json:"paidBy"`
+	Method       string         `json:"method"`
+	Participants []ExpenseShare `json:"participants"`
+}
+
+// ExpenseShare is one participant's part of a shared expense. Weight holds
+// the number of shares or the percentage, depending on the method; Amount is
+// given for the exact method and computed for the others.
+type ExpenseShare struct {
+	Participant string  `json:"participant"`
+	Weight      float64 `json:"weight,omitempty"`
+	Amount      Money   `json:"amount"`
+}
+
+// GroupBalance is what a participant is owed (positive) or owes (negative)
+// across a group's shared expenses and settlements in one currency.
+type GroupBalance struct {
+	Participant string `json:"participant"`
+	Currency    string `json:"currency,omitempty"`
+	Balance     Money  `json:"balance"`
+}
+
+// SettlementSuggestion is a payment that would settle part of a group's
+// balances.
+type SettlementSuggestion struct {
+	FromParticipant string `json:"fromParticipant"`
+	ToParticipant   string `json:"toParticipant"`
+	Currency        string `json:"currency,omitempty"`
+	Amount          Money  `json:"amount"`
+}
+
+type GroupBalances struct {
+	Group       string                 `json:"group"`
+	Balances    []GroupBalance         `json:"balances"`
+	Settlements []SettlementSuggestion `json:"settlements"`
+}
+
+// AccountBalance is one month of an account's running balance.
+type AccountBalance struct {
+	Month        string `json:"month"`
+	Income       Money  `json:"income"`
+	Expenses     Money  `json:"expenses"`
+	TransfersIn  Money  `json:"transfersIn"`
+	TransfersOut Money  `json:"transfersOut"`
+	Balance      Money  `json:"balance"`
+}
+
+// StatementTransaction is a single bank statement line, normalized across
+// the supported import formats. Negative amounts are debits.
+type StatementTransaction struct {
+	TransactionId string
+	AccountId     string
+	Date          time.Time
+	Amount        Money
+	Payee         string
+	Memo          string
+}
+
+type ImportResult struct {
+	Format          string           `json:"format"`
+	Transactions    int              `json:"transactions"`
+	ExpensesAdded   int              `json:"expensesAdded"`
+	IncomeAdded     int              `json:"incomeAdded"`
+	AlreadyImported int              `json:"alreadyImported"`
+	Duplicates      []DuplicateMatch `json:"duplicates"`
+	Anomalies       []ExpenseAnomaly `json:"anomalies"`
+}
+
+// DuplicateMatch reports an expense that looks like another expense already
+// recorded in the same month.
+type DuplicateMatch struct {
+	Month            string  `json:"month"`
+	ExpenseItemName  string  `json:"expenseItemName"`
+	DuplicateOf      string  `json:"duplicateOf"`
+	DuplicateOfMonth string  `json:"duplicateOfMonth"`
+	Score            float64 `json:"score"`
+}
+
+// ExpenseAnomaly explains why an expense, or a category's spending for a
+// month, looks unusual. Score is how many standard deviations the amount is
+// above its baseline, or for a new merchant how many times the typical
+// expense it is.
+type ExpenseAnomaly struct {
+	Kind            string  `json:"kind"`
+	Month           string  `json:"month"`
+	ExpenseItemName string  `json:"expenseItemName,omitempty"`
+	Merchant        string  `json:"merchant,omitempty"`
+	Tag             string  `json:"tag,omitempty"`
+	Category        string  `json:"category,omitempty"`
+	Amount          Money   `json:"amount"`
+	Baseline        Money   `json:"baseline"`
+	Currency        string  `json:"currency,omitempty"`
+	Score           float64 `json:"score"`
+	Explanation     string  `json:"explanation"`
+}
+
+// Household is a shared workspace. Its HouseholdId is used in place of a
+// userId to partition the income, budget and expense data it owns.
+type Household struct {
+	HouseholdId   string `json:"householdId"`
+	HouseholdName string `json:"householdName"`
+	CreatedBy     string `json:"createdBy"`
+	CreatedAt     string `json:"createdAt"`
+}
+
+type HouseholdMember struct {
+	HouseholdId string `json:"householdId"`
+	UserId      string `json:"userId"`
+	UserName    string `json:"userName"`
+	Role        string `json:"role"`
+	JoinedAt    string `json:"joinedAt"`
+}
+
+// HouseholdInvitation invites a user, by username or email, to join a
+// household with a role.
+type HouseholdInvitation struct {
+	HouseholdId   string `json:"householdId"`
+	InvitationId  string `json:"invitationId"`
+	HouseholdName string `json:"householdName"`
+	Invitee       string `json:"invitee"`
+	Role          string `json:"role"`
+	InvitedBy     string `json:"invitedBy"`
+	CreatedAt     string `json:"createdAt"`
+}
+
+// Membership is a household the caller belongs to, with their role in it.
+type Membership struct {
+	Household
+	Role string `json:"role"`
+}
+
+// Goal is a savings target, such as an emergency fund, to reach by a date.
+// StartingAmount is what was already saved when the goal was created.
+type Goal struct {
+	UserId         string `json:"userId"`
+	GoalId         string `json:"goalId"`
+	GoalName       string `json:"goalName"`
+	TargetAmount   Money  `json:"targetAmount"`
+	TargetDate     string `json:"targetDate"`
+	StartingAmount Money  `json:"startingAmount"`
+	Currency       string `json:"currency,omitempty"`
+	CreatedAt      string `json:"createdAt"`
+}
+
+// GoalContribution is money put towards a goal: a manual deposit, or an
+// income or expense item (such as a transfer to savings) linked by its month
+// and name. Negative amounts are withdrawals.
+type GoalContribution struct {
+	UserId         string `json:"userId"`
+	ContributionId string `json:"contributionId"`
+	GoalId         string `json:"goalId"`
+	Date           string `json:"date"`
+	Amount         Money  `json:"amount"`
+	Source         string `json:"source"`
+	Month          string `json:"month,omitempty"`
+	ItemName       string `json:"itemName,omitempty"`
+	Note           string `json:"note,omitempty"`
+}
+
+// GoalProgress reports how far a goal has come and what it will take to
+// reach it. ProjectedCompletion is the month the goal is reached at the
+// recent contribution rate, or empty if nothing has been contributed lately.
+type GoalProgress struct {
+	Goal                Goal    `json:"goal"`
+	Saved               Money   `json:"saved"`
+	Remaining           Money   `json:"remaining"`
+	PercentComplete     float64 `json:"percentComplete"`
+	MonthsRemaining     int     `json:"monthsRemaining"`
+	RequiredMonthly     Money   `json:"requiredMonthly"`
+	RecentMonthlyRate   Money   `json:"recentMonthlyRate"`
+	ProjectedCompletion string  `json:"projectedCompletion"`
+	OnTrack             bool    `json:"onTrack"`
+}
+
+// Debt is a loan or card balance being paid down. Balance is what was owed
+// on BalanceDate; payments recorded after that date reduce it. APR is a
+// yearly percentage rate, and DueDay the day of the month payments are due.
+type Debt struct {
+	UserId         string  `json:"userId"`
+	DebtId         string  `json:"debtId"`
+	DebtName       string  `json:"debtName"`
+	Balance        Money   `json:"balance"`
+	BalanceDate    string  `json:"balanceDate"`
+	APR            float64 `json:"apr"`
+	MinimumPayment Money   `json:"minimumPayment"`
+	DueDay         int     `json:"dueDay"`
+	Currency       string  `json:"currency,omitempty"`
+	AccountId      string  `json:"accountId,omitempty"`
+}
+
+// DebtPayment is a payment made against a debt, recorded from the expense
+// item that paid it.
+type DebtPayment struct {
+	UserId          string `json:"userId"`
+	PaymentId       string `json:"paymentId"`
+	DebtId          string `json:"debtId"`
+	Date            string `json:"date"`
+	Amount          Money  `json:"amount"`
+	Month           string `json:"month"`
+	ExpenseItemName string `json:"expenseItemName"`
+}
+
+// DebtStatus is a debt with its payments applied.
+type DebtStatus struct {
+	Debt
+	CurrentBalance Money `json:"currentBalance"`
+	PaidToDate     Money `json:"paidToDate"`
+}
+
+// PayoffPlan is a month-by-month simulation of paying off every debt with
+// one strategy.
+type PayoffPlan struct {
+	Strategy      string        `json:"strategy"`
+	ExtraMonthly  Money         `json:"extraMonthly"`
+	Months        int           `json:"months"`
+	PayoffDate    string        `json:"payoffDate"`
+	TotalInterest Money         `json:"totalInterest"`
+	TotalPaid     Money         `json:"totalPaid"`
+	Debts         []DebtPayoff  `json:"debts"`
+	Schedule      []PayoffMonth `json:"schedule"`
+}
+
+// DebtPayoff summarizes when one debt is paid off under a plan.
+type DebtPayoff struct {
+	DebtId       string `json:"debtId"`
+	DebtName     string `json:"debtName"`
+	PayoffDate   string `json:"payoffDate"`
+	Months       int    `json:"months"`
+	InterestPaid Money  `json:"interestPaid"`
+	TotalPaid    Money  `json:"totalPaid"`
+}
+
+type PayoffMonth struct {
+	Month    string             `json:"month"`
+	Payments []DebtMonthPayment `json:"payments"`
+}
+
+type DebtMonthPayment struct {
+	DebtId   string `json:"debtId"`
+	Payment  Money  `json:"payment"`
+	Interest Money  `json:"interest"`
+	Balance  Money  `json:"balance"`
+}
+
+// PayoffComparison compares the avalanche and snowball plans for the same
+// debts and monthly budget.
+type PayoffComparison struct {
+	Currency      string     `json:"currency,omitempty"`
+	Avalanche     PayoffPlan `json:"avalanche"`
+	Snowball      PayoffPlan `json:"snowball"`
+	InterestSaved Money      `json:"interestSaved"`
+}
+
+// Holding is an asset or liability tracked outside the accounts, such as a
+// house, a car or a mortgage, valued by dated snapshots.
+type Holding struct {
+	UserId      string `json:"userId"`
+	HoldingId   string `json:"holdingId"`
+	HoldingName string `json:"holdingName"`
+	Kind        string `json:"kind"`
+	Class       string `json:"class"`
+	Currency    string `json:"currency,omitempty"`
+}
+
+// HoldingValuation is the value of a holding on a date. Liabilities are
+// valued at the positive amount owed.
+type HoldingValuation struct {
+	UserId      string `json:"userId"`
+	ValuationId string `json:"valuationId"`
+	HoldingId   string `json:"holdingId"`
+	Date        string `json:"date"`
+	Value       Money  `json:"value"`
+}
+
+// NetWorthPoint is the net worth at the end of a month, in the base
+// currency, broken down by class. Account balances are classed by account
+// type.
+type NetWorthPoint struct {
+	Month              string           `json:"month"`
+	Date               string           `json:"date"`
+	Assets             Money            `json:"assets"`
+	Liabilities        Money            `json:"liabilities"`
+	NetWorth           Money            `json:"netWorth"`
+	AssetsByClass      map[string]Money `json:"assetsByClass"`
+	LiabilitiesByClass map[string]Money `json:"liabilitiesByClass"`
+}
+
+type NetWorthSeries struct {
+	BaseCurrency string          `json:"baseCurrency"`
+	Points       []NetWorthPoint `json:"points"`
+	MissingRates []string        `json:"missingRates"`
+}
+
+// InvestmentTransaction is a buy, sell or dividend in an investment account.
+// Buys and sells carry a quantity and a price per unit, dividends only an
+// amount; all amounts are in the account's currency. Unit prices are quotes
+// rather than amounts and may have more decimals than the currency, so like
+// exchange rates they are kept as plain numbers.
+type InvestmentTransaction struct {
+	UserId        string  `json:"userId"`
+	TransactionId string  `json:"transactionId"`
+	AccountId     string  `json:"accountId"`
+	Type          string  `json:"type"`
+	Symbol        string  `json:"symbol"`
+	Date          string  `json:"date"`
+	Quantity      float64 `json:"quantity,omitempty"`
+	Price         float64 `json:"price,omitempty"`
+	Fees          Money   `json:"fees,omitempty"`
+	Amount        Money   `json:"amount,omitempty"`
+	Currency      string  `json:"currency,omitempty"`
+	Note          string  `json:"note,omitempty"`
+}
+
+// SecurityPrice is the closing price of a symbol on a date. A price with a
+// currency only values holdings in accounts of that currency; one without is
+// taken to be in the currency of whichever account holds the symbol.
+type SecurityPrice struct {
+	UserId   string  `json:"userId"`
+	PriceId  string  `json:"priceId"`
+	Symbol   string  `json:"symbol"`
+	Date     string  `json:"date"`
+	Price    float64 `json:"price"`
+	Currency string  `json:"currency,omitempty"`
+}
+
+// Lot is the part of a buy that has not been sold yet, valued at the latest
+// price on or before the valuation date.
+type Lot struct {
+	LotId          string  `json:"lotId"`
+	AccountId      string  `json:"accountId"`
+	Symbol         string  `json:"symbol"`
+	Date           string  `json:"date"`
+	Quantity       float64 `json:"quantity"`
+	CostBasis      Money   `json:"costBasis"`
+	Price          float64 `json:"price"`
+	PriceDate      string  `json:"priceDate,omitempty"`
+	MarketValue    Money   `json:"marketValue"`
+	UnrealizedGain Money   `json:"unrealizedGain"`
+}
+
+// Position totals the open lots of one symbol in one account.
+type Position struct {
+	AccountId      string  `json:"accountId"`
+	Symbol         string  `json:"symbol"`
+	Currency       string  `json:"currency"`
+	Quantity       float64 `json:"quantity"`
+	CostBasis      Money   `json:"costBasis"`
+	Price          float64 `json:"price"`
+	PriceDate      string  `json:"priceDate,omitempty"`
+	MarketValue    Money   `json:"marketValue"`
+	UnrealizedGain Money   `json:"unrealizedGain"`
+	Dividends      Money   `json:"dividends"`
+}
+
+// RealizedGain is the gain on the part of a lot closed by a sell.
+type RealizedGain struct {
+	AccountId string  `json:"accountId"`
+	Symbol    string  `json:"symbol"`
+	LotId     string  `json:"lotId"`
+	BuyDate   string  `json:"buyDate"`
+	SellDate  string  `json:"sellDate"`
+	Quantity  float64 `json:"quantity"`
+	CostBasis Money   `json:"costBasis"`
+	Proceeds  Money   `json:"proceeds"`
+	Gain      Money   `json:"gain"`
+}
+
+// InvestmentGains reports positions, open lots and realized gains as of a
+// date. The totals are in the base currency.
+type InvestmentGains struct {
+	Date            string         `json:"date"`
+	BaseCurrency    string         `json:"baseCurrency"`
+	Positions       []Position     `json:"positions"`
+	Lots            []Lot          `json:"lots"`
+	Realized        []RealizedGain `json:"realized"`
+	TotalCostBasis  Money          `json:"totalCostBasis"`
+	TotalValue      Money          `json:"totalValue"`
+	TotalUnrealized Money          `json:"totalUnrealized"`
+	TotalRealized   Money          `json:"totalRealized"`
+	TotalDividends  Money          `json:"totalDividends"`
+	MissingPrices   []string       `json:"missingPrices"`
+	MissingRates    []string       `json:"missingRates"`
+}
+
+// InvestmentAllocation breaks the market value of the open positions down by
+// symbol and by account, in the base currency.
+type InvestmentAllocation struct {
+	Date          string            `json:"date"`
+	BaseCurrency  string            `json:"baseCurrency"`
+	Total         Money             `json:"total"`
+	BySymbol      []AllocationSlice `json:"bySymbol"`
+	ByAccount     []AllocationSlice `json:"byAccount"`
+	MissingPrices []string          `json:"missingPrices"`
+	MissingRates  []string          `json:"missingRates"`
+}
+
+type AllocationSlice struct {
+	Name    string  `json:"name"`
+	Value   Money   `json:"value"`
+	Percent float64 `json:"percent"`
+}
+
+// TrendReport is a spending time series per category or tag over a range of
+// months, in the base currency, with the same measures for the total.
+type TrendReport struct {
+	From         string        `json:"from"`
+	To           string        `json:"to"`
+	GroupBy      string        `json:"groupBy"`
+	BaseCurrency string        `json:"baseCurrency"`
+	Window       int           `json:"window"`
+	Totals       []TrendPoint  `json:"totals"`
+	Series       []TrendSeries `json:"series"`
+	TopMovers    []TrendMover  `json:"topMovers"`
+	MissingRates []string      `json:"missingRates"`
+}
+
+// TrendPoint is one month of a series. The deltas compare it with the month
+// before and the same month a year earlier; percentages are left out when
+// there was no spending to compare with.
+type TrendPoint struct {
+	Month          string   `json:"month"`
+	Amount         Money    `json:"amount"`
+	MoM            Money    `json:"mom"`
+	MoMPercent     *float64 `json:"momPercent,omitempty"`
+	YoY            Money    `json:"yoy"`
+	YoYPercent     *float64 `json:"yoyPercent,omitempty"`
+	RollingAverage Money    `json:"rollingAverage"`
+}
+
+type TrendSeries struct {
+	Key    string       `json:"key"`
+	Total  Money        `json:"total"`
+	Points []TrendPoint `json:"points"`
+}
+
+// TrendMover is a category or tag whose spending changed the most between
+// the last two months of the range.
+type TrendMover struct {
+	Key           string   `json:"key"`
+	Current       Money    `json:"current"`
+	Previous      Money    `json:"previous"`
+	Change        Money    `json:"change"`
+	ChangePercent *float64 `json:"changePercent,omitempty"`
+}
+
+// RecurringItem is an income or expense the user knows will repeat, such as
+// a salary or rent, used by the cash-flow forecast. Past income and expense
+// items with the same name, merchant or payer are taken to be occurrences of
+// it.
+type RecurringItem struct {
+	UserId      string `json:"userId"`
+	RecurringId string `json:"recurringId"`
+	Name        string `json:"name"`
+	Kind        string `json:"kind"`
+	Amount      Money  `json:"amount"`
+	Currency    string `json:"currency,omitempty"`
+	Category    string `json:"category,omitempty"`
+	Frequency   string `json:"frequency"`
+	StartDate   string `json:"startDate"`
+	EndDate     string `json:"endDate,omitempty"`
+}
+
+// CashFlowForecast projects income, spending and the combined balance of the
+// accounts for the coming months, in the base currency.
+type CashFlowForecast struct {
+	BaseCurrency    string          `json:"baseCurrency"`
+	HistoryMonths   int             `json:"historyMonths"`
+	OpeningBalance  Money           `json:"openingBalance"`
+	Months          []ForecastMonth `json:"months"`
+	ShortfallMonths []string        `json:"shortfallMonths"`
+	MissingRates    []string        `json:"missingRates"`
+}
+
+// ForecastMonth is one projected month. Shortfall is set when projected
+// spending exceeds projected income.
+type ForecastMonth struct {
+	Month              string           `json:"month"`
+	Income             ForecastRange    `json:"income"`
+	Spending           ForecastRange    `json:"spending"`
+	Net                Money            `json:"net"`
+	EndingBalance      ForecastRange    `json:"endingBalance"`
+	SpendingByCategory map[string]Money `json:"spendingByCategory"`
+	Recurring          []string         `json:"recurring"`
+	Shortfall          bool             `json:"shortfall"`
+}
+
+// ForecastRange is a projected amount with its confidence band.
+type ForecastRange struct {
+	Expected Money `json:"expected"`
+	Low      Money `json:"low"`
+	High     Money `json:"high"`
+}
+
+// Scenario is a what-if copy of a month's income and budget, kept apart
+// from the real Income and Budget tables so that its lines can be changed
+// freely and compared with other scenarios.
+type Scenario struct {
+	UserId       string         `json:"userId"`
+	ScenarioId   string         `json:"scenarioId"`
+	ScenarioName string         `json:"scenarioName"`
+	BaseMonth    string         `json:"baseMonth"`
+	CreatedAt    string         `json:"createdAt"`
+	Lines        []ScenarioLine `json:"lines"`
+}
+
+// ScenarioLine is a monthly income or budget amount in a scenario, applying
+// from StartMonth through EndMonth when they are set. A loan line is a budget
+// line whose amount is the repayment of Principal over TermMonths at APR.
+type ScenarioLine struct {
+	Kind       string  `json:"kind"`
+	Name       string  `json:"name"`
+	Amount     Money   `json:"amount"`
+	Currency   string  `json:"currency,omitempty"`
+	StartMonth string  `json:"startMonth,omitempty"`
+	EndMonth   string  `json:"endMonth,omitempty"`
+	Principal  Money   `json:"principal,omitempty"`
+	APR        float64 `json:"apr,omitempty"`
+	TermMonths int     `json:"termMonths,omitempty"`
+}
+
+// ScenarioComparison projects scenarios side by side over the same months,
+// in the base currency.
+type ScenarioComparison struct {
+	BaseCurrency string               `json:"baseCurrency"`
+	StartMonth   string               `json:"startMonth"`
+	Months       int                  `json:"months"`
+	Scenarios    []ScenarioProjection `json:"scenarios"`
+	MissingRates []string             `json:"missingRates"`
+}
+
+// ScenarioProjection is one scenario's months. NetDifference compares its
+// total net with the first scenario compared.
+type ScenarioProjection struct {
+	ScenarioId    string          `json:"scenarioId"`
+	ScenarioName  string          `json:"scenarioName"`
+	Months        []ScenarioMonth `json:"months"`
+	TotalIncome   Money           `json:"totalIncome"`
+	TotalSpending Money           `json:"totalSpending"`
+	TotalNet      Money           `json:"totalNet"`
+	NetDifference Money           `json:"netDifference"`
+}
+
+type ScenarioMonth struct {
+	Month         string `json:"month"`
+	Income        Money  `json:"income"`
+	Spending      Money  `json:"spending"`
+	Net           Money  `json:"net"`
+	CumulativeNet Money  `json:"cumulativeNet"`
+}
+
+// Subscription is a recurring charge detected in the expense history: the
+// same merchant charging a similar amount at a regular cadence.
+type Subscription struct {
+	Merchant            string       `json:"merchant"`
+	Currency            string       `json:"currency,omitempty"`
+	Cadence             string       `json:"cadence"`
+	Occurrences         int          `json:"occurrences"`
+	FirstDate           string       `json:"firstDate"`
+	LastDate            string       `json:"lastDate"`
+	LastAmount          Money        `json:"lastAmount"`
+	AverageAmount       Money        `json:"averageAmount"`
+	EstimatedAnnualCost Money        `json:"estimatedAnnualCost"`
+	NextExpectedDate    string       `json:"nextExpectedDate"`
+	Status              string       `json:"status"`
+	Known               bool         `json:"known"`
+	PriceIncrease       *PriceChange `json:"priceIncrease,omitempty"`
+	Flags               []string     `json:"flags"`
+}
+
+// PriceChange is the most recent rise in a subscription's amount.
+type PriceChange struct {
+	Date    string  `json:"date"`
+	From    Money   `json:"from"`
+	To      Money   `json:"to"`
+	Percent float64 `json:"percent"`
+}
+
+// AlertRule is a condition a user wants to be told about, such as spending
+// reaching a share of a budget item. Rules are checked whenever expenses or
+// budget items change, and each one fires at most once per month and
+// subject.
+type AlertRule struct {
+	UserId   string `json:"userId"`
+	RuleId   string `json:"ruleId"`
+	RuleName string `json:"ruleName"`
+	Type     string `json:"type"`
+	// BudgetItemName and Percent apply to budget_percent rules
+	BudgetItemName string  `json:"budgetItemName,omitempty"`
+	Percent        float64 `json:"percent,omitempty"`
+	// Amount applies to expense_over rules, in the base currency
+	Amount Money `json:"amount,omitempty"`
+	// IncomeItemName and Day apply to income_missing rules
+	IncomeItemName string   `json:"incomeItemName,omitempty"`
+	Day            int      `json:"day,omitempty"`
+	Channels       []string `json:"channels"`
+	Disabled       bool     `json:"disabled,omitempty"`
+}
+
+// Notification is an alert that fired, kept in the user's inbox and sent to
+// the rule's other channels.
+type Notification struct {
+	UserId         string `json:"userId"`
+	NotificationId string `json:"notificationId"`
+	RuleId         string `json:"ruleId"`
+	Type           string `json:"type"`
+	Month          string `json:"month"`
+	Title          string `json:"title"`
+	Message        string `json:"message"`
+	CreatedAt      string `json:"createdAt"`
+	Read           bool   `json:"read"`
+	// DedupKey identifies what the alert was about, so it is not raised
+	// again
+	DedupKey  string   `json:"dedupKey"`
+	Delivered []string `json:"delivered"`
+}
+
+// EmailSubscription is one member's choice of the emails they get about a
+// workspace. Every kind of email is opt-in.
+type EmailSubscription struct {
+	UserId       string `json:"userId"`
+	SubscriberId string `json:"subscriberId"`
+	Email        string `json:"email"`
+	Alerts       bool   `json:"alerts"`
+	Weekly       bool   `json:"weekly"`
+	Monthly      bool   `json:"monthly"`
+	// UnsubscribeToken is the secret part of the unsubscribe links in the
+	// emails. It is not returned by the API.
+	UnsubscribeToken string `json:"unsubscribeToken,omitempty"`
+	// LastWeekly and LastMonthly are the periods of the last digests sent,
+	// such as 2024-W05 and 2024-01
+	LastWeekly  string `json:"lastWeekly,omitempty"`
+	LastMonthly string `json:"lastMonthly,omitempty"`
+	// PendingEmail is an address the member asked for that they have not
+	// confirmed yet; emails go to Email until they do. ConfirmToken is the
+	// secret part of the confirmation link and is not returned by the API.
+	PendingEmail string `json:"pendingEmail,omitempty"`
+	ConfirmToken string `json:"confirmToken,omitempty"`
+}
+
+// Digest summarizes a week or month of a workspace for an email, in the base
+// currency.
+type Digest struct {
+	UserId       string `json:"userId"`
+	Period       string `json:"period"`
+	PeriodKey    string `json:"periodKey"`
+	From         string `json:"from"`
+	To           string `json:"to"`
+	BaseCurrency string `json:"baseCurrency"`
+	Income       Money  `json:"income"`
+	Spending     Money  `json:"spending"`
+	Net          Money  `json:"net"`
+	// Budgets compares the budget of the month the period ends in with the
+	// spending in that month up to the end of the period
+	BudgetMonth   string           `json:"budgetMonth"`
+	Budgets       []BudgetLine     `json:"budgets"`
+	TopCategories []CategoryAmount `json:"topCategories"`
+	Anomalies     []DigestAnomaly  `json:"anomalies"`
+	MissingRates  []string         `json:"missingRates"`
+}
+
+type CategoryAmount struct {
+	Category string `json:"category"`
+	Amount   Money  `json:"amount"`
+}
+
+// DigestAnomaly is an expense in the period that was flagged as unusual when
+// it was added.
+type DigestAnomaly struct {
+	Date         string   `json:"date"`
+	Description  string   `json:"description"`
+	Amount       Money    `json:"amount"`
+	Currency     string   `json:"currency"`
+	Explanations []string `json:"explanations"`
+}
+
+// Webhook is an address that is sent the events of a workspace, signed with
+// the webhook's secret.
+type Webhook struct {
+	UserId    string `json:"userId"`
+	WebhookId string `json:"webhookId"`
+	URL       string `json:"url"`
+	// Events lists the event types sent, or "*" for all of them
+	Events    []string `json:"events"`
+	Disabled  bool     `json:"disabled,omitempty"`
+	CreatedAt string   `json:"createdAt"`
+	// Secret signs the deliveries. It is only returned when the webhook is
+	// created.
+	Secret string `json:"secret,omitempty"`
+}
+
+// WebhookDelivery records sending one event to a webhook, including every
+// attempt's outcome.
+type WebhookDelivery struct {
+	UserId       string `json:"userId"`
+	DeliveryId   string `json:"deliveryId"`
+	WebhookId    string `json:"webhookId"`
+	EventId      string `json:"eventId"`
+	EventType    string `json:"eventType"`
+	Payload      string `json:"payload"`
+	Status       string `json:"status"`
+	Attempts     int    `json:"attempts"`
+	StatusCode   int    `json:"statusCode,omitempty"`
+	Error        string `json:"error,omitempty"`
+	CreatedAt    string `json:"createdAt"`
+	LastAttempt  string `json:"lastAttempt,omitempty"`
+	RedeliveryOf string `json:"redeliveryOf,omitempty"`
+	// NextAttemptAt is when a pending delivery is next attempted, by the
+	// poller if the server making the attempt now does not record it
+	NextAttemptAt string `json:"nextAttemptAt,omitempty"`
 }
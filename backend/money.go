@@ -0,0 +1,236 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// Money is an exact decimal amount, held as a whole number of
+// ten-thousandths so that sums never drift. It reads and writes plain decimal
+// numbers in JSON, CSV and DynamoDB, so existing clients and stored items
+// keep working.
+//
+// Rounding policy: stored and reported amounts are rounded to the minor unit
+// of their currency (see currencyMinorUnits), with halves rounded to even.
+// Input with more than four decimals is rounded the same way on parsing.
+type Money int64
+
+// moneyScale is the number of decimals a Money value can hold.
+const moneyScale = 4
+
+const moneyUnit Money = 10000
+
+// currencyDigits lists the ISO 4217 currencies whose minor unit is not a
+// hundredth.
+var currencyDigits = map[string]int{
+	"BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "ISK": 0, "JPY": 0, "KMF": 0,
+	"KRW": 0, "PYG": 0, "RWF": 0, "UGX": 0, "UYI": 0, "VND": 0, "VUV": 0,
+	"XAF": 0, "XOF": 0, "XPF": 0,
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+}
+
+// currencyMinorUnits returns the number of decimals amounts in a currency are
+// rounded to. Amounts without a currency, and unknown currencies, use two.
+func currencyMinorUnits(currency string) int {
+	if digits, ok := currencyDigits[strings.ToUpper(currency)]; ok {
+		return digits
+	}
+	return 2
+}
+
+// decimalPattern matches plain decimal numbers with an optional exponent of
+// up to three digits. big.Rat on its own also accepts fractions and hex, octal
+// and binary forms such as "0x10", and an exponent large enough to exhaust
+// memory.
+var decimalPattern = regexp.MustCompile(`^[+-]?(\d+\.?\d*|\.\d+)([eE][+-]?\d{1,3})?$`)
+
+// ParseMoney parses a decimal number such as "12", "-0.5", "1234.5678" or
+// "1.5e2" exactly, without going through float64.
+func ParseMoney(value string) (Money, error) {
+	value = strings.TrimSpace(value)
+	if !decimalPattern.MatchString(value) {
+		return 0, fmt.Errorf("invalid amount %q", value)
+	}
+	r, ok := new(big.Rat).SetString(value)
+	if !ok {
+		return 0, fmt.Errorf("invalid amount %q", value)
+	}
+	r.Mul(r, big.NewRat(int64(moneyUnit), 1))
+	units, err := roundRatHalfEven(r)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q: %v", value, err)
+	}
+	return Money(units), nil
+}
+
+// MoneyFromFloat converts a float64 to the nearest Money value. It is only
+// meant for values that are inherently inexact, such as converted amounts.
+func MoneyFromFloat(value float64) Money {
+	return Money(math.RoundToEven(value * float64(moneyUnit)))
+}
+
+// roundRatHalfEven rounds a rational number to the nearest integer, halves to
+// even, and checks it fits in an int64.
+func roundRatHalfEven(r *big.Rat) (int64, error) {
+	quotient, remainder := new(big.Int).QuoRem(r.Num(), r.Denom(), new(big.Int))
+	twice := new(big.Int).Mul(new(big.Int).Abs(remainder), big.NewInt(2))
+	switch twice.Cmp(r.Denom()) {
+	case 1:
+		quotient.Add(quotient, big.NewInt(int64(remainder.Sign())))
+	case 0:
+		if quotient.Bit(0) == 1 {
+			quotient.Add(quotient, big.NewInt(int64(remainder.Sign())))
+		}
+	}
+	if !quotient.IsInt64() {
+		return 0, fmt.Errorf("amount out of range")
+	}
+	return quotient.Int64(), nil
+}
+
+// Round rounds m to the minor unit of a currency, halves to even.
+func (m Money) Round(currency string) Money {
+	return m.roundTo(currencyMinorUnits(currency))
+}
+
+func (m Money) roundTo(digits int) Money {
+	step := Money(math.Pow10(moneyScale - digits))
+	quotient, remainder := m/step, m%step
+	if remainder < 0 {
+		remainder = -remainder
+	}
+	if 2*remainder > step || (2*remainder == step && quotient%2 != 0) {
+		if m < 0 {
+			quotient--
+		} else {
+			quotient++
+		}
+	}
+	return quotient * step
+}
+
+// Div divides m by n and rounds the quotient to the minor unit of a
+// currency, halves to even. Dividing first and rounding after would
+// truncate the ten-thousandths before rounding them.
+func (m Money) Div(n int, currency string) Money {
+	step := int64(math.Pow10(moneyScale - currencyMinorUnits(currency)))
+	// The quotient is no larger than m, so it always fits
+	units, _ := roundRatHalfEven(big.NewRat(int64(m), int64(n)*step))
+	return Money(units * step)
+}
+
+// Mul multiplies m by a factor such as an exchange rate.
+func (m Money) Mul(factor float64) Money {
+	product := new(big.Rat).Mul(new(big.Rat).SetInt64(int64(m)), new(big.Rat).SetFloat64(factor))
+	units, err := roundRatHalfEven(product)
+	if err != nil {
+		return MoneyFromFloat(float64(m) * factor / float64(moneyUnit))
+	}
+	return Money(units)
+}
+
+// Float64 returns the nearest float64, for calculations that are not about
+// exact amounts, such as ratios.
+func (m Money) Float64() float64 {
+	return float64(m) / float64(moneyUnit)
+}
+
+// String formats m with as few decimals as it needs.
+func (m Money) String() string {
+	s := m.StringFixed(moneyScale)
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+// StringFixed rounds m to a number of decimals and formats it with exactly
+// that many.
+func (m Money) StringFixed(digits int) string {
+	if digits > moneyScale {
+		digits = moneyScale
+	}
+	m = m.roundTo(digits)
+
+	sign := ""
+	units := int64(m)
+	if units < 0 {
+		sign = "-"
+		units = -units
+	}
+	whole := strconv.FormatInt(units/int64(moneyUnit), 10)
+	if digits == 0 {
+		return sign + whole
+	}
+	fraction := fmt.Sprintf("%04d", units%int64(moneyUnit))
+	return sign + whole + "." + fraction[:digits]
+}
+
+// Format formats m with the number of decimals of a currency.
+func (m Money) Format(currency string) string {
+	return m.StringFixed(currencyMinorUnits(currency))
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON accepts a JSON number, as older clients send, or a decimal
+// string.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	value := string(data)
+	if value == "null" {
+		return nil
+	}
+	if unquoted, err := strconv.Unquote(value); err == nil {
+		value = unquoted
+	}
+	parsed, err := ParseMoney(value)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+func (m Money) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+func (m *Money) UnmarshalText(data []byte) error {
+	if len(data) == 0 {
+		*m = 0
+		return nil
+	}
+	parsed, err := ParseMoney(string(data))
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// MarshalDynamoDBAttributeValue stores m as a DynamoDB number. DynamoDB
+// numbers are decimal, so the value is stored exactly.
+func (m Money) MarshalDynamoDBAttributeValue(av *dynamodb.AttributeValue) error {
+	av.N = aws.String(m.String())
+	return nil
+}
+
+// UnmarshalDynamoDBAttributeValue reads a DynamoDB number, including the
+// long binary-float expansions written before amounts were exact.
+func (m *Money) UnmarshalDynamoDBAttributeValue(av *dynamodb.AttributeValue) error {
+	switch {
+	case av.N != nil:
+		return m.UnmarshalText([]byte(*av.N))
+	case av.S != nil:
+		return m.UnmarshalText([]byte(*av.S))
+	}
+	*m = 0
+	return nil
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		value string
+		want  Money
+	}{
+		{"12", 120000},
+		{"-0.5", -5000},
+		{"+3.25", 32500},
+		{" 1234.5678 ", 12345678},
+		{".5", 5000},
+		{"5.", 50000},
+		{"1.5e2", 1500000},
+		{"1E-4", 1},
+		{"0.30000000000000004", 3000},
+		// More than four decimals round half to even
+		{"0.00005", 0},
+		{"0.00015", 2},
+		{"-0.00015", -2},
+	}
+	for _, test := range tests {
+		got, err := ParseMoney(test.value)
+		if err != nil {
+			t.Errorf("ParseMoney(%q): %v", test.value, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("ParseMoney(%q) = %d, want %d", test.value, got, test.want)
+		}
+	}
+
+	for _, value := range []string{"", "abc", "0x10", "0b101", "0o17", "1/3", "1_000", "1,5", "NaN", "Inf", "--1", "1e", "1e1000000000", "99999999999999999999"} {
+		if got, err := ParseMoney(value); err == nil {
+			t.Errorf("ParseMoney(%q) = %s, want an error", value, got)
+		}
+	}
+}
+
+func TestMoneyRound(t *testing.T) {
+	tests := []struct {
+		amount   Money
+		currency string
+		want     Money
+	}{
+		// Two decimals, halves to even
+		{12345, "USD", 12300},
+		{12350, "USD", 12400},
+		{12450, "USD", 12400},
+		{12451, "USD", 12500},
+		{-12350, "USD", -12400},
+		{-12450, "USD", -12400},
+		{12350, "", 12400},
+		{12350, "XYZ", 12400},
+		// No decimals
+		{25000, "JPY", 20000},
+		{35000, "jpy", 40000},
+		{-25000, "KRW", -20000},
+		{25001, "JPY", 30000},
+		// Three decimals
+		{12345, "KWD", 12340},
+		{12355, "BHD", 12360},
+		{-12345, "OMR", -12340},
+	}
+	for _, test := range tests {
+		if got := test.amount.Round(test.currency); got != test.want {
+			t.Errorf("Money(%d).Round(%q) = %d, want %d", test.amount, test.currency, got, test.want)
+		}
+	}
+}
+
+func TestMoneyFormat(t *testing.T) {
+	tests := []struct {
+		amount   Money
+		currency string
+		want     string
+	}{
+		{12345678, "USD", "1234.57"},
+		{-5000, "EUR", "-0.50"},
+		{12345678, "JPY", "1235"},
+		{12345678, "KWD", "1234.568"},
+		{0, "USD", "0.00"},
+	}
+	for _, test := range tests {
+		if got := test.amount.Format(test.currency); got != test.want {
+			t.Errorf("Money(%d).Format(%q) = %s, want %s", test.amount, test.currency, got, test.want)
+		}
+	}
+
+	if got := Money(12300).String(); got != "1.23" {
+		t.Errorf("String() = %s, want 1.23", got)
+	}
+	if got := Money(-10000).String(); got != "-1" {
+		t.Errorf("String() = %s, want -1", got)
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	var item struct {
+		A Money `json:"a"`
+		B Money `json:"b"`
+	}
+	if err := json.Unmarshal([]byte(`{"a": 12.5, "b": "0.1"}`), &item); err != nil {
+		t.Fatal(err)
+	}
+	if item.A != 125000 || item.B != 1000 {
+		t.Errorf("got %d and %d", item.A, item.B)
+	}
+	if err := json.Unmarshal([]byte(`{"a": "0x10"}`), &item); err == nil {
+		t.Error("hex string was accepted")
+	}
+
+	data, err := json.Marshal(item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"a":12.5,"b":0.1}` {
+		t.Errorf("got %s", data)
+	}
+}
+
+func TestMoneyMul(t *testing.T) {
+	tests := []struct {
+		amount Money
+		factor float64
+		want   Money
+	}{
+		{1000000, 0.92, 920000},
+		{1, 0.5, 0},
+		{3, 0.5, 2},
+		{-1000000, 1.5, -1500000},
+	}
+	for _, test := range tests {
+		if got := test.amount.Mul(test.factor); got != test.want {
+			t.Errorf("Money(%d).Mul(%g) = %d, want %d", test.amount, test.factor, got, test.want)
+		}
+	}
+}
+
+func TestMoneyDiv(t *testing.T) {
+	tests := []struct {
+		amount   Money
+		n        int
+		currency string
+		want     Money
+	}{
+		{1000000, 3, "USD", 333300},
+		{2000000, 3, "USD", 666700},
+		// 0.00505 rounds up, although 0.0050 would round to even
+		{101, 2, "USD", 100},
+		{-101, 2, "USD", -100},
+		{50, 1, "USD", 0},
+		{150, 1, "USD", 200},
+		{10000000, 3, "JPY", 3330000},
+		{10000, 3, "BHD", 3330},
+	}
+	for _, test := range tests {
+		if got := test.amount.Div(test.n, test.currency); got != test.want {
+			t.Errorf("Money(%d).Div(%d, %s) = %d, want %d", test.amount, test.n, test.currency, got, test.want)
+		}
+	}
+}
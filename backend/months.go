@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// monthLayout is the format of the month part of the userId#month keys.
+const monthLayout = "2006-01"
+
+// maxMonthRange bounds how many month partitions a single request may read.
+const maxMonthRange = 240
+
+// parseMonth parses a YYYY-MM month.
+func parseMonth(month string) (time.Time, error) {
+	t, err := time.Parse(monthLayout, month)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid month %q, expected YYYY-MM", month)
+	}
+	return t, nil
+}
+
+// monthsBetween returns every month from one month to another, inclusive.
+// Ranges longer than maxMonthRange are rejected.
+func monthsBetween(from string, to string) ([]string, error) {
+	return monthRange(from, to, maxMonthRange)
+}
+
+// monthRange returns every month from one month to another, inclusive,
+// rejecting ranges longer than limit months. A limit of 0 means no limit.
+func monthRange(from string, to string, limit int) ([]string, error) {
+	start, err := parseMonth(from)
+	if err != nil {
+		return nil, err
+	}
+	end, err := parseMonth(to)
+	if err != nil {
+		return nil, err
+	}
+	if end.Before(start) {
+		return nil, fmt.Errorf("month range ends before it starts: %s to %s", from, to)
+	}
+
+	var months []string
+	for m := start; !m.After(end); m = m.AddDate(0, 1, 0) {
+		months = append(months, m.Format(monthLayout))
+		if limit > 0 && len(months) > limit {
+			return nil, fmt.Errorf("month range %s to %s is longer than %d months", from, to, limit)
+		}
+	}
+	return months, nil
+}
+
+// addMonths shifts a YYYY-MM month by n months.
+func addMonths(month string, n int) (string, error) {
+	t, err := parseMonth(month)
+	if err != nil {
+		return "", err
+	}
+	return t.AddDate(0, n, 0).Format(monthLayout), nil
+}
+
+// itemDate returns the date of an item, falling back to the first day of its
+// month for items entered without one.
+func itemDate(date string, month string) time.Time {
+	if t, err := time.Parse("2006-01-02", date); err == nil {
+		return t
+	}
+	t, _ := time.Parse(monthLayout, month)
+	return t
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// mt940StatementLine matches the fixed part of a :61: field: value date,
+// optional entry date, debit/credit mark, optional funds code, amount,
+// transaction type, and the customer and optional bank references.
+var mt940StatementLine = regexp.MustCompile(`^(\d{6})(\d{4})?(RC|RD|C|D)([A-Z])?([\d,]+)([A-Z][A-Z0-9]{3})([^/]*)(?://(.*))?$`)
+
+// ParseMT940 reads a SWIFT MT940 customer statement. Each :61: statement line
+// becomes one transaction, described by the :86: field that follows it.
+func ParseMT940(r io.Reader) ([]StatementTransaction, error) {
+	fields, err := splitMT940Fields(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var transactions []StatementTransaction
+	var accountId string
+	var current *StatementTransaction
+
+	flush := func() {
+		if current != nil {
+			transactions = append(transactions, *current)
+			current = nil
+		}
+	}
+
+	for _, field := range fields {
+		switch field.tag {
+		case "25":
+			accountId = strings.TrimSpace(field.value)
+		case "61":
+			flush()
+			t, err := parseMT940StatementLine(accountId, field.value)
+			if err != nil {
+				return nil, err
+			}
+			current = &t
+		case "86":
+			if current != nil {
+				current.Payee, current.Memo = parseMT940Information(field.value)
+			}
+		default:
+			flush()
+		}
+	}
+	flush()
+
+	if len(transactions) == 0 && accountId == "" {
+		return nil, fmt.Errorf("not an MT940 statement: no :25: or :61: fields")
+	}
+
+	assignSyntheticIds("mt940", transactions)
+	return transactions, nil
+}
+
+type mt940Field struct {
+	tag   string
+	value string
+}
+
+// splitMT940Fields splits a statement into its :tag: fields, joining
+// continuation lines onto the field they belong to.
+func splitMT940Fields(r io.Reader) ([]mt940Field, error) {
+	var fields []mt940Field
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		// Block delimiters of the surrounding SWIFT message
+		if line == "" || line == "-" || line == "-}" || strings.HasPrefix(line, "{") {
+			continue
+		}
+
+		if strings.HasPrefix(line, ":") {
+			if end := strings.Index(line[1:], ":"); end > 0 {
+				fields = append(fields, mt940Field{tag: line[1 : end+1], value: line[end+2:]})
+				continue
+			}
+		}
+
+		if len(fields) > 0 {
+			fields[len(fields)-1].value += "\n" + line
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read MT940 statement: %v", err)
+	}
+	return fields, nil
+}
+
+func parseMT940StatementLine(accountId string, value string) (StatementTransaction, error) {
+	// Supplementary details may follow on a second line
+	line, supplementary, _ := strings.Cut(value, "\n")
+
+	match := mt940StatementLine.FindStringSubmatch(strings.TrimSpace(line))
+	if match == nil {
+		return StatementTransaction{}, fmt.Errorf("invalid MT940 statement line %q", line)
+	}
+
+	date, err := time.Parse("060102", match[1])
+	if err != nil {
+		return StatementTransaction{}, fmt.Errorf("invalid MT940 value date %q", match[1])
+	}
+
+	amount, err := parseStatementAmount(match[5])
+	if err != nil {
+		return StatementTransaction{}, err
+	}
+	if match[3] == "D" || match[3] == "RC" {
+		amount = -amount
+	}
+
+	t := StatementTransaction{
+		AccountId: accountId,
+		Date:      date,
+		Amount:    amount,
+		Memo:      strings.TrimSpace(supplementary),
+	}
+	if bankRef := strings.TrimSpace(match[8]); bankRef != "" {
+		t.TransactionId = bankRef
+	} else if ref := strings.TrimSpace(match[7]); ref != "" && ref != "NONREF" {
+		t.TransactionId = ref
+	}
+	return t, nil
+}
+
+// parseMT940Information extracts the counterparty name and remittance text
+// from a :86: field. Structured fields use ?nn subfields, where ?32 and ?33
+// hold the counterparty name and ?20 to ?29 the remittance information;
+// anything else is treated as free text.
+func parseMT940Information(value string) (string, string) {
+	value = strings.ReplaceAll(value, "\n", "")
+	if !strings.Contains(value, "?") {
+		return "", strings.TrimSpace(value)
+	}
+
+	var name, memo []string
+	for _, part := range strings.Split(value, "?")[1:] {
+		if len(part) < 2 {
+			continue
+		}
+		code, text := part[:2], strings.TrimSpace(part[2:])
+		switch {
+		case code == "32" || code == "33":
+			name = append(name, text)
+		case code >= "20" && code <= "29":
+			memo = append(memo, text)
+		}
+	}
+	return strings.Join(name, " "), strings.Join(memo, " ")
+}
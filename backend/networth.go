@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Kinds of holding.
+const (
+	HoldingAsset     = "asset"
+	HoldingLiability = "liability"
+)
+
+// liabilityAccountTypes are the account types whose balance is money owed.
+// Their balances are negative while something is owed, see
+// ComputeAccountBalances.
+var liabilityAccountTypes = map[string]bool{
+	"credit_card": true,
+	"loan":        true,
+}
+
+// ValidateHolding checks a holding's fields, normalizes its currency code and
+// lower-cases its class so that breakdowns group however it was typed.
+func ValidateHolding(holding *Holding) error {
+	holding.HoldingName = strings.TrimSpace(holding.HoldingName)
+	if holding.HoldingName == "" {
+		return fmt.Errorf("holdingName is required")
+	}
+	if holding.Kind != HoldingAsset && holding.Kind != HoldingLiability {
+		return fmt.Errorf("invalid kind %q, expected asset or liability", holding.Kind)
+	}
+	holding.Class = strings.ToLower(strings.TrimSpace(holding.Class))
+	if holding.Class == "" {
+		holding.Class = "other"
+	}
+	if holding.Currency != "" {
+		currency, err := normalizeCurrency(holding.Currency)
+		if err != nil {
+			return err
+		}
+		holding.Currency = currency
+	}
+	return nil
+}
+
+// ValidateHoldingValuation checks a valuation and rounds it to the holding's
+// currency.
+func ValidateHoldingValuation(valuation *HoldingValuation, holding Holding) error {
+	if valuation.Date == "" {
+		valuation.Date = time.Now().UTC().Format("2006-01-02")
+	}
+	if _, err := time.Parse("2006-01-02", valuation.Date); err != nil {
+		return fmt.Errorf("invalid date, expected YYYY-MM-DD")
+	}
+	valuation.Value = valuation.Value.Round(holding.Currency)
+	if valuation.Value < 0 {
+		return fmt.Errorf("value cannot be negative")
+	}
+	return nil
+}
+
+// ComputeNetWorth values accounts and holdings at the end of every month,
+// converted to the base currency at the rate in effect on that day. Months
+// that have not ended yet are valued as of today. An account counts from its
+// first month of balances, and a holding from its first valuation, which
+// stays its value until the next one. Amounts that cannot be converted are
+// left out and the missing pair and date are listed instead.
+func ComputeNetWorth(months []string, base string, rates *RateTable, accounts []Account, accountBalances map[string][]AccountBalance, holdings []Holding, valuations []HoldingValuation, now time.Time) NetWorthSeries {
+	series := NetWorthSeries{BaseCurrency: base, Points: []NetWorthPoint{}, MissingRates: []string{}}
+	missing := make(map[string]bool)
+
+	convert := func(amount Money, currency string, date time.Time) (Money, bool) {
+		if currency == "" {
+			currency = base
+		}
+		converted, ok := rates.Convert(amount, currency, base, date)
+		if !ok {
+			key := fmt.Sprintf("%s/%s@%s", currency, base, date.Format("2006-01-02"))
+			if !missing[key] {
+				missing[key] = true
+				series.MissingRates = append(series.MissingRates, key)
+			}
+		}
+		return converted, ok
+	}
+
+	byHolding := make(map[string][]HoldingValuation)
+	for _, valuation := range valuations {
+		byHolding[valuation.HoldingId] = append(byHolding[valuation.HoldingId], valuation)
+	}
+	for _, list := range byHolding {
+		sort.Slice(list, func(i, j int) bool { return list[i].Date < list[j].Date })
+	}
+
+	today := now.UTC().Format("2006-01-02")
+	for _, month := range months {
+		start, _ := parseMonth(month)
+		end := start.AddDate(0, 1, -1)
+		if end.Format("2006-01-02") > today {
+			end, _ = time.Parse("2006-01-02", today)
+		}
+		point := NetWorthPoint{
+			Month:              month,
+			Date:               end.Format("2006-01-02"),
+			AssetsByClass:      make(map[string]Money),
+			LiabilitiesByClass: make(map[string]Money),
+		}
+
+		for _, account := range accounts {
+			for _, balance := range accountBalances[account.AccountId] {
+				if balance.Month != month {
+					continue
+				}
+				value, ok := convert(balance.Balance, account.Currency, end)
+				if !ok {
+					continue
+				}
+				if liabilityAccountTypes[account.AccountType] {
+					point.Liabilities -= value
+					point.LiabilitiesByClass[account.AccountType] -= value
+				} else {
+					point.Assets += value
+					point.AssetsByClass[account.AccountType] += value
+				}
+			}
+		}
+
+		for _, holding := range holdings {
+			list := byHolding[holding.HoldingId]
+			i := sort.Search(len(list), func(i int) bool { return list[i].Date > point.Date })
+			if i == 0 {
+				continue
+			}
+			value, ok := convert(list[i-1].Value, holding.Currency, end)
+			if !ok {
+				continue
+			}
+			if holding.Kind == HoldingLiability {
+				point.Liabilities += value
+				point.LiabilitiesByClass[holding.Class] += value
+			} else {
+				point.Assets += value
+				point.AssetsByClass[holding.Class] += value
+			}
+		}
+
+		point.NetWorth = point.Assets - point.Liabilities
+		series.Points = append(series.Points, point)
+	}
+	return series
+}
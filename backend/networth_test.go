@@ -0,0 +1,103 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestComputeNetWorth(t *testing.T) {
+	rates := NewRateTable([]ExchangeRate{
+		{FromCurrency: "EUR", ToCurrency: "USD", Rate: 1.1, Date: "2024-01-01"},
+		{FromCurrency: "EUR", ToCurrency: "USD", Rate: 1.2, Date: "2024-02-15"},
+	})
+	accounts := []Account{
+		{AccountId: "checking", AccountType: "checking"},
+		{AccountId: "card", AccountType: "credit_card", Currency: "USD"},
+		{AccountId: "savings", AccountType: "savings", Currency: "EUR"},
+		{AccountId: "pounds", AccountType: "savings", Currency: "GBP"},
+	}
+	balances := map[string][]AccountBalance{
+		// The checking account only counts from its first month of balances
+		"checking": {{Month: "2024-02", Balance: 20000000}, {Month: "2024-03", Balance: 25000000}},
+		// A credit card owes money while its balance is negative
+		"card":    {{Month: "2024-01", Balance: -5000000}, {Month: "2024-02", Balance: -3000000}},
+		"savings": {{Month: "2024-01", Balance: 10000000}, {Month: "2024-02", Balance: 10000000}},
+		"pounds":  {{Month: "2024-01", Balance: 1000000}, {Month: "2024-02", Balance: 1000000}},
+	}
+	holdings := []Holding{
+		{HoldingId: "house", Kind: HoldingAsset, Class: "property"},
+		{HoldingId: "mortgage", Kind: HoldingLiability, Class: "mortgage", Currency: "USD"},
+	}
+	valuations := []HoldingValuation{
+		{HoldingId: "house", Date: "2024-03-20", Value: 3100000000},
+		{HoldingId: "house", Date: "2024-01-20", Value: 3000000000},
+		{HoldingId: "mortgage", Date: "2024-02-10", Value: 2000000000},
+	}
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	series := ComputeNetWorth([]string{"2024-01", "2024-02", "2024-03"}, "USD", rates, accounts, balances, holdings, valuations, now)
+
+	tests := []struct {
+		month, date                   string
+		assets, liabilities, netWorth Money
+		assetsByClass                 map[string]Money
+		liabilitiesByClass            map[string]Money
+	}{
+		{
+			"2024-01", "2024-01-31", 3011000000, 5000000, 3006000000,
+			map[string]Money{"savings": 11000000, "property": 3000000000},
+			map[string]Money{"credit_card": 5000000},
+		},
+		{
+			// The euros are converted at the rate in effect at the end of
+			// the month, and the house keeps its January valuation
+			"2024-02", "2024-02-29", 3032000000, 2003000000, 1029000000,
+			map[string]Money{"checking": 20000000, "savings": 12000000, "property": 3000000000},
+			map[string]Money{"credit_card": 3000000, "mortgage": 2000000000},
+		},
+		{
+			// The current month is valued as of today, before the house's
+			// next valuation
+			"2024-03", "2024-03-10", 3025000000, 2000000000, 1025000000,
+			map[string]Money{"checking": 25000000, "property": 3000000000},
+			map[string]Money{"mortgage": 2000000000},
+		},
+	}
+	if len(series.Points) != len(tests) {
+		t.Fatalf("got %d points, want %d", len(series.Points), len(tests))
+	}
+	for i, test := range tests {
+		point := series.Points[i]
+		if point.Month != test.month || point.Date != test.date {
+			t.Errorf("point %d: got %s on %s, want %s on %s", i, point.Month, point.Date, test.month, test.date)
+		}
+		if point.Assets != test.assets || point.Liabilities != test.liabilities || point.NetWorth != test.netWorth {
+			t.Errorf("%s: got assets %s, liabilities %s, net worth %s, want %s, %s, %s", test.month,
+				point.Assets, point.Liabilities, point.NetWorth, test.assets, test.liabilities, test.netWorth)
+		}
+		for _, check := range []struct {
+			name      string
+			got, want map[string]Money
+		}{
+			{"assets", point.AssetsByClass, test.assetsByClass},
+			{"liabilities", point.LiabilitiesByClass, test.liabilitiesByClass},
+		} {
+			if len(check.got) != len(check.want) {
+				t.Errorf("%s: got %s by class %v, want %v", test.month, check.name, check.got, check.want)
+				continue
+			}
+			for class, amount := range check.want {
+				if check.got[class] != amount {
+					t.Errorf("%s: got %s by class %v, want %v", test.month, check.name, check.got, check.want)
+					break
+				}
+			}
+		}
+	}
+
+	// The pounds cannot be converted and are left out, once per date
+	want := []string{"GBP/USD@2024-01-31", "GBP/USD@2024-02-29"}
+	if len(series.MissingRates) != len(want) || series.MissingRates[0] != want[0] || series.MissingRates[1] != want[1] {
+		t.Errorf("got missing rates %v, want %v", series.MissingRates, want)
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+var ofxEntityReplacer = strings.NewReplacer("&lt;", "<", "&gt;", ">", "&quot;", "\"", "&apos;", "'", "&nbsp;", " ", "&amp;", "&")
+
+// ParseOFX reads an OFX or QFX statement and returns its bank and credit card
+// transactions. Both the SGML based 1.x format, where leaf elements are not
+// closed, and the XML based 2.x format are accepted.
+func ParseOFX(r io.Reader) ([]StatementTransaction, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read OFX statement: %v", err)
+	}
+
+	body := string(data)
+	start := strings.Index(strings.ToUpper(body), "<OFX>")
+	if start < 0 {
+		return nil, fmt.Errorf("not an OFX statement: missing <OFX> element")
+	}
+	body = body[start:]
+
+	var transactions []StatementTransaction
+	var current *StatementTransaction
+	var accountId string
+	var inPayee, inAccountFrom bool
+
+	for len(body) > 0 {
+		open := strings.IndexByte(body, '<')
+		if open < 0 {
+			break
+		}
+		end := strings.IndexByte(body[open:], '>')
+		if end < 0 {
+			return nil, fmt.Errorf("malformed OFX statement: unterminated tag")
+		}
+		tag := strings.ToUpper(strings.TrimSpace(body[open+1 : open+end]))
+		body = body[open+end+1:]
+
+		// Skip processing instructions and comments
+		if strings.HasPrefix(tag, "?") || strings.HasPrefix(tag, "!") {
+			continue
+		}
+
+		// The value of a leaf element runs up to the next tag, whether or not
+		// the element is explicitly closed
+		next := strings.IndexByte(body, '<')
+		if next < 0 {
+			next = len(body)
+		}
+		value := strings.TrimSpace(ofxEntityReplacer.Replace(body[:next]))
+
+		switch tag {
+		case "STMTTRN":
+			current = &StatementTransaction{AccountId: accountId}
+		case "/STMTTRN":
+			if current == nil {
+				continue
+			}
+			if current.TransactionId == "" {
+				return nil, fmt.Errorf("malformed OFX statement: transaction without FITID")
+			}
+			if current.Date.IsZero() {
+				return nil, fmt.Errorf("malformed OFX statement: transaction %s has no DTPOSTED", current.TransactionId)
+			}
+			transactions = append(transactions, *current)
+			current = nil
+		case "PAYEE":
+			inPayee = true
+		case "/PAYEE":
+			inPayee = false
+		case "BANKACCTFROM", "CCACCTFROM":
+			inAccountFrom = true
+		case "/BANKACCTFROM", "/CCACCTFROM":
+			inAccountFrom = false
+		case "ACCTID":
+			// Only the statement's own account; a transfer names the other
+			// account in a BANKACCTTO or CCACCTTO
+			if inAccountFrom {
+				accountId = value
+			}
+		}
+
+		if current == nil || value == "" {
+			continue
+		}
+
+		switch tag {
+		case "FITID":
+			current.TransactionId = value
+		case "DTPOSTED":
+			posted, err := parseOFXDate(value)
+			if err != nil {
+				return nil, err
+			}
+			current.Date = posted
+		case "TRNAMT":
+			amount, err := parseStatementAmount(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid TRNAMT: %v", err)
+			}
+			current.Amount = amount
+		case "NAME":
+			// A PAYEE aggregate carries its own NAME; prefer the transaction level one
+			if !inPayee || current.Payee == "" {
+				current.Payee = value
+			}
+		case "MEMO":
+			current.Memo = value
+		}
+	}
+
+	return transactions, nil
+}
+
+// parseOFXDate parses an OFX datetime such as 20240115, 20240115120000 or
+// 20240115120000.000[-5:EST]. Only the calendar date is kept, as written in
+// the statement, so a transaction is never moved into a neighbouring month by
+// a timezone conversion.
+func parseOFXDate(value string) (time.Time, error) {
+	if len(value) < 8 {
+		return time.Time{}, fmt.Errorf("invalid OFX date %q", value)
+	}
+	posted, err := time.Parse("20060102", value[:8])
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid OFX date %q: %v", value, err)
+	}
+	return posted, nil
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// qifDatePattern matches the numeric dates found in QIF D fields, such as
+// 01/31/2024, 31.01.2024, 1/31'24 or 2024-01-31. QIF has no standard date
+// format, so whether the first number is the month or the day is worked out
+// for the whole file by qifDayFirst.
+var qifDatePattern = regexp.MustCompile(`^(\d{1,4})[/.-](\d{1,2})(?:[/.-]|')(\d{2,4})$`)
+
+// ParseQIF reads a Quicken Interchange Format export. Only cash, bank and
+// credit card sections are read; investment and list sections are skipped.
+// The name in an !Account block is used as the account of the transactions
+// that follow it.
+func ParseQIF(r io.Reader) ([]StatementTransaction, error) {
+	var transactions []StatementTransaction
+	var dates []string
+	var dateLines []int
+	var current StatementTransaction
+	var currentDate string
+	var currentDateLine int
+	var hasFields bool
+	var accountId, accountName string
+	inTransactions := true
+	inAccount := false
+
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "!") {
+			header := strings.ToLower(strings.TrimSpace(line))
+			inAccount = false
+			switch {
+			case strings.HasPrefix(header, "!type:bank"),
+				strings.HasPrefix(header, "!type:cash"),
+				strings.HasPrefix(header, "!type:ccard"),
+				strings.HasPrefix(header, "!type:oth a"),
+				strings.HasPrefix(header, "!type:oth l"):
+				inTransactions = true
+			case header == "!account":
+				inAccount = true
+				inTransactions = false
+				accountName = ""
+			case strings.HasPrefix(header, "!option"), strings.HasPrefix(header, "!clear"):
+			default:
+				inTransactions = false
+			}
+			continue
+		}
+
+		code, value := line[0], strings.TrimSpace(line[1:])
+		if inAccount {
+			switch code {
+			case 'N':
+				accountName = value
+			case '^':
+				accountId = accountName
+			}
+			continue
+		}
+		if !inTransactions {
+			continue
+		}
+
+		switch code {
+		case '^':
+			if hasFields {
+				if currentDate == "" {
+					return nil, fmt.Errorf("malformed QIF file: record ending on line %d has no date", lineNumber)
+				}
+				current.AccountId = accountId
+				transactions = append(transactions, current)
+				dates = append(dates, currentDate)
+				dateLines = append(dateLines, currentDateLine)
+			}
+			current = StatementTransaction{}
+			currentDate = ""
+			hasFields = false
+			continue
+		case 'D':
+			currentDate = strings.ReplaceAll(value, " ", "")
+			currentDateLine = lineNumber
+		case 'T', 'U':
+			amount, err := parseStatementAmount(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineNumber, err)
+			}
+			current.Amount = amount
+		case 'P':
+			current.Payee = value
+		case 'M':
+			current.Memo = value
+		}
+		hasFields = true
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read QIF file: %v", err)
+	}
+
+	// The final record is not always terminated
+	if hasFields && currentDate != "" {
+		current.AccountId = accountId
+		transactions = append(transactions, current)
+		dates = append(dates, currentDate)
+		dateLines = append(dateLines, currentDateLine)
+	}
+
+	dayFirst, err := qifDayFirst(dates)
+	if err != nil {
+		return nil, err
+	}
+	for i, value := range dates {
+		date, err := parseQIFDate(value, dayFirst)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", dateLines[i], err)
+		}
+		transactions[i].Date = date
+	}
+
+	assignSyntheticIds("qif", transactions)
+	return transactions, nil
+}
+
+// qifDayFirst works out whether a file's dates are written day first, as in
+// most of Europe, or month first, as in the US. A date with a first number
+// over 12 can only be day first and one with a second number over 12 can
+// only be month first. When every date is ambiguous, dates separated by dots
+// are taken as day first and others as month first.
+func qifDayFirst(dates []string) (bool, error) {
+	dayFirst, monthFirst, dotted := false, false, false
+	for _, value := range dates {
+		match := qifDatePattern.FindStringSubmatch(value)
+		if match == nil || len(match[1]) == 4 {
+			continue
+		}
+		first, _ := strconv.Atoi(match[1])
+		second, _ := strconv.Atoi(match[2])
+		if first > 12 {
+			dayFirst = true
+		}
+		if second > 12 {
+			monthFirst = true
+		}
+		if strings.Contains(value, ".") {
+			dotted = true
+		}
+	}
+	if dayFirst && monthFirst {
+		return false, fmt.Errorf("malformed QIF file: dates mix day-first and month-first order")
+	}
+	if dayFirst || monthFirst {
+		return dayFirst, nil
+	}
+	return dotted, nil
+}
+
+// parseQIFDate parses a QIF date in the given order. Years written with two
+// digits are placed like Go's "06" layout: 69 to 99 in the 1900s and 00 to 68
+// in the 2000s.
+func parseQIFDate(value string, dayFirst bool) (time.Time, error) {
+	match := qifDatePattern.FindStringSubmatch(value)
+	if match == nil {
+		return time.Time{}, fmt.Errorf("invalid QIF date %q", value)
+	}
+
+	var year, month, day int
+	if len(match[1]) == 4 {
+		year, _ = strconv.Atoi(match[1])
+		month, _ = strconv.Atoi(match[2])
+		day, _ = strconv.Atoi(match[3])
+		if len(match[3]) > 2 {
+			return time.Time{}, fmt.Errorf("invalid QIF date %q", value)
+		}
+	} else {
+		first, _ := strconv.Atoi(match[1])
+		second, _ := strconv.Atoi(match[2])
+		month, day = first, second
+		if dayFirst {
+			month, day = second, first
+		}
+		year, _ = strconv.Atoi(match[3])
+		switch len(match[3]) {
+		case 2:
+			if year < 69 {
+				year += 2000
+			} else {
+				year += 1900
+			}
+		case 4:
+		default:
+			return time.Time{}, fmt.Errorf("invalid QIF date %q", value)
+		}
+	}
+
+	date := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	if date.Year() != year || int(date.Month()) != month || date.Day() != day {
+		return time.Time{}, fmt.Errorf("invalid QIF date %q", value)
+	}
+	return date, nil
+}
@@ -0,0 +1,517 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"reflect"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// Conflict policies for items that already exist in the target account.
+const (
+	ConflictSkip      = "skip"
+	ConflictOverwrite = "overwrite"
+	ConflictFail      = "fail"
+)
+
+// MaxRestoreSize is the largest export file the restore endpoint accepts.
+const MaxRestoreSize = 64 << 20
+
+// MaxRestoreUncompressedSize is the most the files in a CSV export archive
+// may hold once inflated, so that a small zip cannot fill the memory.
+const MaxRestoreUncompressedSize = 256 << 20
+
+// ErrRestoreConflict is returned when the ConflictFail policy finds items
+// that already exist in the target account.
+var ErrRestoreConflict = errors.New("target account already has some of the archived items")
+
+// ExportArchive is the content of an export, read back from either the JSON
+// document or the zip of CSVs. Items holds the models of each section by
+// section name.
+type ExportArchive struct {
+	ExportManifest
+	Items map[string][]interface{}
+}
+
+type RestoreOptions struct {
+	UserId   string
+	DryRun   bool
+	Conflict string
+}
+
+type RestoreResult struct {
+	DryRun    bool                   `json:"dryRun"`
+	UserId    string                 `json:"userId"`
+	Sections  []RestoreSectionResult `json:"sections"`
+	Anomalies []ExpenseAnomaly       `json:"anomalies"`
+
+	// restored is what was written, by section, for PublishRestore
+	restored map[string][]restoreRecord
+}
+
+type RestoreSectionResult struct {
+	Name      string   `json:"name"`
+	Total     int      `json:"total"`
+	Written   int      `json:"written"`
+	Skipped   int      `json:"skipped"`
+	Conflicts []string `json:"conflicts"`
+}
+
+// restoreRecord is an archived item ready to be written to its table.
+// Replaces is set when the item already exists in the target.
+type restoreRecord struct {
+	Partition string
+	Name      string
+	Item      map[string]*dynamodb.AttributeValue
+	Replaces  bool
+}
+
+// restoreEvents are the events published for the sections whose changes
+// are published, as created and as updated.
+var restoreEvents = map[string][2]string{
+	"income":   {EventIncomeCreated, EventIncomeUpdated},
+	"budget":   {EventBudgetCreated, EventBudgetUpdated},
+	"expenses": {EventExpenseCreated, EventExpenseUpdated},
+}
+
+// ReadExportArchive reads an export produced by WriteJSONExport or
+// WriteCSVExport and checks that its schema version is supported.
+func ReadExportArchive(data []byte) (*ExportArchive, error) {
+	var archive *ExportArchive
+	var err error
+	if bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		archive, err = readCSVArchive(data)
+	} else {
+		archive, err = readJSONArchive(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if archive.SchemaVersion < 1 || archive.SchemaVersion > ExportSchemaVersion {
+		return nil, fmt.Errorf("unsupported export schema version %d, expected 1 to %d", archive.SchemaVersion, ExportSchemaVersion)
+	}
+	return archive, nil
+}
+
+// RestoreArchive writes the archived items to the target user. Every item is
+// reassigned to options.UserId. Items that already exist are handled by the
+// conflict policy; with ConflictFail nothing is written if any exist. An
+// item that appears more than once in the archive is written once, from its
+// last occurrence, and the earlier ones are counted as skipped. Restored
+// expenses are scored for anomalies against the target's own. In a dry run
+// the same checks are made but nothing is written.
+func RestoreArchive(archive *ExportArchive, options RestoreOptions) (*RestoreResult, error) {
+	if options.UserId == "" {
+		options.UserId = archive.UserId
+	}
+	if options.UserId == "" {
+		return nil, fmt.Errorf("no target userId given and the archive does not name one")
+	}
+	if options.Conflict == "" {
+		options.Conflict = ConflictSkip
+	}
+	if options.Conflict != ConflictSkip && options.Conflict != ConflictOverwrite && options.Conflict != ConflictFail {
+		return nil, fmt.Errorf("unknown conflict policy: %s", options.Conflict)
+	}
+
+	records, err := archiveRecords(archive, options.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	// Work out what would be written before writing anything, so a failing
+	// conflict check leaves the target untouched
+	result := &RestoreResult{DryRun: options.DryRun, UserId: options.UserId}
+	pending := make(map[string][]restoreRecord)
+	hasConflicts := false
+	for _, section := range exportSections {
+		sectionResult := RestoreSectionResult{Name: section.Name, Total: len(records[section.Name]), Conflicts: []string{}}
+		unique, repeated := lastOccurrences(records[section.Name])
+		sectionResult.Skipped = repeated
+
+		existingByPartition := make(map[string]map[string]bool)
+		for _, record := range unique {
+			existing, ok := existingByPartition[record.Partition]
+			if !ok {
+				existing, err = GetItemNames(section.Table, section.PartitionKey, record.Partition, section.itemKey())
+				if err != nil {
+					return nil, err
+				}
+				existingByPartition[record.Partition] = existing
+			}
+
+			if existing[record.Name] {
+				sectionResult.Conflicts = append(sectionResult.Conflicts, record.Partition+"/"+record.Name)
+				hasConflicts = true
+				if options.Conflict == ConflictSkip {
+					sectionResult.Skipped++
+					continue
+				}
+				record.Replaces = true
+			}
+			pending[section.Name] = append(pending[section.Name], record)
+			sectionResult.Written++
+		}
+
+		result.Sections = append(result.Sections, sectionResult)
+	}
+
+	if hasConflicts && options.Conflict == ConflictFail {
+		for i := range result.Sections {
+			result.Sections[i].Skipped = result.Sections[i].Total
+			result.Sections[i].Written = 0
+		}
+		return result, ErrRestoreConflict
+	}
+
+	// Score the expenses as expenses added any other way are
+	result.Anomalies, err = scoreRestoredExpenses(pending["expenses"])
+	if err != nil {
+		return nil, err
+	}
+
+	if options.DryRun {
+		return result, nil
+	}
+
+	for _, section := range exportSections {
+		if len(pending[section.Name]) == 0 {
+			continue
+		}
+		var items []map[string]*dynamodb.AttributeValue
+		for _, record := range pending[section.Name] {
+			items = append(items, record.Item)
+		}
+		if err := PutItems(section.Table, items); err != nil {
+			return nil, err
+		}
+		if section.monthly() {
+			var months []string
+			for _, item := range items {
+				months = append(months, aws.StringValue(item["month"].S))
+			}
+			if err := AddUserMonths(options.UserId, months...); err != nil {
+				return nil, err
+			}
+		}
+	}
+	result.restored = pending
+
+	return result, nil
+}
+
+// lastOccurrences keeps the last copy of each item that appears more than
+// once, as separate writes would; a batch write rejects the same key twice.
+// It also returns how many earlier copies were dropped.
+func lastOccurrences(records []restoreRecord) ([]restoreRecord, int) {
+	last := make(map[string]int)
+	for i, record := range records {
+		last[record.Partition+"/"+record.Name] = i
+	}
+
+	var unique []restoreRecord
+	for i, record := range records {
+		if last[record.Partition+"/"+record.Name] == i {
+			unique = append(unique, record)
+		}
+	}
+	return unique, len(records) - len(unique)
+}
+
+// scoreRestoredExpenses scores expense records against the expenses already
+// in their workspace, and updates the records with the scores.
+func scoreRestoredExpenses(records []restoreRecord) ([]ExpenseAnomaly, error) {
+	items := make([]ExpenseItem, len(records))
+	for i, record := range records {
+		if err := dynamodbattribute.UnmarshalMap(record.Item, &items[i]); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal expenses item %s: %v", record.Name, err)
+		}
+	}
+
+	anomalies, err := FlagAnomalousExpenses(items)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range records {
+		av, err := dynamodbattribute.MarshalMap(items[i])
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal expenses item %s: %v", records[i].Name, err)
+		}
+		av["userId#month"] = &dynamodb.AttributeValue{S: aws.String(records[i].Partition)}
+		records[i].Item = av
+	}
+	return anomalies, nil
+}
+
+// PublishRestore publishes the income, budget and expense items a restore
+// wrote, as created or, where they replaced an item, as updated, and checks
+// the alert rules of every month written to.
+func PublishRestore(result *RestoreResult) {
+	months := make(map[string]bool)
+	for _, section := range exportSections {
+		if !section.monthly() {
+			continue
+		}
+		for _, record := range result.restored[section.Name] {
+			month := aws.StringValue(record.Item["month"].S)
+			months[month] = true
+
+			events, ok := restoreEvents[section.Name]
+			if !ok {
+				continue
+			}
+			item := reflect.New(reflect.TypeOf(section.Item))
+			if err := dynamodbattribute.UnmarshalMap(record.Item, item.Interface()); err != nil {
+				log.Printf("Publishing restored %s item %s failed: %v", section.Name, record.Name, err)
+				continue
+			}
+			eventType := events[0]
+			if record.Replaces {
+				eventType = events[1]
+			}
+			PublishEvent(result.UserId, eventType, month, item.Elem().Interface())
+		}
+	}
+
+	for month := range months {
+		NotifyAlerts(result.UserId, month)
+	}
+}
+
+// archiveRecords validates the archived items, reassigns them to the target
+// user and marshals them with their partition key.
+func archiveRecords(archive *ExportArchive, userId string) (map[string][]restoreRecord, error) {
+	records := make(map[string][]restoreRecord)
+	for _, section := range exportSections {
+		for _, item := range archive.Items[section.Name] {
+			if section.Restore != nil {
+				item = section.Restore(item)
+			}
+			av, err := dynamodbattribute.MarshalMap(item)
+			if err != nil {
+				return nil, fmt.Errorf("failed to marshal %s item: %v", section.Name, err)
+			}
+
+			av["userId"] = &dynamodb.AttributeValue{S: aws.String(userId)}
+
+			var name string
+			if key, ok := av[section.itemKey()]; ok {
+				name = aws.StringValue(key.S)
+			}
+			if name == "" {
+				return nil, fmt.Errorf("%s item has no %s", section.Name, section.itemKey())
+			}
+
+			partition := userId
+			if section.monthly() {
+				var month string
+				if value, ok := av["month"]; ok {
+					month = aws.StringValue(value.S)
+				}
+				if _, err := parseMonth(month); err != nil {
+					return nil, fmt.Errorf("%s item %s: %v", section.Name, name, err)
+				}
+				partition = fmt.Sprintf("%s#%s", userId, month)
+				av["userId#month"] = &dynamodb.AttributeValue{S: aws.String(partition)}
+			}
+
+			records[section.Name] = append(records[section.Name], restoreRecord{Partition: partition, Name: name, Item: av})
+		}
+	}
+
+	return records, nil
+}
+
+// findExportSection returns the section with the given name.
+func findExportSection(name string) (exportSection, bool) {
+	for _, section := range exportSections {
+		if section.Name == name {
+			return section, true
+		}
+	}
+	return exportSection{}, false
+}
+
+// readJSONArchive reads the document produced by WriteJSONExport.
+func readJSONArchive(data []byte) (*ExportArchive, error) {
+	archive := &ExportArchive{Items: make(map[string][]interface{})}
+	if err := json.Unmarshal(data, &archive.ExportManifest); err != nil {
+		return nil, fmt.Errorf("failed to decode JSON export: %v", err)
+	}
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("failed to decode JSON export: %v", err)
+	}
+
+	for _, name := range archive.Sections {
+		section, ok := findExportSection(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown export section %s", name)
+		}
+		items := reflect.New(reflect.SliceOf(reflect.TypeOf(section.Item)))
+		if content, ok := raw[name]; ok {
+			if err := json.Unmarshal(content, items.Interface()); err != nil {
+				return nil, fmt.Errorf("failed to decode %s: %v", name, err)
+			}
+		}
+		for i := 0; i < items.Elem().Len(); i++ {
+			archive.Items[name] = append(archive.Items[name], items.Elem().Index(i).Interface())
+		}
+	}
+
+	return archive, nil
+}
+
+// readCSVArchive reads the zip produced by WriteCSVExport.
+func readCSVArchive(data []byte) (*ExportArchive, error) {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open export archive: %v", err)
+	}
+
+	archive := &ExportArchive{Items: make(map[string][]interface{})}
+	files := make(map[string]*zip.File)
+	for _, file := range reader.File {
+		files[file.Name] = file
+	}
+
+	// Every file read counts towards the limit. The sizes the archive
+	// claims are checked first, and the reads are limited too as the claims
+	// can be false
+	remaining := int64(MaxRestoreUncompressedSize)
+
+	manifest, ok := files["manifest.json"]
+	if !ok {
+		return nil, fmt.Errorf("export archive has no manifest.json")
+	}
+	err = readZipFile(manifest, &remaining, func(r io.Reader) error {
+		return json.NewDecoder(r).Decode(&archive.ExportManifest)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read export manifest: %v", err)
+	}
+
+	for _, section := range archive.Sections {
+		file, ok := files[section+".csv"]
+		if !ok {
+			return nil, fmt.Errorf("export archive is missing %s.csv", section)
+		}
+		err := readZipFile(file, &remaining, func(r io.Reader) error {
+			return readCSVSection(archive, section, r)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s.csv: %v", section, err)
+		}
+	}
+
+	return archive, nil
+}
+
+// readZipFile calls fn with the content of a file of a zip. No more than
+// remaining bytes are inflated, and remaining is reduced by what was read.
+func readZipFile(file *zip.File, remaining *int64, fn func(r io.Reader) error) error {
+	tooLarge := fmt.Errorf("export archive is larger than %d MB uncompressed", MaxRestoreUncompressedSize>>20)
+	if file.UncompressedSize64 > uint64(*remaining) {
+		return tooLarge
+	}
+
+	rc, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	// Allow one byte over the limit, to tell a file that reaches the limit
+	// from one that is cut off by it
+	limited := &io.LimitedReader{R: rc, N: *remaining + 1}
+	err = fn(limited)
+	*remaining = limited.N - 1
+	if *remaining < 0 {
+		return tooLarge
+	}
+	return err
+}
+
+func readCSVSection(archive *ExportArchive, name string, r io.Reader) error {
+	section, ok := findExportSection(name)
+	if !ok {
+		return fmt.Errorf("unknown export section %s", name)
+	}
+
+	rows, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return fmt.Errorf("missing header row")
+	}
+
+	for line, row := range rows[1:] {
+		item, err := csvItem(reflect.TypeOf(section.Item), rows[0], row)
+		if err != nil {
+			return fmt.Errorf("row %d: %v", line+2, err)
+		}
+		archive.Items[name] = append(archive.Items[name], item)
+	}
+
+	return nil
+}
+
+// RestoreCommand implements the "restore" admin command, which restores an
+// export file from disk without going through the API. Unlike the restore
+// endpoint it publishes no events; run evaluate-alerts afterwards to check
+// the alert rules of the restored months:
+//
+//	backend restore -file export.json -user <userId> [-dry-run] [-conflict skip|overwrite|fail]
+func RestoreCommand(args []string) int {
+	flags := flag.NewFlagSet("restore", flag.ContinueOnError)
+	file := flags.String("file", "", "export file to restore (JSON document or CSV zip)")
+	userId := flags.String("user", "", "userId to restore into (defaults to the userId in the export)")
+	dryRun := flags.Bool("dry-run", false, "report what would be written without writing")
+	conflict := flags.String("conflict", ConflictSkip, "what to do with items that already exist: skip, overwrite or fail")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *file == "" {
+		fmt.Fprintln(os.Stderr, "restore: -file is required")
+		flags.Usage()
+		return 2
+	}
+
+	data, err := os.ReadFile(*file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "restore: %v\n", err)
+		return 1
+	}
+	archive, err := ReadExportArchive(data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "restore: %v\n", err)
+		return 1
+	}
+
+	result, err := RestoreArchive(archive, RestoreOptions{UserId: *userId, DryRun: *dryRun, Conflict: *conflict})
+	if result != nil {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(result)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "restore: %v\n", err)
+		return 1
+	}
+	return 0
+}
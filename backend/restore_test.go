@@ -0,0 +1,206 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"encoding/json"
+	"hash/crc32"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// zipOf builds a zip holding one file. A claimed size other than the real
+// one makes a zip whose header lies about it.
+func zipOf(t *testing.T, name string, content []byte, claimedSize uint64) *zip.File {
+	var compressed bytes.Buffer
+	deflate, _ := flate.NewWriter(&compressed, flate.BestCompression)
+	deflate.Write(content)
+	deflate.Close()
+
+	var data bytes.Buffer
+	writer := zip.NewWriter(&data)
+	file, err := writer.CreateRaw(&zip.FileHeader{
+		Name:               name,
+		Method:             zip.Deflate,
+		CRC32:              crc32.ChecksumIEEE(content),
+		CompressedSize64:   uint64(compressed.Len()),
+		UncompressedSize64: claimedSize,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Write(compressed.Bytes())
+	writer.Close()
+
+	reader, err := zip.NewReader(bytes.NewReader(data.Bytes()), int64(data.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reader.File[0]
+}
+
+func TestReadZipFileLimits(t *testing.T) {
+	content := []byte(strings.Repeat("0", 1000))
+	readAll := func(r io.Reader) error {
+		_, err := io.ReadAll(r)
+		return err
+	}
+
+	remaining := int64(2000)
+	if err := readZipFile(zipOf(t, "a.csv", content, 1000), &remaining, readAll); err != nil {
+		t.Fatal(err)
+	}
+	if remaining != 1000 {
+		t.Errorf("got %d bytes remaining, want 1000", remaining)
+	}
+
+	// Exactly at the limit is allowed
+	remaining = 1000
+	if err := readZipFile(zipOf(t, "a.csv", content, 1000), &remaining, readAll); err != nil || remaining != 0 {
+		t.Errorf("at the limit: got %v with %d remaining", err, remaining)
+	}
+
+	// A file that claims to be too large is not inflated
+	remaining = 500
+	called := false
+	err := readZipFile(zipOf(t, "a.csv", content, 1000), &remaining, func(r io.Reader) error {
+		called = true
+		return nil
+	})
+	if err == nil || called {
+		t.Errorf("claimed too large: got %v, called %v", err, called)
+	}
+
+	// A file that claims to be small but is not is cut off
+	remaining = 500
+	if err := readZipFile(zipOf(t, "a.csv", content, 100), &remaining, readAll); err == nil {
+		t.Error("expected an error for a file larger than it claims")
+	}
+}
+
+// exportFixture is a workspace's stored items by section. The rent expense
+// appears twice, as it can in an archive that was edited by hand.
+var exportFixture = map[string][]interface{}{
+	"income": {
+		IncomeItem{UserId: "user-1", IncomeItemName: "salary", Month: "2024-01", IncomeItemValue: 30000000, Date: "2024-01-25", Payer: "Acme", AccountId: "checking", Currency: "EUR"},
+	},
+	"expenses": {
+		ExpenseItem{UserId: "user-1", ExpenseItemName: "rent", Month: "2024-01", ExpenseValue: 12000000, ExpenseTags: []string{"housing"}, Date: "2024-01-01", Currency: "EUR"},
+		ExpenseItem{
+			UserId: "user-1", ExpenseItemName: "groceries", Month: "2024-01", ExpenseValue: 1234500, ExpenseTags: []string{"food", "weekly"},
+			Date: "2024-01-06", Merchant: "Market, \"Central\"", DuplicateOf: "shop", DuplicateOfMonth: "2023-12", AccountId: "card", Currency: "EUR",
+			Splits: []ExpenseSplit{
+				{Amount: 1000000, Category: "groceries", Tags: []string{"food"}},
+				{Amount: 234500, Category: "household", Note: "soap; sponges"},
+			},
+			Sharing: &ExpenseSharing{Group: "flat", PaidBy: "ana", Method: ShareEqual, Participants: []ExpenseShare{
+				{Participant: "ana", Amount: 617300}, {Participant: "ben", Weight: 1.5, Amount: 617200},
+			}},
+			AnomalyScore: 0.93,
+			Anomalies:    []string{"merchant amount"},
+		},
+		ExpenseItem{UserId: "user-1", ExpenseItemName: "rent", Month: "2024-01", ExpenseValue: 12500000, ExpenseTags: []string{"housing"}, Date: "2024-01-01", Currency: "EUR"},
+	},
+	"transfers": {
+		Transfer{UserId: "user-1", TransferId: "t1", Month: "2024-02", Date: "2024-02-03", FromAccountId: "checking", ToAccountId: "usd", Amount: 1000000, ToAmount: 1085000, Description: "to dollars"},
+	},
+	"scenarios": {
+		Scenario{UserId: "user-1", ScenarioId: "s1", ScenarioName: "Car", BaseMonth: "2024-01", CreatedAt: "2024-01-02T10:00:00Z", Lines: []ScenarioLine{
+			{Kind: ScenarioIncome, Name: "salary", Amount: 30000000},
+			{Kind: ScenarioLoan, Name: "car", Amount: 4300000, Currency: "EUR", StartMonth: "2024-03", EndMonth: "2027-02", Principal: 150000000, APR: 5.5, TermMonths: 36},
+		}},
+	},
+	"webhooks": {
+		Webhook{UserId: "user-1", WebhookId: "w1", URL: "https://example.com/hook", Events: []string{"*"}, Disabled: true, CreatedAt: "2024-01-02T10:00:00Z", Secret: "whsec_secret"},
+	},
+}
+
+func TestExportRoundTrip(t *testing.T) {
+	var sections []exportSection
+	for _, section := range exportSections {
+		if _, ok := exportFixture[section.Name]; ok {
+			sections = append(sections, section)
+		}
+	}
+	source := func(section exportSection, fn func(item map[string]*dynamodb.AttributeValue) error) error {
+		for _, item := range exportFixture[section.Name] {
+			av, err := dynamodbattribute.MarshalMap(item)
+			if err != nil {
+				return err
+			}
+			if err := fn(av); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	formats := []struct {
+		name  string
+		write func(w io.Writer) error
+	}{
+		{"json", func(w io.Writer) error { return writeJSONExport(w, "user-1", sections, source) }},
+		{"csv", func(w io.Writer) error { return writeCSVExport(w, "user-1", sections, source) }},
+	}
+	for _, format := range formats {
+		var data bytes.Buffer
+		if err := format.write(&data); err != nil {
+			t.Fatalf("%s: %v", format.name, err)
+		}
+		archive, err := ReadExportArchive(data.Bytes())
+		if err != nil {
+			t.Fatalf("%s: %v", format.name, err)
+		}
+		if archive.UserId != "user-1" || len(archive.Sections) != len(sections) {
+			t.Errorf("%s: got user %s and sections %v", format.name, archive.UserId, archive.Sections)
+		}
+
+		// Items come back as they were stored, less what the export leaves
+		// out. They are compared as the API returns them, since an empty
+		// list may come back as no list
+		for _, section := range sections {
+			var want []interface{}
+			for _, item := range exportFixture[section.Name] {
+				if section.Export != nil {
+					item = section.Export(item)
+				}
+				want = append(want, item)
+			}
+			got, _ := json.Marshal(archive.Items[section.Name])
+			wantJSON, _ := json.Marshal(want)
+			if !bytes.Equal(got, wantJSON) {
+				t.Errorf("%s %s: got %s, want %s", format.name, section.Name, got, wantJSON)
+			}
+			if len(archive.Items[section.Name]) > 0 && reflect.TypeOf(archive.Items[section.Name][0]) != reflect.TypeOf(section.Item) {
+				t.Errorf("%s %s: got items of type %T", format.name, section.Name, archive.Items[section.Name][0])
+			}
+		}
+
+		// Both copies of the repeated item are read, and the last one is
+		// the one restored
+		records, err := archiveRecords(archive, "user-2")
+		if err != nil {
+			t.Fatalf("%s: %v", format.name, err)
+		}
+		unique, repeated := lastOccurrences(records["expenses"])
+		if len(unique) != 2 || repeated != 1 {
+			t.Fatalf("%s: got %d expenses and %d repeated, want 2 and 1", format.name, len(unique), repeated)
+		}
+		var rent ExpenseItem
+		if err := dynamodbattribute.UnmarshalMap(unique[1].Item, &rent); err != nil {
+			t.Fatal(err)
+		}
+		if unique[0].Name != "groceries" || rent.ExpenseItemName != "rent" || rent.ExpenseValue != 12500000 {
+			t.Errorf("%s: got %s and %s of %s", format.name, unique[0].Name, rent.ExpenseItemName, rent.ExpenseValue)
+		}
+		if unique[1].Partition != "user-2#2024-01" || rent.UserId != "user-2" {
+			t.Errorf("%s: restored to %s as %s", format.name, unique[1].Partition, rent.UserId)
+		}
+	}
+}
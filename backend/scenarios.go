@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// Kinds of scenario line.
+const (
+	ScenarioIncome = "income"
+	ScenarioBudget = "budget"
+	ScenarioLoan   = "loan"
+)
+
+// scenarioHorizon is how many months scenarios are compared over unless
+// another horizon is asked for.
+const scenarioHorizon = 12
+
+// NewScenario copies a month's income and budget items into the lines of a
+// new scenario.
+func NewScenario(userId string, name string, baseMonth string, income []IncomeItem, budget []BudgetItem) Scenario {
+	scenario := Scenario{
+		UserId:       userId,
+		ScenarioName: name,
+		BaseMonth:    baseMonth,
+		CreatedAt:    time.Now().UTC().Format(time.RFC3339),
+		Lines:        []ScenarioLine{},
+	}
+	for _, item := range income {
+		scenario.Lines = append(scenario.Lines, ScenarioLine{
+			Kind:     ScenarioIncome,
+			Name:     item.IncomeItemName,
+			Amount:   item.IncomeItemValue,
+			Currency: item.Currency,
+		})
+	}
+	for _, item := range budget {
+		scenario.Lines = append(scenario.Lines, ScenarioLine{
+			Kind:     ScenarioBudget,
+			Name:     item.BudgetItemName,
+			Amount:   item.BudgetItemValue,
+			Currency: item.Currency,
+		})
+	}
+	return scenario
+}
+
+// ValidateScenario checks a scenario's name and lines. Loan lines get their
+// monthly repayment and last month worked out.
+func ValidateScenario(scenario *Scenario) error {
+	scenario.ScenarioName = strings.TrimSpace(scenario.ScenarioName)
+	if scenario.ScenarioName == "" {
+		return fmt.Errorf("scenarioName is required")
+	}
+	if _, err := parseMonth(scenario.BaseMonth); err != nil {
+		return err
+	}
+	if scenario.Lines == nil {
+		scenario.Lines = []ScenarioLine{}
+	}
+	for i := range scenario.Lines {
+		if err := validateScenarioLine(&scenario.Lines[i]); err != nil {
+			return fmt.Errorf("line %d: %v", i+1, err)
+		}
+	}
+	return nil
+}
+
+func validateScenarioLine(line *ScenarioLine) error {
+	line.Name = strings.TrimSpace(line.Name)
+	if line.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if line.Currency != "" {
+		currency, err := normalizeCurrency(line.Currency)
+		if err != nil {
+			return err
+		}
+		line.Currency = currency
+	}
+	for _, month := range []string{line.StartMonth, line.EndMonth} {
+		if month == "" {
+			continue
+		}
+		if _, err := parseMonth(month); err != nil {
+			return err
+		}
+	}
+
+	switch line.Kind {
+	case ScenarioIncome, ScenarioBudget:
+		line.Amount = line.Amount.Round(line.Currency)
+		if line.Amount < 0 {
+			return fmt.Errorf("amount cannot be negative")
+		}
+	case ScenarioLoan:
+		line.Principal = line.Principal.Round(line.Currency)
+		if line.Principal <= 0 {
+			return fmt.Errorf("loans need a positive principal")
+		}
+		if line.TermMonths < 1 {
+			return fmt.Errorf("loans need a term of at least one month")
+		}
+		if line.APR < 0 || line.APR > 100 {
+			return fmt.Errorf("apr must be a percentage between 0 and 100")
+		}
+		if line.StartMonth == "" {
+			return fmt.Errorf("loans need a startMonth")
+		}
+		line.Amount = LoanPayment(line.Principal, line.APR, line.TermMonths, line.Currency)
+		line.EndMonth, _ = addMonths(line.StartMonth, line.TermMonths-1)
+	default:
+		return fmt.Errorf("invalid kind %q, expected income, budget or loan", line.Kind)
+	}
+	if line.StartMonth != "" && line.EndMonth != "" && line.EndMonth < line.StartMonth {
+		return fmt.Errorf("endMonth is before startMonth")
+	}
+	return nil
+}
+
+// LoanPayment returns the fixed monthly repayment of a loan, rounded up to
+// the currency's minor unit so the loan is repaid within its term.
+func LoanPayment(principal Money, apr float64, termMonths int, currency string) Money {
+	if apr == 0 {
+		return ceilMoney(principal, termMonths, currency)
+	}
+	rate := apr / 1200
+	payment := principal.Float64() * rate / (1 - math.Pow(1+rate, -float64(termMonths)))
+	step := math.Pow10(-currencyMinorUnits(currency))
+	return MoneyFromFloat(math.Ceil(payment/step-1e-9) * step).Round(currency)
+}
+
+// lineActive reports whether a scenario line applies in a month.
+func lineActive(line ScenarioLine, month string) bool {
+	return (line.StartMonth == "" || month >= line.StartMonth) && (line.EndMonth == "" || month <= line.EndMonth)
+}
+
+// CompareScenarios projects each scenario's lines over the months from start,
+// converted to the base currency at today's rates. Lines that cannot be
+// converted are left out and the missing pairs listed.
+func CompareScenarios(scenarios []Scenario, start string, months int, base string, rates *RateTable, now time.Time) (*ScenarioComparison, error) {
+	if months < 1 {
+		return nil, fmt.Errorf("months must be at least 1")
+	}
+	last, err := addMonths(start, months-1)
+	if err != nil {
+		return nil, err
+	}
+	monthList, err := monthsBetween(start, last)
+	if err != nil {
+		return nil, err
+	}
+
+	comparison := &ScenarioComparison{
+		BaseCurrency: base,
+		StartMonth:   start,
+		Months:       months,
+		Scenarios:    []ScenarioProjection{},
+		MissingRates: []string{},
+	}
+	missing := make(map[string]bool)
+	convert := func(amount Money, currency string) (Money, bool) {
+		if currency == "" {
+			currency = base
+		}
+		converted, ok := rates.Convert(amount, currency, base, now)
+		if !ok {
+			key := fmt.Sprintf("%s/%s@%s", currency, base, now.Format("2006-01-02"))
+			if !missing[key] {
+				missing[key] = true
+				comparison.MissingRates = append(comparison.MissingRates, key)
+			}
+		}
+		return converted, ok
+	}
+
+	for _, scenario := range scenarios {
+		projection := ScenarioProjection{
+			ScenarioId:   scenario.ScenarioId,
+			ScenarioName: scenario.ScenarioName,
+			Months:       make([]ScenarioMonth, 0, len(monthList)),
+		}
+		var cumulative Money
+		for _, month := range monthList {
+			point := ScenarioMonth{Month: month}
+			for _, line := range scenario.Lines {
+				if !lineActive(line, month) {
+					continue
+				}
+				amount, ok := convert(line.Amount, line.Currency)
+				if !ok {
+					continue
+				}
+				if line.Kind == ScenarioIncome {
+					point.Income += amount
+				} else {
+					point.Spending += amount
+				}
+			}
+			point.Net = point.Income - point.Spending
+			cumulative += point.Net
+			point.CumulativeNet = cumulative
+
+			projection.TotalIncome += point.Income
+			projection.TotalSpending += point.Spending
+			projection.Months = append(projection.Months, point)
+		}
+		projection.TotalNet = projection.TotalIncome - projection.TotalSpending
+		if len(comparison.Scenarios) > 0 {
+			projection.NetDifference = projection.TotalNet - comparison.Scenarios[0].TotalNet
+		}
+		comparison.Scenarios = append(comparison.Scenarios, projection)
+	}
+	return comparison, nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoanPayment(t *testing.T) {
+	tests := []struct {
+		name       string
+		principal  Money
+		apr        float64
+		termMonths int
+		currency   string
+		want       Money
+	}{
+		{"no interest, rounded up", 10000000, 0, 3, "USD", 3333400},
+		{"no interest, even split", 12000000, 0, 12, "USD", 1000000},
+		{"no interest in yen", 10000000, 0, 3, "JPY", 3340000},
+		{"interest", 100000000, 6, 12, "USD", 8606700},
+		{"mortgage", 2000000000, 5, 360, "USD", 10736500},
+		{"interest in yen", 10000000000, 3, 12, "JPY", 846940000},
+		{"single month", 10000000, 12, 1, "USD", 10100000},
+	}
+	for _, test := range tests {
+		got := LoanPayment(test.principal, test.apr, test.termMonths, test.currency)
+		if got != test.want {
+			t.Errorf("%s: got %s, want %s", test.name, got, test.want)
+		}
+		// The payments always repay at least the principal
+		if got.Mul(float64(test.termMonths)) < test.principal {
+			t.Errorf("%s: %d payments of %s do not repay %s", test.name, test.termMonths, got, test.principal)
+		}
+	}
+}
+
+func TestValidateScenarioLoan(t *testing.T) {
+	tests := []struct {
+		name     string
+		line     ScenarioLine
+		amount   Money
+		endMonth string
+		wantErr  bool
+	}{
+		{
+			"end month across the year",
+			ScenarioLine{Kind: ScenarioLoan, Name: "car", Principal: 30000000, TermMonths: 3, StartMonth: "2024-11", Currency: "usd"},
+			10000000, "2025-01", false,
+		},
+		{
+			"end month given is replaced",
+			ScenarioLine{Kind: ScenarioLoan, Name: "car", Principal: 30000000, TermMonths: 1, StartMonth: "2024-11", EndMonth: "2030-01"},
+			30000000, "2024-11", false,
+		},
+		{"no principal", ScenarioLine{Kind: ScenarioLoan, Name: "car", TermMonths: 3, StartMonth: "2024-11"}, 0, "", true},
+		{"no term", ScenarioLine{Kind: ScenarioLoan, Name: "car", Principal: 30000000, StartMonth: "2024-11"}, 0, "", true},
+		{"no start month", ScenarioLine{Kind: ScenarioLoan, Name: "car", Principal: 30000000, TermMonths: 3}, 0, "", true},
+		{"apr out of range", ScenarioLine{Kind: ScenarioLoan, Name: "car", Principal: 30000000, TermMonths: 3, StartMonth: "2024-11", APR: 120}, 0, "", true},
+	}
+	for _, test := range tests {
+		scenario := Scenario{ScenarioName: "plan", BaseMonth: "2024-10", Lines: []ScenarioLine{test.line}}
+		err := ValidateScenario(&scenario)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: error %v, want error %v", test.name, err, test.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		line := scenario.Lines[0]
+		if line.Amount != test.amount || line.EndMonth != test.endMonth {
+			t.Errorf("%s: got %s until %s, want %s until %s", test.name, line.Amount, line.EndMonth, test.amount, test.endMonth)
+		}
+	}
+}
+
+func TestCompareScenarios(t *testing.T) {
+	now := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+	rates := NewRateTable([]ExchangeRate{{FromCurrency: "EUR", ToCurrency: "USD", Rate: 1.1, Date: "2024-01-01"}})
+
+	current := Scenario{ScenarioId: "current", ScenarioName: "Current", Lines: []ScenarioLine{
+		{Kind: ScenarioIncome, Name: "salary", Amount: 30000000},
+		{Kind: ScenarioBudget, Name: "living", Amount: 20000000, Currency: "USD"},
+	}}
+	withLoan := Scenario{ScenarioId: "loan", ScenarioName: "With a loan", Lines: []ScenarioLine{
+		{Kind: ScenarioIncome, Name: "salary", Amount: 30000000},
+		{Kind: ScenarioIncome, Name: "rent out", Amount: 1000000, Currency: "EUR"},
+		{Kind: ScenarioIncome, Name: "pounds", Amount: 1000000, Currency: "GBP"},
+		{Kind: ScenarioBudget, Name: "living", Amount: 20000000},
+		{Kind: ScenarioLoan, Name: "car", Amount: 5000000, StartMonth: "2024-02", EndMonth: "2024-03"},
+	}}
+
+	comparison, err := CompareScenarios([]Scenario{current, withLoan}, "2024-01", 4, "USD", rates, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(comparison.Scenarios) != 2 {
+		t.Fatalf("got %d scenarios", len(comparison.Scenarios))
+	}
+
+	base := comparison.Scenarios[0]
+	if base.TotalNet != 40000000 || base.NetDifference != 0 {
+		t.Errorf("current: got total net %s and difference %s", base.TotalNet, base.NetDifference)
+	}
+
+	// The euros are converted at today's rate, the pounds cannot be, and
+	// the loan is repaid in February and March only
+	projection := comparison.Scenarios[1]
+	wantNet := []Money{11100000, 6100000, 6100000, 11100000}
+	wantCumulative := []Money{11100000, 17200000, 23300000, 34400000}
+	for i, month := range projection.Months {
+		if month.Net != wantNet[i] || month.CumulativeNet != wantCumulative[i] {
+			t.Errorf("%s: got net %s and cumulative %s, want %s and %s", month.Month, month.Net, month.CumulativeNet, wantNet[i], wantCumulative[i])
+		}
+	}
+	if projection.TotalIncome != 124400000 || projection.TotalSpending != 90000000 || projection.TotalNet != 34400000 {
+		t.Errorf("got totals %s, %s and %s", projection.TotalIncome, projection.TotalSpending, projection.TotalNet)
+	}
+	if projection.NetDifference != -5600000 {
+		t.Errorf("got net difference %s, want -560", projection.NetDifference)
+	}
+
+	if len(comparison.MissingRates) != 1 || comparison.MissingRates[0] != "GBP/USD@2024-01-15" {
+		t.Errorf("got missing rates %v", comparison.MissingRates)
+	}
+
+	if _, err := CompareScenarios([]Scenario{current}, "2024-01", 0, "USD", rates, now); err == nil {
+		t.Error("expected an error for 0 months")
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Ways of sharing an expense among a group.
+const (
+	ShareEqual   = "equal"
+	ShareShares  = "shares"
+	ShareExact   = "exact"
+	SharePercent = "percent"
+)
+
+// ComputeShares validates an expense's sharing, if it has any, and fills in
+// each participant's amount. Amounts are in the expense's currency and always
+// add up to exactly the expense value; any minor units left over from
+// dividing are handed out one at a time, largest remainder first.
+func ComputeShares(item *ExpenseItem) error {
+	sharing := item.Sharing
+	if sharing == nil {
+		return nil
+	}
+
+	sharing.Group = strings.TrimSpace(sharing.Group)
+	sharing.PaidBy = strings.TrimSpace(sharing.PaidBy)
+	if sharing.PaidBy == "" {
+		return fmt.Errorf("sharing needs paidBy")
+	}
+	if len(sharing.Participants) == 0 {
+		return fmt.Errorf("sharing needs at least one participant")
+	}
+	seen := make(map[string]bool)
+	for i := range sharing.Participants {
+		share := &sharing.Participants[i]
+		share.Participant = strings.TrimSpace(share.Participant)
+		if share.Participant == "" {
+			return fmt.Errorf("participant %d has no name", i+1)
+		}
+		if seen[share.Participant] {
+			return fmt.Errorf("participant %s is listed twice", share.Participant)
+		}
+		seen[share.Participant] = true
+	}
+
+	weights := make([]float64, len(sharing.Participants))
+	switch sharing.Method {
+	case ShareEqual, "":
+		sharing.Method = ShareEqual
+		for i := range weights {
+			weights[i] = 1
+		}
+	case ShareShares, SharePercent:
+		total := 0.0
+		for i, share := range sharing.Participants {
+			if share.Weight < 0 {
+				return fmt.Errorf("participant %s has a negative %s", share.Participant, sharing.Method)
+			}
+			weights[i] = share.Weight
+			total += share.Weight
+		}
+		if total <= 0 {
+			return fmt.Errorf("%s must add up to more than zero", sharing.Method)
+		}
+		if sharing.Method == SharePercent && math.Abs(total-100) > 1e-6 {
+			return fmt.Errorf("percentages add up to %g, not 100", total)
+		}
+	case ShareExact:
+		var total Money
+		for i := range sharing.Participants {
+			share := &sharing.Participants[i]
+			share.Amount = share.Amount.Round(item.Currency)
+			if share.Amount < 0 {
+				return fmt.Errorf("participant %s has a negative amount", share.Participant)
+			}
+			total += share.Amount
+		}
+		if total != item.ExpenseValue {
+			return fmt.Errorf("exact shares add up to %s but the expense is %s", total.Format(item.Currency), item.ExpenseValue.Format(item.Currency))
+		}
+		return nil
+	default:
+		return fmt.Errorf("invalid sharing method %q, expected equal, shares, exact or percent", sharing.Method)
+	}
+
+	for i, amount := range allocateMoney(item.ExpenseValue, item.Currency, weights) {
+		sharing.Participants[i].Amount = amount
+	}
+	return nil
+}
+
+// allocateMoney divides an amount in proportion to weights, in whole minor
+// units of the currency, so that the parts add up to exactly the amount.
+func allocateMoney(amount Money, currency string, weights []float64) []Money {
+	step := Money(math.Pow10(moneyScale - currencyMinorUnits(currency)))
+	units := int64(amount.Round(currency) / step)
+	sign := int64(1)
+	if units < 0 {
+		sign, units = -1, -units
+	}
+
+	total := 0.0
+	for _, weight := range weights {
+		total += weight
+	}
+
+	parts := make([]int64, len(weights))
+	remainders := make([]float64, len(weights))
+	allocated := int64(0)
+	for i, weight := range weights {
+		exact := float64(units) * weight / total
+		parts[i] = int64(math.Floor(exact))
+		remainders[i] = exact - float64(parts[i])
+		allocated += parts[i]
+	}
+
+	order := make([]int, len(weights))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return remainders[order[a]] > remainders[order[b]] })
+	for i := 0; allocated < units; i++ {
+		parts[order[i%len(order)]]++
+		allocated++
+	}
+
+	amounts := make([]Money, len(weights))
+	for i, part := range parts {
+		amounts[i] = Money(sign*part) * step
+	}
+	return amounts
+}
+
+// ComputeGroupBalances nets a group's shared expenses and settlements into a
+// balance per participant and currency. The payer of an expense is owed its
+// value and each participant owes their share; a settlement moves the
+// amount from the payer's debt to the payee's credit. An empty group covers
+// every group. Expenses and settlements without a currency are in the base
+// currency and are netted with the ones that name it.
+func ComputeGroupBalances(group string, base string, expenses []ExpenseItem, transfers []Transfer) []GroupBalance {
+	type key struct{ participant, currency string }
+	balances := make(map[key]Money)
+	currencyOf := func(currency string) string {
+		if currency == "" {
+			return base
+		}
+		return currency
+	}
+
+	for _, item := range expenses {
+		sharing := item.Sharing
+		if sharing == nil || (group != "" && sharing.Group != group) {
+			continue
+		}
+		currency := currencyOf(item.Currency)
+		balances[key{sharing.PaidBy, currency}] += item.ExpenseValue
+		for _, share := range sharing.Participants {
+			balances[key{share.Participant, currency}] -= share.Amount
+		}
+	}
+	for _, transfer := range transfers {
+		if transfer.FromParticipant == "" || (group != "" && transfer.Group != group) {
+			continue
+		}
+		currency := currencyOf(transfer.Currency)
+		balances[key{transfer.FromParticipant, currency}] += transfer.Amount
+		balances[key{transfer.ToParticipant, currency}] -= transfer.Amount
+	}
+
+	result := []GroupBalance{}
+	for k, balance := range balances {
+		result = append(result, GroupBalance{Participant: k.participant, Currency: k.currency, Balance: balance})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Currency != result[j].Currency {
+			return result[i].Currency < result[j].Currency
+		}
+		return result[i].Participant < result[j].Participant
+	})
+	return result
+}
+
+// SuggestSettlements proposes payments that bring every balance to zero.
+// In each currency the largest debtor pays the largest creditor until one of
+// them is settled, which needs at most one payment fewer than there are
+// participants with a balance.
+func SuggestSettlements(balances []GroupBalance) []SettlementSuggestion {
+	byCurrency := make(map[string][]GroupBalance)
+	var currencies []string
+	for _, balance := range balances {
+		if balance.Balance == 0 {
+			continue
+		}
+		if _, ok := byCurrency[balance.Currency]; !ok {
+			currencies = append(currencies, balance.Currency)
+		}
+		byCurrency[balance.Currency] = append(byCurrency[balance.Currency], balance)
+	}
+	sort.Strings(currencies)
+
+	suggestions := []SettlementSuggestion{}
+	for _, currency := range currencies {
+		var debtors, creditors []GroupBalance
+		for _, balance := range byCurrency[currency] {
+			if balance.Balance < 0 {
+				balance.Balance = -balance.Balance
+				debtors = append(debtors, balance)
+			} else {
+				creditors = append(creditors, balance)
+			}
+		}
+		largestFirst := func(list []GroupBalance) {
+			sort.SliceStable(list, func(i, j int) bool {
+				if list[i].Balance != list[j].Balance {
+					return list[i].Balance > list[j].Balance
+				}
+				return list[i].Participant < list[j].Participant
+			})
+		}
+		largestFirst(debtors)
+		largestFirst(creditors)
+
+		for i, j := 0, 0; i < len(debtors) && j < len(creditors); {
+			amount := debtors[i].Balance
+			if creditors[j].Balance < amount {
+				amount = creditors[j].Balance
+			}
+			suggestions = append(suggestions, SettlementSuggestion{
+				FromParticipant: debtors[i].Participant,
+				ToParticipant:   creditors[j].Participant,
+				Currency:        currency,
+				Amount:          amount,
+			})
+			debtors[i].Balance -= amount
+			creditors[j].Balance -= amount
+			if debtors[i].Balance == 0 {
+				i++
+			}
+			if creditors[j].Balance == 0 {
+				j++
+			}
+		}
+	}
+	return suggestions
+}
+
+// ValidateSettlement checks a settlement between two participants and
+// derives its month from its date. A settlement without a currency is in the
+// base currency, which is recorded on it.
+func ValidateSettlement(transfer *Transfer, base string) error {
+	transfer.FromParticipant = strings.TrimSpace(transfer.FromParticipant)
+	transfer.ToParticipant = strings.TrimSpace(transfer.ToParticipant)
+	if transfer.FromParticipant == "" || transfer.ToParticipant == "" {
+		return fmt.Errorf("fromParticipant and toParticipant are required")
+	}
+	if transfer.FromParticipant == transfer.ToParticipant {
+		return fmt.Errorf("cannot settle with yourself")
+	}
+	if transfer.Currency == "" {
+		transfer.Currency = base
+	}
+	currency, err := normalizeCurrency(transfer.Currency)
+	if err != nil {
+		return err
+	}
+	transfer.Currency = currency
+	transfer.Amount = transfer.Amount.Round(transfer.Currency)
+	if transfer.Amount <= 0 {
+		return fmt.Errorf("amount must be positive")
+	}
+	if transfer.Date == "" {
+		transfer.Date = time.Now().UTC().Format("2006-01-02")
+	}
+	date, err := time.Parse("2006-01-02", transfer.Date)
+	if err != nil {
+		return fmt.Errorf("invalid date, expected YYYY-MM-DD")
+	}
+	transfer.Month = date.Format(monthLayout)
+	return nil
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestComputeShares(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    Money
+		currency string
+		method   string
+		shares   []ExpenseShare
+		want     []Money
+		wantErr  bool
+	}{
+		{
+			"equal with leftover cents",
+			1000000, "USD", ShareEqual,
+			[]ExpenseShare{{Participant: "ann"}, {Participant: "bob"}, {Participant: "cy"}},
+			[]Money{333400, 333300, 333300}, false,
+		},
+		{
+			"equal in a currency without minor units",
+			1000000, "JPY", "",
+			[]ExpenseShare{{Participant: "ann"}, {Participant: "bob"}, {Participant: "cy"}},
+			[]Money{340000, 330000, 330000}, false,
+		},
+		{
+			"shares",
+			900000, "USD", ShareShares,
+			[]ExpenseShare{{Participant: "ann", Weight: 2}, {Participant: "bob", Weight: 1}},
+			[]Money{600000, 300000}, false,
+		},
+		{
+			"percent",
+			1000000, "EUR", SharePercent,
+			[]ExpenseShare{{Participant: "ann", Weight: 25}, {Participant: "bob", Weight: 75}},
+			[]Money{250000, 750000}, false,
+		},
+		{
+			"percent not adding up to 100",
+			1000000, "EUR", SharePercent,
+			[]ExpenseShare{{Participant: "ann", Weight: 25}, {Participant: "bob", Weight: 70}},
+			nil, true,
+		},
+		{
+			"exact",
+			1000000, "USD", ShareExact,
+			[]ExpenseShare{{Participant: "ann", Amount: 400000}, {Participant: "bob", Amount: 600000}},
+			[]Money{400000, 600000}, false,
+		},
+		{
+			"exact not adding up",
+			1000000, "USD", ShareExact,
+			[]ExpenseShare{{Participant: "ann", Amount: 400000}, {Participant: "bob", Amount: 500000}},
+			nil, true,
+		},
+		{
+			"exact with a negative amount",
+			1000000, "USD", ShareExact,
+			[]ExpenseShare{{Participant: "ann", Amount: -200000}, {Participant: "bob", Amount: 1200000}},
+			nil, true,
+		},
+		{
+			"participant listed twice",
+			1000000, "USD", ShareEqual,
+			[]ExpenseShare{{Participant: "ann"}, {Participant: " ann "}},
+			nil, true,
+		},
+	}
+	for _, test := range tests {
+		item := ExpenseItem{ExpenseValue: test.value, Currency: test.currency, Sharing: &ExpenseSharing{
+			PaidBy:       "ann",
+			Method:       test.method,
+			Participants: test.shares,
+		}}
+		err := ComputeShares(&item)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected an error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		var got []Money
+		for _, share := range item.Sharing.Participants {
+			got = append(got, share.Amount)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestComputeGroupBalances(t *testing.T) {
+	expenses := []ExpenseItem{
+		{ExpenseValue: 900000, Sharing: &ExpenseSharing{Group: "trip", PaidBy: "ann", Participants: []ExpenseShare{
+			{Participant: "ann", Amount: 300000}, {Participant: "bob", Amount: 300000}, {Participant: "cy", Amount: 300000},
+		}}},
+		{ExpenseValue: 200000, Currency: "USD", Sharing: &ExpenseSharing{Group: "trip", PaidBy: "bob", Participants: []ExpenseShare{
+			{Participant: "ann", Amount: 100000}, {Participant: "bob", Amount: 100000},
+		}}},
+		{ExpenseValue: 500000, Currency: "USD", Sharing: &ExpenseSharing{Group: "flat", PaidBy: "cy", Participants: []ExpenseShare{
+			{Participant: "cy", Amount: 500000},
+		}}},
+	}
+	transfers := []Transfer{
+		{Group: "trip", FromParticipant: "cy", ToParticipant: "ann", Currency: "USD", Amount: 100000},
+	}
+
+	// The expense without a currency is in the base currency, so it nets
+	// with the USD ones
+	got := ComputeGroupBalances("trip", "USD", expenses, transfers)
+	want := []GroupBalance{
+		{Participant: "ann", Currency: "USD", Balance: 400000},
+		{Participant: "bob", Currency: "USD", Balance: -200000},
+		{Participant: "cy", Currency: "USD", Balance: -200000},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestSuggestSettlements(t *testing.T) {
+	tests := []struct {
+		name     string
+		balances []GroupBalance
+		want     []SettlementSuggestion
+	}{
+		{
+			"settled",
+			[]GroupBalance{{Participant: "ann", Currency: "USD"}, {Participant: "bob", Currency: "USD"}},
+			[]SettlementSuggestion{},
+		},
+		{
+			"two debtors one creditor",
+			[]GroupBalance{
+				{Participant: "ann", Currency: "USD", Balance: 400000},
+				{Participant: "bob", Currency: "USD", Balance: -100000},
+				{Participant: "cy", Currency: "USD", Balance: -300000},
+			},
+			[]SettlementSuggestion{
+				{FromParticipant: "cy", ToParticipant: "ann", Currency: "USD", Amount: 300000},
+				{FromParticipant: "bob", ToParticipant: "ann", Currency: "USD", Amount: 100000},
+			},
+		},
+		{
+			"currencies settled separately",
+			[]GroupBalance{
+				{Participant: "ann", Currency: "USD", Balance: 100000},
+				{Participant: "bob", Currency: "USD", Balance: -100000},
+				{Participant: "ann", Currency: "EUR", Balance: -50000},
+				{Participant: "bob", Currency: "EUR", Balance: 50000},
+			},
+			[]SettlementSuggestion{
+				{FromParticipant: "ann", ToParticipant: "bob", Currency: "EUR", Amount: 50000},
+				{FromParticipant: "bob", ToParticipant: "ann", Currency: "USD", Amount: 100000},
+			},
+		},
+	}
+	for _, test := range tests {
+		if got := SuggestSettlements(test.balances); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestValidateSettlement(t *testing.T) {
+	transfer := Transfer{FromParticipant: "bob", ToParticipant: "ann", Amount: 123456, Date: "2024-03-05"}
+	if err := ValidateSettlement(&transfer, "JPY"); err != nil {
+		t.Fatal(err)
+	}
+	if transfer.Currency != "JPY" || transfer.Amount != 120000 {
+		t.Errorf("got %s %d, want the amount rounded in the base currency", transfer.Currency, transfer.Amount)
+	}
+}
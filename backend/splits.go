@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ValidateSplits checks an expense's split lines, if it has any: every line
+// needs a category and a non-zero amount, and the amounts, rounded to the
+// expense's currency, must add up to exactly the expense value.
+func ValidateSplits(item *ExpenseItem) error {
+	if len(item.Splits) == 0 {
+		item.Splits = nil
+		return nil
+	}
+
+	var total Money
+	for i := range item.Splits {
+		split := &item.Splits[i]
+		split.Category = strings.TrimSpace(split.Category)
+		if split.Category == "" {
+			return fmt.Errorf("split line %d has no category", i+1)
+		}
+		split.Amount = split.Amount.Round(item.Currency)
+		if split.Amount == 0 {
+			return fmt.Errorf("split line %d has no amount", i+1)
+		}
+		if split.Tags == nil {
+			split.Tags = []string{}
+		}
+		total += split.Amount
+	}
+
+	if total != item.ExpenseValue {
+		return fmt.Errorf("split lines add up to %s but the expense is %s", total.Format(item.Currency), item.ExpenseValue.Format(item.Currency))
+	}
+	return nil
+}
+
+// expenseLines returns the lines spending should be attributed to: the split
+// lines of a split expense, or the whole expense as a single line. An expense
+// that is not split has its first tag as its category, as the frontend shows
+// it, and no category when it has no tags.
+func expenseLines(item ExpenseItem) []ExpenseSplit {
+	if len(item.Splits) > 0 {
+		return item.Splits
+	}
+	category := ""
+	if len(item.ExpenseTags) > 0 {
+		category = strings.TrimSpace(item.ExpenseTags[0])
+	}
+	return []ExpenseSplit{{Category: category, Amount: item.ExpenseValue, Tags: item.ExpenseTags}}
+}
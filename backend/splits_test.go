@@ -0,0 +1,81 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExpenseLines(t *testing.T) {
+	tests := []struct {
+		name string
+		item ExpenseItem
+		want []ExpenseSplit
+	}{
+		{
+			"unsplit with tags",
+			ExpenseItem{ExpenseValue: 500000, ExpenseTags: []string{"Groceries", "weekly"}},
+			[]ExpenseSplit{{Category: "Groceries", Amount: 500000, Tags: []string{"Groceries", "weekly"}}},
+		},
+		{
+			"unsplit without tags",
+			ExpenseItem{ExpenseValue: 500000, ExpenseTags: []string{}},
+			[]ExpenseSplit{{Amount: 500000, Tags: []string{}}},
+		},
+		{
+			"split",
+			ExpenseItem{ExpenseValue: 500000, ExpenseTags: []string{"shopping"}, Splits: []ExpenseSplit{
+				{Category: "household", Amount: 300000},
+				{Category: "clothing", Amount: 200000},
+			}},
+			[]ExpenseSplit{{Category: "household", Amount: 300000}, {Category: "clothing", Amount: 200000}},
+		},
+	}
+	for _, test := range tests {
+		if got := expenseLines(test.item); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestValidateSplits(t *testing.T) {
+	item := ExpenseItem{ExpenseValue: 1000000, Currency: "USD", Splits: []ExpenseSplit{
+		{Category: " food ", Amount: 600000},
+		{Category: "drinks", Amount: 400000},
+	}}
+	if err := ValidateSplits(&item); err != nil {
+		t.Fatal(err)
+	}
+	if item.Splits[0].Category != "food" || item.Splits[0].Tags == nil {
+		t.Errorf("split line not normalized: %+v", item.Splits[0])
+	}
+
+	invalid := []ExpenseItem{
+		{ExpenseValue: 1000000, Splits: []ExpenseSplit{{Category: "food", Amount: 600000}, {Category: "drinks", Amount: 300000}}},
+		{ExpenseValue: 1000000, Splits: []ExpenseSplit{{Category: "", Amount: 1000000}}},
+		{ExpenseValue: 1000000, Splits: []ExpenseSplit{{Category: "food", Amount: 1000000}, {Category: "drinks", Amount: 0}}},
+	}
+	for i, item := range invalid {
+		if err := ValidateSplits(&item); err == nil {
+			t.Errorf("case %d: invalid splits were accepted", i)
+		}
+	}
+}
+
+func TestBuildCurrencyReportCountsUnsplitExpensesTowardsBudgets(t *testing.T) {
+	budget := []BudgetItem{{BudgetItemName: "Groceries", Month: "2024-01", BudgetItemValue: 4000000}}
+	expenses := []ExpenseItem{
+		{ExpenseItemName: "market", Month: "2024-01", ExpenseValue: 2500000, ExpenseTags: []string{"groceries"}},
+		{ExpenseItemName: "bakery", Month: "2024-01", ExpenseValue: 500000, ExpenseTags: []string{"Groceries"}},
+		{ExpenseItemName: "cinema", Month: "2024-01", ExpenseValue: 300000, ExpenseTags: []string{"fun"}},
+		{ExpenseItemName: "misc", Month: "2024-01", ExpenseValue: 100000, ExpenseTags: []string{}},
+	}
+	report := BuildCurrencyReport("2024-01", "USD", NewRateTable(nil), nil, budget, expenses)
+
+	if len(report.Budgets) != 1 || report.Budgets[0].Spent != 3000000 || report.Budgets[0].Remaining != 1000000 {
+		t.Errorf("budget lines %+v, want 300 spent of 400", report.Budgets)
+	}
+	want := map[string]Money{"groceries": 3000000, "fun": 300000, "uncategorized": 100000}
+	if !reflect.DeepEqual(report.ExpensesByCategory, want) {
+		t.Errorf("categories %v, want %v", report.ExpensesByCategory, want)
+	}
+}
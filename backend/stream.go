@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// eventRetention is how long events are kept for streams to resume from.
+const eventRetention = 24 * time.Hour
+
+// streamKeepAlive is how often an idle stream is sent a comment, so that
+// proxies and load balancers do not close it.
+const streamKeepAlive = 20 * time.Second
+
+// streamBuffer is how many events a stream can fall behind by before it is
+// closed. The client reconnects and resumes from the events table.
+const streamBuffer = 64
+
+// streamPollInterval is how often a stream looks in the events table for
+// events published by other servers.
+const streamPollInterval = 5 * time.Second
+
+// streamPollLag is how far back each look starts, so that events written
+// late, or by a server whose clock is a little behind, are still found.
+const streamPollLag = time.Minute
+
+// streamMaxLifetime is the longest a stream is kept open, so that the
+// client reconnects and is authenticated again.
+const streamMaxLifetime = time.Hour
+
+// EventReset is sent to a stream resuming from an event older than
+// eventRetention, as the events it missed may have been deleted. The client
+// should fetch the workspace's data again.
+const EventReset = "reset"
+
+// eventHub passes the events published by this server to the streams open
+// for their workspace as they happen. It only knows about this server, so
+// streams also poll the events table, which every server writes to, for
+// the events published elsewhere.
+type eventHub struct {
+	mu      sync.Mutex
+	streams map[string]map[chan Event]bool
+}
+
+var streamHub = &eventHub{streams: make(map[string]map[chan Event]bool)}
+
+func init() {
+	AddEventListener(recordStreamEvent)
+}
+
+func (h *eventHub) subscribe(userId string) chan Event {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	stream := make(chan Event, streamBuffer)
+	if h.streams[userId] == nil {
+		h.streams[userId] = make(map[chan Event]bool)
+	}
+	h.streams[userId][stream] = true
+	return stream
+}
+
+func (h *eventHub) unsubscribe(userId string, stream chan Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.streams[userId][stream] {
+		delete(h.streams[userId], stream)
+		close(stream)
+	}
+	if len(h.streams[userId]) == 0 {
+		delete(h.streams, userId)
+	}
+}
+
+// publish sends an event to the workspace's streams. A stream that is too
+// far behind is closed rather than allowed to hold up the others.
+func (h *eventHub) publish(event Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for stream := range h.streams[event.UserId] {
+		select {
+		case stream <- event:
+		default:
+			delete(h.streams[event.UserId], stream)
+			close(stream)
+		}
+	}
+}
+
+// recordStreamEvent keeps an event for streams to resume from and passes it
+// to the streams open now.
+func recordStreamEvent(event Event) {
+	if err := AddEvent(event, time.Now().Add(eventRetention)); err != nil {
+		log.Printf("Recording event %s failed: %v", event.EventId, err)
+	}
+	streamHub.publish(event)
+}
+
+// storedEvent is how events are kept in the Events table. The data is kept
+// as JSON text, and DynamoDB deletes the event once it expires.
+type storedEvent struct {
+	UserId    string `json:"userId"`
+	EventId   string `json:"eventId"`
+	Type      string `json:"type"`
+	Month     string `json:"month"`
+	CreatedAt string `json:"createdAt"`
+	Data      string `json:"data"`
+	ExpiresAt int64  `json:"expiresAt"`
+}
+
+// writeStreamEvent writes an event in the text/event-stream format. The data
+// is the event as webhooks are sent it.
+func writeStreamEvent(w http.ResponseWriter, event Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", event.EventId, event.Type, payload)
+	return err
+}
+
+// eventCursor returns an event id that sorts after the events published
+// before t and before those published at or after it.
+func eventCursor(t time.Time) string {
+	var id uuid.UUID
+	var millis [8]byte
+	binary.BigEndian.PutUint64(millis[:], uint64(t.UnixMilli()))
+	copy(id[:6], millis[2:])
+	id[6] = 0x70 // version 7
+	id[8] = 0x80 // RFC 4122 variant
+	return id.String()
+}
+
+// eventTime returns when an event id was made. Event ids are version 7
+// UUIDs, which start with the time in milliseconds.
+func eventTime(eventId string) (time.Time, bool) {
+	id, err := uuid.Parse(eventId)
+	if err != nil || id.Version() != 7 {
+		return time.Time{}, false
+	}
+	var millis [8]byte
+	copy(millis[2:], id[:6])
+	return time.UnixMilli(int64(binary.BigEndian.Uint64(millis[:]))), true
+}
+
+// streamNeedsReset reports whether a stream resuming from an event can no
+// longer be sent everything it missed: the event is older than the events
+// kept, or is not an event id at all.
+func streamNeedsReset(lastEventId string, now time.Time) bool {
+	created, ok := eventTime(lastEventId)
+	return !ok || now.Sub(created) > eventRetention
+}
+
+// resetEvent tells a stream's client to fetch the workspace's data again.
+// Its id is where the stream carries on from, so a client that reconnects
+// straight away is not reset twice.
+func resetEvent(userId string, lastEventId string, now time.Time) Event {
+	data, _ := json.Marshal(map[string]string{"lastEventId": lastEventId})
+	return Event{
+		EventId:   eventCursor(now),
+		Type:      EventReset,
+		UserId:    userId,
+		CreatedAt: now.UTC().Format(time.RFC3339Nano),
+		Data:      data,
+	}
+}
+
+// streamDeadline returns when a stream opened now by the caller is closed:
+// when the caller's token expires, and no later than streamMaxLifetime.
+func streamDeadline(caller Caller, now time.Time) time.Time {
+	deadline := now.Add(streamMaxLifetime)
+	if !caller.ExpiresAt.IsZero() && caller.ExpiresAt.Before(deadline) {
+		deadline = caller.ExpiresAt
+	}
+	return deadline
+}
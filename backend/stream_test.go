@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestEventCursor(t *testing.T) {
+	now := time.Now()
+	cursor := eventCursor(now)
+	if _, err := uuid.Parse(cursor); err != nil {
+		t.Fatalf("cursor %s is not a valid id: %v", cursor, err)
+	}
+
+	// Events made now sort after the cursor, and a cursor a second on
+	// sorts after them
+	eventId := uuid.Must(uuid.NewV7()).String()
+	if eventId <= cursor {
+		t.Errorf("event %s sorts before the cursor %s", eventId, cursor)
+	}
+	if later := eventCursor(now.Add(time.Second)); later <= eventId {
+		t.Errorf("cursor %s sorts before the event %s", later, eventId)
+	}
+}
+
+func TestEventTime(t *testing.T) {
+	now := time.Date(2024, 3, 6, 15, 4, 5, 6000000, time.UTC)
+	created, ok := eventTime(eventCursor(now))
+	if !ok || !created.Equal(now) {
+		t.Errorf("got %v %v, want %v", created, ok, now)
+	}
+
+	if _, ok := eventTime(uuid.NewString()); ok {
+		t.Error("expected a version 4 id to have no time")
+	}
+	if _, ok := eventTime("not-an-id"); ok {
+		t.Error("expected an invalid id to have no time")
+	}
+}
+
+func TestStreamNeedsReset(t *testing.T) {
+	now := time.Date(2024, 3, 6, 15, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		lastEventId string
+		reset       bool
+	}{
+		{"recent", eventCursor(now.Add(-time.Hour)), false},
+		{"at retention", eventCursor(now.Add(-eventRetention)), false},
+		{"older than retention", eventCursor(now.Add(-eventRetention - time.Minute)), true},
+		{"not an event id", uuid.NewString(), true},
+	}
+	for _, test := range tests {
+		if got := streamNeedsReset(test.lastEventId, now); got != test.reset {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.reset)
+		}
+	}
+}
+
+func TestResetEvent(t *testing.T) {
+	now := time.Date(2024, 3, 6, 15, 0, 0, 0, time.UTC)
+	event := resetEvent("user-1", "old-id", now)
+	if event.Type != EventReset || event.EventId != eventCursor(now) {
+		t.Errorf("got %s %s", event.Type, event.EventId)
+	}
+
+	recorder := httptest.NewRecorder()
+	if err := writeStreamEvent(recorder, event); err != nil {
+		t.Fatal(err)
+	}
+	body := recorder.Body.String()
+	if !strings.HasPrefix(body, "id: "+event.EventId+"\nevent: reset\ndata: ") {
+		t.Errorf("got %q", body)
+	}
+
+	var sent Event
+	if err := json.Unmarshal([]byte(strings.TrimSpace(body[strings.Index(body, "data: ")+len("data: "):])), &sent); err != nil {
+		t.Fatal(err)
+	}
+	if string(sent.Data) != `{"lastEventId":"old-id"}` {
+		t.Errorf("got data %s", sent.Data)
+	}
+}
+
+func TestStreamDeadline(t *testing.T) {
+	now := time.Date(2024, 3, 6, 15, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		expires time.Time
+		want    time.Time
+	}{
+		{"token expires first", now.Add(10 * time.Minute), now.Add(10 * time.Minute)},
+		{"token outlives the stream", now.Add(3 * time.Hour), now.Add(streamMaxLifetime)},
+		{"expiry unknown", time.Time{}, now.Add(streamMaxLifetime)},
+	}
+	for _, test := range tests {
+		if got := streamDeadline(Caller{ExpiresAt: test.expires}, now); !got.Equal(test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// Statuses of a detected subscription. A subscription is overdue once its
+// next charge is later than expected, and stopped once a whole further
+// period has passed without one.
+const (
+	SubscriptionActive  = "active"
+	SubscriptionOverdue = "overdue"
+	SubscriptionStopped = "stopped"
+)
+
+// subscriptionCadence is a billing period that subscriptions are matched
+// against, with how many days an interval may be off and still count.
+type subscriptionCadence struct {
+	name      string
+	days      float64
+	tolerance float64
+	perYear   float64
+	months    int
+}
+
+var subscriptionCadences = []subscriptionCadence{
+	{name: "weekly", days: 7, tolerance: 2, perYear: 52},
+	{name: "monthly", days: 30.4, tolerance: 5, perYear: 12, months: 1},
+	{name: "quarterly", days: 91.3, tolerance: 10, perYear: 4, months: 3},
+	{name: "yearly", days: 365.25, tolerance: 15, perYear: 1, months: 12},
+}
+
+const (
+	// subscriptionMinOccurrences is how many charges are needed to call a
+	// merchant's charges recurring
+	subscriptionMinOccurrences = 3
+	// subscriptionRegularShare is the share of intervals between charges that
+	// must be a single period of the cadence, and of charges that must keep
+	// the previous charge's price
+	subscriptionRegularShare = 0.75
+	// subscriptionAmountTolerance is how far, as a share of the previous
+	// charge, a charge may be from it and still count as the same price
+	subscriptionAmountTolerance = 0.25
+	// subscriptionHistoryMonths is how many months of expenses are analyzed
+	// unless another range is asked for
+	subscriptionHistoryMonths = 24
+)
+
+// DetectSubscriptions groups expenses by merchant and currency and reports
+// the groups whose charges repeat at a regular cadence with similar amounts.
+// Expenses without a merchant are grouped by their name. Subscriptions that
+// match a known recurring item are marked as known.
+func DetectSubscriptions(expenses []ExpenseItem, recurring []RecurringItem, now time.Time) []Subscription {
+	type key struct{ merchant, currency string }
+	groups := make(map[key][]ExpenseItem)
+	names := make(map[key]string)
+	for _, item := range expenses {
+		if item.ExpenseValue <= 0 {
+			continue
+		}
+		description := expenseDescription(item)
+		k := key{merchantKey(description), item.Currency}
+		if k.merchant == "" {
+			continue
+		}
+		groups[k] = append(groups[k], item)
+		names[k] = description
+	}
+
+	matcher := newRecurringMatcher(recurring)
+	subscriptions := []Subscription{}
+	for k, items := range groups {
+		subscription, ok := detectSubscription(names[k], k.currency, items, now)
+		if !ok {
+			continue
+		}
+		subscription.Known = matcher.matches(RecurringExpense, names[k])
+		subscriptions = append(subscriptions, subscription)
+	}
+	sort.Slice(subscriptions, func(i, j int) bool {
+		if subscriptions[i].EstimatedAnnualCost != subscriptions[j].EstimatedAnnualCost {
+			return subscriptions[i].EstimatedAnnualCost > subscriptions[j].EstimatedAnnualCost
+		}
+		return subscriptions[i].Merchant < subscriptions[j].Merchant
+	})
+	return subscriptions
+}
+
+// detectSubscription checks whether one merchant's charges are recurring.
+// The cadence is found from the dates alone, so that a price change does not
+// hide it, and the amounts of the charges on the cadence are then compared
+// in date order.
+func detectSubscription(merchant string, currency string, items []ExpenseItem, now time.Time) (Subscription, bool) {
+	sorted := append([]ExpenseItem(nil), items...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return itemDate(sorted[i].Date, sorted[i].Month).Before(itemDate(sorted[j].Date, sorted[j].Month))
+	})
+
+	var cadence *subscriptionCadence
+	var charges []ExpenseItem
+	for i := range subscriptionCadences {
+		c := &subscriptionCadences[i]
+		chain, regular := subscriptionChain(sorted, *c)
+		if len(chain) < subscriptionMinOccurrences || len(chain) <= len(charges) {
+			continue
+		}
+		if float64(regular) < subscriptionRegularShare*float64(len(chain)-1) {
+			continue
+		}
+		cadence, charges = c, chain
+	}
+	if cadence == nil {
+		return Subscription{}, false
+	}
+
+	// A subscription keeps its price from one charge to the next, changing
+	// now and then; charges that vary all the time are regular spending
+	steady := 0
+	for i := 1; i < len(charges); i++ {
+		from, to := charges[i-1].ExpenseValue.Float64(), charges[i].ExpenseValue.Float64()
+		if math.Abs(to-from) <= subscriptionAmountTolerance*from {
+			steady++
+		}
+	}
+	if float64(steady) < subscriptionRegularShare*float64(len(charges)-1) {
+		return Subscription{}, false
+	}
+
+	first := charges[0]
+	last := charges[len(charges)-1]
+	lastDate := itemDate(last.Date, last.Month)
+	var total Money
+	for _, charge := range charges {
+		total += charge.ExpenseValue
+	}
+
+	subscription := Subscription{
+		Merchant:            merchant,
+		Currency:            currency,
+		Cadence:             cadence.name,
+		Occurrences:         len(charges),
+		FirstDate:           itemDate(first.Date, first.Month).Format("2006-01-02"),
+		LastDate:            lastDate.Format("2006-01-02"),
+		LastAmount:          last.ExpenseValue,
+		AverageAmount:       (total / Money(len(charges))).Round(currency),
+		EstimatedAnnualCost: last.ExpenseValue.Mul(cadence.perYear).Round(currency),
+		Status:              SubscriptionActive,
+		Flags:               []string{},
+	}
+
+	// Months are added as calendar months, so a charge on the 31st is next
+	// expected at the end of a shorter month
+	next := lastDate.AddDate(0, 0, int(math.Round(cadence.days)))
+	if cadence.months > 0 {
+		next = addMonthsClamped(lastDate, cadence.months)
+	}
+	subscription.NextExpectedDate = next.Format("2006-01-02")
+
+	grace := time.Duration(cadence.tolerance*24) * time.Hour
+	period := time.Duration(cadence.days*24) * time.Hour
+	switch {
+	case now.After(next.Add(period + grace)):
+		subscription.Status = SubscriptionStopped
+		subscription.Flags = append(subscription.Flags, fmt.Sprintf("no charge since %s; the %s charge seems to have stopped", subscription.LastDate, cadence.name))
+	case now.After(next.Add(grace)):
+		subscription.Status = SubscriptionOverdue
+		subscription.Flags = append(subscription.Flags, fmt.Sprintf("expected a charge around %s", subscription.NextExpectedDate))
+	}
+
+	for i := len(charges) - 1; i > 0; i-- {
+		from, to := charges[i-1].ExpenseValue, charges[i].ExpenseValue
+		if to <= from {
+			continue
+		}
+		percent := math.Round((to-from).Float64()/from.Float64()*1000) / 10
+		subscription.PriceIncrease = &PriceChange{
+			Date:    itemDate(charges[i].Date, charges[i].Month).Format("2006-01-02"),
+			From:    from,
+			To:      to,
+			Percent: percent,
+		}
+		subscription.Flags = append(subscription.Flags, fmt.Sprintf("price rose from %s to %s (%.1f%%) on %s",
+			from.Format(currency), to.Format(currency), percent, subscription.PriceIncrease.Date))
+		break
+	}
+	return subscription, true
+}
+
+// subscriptionChain returns the longest run of charges, in date order, that
+// follows a cadence: each charge comes one period after the previous one, or
+// two when a charge was missed. Charges off the cadence, such as one-off
+// purchases from the same merchant, are left out, and where two charges fit
+// the one closest in amount to the previous charge is taken. It also returns
+// how many of the intervals in the run are a single period.
+func subscriptionChain(charges []ExpenseItem, c subscriptionCadence) ([]ExpenseItem, int) {
+	dates := make([]time.Time, len(charges))
+	for i, charge := range charges {
+		dates[i] = itemDate(charge.Date, charge.Month)
+	}
+	days := func(i, j int) float64 { return dates[j].Sub(dates[i]).Hours() / 24 }
+
+	var best []int
+	bestRegular := 0
+	for start := range charges {
+		chain := []int{start}
+		regular := 0
+		for current := start; ; {
+			next, periods := -1, 0
+			for _, k := range []int{1, 2} {
+				for j := current + 1; j < len(charges); j++ {
+					if math.Abs(days(current, j)-float64(k)*c.days) > c.tolerance {
+						continue
+					}
+					if next < 0 || math.Abs((charges[j].ExpenseValue-charges[current].ExpenseValue).Float64()) <
+						math.Abs((charges[next].ExpenseValue-charges[current].ExpenseValue).Float64()) {
+						next = j
+					}
+				}
+				if next >= 0 {
+					periods = k
+					break
+				}
+			}
+			if next < 0 {
+				break
+			}
+			if periods == 1 {
+				regular++
+			}
+			chain = append(chain, next)
+			current = next
+		}
+		if len(chain) > len(best) || (len(chain) == len(best) && regular > bestRegular) {
+			best, bestRegular = chain, regular
+		}
+	}
+
+	chain := make([]ExpenseItem, len(best))
+	for i, index := range best {
+		chain[i] = charges[index]
+	}
+	return chain, bestRegular
+}
+
+// addMonthsClamped adds calendar months to a date, moving it back to the last
+// day of the month for days the month does not have.
+func addMonthsClamped(date time.Time, months int) time.Time {
+	firstOfMonth := time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, time.UTC).AddDate(0, months, 0)
+	lastDay := firstOfMonth.AddDate(0, 1, -1).Day()
+	day := date.Day()
+	if day > lastDay {
+		day = lastDay
+	}
+	return time.Date(firstOfMonth.Year(), firstOfMonth.Month(), day, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDetectSubscriptions(t *testing.T) {
+	charge := func(merchant string, date string, value Money) ExpenseItem {
+		return ExpenseItem{ExpenseItemName: merchant + " " + date, Merchant: merchant, Date: date, Month: date[:7], ExpenseValue: value, Currency: "USD"}
+	}
+	now := time.Date(2024, 6, 10, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name            string
+		expenses        []ExpenseItem
+		wantFound       bool
+		wantCadence     string
+		wantOccurrences int
+		wantStatus      string
+		wantIncrease    *PriceChange
+	}{
+		{
+			name: "monthly with a large price rise",
+			expenses: []ExpenseItem{
+				charge("Streamly", "2024-01-05", 99900),
+				charge("Streamly", "2024-02-05", 99900),
+				charge("Streamly", "2024-03-05", 99900),
+				charge("Streamly", "2024-04-05", 159900),
+				charge("Streamly", "2024-05-05", 159900),
+				charge("Streamly", "2024-06-05", 159900),
+			},
+			wantFound: true, wantCadence: "monthly", wantOccurrences: 6, wantStatus: SubscriptionActive,
+			wantIncrease: &PriceChange{Date: "2024-04-05", From: 99900, To: 159900, Percent: 60.1},
+		},
+		{
+			name: "one-off purchases off the cadence",
+			expenses: []ExpenseItem{
+				charge("Gamebox", "2024-02-01", 149900),
+				charge("Gamebox", "2024-02-14", 5999000),
+				charge("Gamebox", "2024-03-01", 149900),
+				charge("Gamebox", "2024-04-01", 149900),
+				charge("Gamebox", "2024-04-20", 199900),
+				charge("Gamebox", "2024-05-01", 149900),
+				charge("Gamebox", "2024-06-01", 149900),
+			},
+			wantFound: true, wantCadence: "monthly", wantOccurrences: 5, wantStatus: SubscriptionActive,
+		},
+		{
+			name: "a missed month",
+			expenses: []ExpenseItem{
+				charge("Gym", "2024-01-03", 300000),
+				charge("Gym", "2024-02-03", 300000),
+				charge("Gym", "2024-03-03", 300000),
+				charge("Gym", "2024-05-03", 300000),
+				charge("Gym", "2024-06-03", 300000),
+			},
+			wantFound: true, wantCadence: "monthly", wantOccurrences: 5, wantStatus: SubscriptionActive,
+		},
+		{
+			name: "weekly",
+			expenses: []ExpenseItem{
+				charge("Veggie Box", "2024-05-06", 250000),
+				charge("Veggie Box", "2024-05-13", 250000),
+				charge("Veggie Box", "2024-05-20", 250000),
+				charge("Veggie Box", "2024-05-27", 250000),
+				charge("Veggie Box", "2024-06-03", 250000),
+			},
+			wantFound: true, wantCadence: "weekly", wantOccurrences: 5, wantStatus: SubscriptionActive,
+		},
+		{
+			name: "stopped",
+			expenses: []ExpenseItem{
+				charge("News", "2023-12-15", 80000),
+				charge("News", "2024-01-15", 80000),
+				charge("News", "2024-02-15", 80000),
+			},
+			wantFound: true, wantCadence: "monthly", wantOccurrences: 3, wantStatus: SubscriptionStopped,
+		},
+		{
+			name: "monthly spending that varies",
+			expenses: []ExpenseItem{
+				charge("Grocer", "2024-01-10", 820000),
+				charge("Grocer", "2024-02-10", 1430000),
+				charge("Grocer", "2024-03-10", 560000),
+				charge("Grocer", "2024-04-10", 1210000),
+				charge("Grocer", "2024-05-10", 390000),
+			},
+			wantFound: false,
+		},
+		{
+			name: "too few charges",
+			expenses: []ExpenseItem{
+				charge("Cloud", "2024-04-02", 20000),
+				charge("Cloud", "2024-05-02", 20000),
+			},
+			wantFound: false,
+		},
+	}
+	for _, test := range tests {
+		subscriptions := DetectSubscriptions(test.expenses, nil, now)
+		if !test.wantFound {
+			if len(subscriptions) != 0 {
+				t.Errorf("%s: detected %+v", test.name, subscriptions)
+			}
+			continue
+		}
+		if len(subscriptions) != 1 {
+			t.Errorf("%s: detected %d subscriptions, want 1", test.name, len(subscriptions))
+			continue
+		}
+		got := subscriptions[0]
+		if got.Cadence != test.wantCadence || got.Occurrences != test.wantOccurrences || got.Status != test.wantStatus {
+			t.Errorf("%s: got %s x%d %s, want %s x%d %s", test.name,
+				got.Cadence, got.Occurrences, got.Status, test.wantCadence, test.wantOccurrences, test.wantStatus)
+		}
+		switch {
+		case test.wantIncrease == nil && got.PriceIncrease != nil:
+			t.Errorf("%s: unexpected price increase %+v", test.name, *got.PriceIncrease)
+		case test.wantIncrease != nil && (got.PriceIncrease == nil || *got.PriceIncrease != *test.wantIncrease):
+			t.Errorf("%s: price increase %+v, want %+v", test.name, got.PriceIncrease, *test.wantIncrease)
+		}
+	}
+}
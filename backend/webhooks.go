@@ -0,0 +1,360 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Statuses of a webhook delivery.
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// webhookRetryDelays are the waits before each retry of a delivery that
+// failed. A delivery that still fails after the last one is marked failed
+// and can be sent again with the redeliver endpoint. Retries are made by
+// the poller, so they survive a restart.
+var webhookRetryDelays = []time.Duration{
+	10 * time.Second,
+	time.Minute,
+	5 * time.Minute,
+	30 * time.Minute,
+}
+
+// webhookAttemptLease is how long an attempt may take before the poller
+// takes it to be lost, such as to a restart, and makes it again.
+const webhookAttemptLease = 2 * time.Minute
+
+// webhookPollInterval is how often the poller looks for deliveries that are
+// due another attempt.
+const webhookPollInterval = 30 * time.Second
+
+// webhookClient only connects to public addresses, see dialWebhook, and does
+// not follow redirects, which could lead anywhere. A redirect is a failed
+// delivery.
+var webhookClient = &http.Client{
+	Timeout: 10 * time.Second,
+	Transport: &http.Transport{
+		DialContext:         dialWebhook,
+		TLSHandshakeTimeout: 5 * time.Second,
+		MaxIdleConns:        10,
+		IdleConnTimeout:     90 * time.Second,
+	},
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// blockedWebhookNetworks are networks webhooks may not be sent to on top of
+// the loopback, private, link-local and multicast ones: addresses that are
+// not routed on the internet, or that reach internal services, such as
+// shared address space and NAT64 prefixes.
+var blockedWebhookNetworks = func() []*net.IPNet {
+	var networks []*net.IPNet
+	for _, cidr := range []string{
+		"0.0.0.0/8",
+		"100.64.0.0/10",
+		"192.0.0.0/24",
+		"198.18.0.0/15",
+		"240.0.0.0/4",
+		"64:ff9b::/96",
+		"64:ff9b:1::/48",
+	} {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}()
+
+// isPublicIP reports whether webhooks may be sent to an address. The
+// server's own addresses, private networks and link-local addresses, which
+// include the cloud metadata endpoint at 169.254.169.254, are refused.
+func isPublicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, network := range blockedWebhookNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// dialWebhook resolves a webhook's host and connects to it only if every
+// address it resolves to is public. The check is made on the addresses
+// actually dialed, so a host that resolves to a public address when the
+// webhook is saved and a private one later is refused too.
+func dialWebhook(ctx context.Context, network string, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	for _, addr := range addrs {
+		if !isPublicIP(addr.IP) {
+			return nil, fmt.Errorf("%s resolves to %s, which is not a public address", host, addr.IP)
+		}
+	}
+
+	dialer := net.Dialer{Timeout: 5 * time.Second}
+	for _, addr := range addrs {
+		var conn net.Conn
+		conn, err = dialer.DialContext(ctx, network, net.JoinHostPort(addr.IP.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+	}
+	if err == nil {
+		err = fmt.Errorf("%s has no addresses", host)
+	}
+	return nil, err
+}
+
+func init() {
+	AddEventListener(dispatchWebhooks)
+}
+
+// ValidateWebhook checks a webhook's address and the event types it is sent.
+func ValidateWebhook(webhook *Webhook) error {
+	webhook.URL = strings.TrimSpace(webhook.URL)
+	parsed, err := url.Parse(webhook.URL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("url must be an http or https address")
+	}
+	host := strings.ToLower(strings.TrimSuffix(parsed.Hostname(), "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return fmt.Errorf("url must be a public address")
+	}
+	if ip := net.ParseIP(host); ip != nil && !isPublicIP(ip) {
+		return fmt.Errorf("url must be a public address")
+	}
+
+	events := []string{}
+	seen := make(map[string]bool)
+	for _, eventType := range webhook.Events {
+		eventType = strings.ToLower(strings.TrimSpace(eventType))
+		if seen[eventType] {
+			continue
+		}
+		if eventType != "*" && !eventTypes[eventType] {
+			return fmt.Errorf("unknown event type %q", eventType)
+		}
+		seen[eventType] = true
+		events = append(events, eventType)
+	}
+	if len(events) == 0 {
+		return fmt.Errorf("events is required, use \"*\" for every event")
+	}
+	webhook.Events = events
+	return nil
+}
+
+// webhookWants reports whether a webhook is sent an event type.
+func webhookWants(webhook Webhook, eventType string) bool {
+	for _, wanted := range webhook.Events {
+		if wanted == "*" || wanted == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// SignWebhookPayload returns the X-Budget-Signature header for a payload:
+// the time it was signed and the hex HMAC-SHA256, keyed with the webhook's
+// secret, of the time and the payload joined by a dot. Receivers should
+// recompute it and reject old timestamps to prevent replays.
+func SignWebhookPayload(secret string, timestamp int64, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(payload)
+	return fmt.Sprintf("t=%d,v1=%s", timestamp, hex.EncodeToString(mac.Sum(nil)))
+}
+
+// dispatchWebhooks records a delivery of an event for each of the
+// workspace's webhooks that wants it and sends them in the background.
+func dispatchWebhooks(event Event) {
+	webhooks, err := GetAllWebhooks(event.UserId)
+	if err != nil {
+		log.Printf("Getting webhooks for %s failed: %v", event.UserId, err)
+		return
+	}
+	var payload []byte
+	for _, webhook := range webhooks {
+		if webhook.Disabled || !webhookWants(webhook, event.Type) {
+			continue
+		}
+		if payload == nil {
+			if payload, err = json.Marshal(event); err != nil {
+				log.Printf("Encoding event %s failed: %v", event.EventId, err)
+				return
+			}
+		}
+
+		now := time.Now().UTC()
+		delivery := WebhookDelivery{
+			UserId:        webhook.UserId,
+			DeliveryId:    uuid.New().String(),
+			WebhookId:     webhook.WebhookId,
+			EventId:       event.EventId,
+			EventType:     event.Type,
+			Payload:       string(payload),
+			Status:        DeliveryPending,
+			CreatedAt:     now.Format(time.RFC3339),
+			NextAttemptAt: now.Add(webhookAttemptLease).Format(time.RFC3339),
+		}
+		if err := AddWebhookDelivery(delivery); err != nil {
+			log.Printf("Recording delivery of %s to webhook %s failed: %v", event.EventId, webhook.WebhookId, err)
+			continue
+		}
+		go DeliverWebhook(webhook, delivery)
+	}
+}
+
+// RedeliverWebhook sends the payload of an earlier delivery again, as a new
+// delivery with its own log.
+func RedeliverWebhook(webhook Webhook, original WebhookDelivery) (*WebhookDelivery, error) {
+	now := time.Now().UTC()
+	delivery := WebhookDelivery{
+		UserId:        original.UserId,
+		DeliveryId:    uuid.New().String(),
+		WebhookId:     original.WebhookId,
+		EventId:       original.EventId,
+		EventType:     original.EventType,
+		Payload:       original.Payload,
+		Status:        DeliveryPending,
+		CreatedAt:     now.Format(time.RFC3339),
+		RedeliveryOf:  original.DeliveryId,
+		NextAttemptAt: now.Add(webhookAttemptLease).Format(time.RFC3339),
+	}
+	if err := AddWebhookDelivery(delivery); err != nil {
+		return nil, err
+	}
+	go DeliverWebhook(webhook, delivery)
+	return &delivery, nil
+}
+
+// DeliverWebhook makes one attempt at a delivery and saves its outcome, so
+// the delivery's log shows the latest one. A delivery that fails is given
+// the time of its next attempt, after the next of webhookRetryDelays, for
+// the poller to make; once they are used up it is marked failed.
+func DeliverWebhook(webhook Webhook, delivery WebhookDelivery) {
+	statusCode, err := postWebhook(webhook, delivery)
+	now := time.Now().UTC()
+	delivery.Attempts++
+	delivery.LastAttempt = now.Format(time.RFC3339)
+	delivery.StatusCode = statusCode
+	delivery.Error = ""
+	delivery.NextAttemptAt = ""
+	switch {
+	case err == nil:
+		delivery.Status = DeliverySucceeded
+	case delivery.Attempts <= len(webhookRetryDelays):
+		delivery.Status = DeliveryPending
+		delivery.Error = err.Error()
+		delivery.NextAttemptAt = now.Add(webhookRetryDelays[delivery.Attempts-1]).Format(time.RFC3339)
+	default:
+		delivery.Status = DeliveryFailed
+		delivery.Error = err.Error()
+	}
+	if err := AddWebhookDelivery(delivery); err != nil {
+		log.Printf("Recording delivery %s failed: %v", delivery.DeliveryId, err)
+	}
+}
+
+// RetryWebhookDeliveries makes the attempts that are due: retries of
+// deliveries that failed, and attempts lost to a restart. Each delivery is
+// claimed first, so that servers polling at the same time do not both send
+// it. Deliveries to a webhook that has been deleted or disabled are marked
+// failed.
+func RetryWebhookDeliveries(now time.Time) error {
+	deliveries, err := GetDueWebhookDeliveries(now)
+	if err != nil {
+		return err
+	}
+	for _, delivery := range deliveries {
+		claimed, err := ClaimWebhookDelivery(delivery, now.Add(webhookAttemptLease).Format(time.RFC3339))
+		if err != nil {
+			log.Printf("Claiming delivery %s failed: %v", delivery.DeliveryId, err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+		webhook, err := GetWebhook(delivery.UserId, delivery.WebhookId)
+		if err != nil {
+			log.Printf("Getting webhook %s for delivery %s failed: %v", delivery.WebhookId, delivery.DeliveryId, err)
+			continue
+		}
+		if webhook == nil || webhook.Disabled {
+			delivery.Status = DeliveryFailed
+			delivery.Error = "webhook was deleted or disabled"
+			delivery.NextAttemptAt = ""
+			if err := AddWebhookDelivery(delivery); err != nil {
+				log.Printf("Recording delivery %s failed: %v", delivery.DeliveryId, err)
+			}
+			continue
+		}
+		go DeliverWebhook(*webhook, delivery)
+	}
+	return nil
+}
+
+// PollWebhookDeliveries makes the due attempts every webhookPollInterval. It
+// runs for as long as the server does.
+func PollWebhookDeliveries() {
+	for range time.Tick(webhookPollInterval) {
+		if err := RetryWebhookDeliveries(time.Now().UTC()); err != nil {
+			log.Printf("Retrying webhook deliveries failed: %v", err)
+		}
+	}
+}
+
+// postWebhook makes one attempt at a delivery. Any response other than 2xx
+// is a failure.
+func postWebhook(webhook Webhook, delivery WebhookDelivery) (int, error) {
+	payload := []byte(delivery.Payload)
+	request, err := http.NewRequest(http.MethodPost, webhook.URL, strings.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "Budget-Webhooks/1.0")
+	request.Header.Set("X-Budget-Event", delivery.EventType)
+	request.Header.Set("X-Budget-Delivery", delivery.DeliveryId)
+	request.Header.Set("X-Budget-Signature", SignWebhookPayload(webhook.Secret, time.Now().Unix(), payload))
+
+	response, err := webhookClient.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(response.Body, 64<<10))
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return response.StatusCode, fmt.Errorf("endpoint responded %s", response.Status)
+	}
+	return response.StatusCode, nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestSignWebhookPayload(t *testing.T) {
+	got := SignWebhookPayload("whsec_test", 1700000000, []byte(`{"id":"1"}`))
+	want := "t=1700000000,v1=11bf4466ea17c3df3fd743af0b435368e16b7a05eb8eced85e8c4670767bdec5"
+	if got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+
+	// The timestamp is signed, so a replayed payload cannot be given a new
+	// one
+	if SignWebhookPayload("whsec_test", 1700000001, []byte(`{"id":"1"}`)) == got {
+		t.Error("signature does not depend on the timestamp")
+	}
+	if SignWebhookPayload("whsec_other", 1700000000, []byte(`{"id":"1"}`)) == got {
+		t.Error("signature does not depend on the secret")
+	}
+}
+
+func TestIsPublicIP(t *testing.T) {
+	tests := []struct {
+		ip     string
+		public bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"0.0.0.0", false},
+		{"100.64.0.1", false},
+		{"224.0.0.1", false},
+		{"::ffff:127.0.0.1", false},
+		{"64:ff9b::a9fe:a9fe", false},
+	}
+	for _, test := range tests {
+		if got := isPublicIP(net.ParseIP(test.ip)); got != test.public {
+			t.Errorf("%s: got %v, want %v", test.ip, got, test.public)
+		}
+	}
+}
+
+func TestValidateWebhook(t *testing.T) {
+	refused := []string{
+		"http://127.0.0.1/hook",
+		"http://169.254.169.254/latest/meta-data/",
+		"http://[::1]:8080/hook",
+		"http://localhost/hook",
+		"http://api.localhost./hook",
+		"https://10.0.0.5/hook",
+		"ftp://example.com/hook",
+	}
+	for _, url := range refused {
+		webhook := Webhook{URL: url, Events: []string{"*"}}
+		if err := ValidateWebhook(&webhook); err == nil {
+			t.Errorf("%s: expected an error", url)
+		}
+	}
+
+	webhook := Webhook{URL: " https://example.com/hook ", Events: []string{"Expense.Created", "expense.created"}}
+	if err := ValidateWebhook(&webhook); err != nil {
+		t.Fatal(err)
+	}
+	if webhook.URL != "https://example.com/hook" || len(webhook.Events) != 1 || webhook.Events[0] != EventExpenseCreated {
+		t.Errorf("got %s %v", webhook.URL, webhook.Events)
+	}
+}
+
+func TestDialWebhookRefusesPrivateAddresses(t *testing.T) {
+	for _, address := range []string{"127.0.0.1:80", "169.254.169.254:80", "[::1]:443"} {
+		conn, err := dialWebhook(context.Background(), "tcp", address)
+		if err == nil {
+			conn.Close()
+			t.Errorf("%s: expected an error", address)
+			continue
+		}
+		if !strings.Contains(err.Error(), "not a public address") {
+			t.Errorf("%s: got %v", address, err)
+		}
+	}
+}
+
+func TestWebhookClientDoesNotFollowRedirects(t *testing.T) {
+	if err := webhookClient.CheckRedirect(nil, nil); err != http.ErrUseLastResponse {
+		t.Errorf("got %v, want http.ErrUseLastResponse", err)
+	}
+}
@@ -61,6 +61,311 @@ export class BudgetingAppStack extends cdk.Stack {
       billingMode: dynamodb.BillingMode.PAY_PER_REQUEST,
     });
 
+    const accountsTable = new dynamodb.Table(this, 'AccountsTable', {
+      tableName: 'Accounts',
+      partitionKey: {
+        name: 'userId',
+        type: dynamodb.AttributeType.STRING,
+      },
+      sortKey: {
+        name: 'accountId',
+        type: dynamodb.AttributeType.STRING,
+      },
+      billingMode: dynamodb.BillingMode.PAY_PER_REQUEST,
+    });
+
+    const transfersTable = new dynamodb.Table(this, 'TransfersTable', {
+      tableName: 'Transfers',
+      partitionKey: {
+        name: 'userId#month',
+        type: dynamodb.AttributeType.STRING,
+      },
+      sortKey: {
+        name: 'transferId',
+        type: dynamodb.AttributeType.STRING,
+      },
+      billingMode: dynamodb.BillingMode.PAY_PER_REQUEST,
+    });
+
+    const userSettingsTable = new dynamodb.Table(this, 'UserSettingsTable', {
+      tableName: 'UserSettings',
+      partitionKey: {
+        name: 'userId',
+        type: dynamodb.AttributeType.STRING,
+      },
+      billingMode: dynamodb.BillingMode.PAY_PER_REQUEST,
+    });
+
+    const exchangeRatesTable = new dynamodb.Table(this, 'ExchangeRatesTable', {
+      tableName: 'ExchangeRates',
+      partitionKey: {
+        name: 'userId',
+        type: dynamodb.AttributeType.STRING,
+      },
+      sortKey: {
+        name: 'rateId',
+        type: dynamodb.AttributeType.STRING,
+      },
+      billingMode: dynamodb.BillingMode.PAY_PER_REQUEST,
+    });
+
+    const householdsTable = new dynamodb.Table(this, 'HouseholdsTable', {
+      tableName: 'Households',
+      partitionKey: {
+        name: 'householdId',
+        type: dynamodb.AttributeType.STRING,
+      },
+      billingMode: dynamodb.BillingMode.PAY_PER_REQUEST,
+    });
+
+    const householdMembersTable = new dynamodb.Table(this, 'HouseholdMembersTable', {
+      tableName: 'HouseholdMembers',
+      partitionKey: {
+        name: 'householdId',
+        type: dynamodb.AttributeType.STRING,
+      },
+      sortKey: {
+        name: 'userId',
+        type: dynamodb.AttributeType.STRING,
+      },
+      billingMode: dynamodb.BillingMode.PAY_PER_REQUEST,
+    });
+
+    const householdInvitationsTable = new dynamodb.Table(this, 'HouseholdInvitationsTable', {
+      tableName: 'HouseholdInvitations',
+      partitionKey: {
+        name: 'householdId',
+        type: dynamodb.AttributeType.STRING,
+      },
+      sortKey: {
+        name: 'invitationId',
+        type: dynamodb.AttributeType.STRING,
+      },
+      billingMode: dynamodb.BillingMode.PAY_PER_REQUEST,
+    });
+
+    const goalsTable = new dynamodb.Table(this, 'GoalsTable', {
+      tableName: 'Goals',
+      partitionKey: {
+        name: 'userId',
+        type: dynamodb.AttributeType.STRING,
+      },
+      sortKey: {
+        name: 'goalId',
+        type: dynamodb.AttributeType.STRING,
+      },
+      billingMode: dynamodb.BillingMode.PAY_PER_REQUEST,
+    });
+
+    const goalContributionsTable = new dynamodb.Table(this, 'GoalContributionsTable', {
+      tableName: 'GoalContributions',
+      partitionKey: {
+        name: 'userId',
+        type: dynamodb.AttributeType.STRING,
+      },
+      sortKey: {
+        name: 'contributionId',
+        type: dynamodb.AttributeType.STRING,
+      },
+      billingMode: dynamodb.BillingMode.PAY_PER_REQUEST,
+    });
+
+    const debtsTable = new dynamodb.Table(this, 'DebtsTable', {
+      tableName: 'Debts',
+      partitionKey: {
+        name: 'userId',
+        type: dynamodb.AttributeType.STRING,
+      },
+      sortKey: {
+        name: 'debtId',
+        type: dynamodb.AttributeType.STRING,
+      },
+      billingMode: dynamodb.BillingMode.PAY_PER_REQUEST,
+    });
+
+    const debtPaymentsTable = new dynamodb.Table(this, 'DebtPaymentsTable', {
+      tableName: 'DebtPayments',
+      partitionKey: {
+        name: 'userId',
+        type: dynamodb.AttributeType.STRING,
+      },
+      sortKey: {
+        name: 'paymentId',
+        type: dynamodb.AttributeType.STRING,
+      },
+      billingMode: dynamodb.BillingMode.PAY_PER_REQUEST,
+    });
+
+    const holdingsTable = new dynamodb.Table(this, 'HoldingsTable', {
+      tableName: 'Holdings',
+      partitionKey: {
+        name: 'userId',
+        type: dynamodb.AttributeType.STRING,
+      },
+      sortKey: {
+        name: 'holdingId',
+        type: dynamodb.AttributeType.STRING,
+      },
+      billingMode: dynamodb.BillingMode.PAY_PER_REQUEST,
+    });
+
+    const holdingValuationsTable = new dynamodb.Table(this, 'HoldingValuationsTable', {
+      tableName: 'HoldingValuations',
+      partitionKey: {
+        name: 'userId',
+        type: dynamodb.AttributeType.STRING,
+      },
+      sortKey: {
+        name: 'valuationId',
+        type: dynamodb.AttributeType.STRING,
+      },
+      billingMode: dynamodb.BillingMode.PAY_PER_REQUEST,
+    });
+
+    const investmentTransactionsTable = new dynamodb.Table(this, 'InvestmentTransactionsTable', {
+      tableName: 'InvestmentTransactions',
+      partitionKey: {
+        name: 'userId',
+        type: dynamodb.AttributeType.STRING,
+      },
+      sortKey: {
+        name: 'transactionId',
+        type: dynamodb.AttributeType.STRING,
+      },
+      billingMode: dynamodb.BillingMode.PAY_PER_REQUEST,
+    });
+
+    const securityPricesTable = new dynamodb.Table(this, 'SecurityPricesTable', {
+      tableName: 'SecurityPrices',
+      partitionKey: {
+        name: 'userId',
+        type: dynamodb.AttributeType.STRING,
+      },
+      sortKey: {
+        name: 'priceId',
+        type: dynamodb.AttributeType.STRING,
+      },
+      billingMode: dynamodb.BillingMode.PAY_PER_REQUEST,
+    });
+
+    const recurringItemsTable = new dynamodb.Table(this, 'RecurringItemsTable', {
+      tableName: 'RecurringItems',
+      partitionKey: {
+        name: 'userId',
+        type: dynamodb.AttributeType.STRING,
+      },
+      sortKey: {
+        name: 'recurringId',
+        type: dynamodb.AttributeType.STRING,
+      },
+      billingMode: dynamodb.BillingMode.PAY_PER_REQUEST,
+    });
+
+    const scenariosTable = new dynamodb.Table(this, 'ScenariosTable', {
+      tableName: 'Scenarios',
+      partitionKey: {
+        name: 'userId',
+        type: dynamodb.AttributeType.STRING,
+      },
+      sortKey: {
+        name: 'scenarioId',
+        type: dynamodb.AttributeType.STRING,
+      },
+      billingMode: dynamodb.BillingMode.PAY_PER_REQUEST,
+    });
+
+    const alertRulesTable = new dynamodb.Table(this, 'AlertRulesTable', {
+      tableName: 'AlertRules',
+      partitionKey: {
+        name: 'userId',
+        type: dynamodb.AttributeType.STRING,
+      },
+      sortKey: {
+        name: 'ruleId',
+        type: dynamodb.AttributeType.STRING,
+      },
+      billingMode: dynamodb.BillingMode.PAY_PER_REQUEST,
+    });
+
+    const notificationsTable = new dynamodb.Table(this, 'NotificationsTable', {
+      tableName: 'Notifications',
+      partitionKey: {
+        name: 'userId',
+        type: dynamodb.AttributeType.STRING,
+      },
+      sortKey: {
+        name: 'notificationId',
+        type: dynamodb.AttributeType.STRING,
+      },
+      billingMode: dynamodb.BillingMode.PAY_PER_REQUEST,
+    });
+
+    const emailSubscriptionsTable = new dynamodb.Table(this, 'EmailSubscriptionsTable', {
+      tableName: 'EmailSubscriptions',
+      partitionKey: {
+        name: 'userId',
+        type: dynamodb.AttributeType.STRING,
+      },
+      sortKey: {
+        name: 'subscriberId',
+        type: dynamodb.AttributeType.STRING,
+      },
+      billingMode: dynamodb.BillingMode.PAY_PER_REQUEST,
+    });
+
+    const webhooksTable = new dynamodb.Table(this, 'WebhooksTable', {
+      tableName: 'Webhooks',
+      partitionKey: {
+        name: 'userId',
+        type: dynamodb.AttributeType.STRING,
+      },
+      sortKey: {
+        name: 'webhookId',
+        type: dynamodb.AttributeType.STRING,
+      },
+      billingMode: dynamodb.BillingMode.PAY_PER_REQUEST,
+    });
+
+    const webhookDeliveriesTable = new dynamodb.Table(this, 'WebhookDeliveriesTable', {
+      tableName: 'WebhookDeliveries',
+      partitionKey: {
+        name: 'userId',
+        type: dynamodb.AttributeType.STRING,
+      },
+      sortKey: {
+        name: 'deliveryId',
+        type: dynamodb.AttributeType.STRING,
+      },
+      billingMode: dynamodb.BillingMode.PAY_PER_REQUEST,
+    });
+
+    const eventsTable = new dynamodb.Table(this, 'EventsTable', {
+      tableName: 'Events',
+      partitionKey: {
+        name: 'userId',
+        type: dynamodb.AttributeType.STRING,
+      },
+      sortKey: {
+        name: 'eventId',
+        type: dynamodb.AttributeType.STRING,
+      },
+      billingMode: dynamodb.BillingMode.PAY_PER_REQUEST,
+      timeToLiveAttribute: 'expiresAt',
+    });
+
+    const userMonthsTable = new dynamodb.Table(this, 'UserMonthsTable', {
+      tableName: 'UserMonths',
+      partitionKey: {
+        name: 'userId',
+        type: dynamodb.AttributeType.STRING,
+      },
+      sortKey: {
+        name: 'month',
+        type: dynamodb.AttributeType.STRING,
+      },
+      billingMode: dynamodb.BillingMode.PAY_PER_REQUEST,
+    });
+
 
     // Create VPC
     const vpc = new ec2.Vpc(this, 'BudgetingVPC', {